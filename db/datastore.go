@@ -35,3 +35,25 @@ type DataStore interface {
 	// Close the database
 	Close()
 }
+
+/*
+BatchStore is optionally implemented by a DataStore to write the commits of multiple blocks
+in one database transaction, it saves the disk syncs of each block on initial sync.
+Reads during a batch must see the writes in the batch.
+*/
+type BatchStore interface {
+	// Start a batch, the writes are not persisted until CommitBatch
+	BeginBatch() error
+
+	// Persist the writes since BeginBatch at once
+	CommitBatch() error
+}
+
+/*
+HeightIndex is optionally implemented by a DataStore to get the headers on the best chain by height
+from an index, instead of walking back the headers from the chain tip.
+*/
+type HeightIndex interface {
+	// Get the header on the best chain at the height
+	HeaderAtHeight(height uint32) (*StoreHeader, error)
+}
@@ -1,8 +1,8 @@
 package db
 
 import (
-	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type StoreTx struct {
@@ -14,12 +14,19 @@ type StoreTx struct {
 
 	// Transaction
 	Data Transaction
+
+	// The fee paid by the transaction, UnknownFee if not all the inputs are wallet outputs
+	Fee Fixed64
 }
 
+// The fee of a transaction spending outputs not known by the wallet
+const UnknownFee Fixed64 = -1
+
 func NewStoreTx(tx Transaction, height uint32) *StoreTx {
 	storeTx := new(StoreTx)
 	storeTx.TxId = tx.Hash()
 	storeTx.Height = height
 	storeTx.Data = tx
+	storeTx.Fee = UnknownFee
 	return storeTx
 }
@@ -2,16 +2,16 @@ package _interface
 
 import (
 	"bytes"
-	"errors"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 
-	. "github.com/elastos/Elastos.ELA/bloom"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/boltdb/bolt"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/bloom"
 )
 
 type Proofs interface {
@@ -27,6 +27,13 @@ type Proofs interface {
 	// Delete a merkle proof of a block
 	Delete(blockHash *Uint256) error
 
+	// Get the number of merkle proofs in database
+	Count() (int, error)
+
+	// Delete the merkle proofs of the blocks below the height except the blocks to keep,
+	// return the bytes of the deleted proofs
+	PruneBelow(height uint32, keep map[Uint256]bool) (int, error)
+
 	// Reset database, clear all data
 	Reset() error
 
@@ -142,6 +149,60 @@ func (db *ProofsDB) Delete(blockHash *Uint256) error {
 	})
 }
 
+// Get the number of merkle proofs in database
+func (db *ProofsDB) Count() (count int, err error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(BKTProofs).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+// Delete the merkle proofs of the blocks below the height except the blocks to keep,
+// return the bytes of the deleted proofs
+func (db *ProofsDB) PruneBelow(height uint32, keep map[Uint256]bool) (freed int, err error) {
+	db.Lock()
+	defer db.Unlock()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTProofs)
+
+		// Keys can not be deleted while iterating the bucket
+		var pruned [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			proof, err := deserializeProof(v)
+			if err != nil {
+				return err
+			}
+			if proof.Height >= height || keep[proof.BlockHash] {
+				return nil
+			}
+			pruned = append(pruned, k)
+			freed += len(k) + len(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range pruned {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return freed, nil
+}
+
 func (db *ProofsDB) Reset() error {
 	db.Lock()
 	defer db.Unlock()
@@ -0,0 +1,83 @@
+package _interface
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/bloom"
+)
+
+func TestProofsDB_PruneBelow(t *testing.T) {
+	log.Init()
+
+	// The proofs database is created in the working directory
+	dir, err := ioutil.TempDir("", "proofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	proofs, err := NewProofsDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proofs.Close()
+
+	for height := uint32(1); height <= 10; height++ {
+		proof := &MerkleProof{
+			BlockHash:    Uint256{byte(height)},
+			Height:       height,
+			Transactions: 1,
+			Hashes:       []*Uint256{{byte(height)}},
+			Flags:        []byte{1},
+		}
+		if err := proofs.Put(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := proofs.Count(); err != nil || count != 10 {
+		t.Fatalf("proofs count %d, %v, expect 10", count, err)
+	}
+
+	// The proof of the block at height 2 is kept for a queued transaction
+	freed, err := proofs.PruneBelow(6, map[Uint256]bool{{2}: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed <= 0 {
+		t.Errorf("%d bytes freed, expect more than 0", freed)
+	}
+	if count, _ := proofs.Count(); count != 6 {
+		t.Errorf("proofs count %d after prune, expect 6", count)
+	}
+	for height := uint32(1); height <= 10; height++ {
+		_, err := proofs.Get(&Uint256{byte(height)})
+		expect := height >= 6 || height == 2
+		if (err == nil) != expect {
+			t.Errorf("proof at height %d stored %v, expect %v", height, err == nil, expect)
+		}
+	}
+
+	// Nothing more to prune until the kept proof is released
+	if freed, err := proofs.PruneBelow(6, map[Uint256]bool{{2}: true}); err != nil || freed != 0 {
+		t.Errorf("pruned again freed %d, %v, expect 0", freed, err)
+	}
+	if _, err := proofs.PruneBelow(6, nil); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := proofs.Count(); count != 5 {
+		t.Errorf("proofs count %d after released, expect 5", count)
+	}
+}
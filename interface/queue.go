@@ -1,11 +1,13 @@
 package _interface
 
 import (
-	"sync"
+	"bytes"
 	"database/sql"
+	"sync"
 
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"fmt"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type Queue interface {
@@ -29,8 +31,12 @@ const (
 	CreateQueueDB = `CREATE TABLE IF NOT EXISTS Queue(
 				TxHash BLOB NOT NULL PRIMARY KEY,
 				BlockHash BLOB NOT NULL,
-				Height INTEGER NOT NULL
+				Height INTEGER NOT NULL,
+				RawData BLOB NOT NULL DEFAULT x''
 			);`
+
+	// Add the RawData column to the table created before the transactions were queued with the items
+	AddQueueRawData = `ALTER TABLE Queue ADD COLUMN RawData BLOB NOT NULL DEFAULT x''`
 )
 
 type QueueDB struct {
@@ -49,16 +55,41 @@ func NewQueueDB() (Queue, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = addRawDataColumn(db)
+	if err != nil {
+		return nil, err
+	}
 	return &QueueDB{RWMutex: new(sync.RWMutex), DB: db}, nil
 }
 
+// Add the RawData column if it's missing, the items already queued have no transaction
+func addRawDataColumn(db *sql.DB) error {
+	var count int
+	row := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('Queue') WHERE name='RawData'`)
+	err := row.Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(AddQueueRawData)
+	return err
+}
+
 // Put a queue item to database
 func (db *QueueDB) Put(item *QueueItem) error {
 	db.Lock()
 	defer db.Unlock()
 
-	sql := "INSERT OR REPLACE INTO Queue(TxHash, BlockHash, Height) VALUES(?,?,?)"
-	_, err := db.Exec(sql, item.TxHash.Bytes(), item.BlockHash.Bytes(), item.Height)
+	// Keep the transaction with the item, so it's notified even the wallet doesn't keep it
+	buf := bytes.NewBuffer([]byte{})
+	if item.Tx != nil {
+		err := item.Tx.Serialize(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	sql := "INSERT OR REPLACE INTO Queue(TxHash, BlockHash, Height, RawData) VALUES(?,?,?,?)"
+	_, err := db.Exec(sql, item.TxHash.Bytes(), item.BlockHash.Bytes(), item.Height, buf.Bytes())
 	if err != nil {
 		return err
 	}
@@ -71,17 +102,19 @@ func (db *QueueDB) GetAll() ([]*QueueItem, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	rows, err := db.Query("SELECT TxHash, BlockHash, Height FROM Queue")
+	rows, err := db.Query("SELECT TxHash, BlockHash, Height, RawData FROM Queue")
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var items []*QueueItem
 	for rows.Next() {
 		var txHashBytes []byte
 		var blockHashBytes []byte
 		var height uint32
-		err = rows.Scan(&txHashBytes, &blockHashBytes, &height)
+		var rawData []byte
+		err = rows.Scan(&txHashBytes, &blockHashBytes, &height, &rawData)
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +128,14 @@ func (db *QueueDB) GetAll() ([]*QueueItem, error) {
 			return nil, err
 		}
 		item := &QueueItem{TxHash: *txHash, BlockHash: *blockHash, Height: height}
+		if len(rawData) > 0 {
+			var tx Transaction
+			err = tx.Deserialize(bytes.NewReader(rawData))
+			if err != nil {
+				return nil, err
+			}
+			item.Tx = &tx
+		}
 		items = append(items, item)
 	}
 
@@ -0,0 +1,71 @@
+package _interface
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Run the test in a temporary working directory, the databases are created there
+func inTempDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestQueueDB_Tx(t *testing.T) {
+	log.Init()
+	defer inTempDir(t)()
+
+	queue, err := NewQueueDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.(*QueueDB).Close()
+
+	tx := &Transaction{TxType: TransferAsset, LockTime: 5, Outputs: []*Output{{}, {}}}
+	if err := queue.Put(&QueueItem{TxHash: tx.Hash(), BlockHash: Uint256{1}, Height: 1, Tx: tx}); err != nil {
+		t.Fatal(err)
+	}
+	// Queued without the transaction like the earlier versions
+	if err := queue.Put(&QueueItem{TxHash: Uint256{2}, BlockHash: Uint256{2}, Height: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := queue.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("queued %d items, expect 2", len(items))
+	}
+	for _, item := range items {
+		switch item.Height {
+		case 1:
+			if item.Tx == nil || item.Tx.Hash() != tx.Hash() {
+				t.Errorf("queued transaction not kept")
+			}
+		case 2:
+			if item.Tx != nil {
+				t.Errorf("queued item without transaction has transaction")
+			}
+		}
+	}
+}
@@ -2,10 +2,13 @@ package _interface
 
 import (
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type QueueItem struct {
-	TxHash        Uint256
-	BlockHash     Uint256
-	Height        uint32
+	TxHash    Uint256
+	BlockHash Uint256
+	Height    uint32
+	// The queued transaction, nil for the items queued before it was kept
+	Tx *Transaction
 }
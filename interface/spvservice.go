@@ -3,9 +3,9 @@ package _interface
 import (
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
 
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 /*
@@ -30,6 +30,17 @@ type SPVService interface {
 	// This method is useful when receive a transaction from other peer
 	VerifyTransaction(bloom.MerkleProof, Transaction) error
 
+	// Check if the transaction is proven in the block by the stored merkle proof of the block,
+	// an error is returned if the proof of the block is not stored
+	VerifyTxInBlock(txId, blockHash Uint256) (bool, error)
+
+	// Get the number of blocks with merkle proofs stored
+	KnownBlockCount() int
+
+	// Delete the stored merkle proofs of the blocks below the height, the block headers are kept,
+	// return the bytes freed. Proofs of the transactions waiting for receipts are kept.
+	PruneBelow(height uint32) (int, error)
+
 	// Send a transaction to the P2P network
 	SendTransaction(Transaction) error
 
@@ -65,6 +76,33 @@ type TransactionListener interface {
 	Rollback(height uint32)
 }
 
+/*
+Register an AccountTransactionListener into the SPVService RegisterTransactionListener() method
+to receive transaction notifications with the registered accounts that the transaction belongs to.
+The bloom filter sent to the network is still the union of all registered accounts,
+the accounts are matched locally when a transaction is received.
+*/
+type AccountTransactionListener interface {
+	TransactionListener
+
+	// NotifyAccounts() is called instead of Notify() with the registered
+	// account addresses that matched the received transaction outputs
+	NotifyAccounts(accounts []string, proof bloom.MerkleProof, tx Transaction)
+}
+
+/*
+Register a ConfirmationListener into the SPVService RegisterTransactionListener() method
+to receive the confirmation count of a transaction each time a new block is committed,
+the updates stop after the transaction reaches the confirmed height.
+*/
+type ConfirmationListener interface {
+	TransactionListener
+
+	// OnConfirmationUpdate() is called with the transaction id and it's current confirmations,
+	// a transaction in the chain tip block has 1 confirmation
+	OnConfirmationUpdate(txId Uint256, confirmations int)
+}
+
 func NewSPVService(clientId uint64, seeds []string) SPVService {
 	return newSPVServiceImpl(clientId, seeds)
 }
@@ -1,18 +1,18 @@
 package _interface
 
 import (
-	"os"
 	"errors"
+	"os"
 	"os/signal"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
-	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 type SPVServiceImpl struct {
@@ -59,10 +59,81 @@ func (service *SPVServiceImpl) VerifyTransaction(proof bloom.MerkleProof, tx Tra
 		return errors.New("SPV service not started")
 	}
 
+	txIds, err := service.checkProof(proof)
+	if err != nil {
+		return err
+	}
+	if len(txIds) == 0 {
+		return errors.New("invalid transaction proof, no transactions found")
+	}
+
+	// Check if transaction hash is match
+	if !containsTxId(txIds, tx.Hash()) {
+		return errors.New("transaction hash not match proof")
+	}
+
+	return nil
+}
+
+// Check the transaction is proven in the block by the stored merkle proof of the block,
+// an error is returned if the proof of the block is not stored.
+func (service *SPVServiceImpl) VerifyTxInBlock(txId, blockHash Uint256) (bool, error) {
+	if service.SPVWallet == nil {
+		return false, errors.New("SPV service not started")
+	}
+
+	proof, err := service.proofs.Get(&blockHash)
+	if err != nil {
+		return false, errors.New("merkle proof of block " + blockHash.String() + " not stored")
+	}
+	txIds, err := service.checkProof(*proof)
+	if err != nil {
+		return false, err
+	}
+	return containsTxId(txIds, txId), nil
+}
+
+// Get the number of blocks with merkle proofs stored, 0 if the service is not started
+func (service *SPVServiceImpl) KnownBlockCount() int {
+	if service.proofs == nil {
+		return 0
+	}
+	count, err := service.proofs.Count()
+	if err != nil {
+		log.Error("Count merkle proofs failed, ", err)
+		return 0
+	}
+	return count
+}
+
+/*
+Delete the stored merkle proofs of the blocks below the height and return the bytes freed.
+Only the proofs are deleted, the block headers are kept so the chain and the sync are not affected.
+The proofs of the queued transactions are kept until their receipts are submitted,
+so the notifications of them still carry their proofs.
+*/
+func (service *SPVServiceImpl) PruneBelow(height uint32) (int, error) {
+	if service.proofs == nil {
+		return 0, errors.New("SPV service not started")
+	}
+
+	items, err := service.queue.GetAll()
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[Uint256]bool)
+	for _, item := range items {
+		keep[item.BlockHash] = true
+	}
+	return service.proofs.PruneBelow(height, keep)
+}
+
+// Check the proof against the block header on the main chain, return the transaction ids proven
+func (service *SPVServiceImpl) checkProof(proof bloom.MerkleProof) ([]*Uint256, error) {
 	// Get Header from main chain
 	header, err := service.Headers().GetHeader(proof.BlockHash)
 	if err != nil {
-		return errors.New("can not get block from main chain")
+		return nil, errors.New("can not get block from main chain")
 	}
 
 	// Check if merkleroot is match
@@ -72,27 +143,23 @@ func (service *SPVServiceImpl) VerifyTransaction(proof bloom.MerkleProof, tx Tra
 		Hashes:       proof.Hashes,
 		Flags:        proof.Flags,
 	}
+	if err := sdk.CheckMerkleBlockBounds(&merkleBlock); err != nil {
+		return nil, errors.New("check merkle branch failed, " + err.Error())
+	}
 	txIds, err := bloom.CheckMerkleBlock(merkleBlock)
 	if err != nil {
-		return errors.New("check merkle branch failed, " + err.Error())
-	}
-	if len(txIds) == 0 {
-		return errors.New("invalid transaction proof, no transactions found")
+		return nil, errors.New("check merkle branch failed, " + err.Error())
 	}
+	return txIds, nil
+}
 
-	// Check if transaction hash is match
-	match := false
-	for _, txId := range txIds {
-		if *txId == tx.Hash() {
-			match = true
-			break
+func containsTxId(txIds []*Uint256, txId Uint256) bool {
+	for _, id := range txIds {
+		if *id == txId {
+			return true
 		}
 	}
-	if !match {
-		return errors.New("transaction hash not match proof")
-	}
-
-	return nil
+	return false
 }
 
 func (service *SPVServiceImpl) SendTransaction(tx Transaction) error {
@@ -178,27 +245,22 @@ func (service *SPVServiceImpl) OnBlockCommitted(block bloom.MerkleBlock, txs []T
 		Flags:        block.Flags,
 	})
 
-	// If no transactions return
-	if len(txs) == 0 {
-		return
-	}
-
-	// Find transactions matches registered accounts
+	// Find transactions matches registered accounts, the queued transactions
+	// are notified with every block, even the block has no transactions
 	var matchedTxs []Transaction
 	for _, tx := range txs {
-		for _, output := range tx.Outputs {
-			if service.addrFilter.ContainAddr(output.ProgramHash) {
-				matchedTxs = append(matchedTxs, tx)
-			}
+		if len(service.matchAccounts(tx)) > 0 {
+			matchedTxs = append(matchedTxs, tx)
 		}
 	}
 
 	// Queue matched transactions
-	for _, tx := range matchedTxs {
+	for i := range matchedTxs {
 		item := &QueueItem{
-			TxHash:    tx.Hash(),
+			TxHash:    matchedTxs[i].Hash(),
 			BlockHash: header.Hash(),
 			Height:    header.Height,
+			Tx:        &matchedTxs[i],
 		}
 
 		// Save to queue db
@@ -215,35 +277,86 @@ func (service *SPVServiceImpl) OnBlockCommitted(block bloom.MerkleBlock, txs []T
 		proof, err := service.proofs.Get(&item.BlockHash)
 		if err != nil {
 			log.Error("Query merkle proof failed, block hash:", item.BlockHash.String())
-			return
+			continue
 		}
-		//	Get transaction from db
-		storeTx, err := service.DataStore().Txs().Get(&item.TxHash)
+		tx, err := service.queuedTx(item)
 		if err != nil {
-			log.Error("Query transaction failed, tx hash:", item.TxHash.String())
-			return
+			log.Error("Query transaction failed, tx hash:", item.TxHash.String(), ", error:", err)
+			continue
 		}
 		// Prune the proof by the given transaction id
-		proof = getTransactionProof(proof, storeTx.TxId)
+		proof = getTransactionProof(proof, item.TxHash)
+
+		// The block contains the transaction is the first confirmation
+		confirmations := header.Height - item.Height + 1
 
 		// Notify listeners
-		service.notifyTransaction(*proof, storeTx.Data, header.Height-item.Height)
+		service.notifyTransaction(*proof, *tx, confirmations)
+
+		// Notify confirmation updates
+		service.notifyConfirmation(*tx, confirmations)
 	}
 }
 
+// Get the transaction of a queued item, the items queued by the earlier versions
+// have no transaction kept, so it's read from the wallet
+func (service *SPVServiceImpl) queuedTx(item *QueueItem) (*Transaction, error) {
+	if item.Tx != nil {
+		return item.Tx, nil
+	}
+	storeTx, err := service.DataStore().Txs().Get(&item.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	return &storeTx.Data, nil
+}
+
+// Get the registered account addresses that the transaction outputs belong to
+func (service *SPVServiceImpl) matchAccounts(tx Transaction) []string {
+	var accounts []string
+	matched := make(map[Uint168]bool)
+	for _, output := range tx.Outputs {
+		if matched[output.ProgramHash] || !service.addrFilter.ContainAddr(output.ProgramHash) {
+			continue
+		}
+		matched[output.ProgramHash] = true
+		address, err := output.ProgramHash.ToAddress()
+		if err != nil {
+			continue
+		}
+		accounts = append(accounts, address)
+	}
+	return accounts
+}
+
 func (service *SPVServiceImpl) notifyTransaction(proof bloom.MerkleProof, tx Transaction, confirmations uint32) {
+	accounts := service.matchAccounts(tx)
 	listeners := service.listeners[tx.TxType]
 	for _, listener := range listeners {
-		if listener.Confirmed() {
-			if confirmations >= getConfirmations(tx) {
-				go listener.Notify(proof, tx)
-			}
+		if listener.Confirmed() && confirmations < getConfirmations(tx) {
+			continue
+		}
+		if accountListener, ok := listener.(AccountTransactionListener); ok {
+			go accountListener.NotifyAccounts(accounts, proof, tx)
 		} else {
 			go listener.Notify(proof, tx)
 		}
 	}
 }
 
+func (service *SPVServiceImpl) notifyConfirmation(tx Transaction, confirmations uint32) {
+	// Stop updates after the transaction reaches confirmed height
+	if confirmations > getConfirmations(tx) {
+		return
+	}
+	listeners := service.listeners[tx.TxType]
+	for _, listener := range listeners {
+		if confirmationListener, ok := listener.(ConfirmationListener); ok {
+			go confirmationListener.OnConfirmationUpdate(tx.Hash(), int(confirmations))
+		}
+	}
+}
+
 func (service *SPVServiceImpl) notifyRollback(height uint32) {
 	for _, group := range service.listeners {
 		for _, listener := range group {
@@ -0,0 +1,201 @@
+package _interface
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVServiceImpl_VerifyTxInBlock(t *testing.T) {
+	log.Init()
+	defer inTempDir(t)()
+
+	wallet, err := spvwallet.Init(1, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs, err := NewProofsDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proofs.Close()
+	service := newSPVServiceImpl(1, nil)
+	service.SPVWallet = wallet
+	service.proofs = proofs
+
+	// A block with a single transaction, the transaction hash is the merkle root
+	tx := Transaction{TxType: TransferAsset, LockTime: 1}
+	txId := tx.Hash()
+	header := Header{Height: 1, MerkleRoot: txId}
+	if err := wallet.Headers().Put(&db.StoreHeader{Header: header, TotalWork: big.NewInt(1)}, true); err != nil {
+		t.Fatal(err)
+	}
+	blockHash := header.Hash()
+	proof := MerkleProof{BlockHash: blockHash, Height: 1, Transactions: 1,
+		Hashes: []*Uint256{&txId}, Flags: []byte{1}}
+	if err := proofs.Put(&proof); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.VerifyTransaction(proof, tx); err != nil {
+		t.Errorf("verify transaction with the proof error %v", err)
+	}
+
+	if ok, err := service.VerifyTxInBlock(txId, blockHash); err != nil || !ok {
+		t.Errorf("transaction in the block verified %v, error %v", ok, err)
+	}
+	if ok, err := service.VerifyTxInBlock(Uint256{1}, blockHash); err != nil || ok {
+		t.Errorf("transaction not in the block verified %v, error %v", ok, err)
+	}
+	if _, err := service.VerifyTxInBlock(txId, Uint256{1}); err == nil {
+		t.Error("verified with the proof of the block not stored")
+	}
+
+	// The proof does not match the merkle root of the stored header
+	other := Header{Height: 2, Previous: blockHash, MerkleRoot: Uint256{2}}
+	if err := wallet.Headers().Put(&db.StoreHeader{Header: other, TotalWork: big.NewInt(2)}, true); err != nil {
+		t.Fatal(err)
+	}
+	err = proofs.Put(&MerkleProof{BlockHash: other.Hash(), Height: 2, Transactions: 1,
+		Hashes: []*Uint256{&txId}, Flags: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyTxInBlock(txId, other.Hash()); err == nil {
+		t.Error("verified with the proof not matching the block header")
+	}
+}
+
+type notifyListener struct {
+	notified chan Transaction
+}
+
+func (l *notifyListener) Type() TransactionType { return TransferAsset }
+
+func (l *notifyListener) Confirmed() bool { return false }
+
+func (l *notifyListener) Notify(proof MerkleProof, tx Transaction) { l.notified <- tx }
+
+func (l *notifyListener) Rollback(height uint32) {}
+
+func TestSPVServiceImpl_OnBlockCommittedSkipsFailedItem(t *testing.T) {
+	log.Init()
+	defer inTempDir(t)()
+
+	proofs, err := NewProofsDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proofs.Close()
+	queue, err := NewQueueDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.(*QueueDB).Close()
+
+	service := newSPVServiceImpl(0, nil)
+	service.proofs = proofs
+	service.queue = queue
+	service.addrFilter = sdk.NewAddrFilter(nil)
+	listener := &notifyListener{notified: make(chan Transaction, 2)}
+	service.RegisterTransactionListener(listener)
+
+	block := MerkleBlock{Header: Header{Height: 10}}
+	// The proof of the first item is missing, the second is in the committed block
+	lost := &Transaction{TxType: TransferAsset, LockTime: 1}
+	queue.Put(&QueueItem{TxHash: lost.Hash(), BlockHash: Uint256{1}, Height: 9, Tx: lost})
+	tx := &Transaction{TxType: TransferAsset, LockTime: 2}
+	queue.Put(&QueueItem{TxHash: tx.Hash(), BlockHash: block.Header.Hash(), Height: 10, Tx: tx})
+
+	service.OnBlockCommitted(block, []Transaction{{TxType: TransferAsset, LockTime: 3}})
+
+	select {
+	case notified := <-listener.notified:
+		if notified.Hash() != tx.Hash() {
+			t.Errorf("notified transaction with the missing proof")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued transaction not notified after an item failed")
+	}
+}
+
+type confirmationListener struct {
+	notifyListener
+	updates chan int
+}
+
+func (l *confirmationListener) Confirmed() bool { return true }
+
+func (l *confirmationListener) OnConfirmationUpdate(txId Uint256, confirmations int) {
+	l.updates <- confirmations
+}
+
+func TestSPVServiceImpl_ConfirmationUpdates(t *testing.T) {
+	log.Init()
+	defer inTempDir(t)()
+
+	proofs, err := NewProofsDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proofs.Close()
+	queue, err := NewQueueDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.(*QueueDB).Close()
+
+	account := Uint168{1}
+	service := newSPVServiceImpl(0, nil)
+	service.proofs = proofs
+	service.queue = queue
+	service.addrFilter = sdk.NewAddrFilter([]*Uint168{&account})
+	listener := &confirmationListener{
+		notifyListener: notifyListener{notified: make(chan Transaction, DefaultConfirmations+2)},
+		updates:        make(chan int, DefaultConfirmations+2),
+	}
+	service.RegisterTransactionListener(listener)
+
+	// The transaction is in the first block, the blocks after have no transactions
+	tx := Transaction{TxType: TransferAsset, Outputs: []*Output{{ProgramHash: account}}}
+	service.OnBlockCommitted(MerkleBlock{Header: Header{Height: 10}}, []Transaction{tx})
+	for height := uint32(11); height < 10+DefaultConfirmations; height++ {
+		service.OnBlockCommitted(MerkleBlock{Header: Header{Height: height}}, nil)
+	}
+
+	// One update for each confirmation, sent by goroutines so not in order
+	updates := make(map[int]bool)
+	for i := 0; i < DefaultConfirmations; i++ {
+		select {
+		case confirmations := <-listener.updates:
+			updates[confirmations] = true
+		case <-time.After(time.Second):
+			t.Fatalf("%d confirmation updates notified, expect %d", i, DefaultConfirmations)
+		}
+	}
+	for confirmations := 1; confirmations <= DefaultConfirmations; confirmations++ {
+		if !updates[confirmations] {
+			t.Errorf("confirmation update %d not notified", confirmations)
+		}
+	}
+
+	// The confirmed listener is notified with the last update only
+	select {
+	case <-listener.notified:
+	case <-time.After(time.Second):
+		t.Fatal("confirmed listener not notified")
+	}
+	select {
+	case <-listener.notified:
+		t.Error("confirmed listener notified before confirmed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -1,12 +1,14 @@
 package log
 
 import (
+	"fmt"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 	"io"
-	"os"
 	"log"
-	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
-	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 )
 
 const (
@@ -31,10 +33,23 @@ const (
 
 var level uint8
 var logger *log.Logger
+var fileWriter *RotateWriter
 
 func Init() {
+	SuppressWindow = config.Values().LogSuppressWindow
+
+	// Use rotating log file if configured
+	if cfg := config.Values(); cfg.LogFile != "" {
+		err := Configure(cfg.LogFile, cfg.LogMaxSize, cfg.LogMaxBackups, fmt.Sprint(cfg.Level()))
+		if err != nil {
+			fmt.Println("error: configure log file failed,", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	writers := []io.Writer{}
-	level = config.Values().PrintLevel
+	level = config.Values().Level()
 	if level >= LevelFile {
 		logFile, err := OpenLogFile()
 		if err != nil {
@@ -47,6 +62,50 @@ func Init() {
 	logger = log.New(io.MultiWriter(writers...), "", log.Ldate|log.Lmicroseconds)
 }
 
+// Configure the logger to write into a size based rotating log file in addition to stdout.
+// path is the log file path, maxSizeMB is the max size of a log file in MB before rotation,
+// maxBackups is how many rotated files to retain, logLevel is one of trace, warn, error, debug
+// or the level number.
+func Configure(path string, maxSizeMB int, maxBackups int, logLevel string) error {
+	printLevel, err := parseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	writer, err := NewRotateWriter(path, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return err
+	}
+
+	if fileWriter != nil {
+		fileWriter.Close()
+	}
+	fileWriter = writer
+
+	level = printLevel
+	logger = log.New(io.MultiWriter(os.Stdout, writer), "", log.Ldate|log.Lmicroseconds)
+	return nil
+}
+
+func parseLevel(level string) (uint8, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace":
+		return LevelTrace, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "debug":
+		return LevelDebug, nil
+	}
+
+	value, err := strconv.ParseUint(level, 10, 8)
+	if err != nil || value > LevelFile {
+		return 0, fmt.Errorf("invalid log level %q", level)
+	}
+	return uint8(value), nil
+}
+
 func OpenLogFile() (*os.File, error) {
 	if fi, err := os.Stat(PATH); err == nil {
 		if !fi.IsDir() {
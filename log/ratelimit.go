@@ -0,0 +1,92 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Seconds within which the repeated messages of the same key are logged once,
+// the next message after the window tells how many were suppressed. 0 to log all messages.
+var SuppressWindow uint32 = 0
+
+type limitedEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// limiter keeps when the messages of each key are last logged
+type limiter struct {
+	sync.Mutex
+	entries map[string]*limitedEntry
+	pruned  time.Time
+}
+
+var limited = &limiter{entries: make(map[string]*limitedEntry)}
+
+// Check if the message of the key should be logged now, return the number of messages suppressed before
+func (l *limiter) allow(key string, now time.Time) (bool, int) {
+	window := time.Second * time.Duration(SuppressWindow)
+	if window <= 0 {
+		return true, 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if now.Sub(l.pruned) >= window {
+		l.prune(now, window)
+	}
+
+	entry, ok := l.entries[key]
+	if !ok {
+		l.entries[key] = &limitedEntry{logged: now}
+		return true, 0
+	}
+	if now.Sub(entry.logged) < window {
+		entry.suppressed++
+		return false, 0
+	}
+	suppressed := entry.suppressed
+	entry.logged, entry.suppressed = now, 0
+	return true, suppressed
+}
+
+// Remove the entries logged before the window, the ones with suppressed messages are kept
+// to tell the number when the key is logged again
+func (l *limiter) prune(now time.Time, window time.Duration) {
+	for key, entry := range l.entries {
+		if entry.suppressed == 0 && now.Sub(entry.logged) >= window {
+			delete(l.entries, key)
+		}
+	}
+	l.pruned = now
+}
+
+func limitedMsg(key string, msg []interface{}) (string, bool) {
+	ok, suppressed := limited.allow(key, time.Now())
+	if !ok {
+		return "", false
+	}
+	text := fmt.Sprint(msg...)
+	if suppressed > 0 {
+		text += fmt.Sprintf(" (%d similar messages suppressed)", suppressed)
+	}
+	return text, true
+}
+
+// Log a warning at most once within SuppressWindow for the key, used for the repeated peer errors.
+// The key must be a fixed text, not built from the data sent by peers.
+func WarnLimited(key string, msg ...interface{}) {
+	if text, ok := limitedMsg(key, msg); ok {
+		Warnf("%s", text)
+	}
+}
+
+// Log an error at most once within SuppressWindow for the key, used for the repeated peer errors.
+// The key must be a fixed text, not built from the data sent by peers.
+func ErrorLimited(key string, msg ...interface{}) {
+	if text, ok := limitedMsg(key, msg); ok {
+		Errorf("%s", text)
+	}
+}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	defer func() { SuppressWindow = 0 }()
+	SuppressWindow = 10
+
+	l := &limiter{entries: make(map[string]*limitedEntry)}
+	now := time.Now()
+	if ok, _ := l.allow("notfound", now); !ok {
+		t.Fatal("first message suppressed")
+	}
+
+	// Repeated within the window are suppressed, other keys are not
+	for i := 1; i <= 3; i++ {
+		if ok, _ := l.allow("notfound", now.Add(time.Duration(i)*time.Second)); ok {
+			t.Errorf("message %d within the window logged", i)
+		}
+	}
+	if ok, _ := l.allow("non sync peer", now.Add(time.Second)); !ok {
+		t.Error("message of another key suppressed")
+	}
+
+	// The first message after the window tells how many were suppressed
+	ok, suppressed := l.allow("notfound", now.Add(10*time.Second))
+	if !ok || suppressed != 3 {
+		t.Errorf("after the window logged %v with %d suppressed, expect 3 suppressed", ok, suppressed)
+	}
+	if ok, _ := l.allow("notfound", now.Add(11*time.Second)); ok {
+		t.Error("window not restarted")
+	}
+
+	SuppressWindow = 0
+	if ok, _ := l.allow("notfound", now.Add(12*time.Second)); !ok {
+		t.Error("message suppressed with the window disabled")
+	}
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	defer func() { SuppressWindow = 0 }()
+	SuppressWindow = 10
+
+	l := &limiter{entries: make(map[string]*limitedEntry)}
+	now := time.Now()
+	l.allow("handle message", now)
+	l.allow("misbehaved", now)
+	l.allow("misbehaved", now.Add(time.Second))
+
+	// Entries logged before the window are removed, unless messages were suppressed
+	l.allow("decode message", now.Add(20*time.Second))
+	if _, ok := l.entries["handle message"]; ok {
+		t.Error("entry logged before the window not removed")
+	}
+	if _, ok := l.entries["misbehaved"]; !ok {
+		t.Error("entry with suppressed messages removed")
+	}
+	if len(l.entries) != 2 {
+		t.Errorf("%d entries after prune, expect 2", len(l.entries))
+	}
+}
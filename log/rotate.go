@@ -0,0 +1,105 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotateWriter is a file writer which rotates the log file when it reaches the max size,
+// rotated files are renamed to path.1, path.2 ... and the oldest beyond maxBackups are removed.
+type RotateWriter struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	size       int64
+	file       *os.File
+}
+
+func NewRotateWriter(path string, maxSize int64, maxBackups int) (*RotateWriter, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid log file max size %d", maxSize)
+	}
+	if maxBackups < 0 {
+		return nil, fmt.Errorf("invalid log file max backups %d", maxBackups)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0766); err != nil {
+		return nil, err
+	}
+
+	writer := &RotateWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *RotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// Write the log line into file, the file is rotated before a write makes it exceed max size.
+// The lock is held during rotation, so no log lines will be lost.
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if w.maxBackups == 0 {
+		os.Remove(w.path)
+	} else {
+		// Shift backups, path.(n-1) -> path.n, the oldest will be overwritten
+		for i := w.maxBackups - 1; i > 0; i-- {
+			os.Rename(backupName(w.path, i), backupName(w.path, i+1))
+		}
+		if err := os.Rename(w.path, backupName(w.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	return w.open()
+}
+
+func (w *RotateWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.file.Close()
+}
+
+func backupName(path string, index int) string {
+	return fmt.Sprint(path, ".", index)
+}
@@ -0,0 +1,98 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotateWriter_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spv.log")
+	writer, err := NewRotateWriter(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each line is 10 bytes, two lines fit in one file
+	for i := 0; i < 7; i++ {
+		if _, err := fmt.Fprintf(writer, "line %04d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+
+	// The current file and 2 backups are kept, the oldest are removed
+	expect := map[string]string{
+		path:                "line 0006\n",
+		backupName(path, 1): "line 0004\nline 0005\n",
+		backupName(path, 2): "line 0002\nline 0003\n",
+	}
+	for name, lines := range expect {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Errorf("read log file %s error %v", name, err)
+			continue
+		}
+		if string(data) != lines {
+			t.Errorf("log file %s has %q, expect %q", name, data, lines)
+		}
+	}
+	if _, err := os.Stat(backupName(path, 3)); !os.IsNotExist(err) {
+		t.Error("log file beyond max backups kept")
+	}
+
+	// Reopened log file is appended and rotated by its size
+	writer, err = NewRotateWriter(path, 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(writer, "line 0007\n")
+	fmt.Fprint(writer, "line 0008\n")
+	writer.Close()
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "line 0008\n" {
+		t.Errorf("log file has %q after rotated without backups", data)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer Init()
+
+	path := filepath.Join(dir, "logs", "spv.log")
+	if err := Configure(path, 1, 1, "warn"); err != nil {
+		t.Fatal(err)
+	}
+	Warn("configured warning")
+	Debug("filtered debug message")
+	fileWriter.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "configured warning") {
+		t.Error("warning not written into the log file")
+	}
+	if strings.Contains(string(data), "filtered debug message") {
+		t.Error("message above the log level written")
+	}
+
+	for _, invalid := range []string{"verbose", "6", "-1"} {
+		if err := Configure(path, 1, 1, invalid); err == nil {
+			t.Errorf("configured with invalid level %q", invalid)
+		}
+	}
+}
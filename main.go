@@ -1,17 +1,25 @@
 package main
 
 import (
+	"encoding/binary"
+	"fmt"
 	"os"
 	"os/signal"
-	"encoding/binary"
 
+	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
-	"github.com/elastos/Elastos.ELA.SPV/log"
 )
 
 func main() {
-	// Initiate log
+	// Load config from config file and environment variables
+	cfg, err := config.Load(nil)
+	if err != nil {
+		fmt.Println("Load config failed,", err)
+		os.Exit(0)
+	}
+
+	// Initiate log with the loaded config
 	log.Init()
 
 	file, err := spvwallet.OpenKeystoreFile()
@@ -22,7 +30,7 @@ func main() {
 
 	// Initiate SPV service
 	iv, _ := file.GetIV()
-	wallet, err := spvwallet.Init(binary.LittleEndian.Uint64(iv), config.Values().SeedList)
+	wallet, err := spvwallet.Init(binary.LittleEndian.Uint64(iv), cfg.SeedList)
 	if err != nil {
 		log.Error("Initiate SPV service failed,", err)
 		os.Exit(0)
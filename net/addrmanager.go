@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 )
@@ -14,18 +17,37 @@ const (
 	CachedAddrsFile = "addrs.cache"
 )
 
+// Try the recently connected good peers first on startup, before the random addresses and seeds.
+// Cached addresses are ranked by the times connected and the time last seen.
+var ReconnectLastPeers = false
+
+// The connection history of a cached address
+type addrStat struct {
+	lastSeen  time.Time
+	successes int
+}
+
+// The more connected and the more recently seen, the higher the score
+func (s *addrStat) score(now time.Time) float64 {
+	return float64(s.successes) / (1 + now.Sub(s.lastSeen).Hours())
+}
+
 type AddrManager struct {
 	sync.RWMutex
 	seeds     []string
 	cached    []string
+	stats     map[string]*addrStat
 	connected map[string]byte
+	random    *random
 }
 
-func newAddrManager(seeds []string) *AddrManager {
+func newAddrManager(seeds []string, random *random) *AddrManager {
 	am := &AddrManager{
 		seeds:     make([]string, 0),
 		cached:    make([]string, 0),
+		stats:     make(map[string]*addrStat),
 		connected: make(map[string]byte),
+		random:    random,
 	}
 
 	// Read seed list from config file
@@ -40,16 +62,36 @@ func newAddrManager(seeds []string) *AddrManager {
 	}
 	addrs := strings.Split(strings.TrimSpace(string(data)), "\n")
 
-	for _, addr := range addrs {
-		if len(strings.TrimSpace(addr)) != 0 {
-			am.cached = append(am.cached, addr)
+	// Each line is an address, optionally followed by last seen time and success count
+	for _, line := range addrs {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		addr := fields[0]
+		am.cached = append(am.cached, addr)
+
+		if len(fields) != 3 {
+			continue
+		}
+		lastSeen, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		successes, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
 		}
+		am.stats[addr] = &addrStat{lastSeen: time.Unix(lastSeen, 0), successes: successes}
 	}
 
 	return am
 }
 
 func (am *AddrManager) GetIdleAddrs(count int) []string {
+	am.RLock()
+	defer am.RUnlock()
+
 	addrMap := make(map[string]string)
 
 	for _, seed := range am.seeds {
@@ -66,21 +108,25 @@ func (am *AddrManager) GetIdleAddrs(count int) []string {
 		addrMap[cache] = cache
 	}
 
-	totalAddrs := len(addrMap)
-	if count > totalAddrs {
-		count = totalAddrs
+	randAddrs := make([]string, 0, len(addrMap))
+	for addr := range addrMap {
+		randAddrs = append(randAddrs, addr)
+	}
+	am.random.shuffleAddrs(randAddrs)
+
+	// Move the good addresses to the front, others are kept in random order
+	if ReconnectLastPeers {
+		now := time.Now()
+		sort.SliceStable(randAddrs, func(i, j int) bool {
+			return am.score(randAddrs[i], now) > am.score(randAddrs[j], now)
+		})
 	}
 
-	randAddrs := make([]string, count)
-	for addr := range addrMap {
-		count--
-		randAddrs[count] = addr
-		if count == 0 {
-			break
-		}
+	if count > len(randAddrs) {
+		count = len(randAddrs)
 	}
 
-	return randAddrs
+	return randAddrs[:count]
 }
 
 func (am *AddrManager) AddAddr(addr string) {
@@ -89,10 +135,21 @@ func (am *AddrManager) AddAddr(addr string) {
 
 	am.connected[addr] = 'c'
 
-	if !am.isSeed(addr) && !am.isCached(addr) {
+	if am.isSeed(addr) {
+		return
+	}
+	if !am.isCached(addr) {
 		am.cached = append(am.cached, addr)
-		am.saveCached()
 	}
+
+	stat, ok := am.stats[addr]
+	if !ok {
+		stat = new(addrStat)
+		am.stats[addr] = stat
+	}
+	stat.lastSeen = time.Now()
+	stat.successes++
+	am.saveCached()
 }
 
 func (am *AddrManager) DisconnectedAddr(addr string) {
@@ -110,12 +167,21 @@ func (am *AddrManager) DiscardAddr(addr string) {
 	for i, cache := range am.cached {
 		if cache == addr {
 			am.cached = append(am.cached[:i], am.cached[i+1:]...)
+			delete(am.stats, addr)
 			am.saveCached()
 			return
 		}
 	}
 }
 
+func (am *AddrManager) score(addr string, now time.Time) float64 {
+	stat, ok := am.stats[addr]
+	if !ok {
+		return 0
+	}
+	return stat.score(now)
+}
+
 func (am *AddrManager) isSeed(addr string) bool {
 	for _, seed := range am.seeds {
 		if seed == addr {
@@ -143,6 +209,9 @@ func (am *AddrManager) saveCached() {
 	var cached string
 	for _, addr := range am.cached {
 		cached += string(addr)
+		if stat, ok := am.stats[addr]; ok {
+			cached += fmt.Sprint(" ", stat.lastSeen.Unix(), " ", stat.successes)
+		}
 		cached += "\n"
 	}
 
@@ -151,6 +220,7 @@ func (am *AddrManager) saveCached() {
 		fmt.Println("Open cached addresses failed")
 		return
 	}
+	defer file.Close()
 
 	_, err = file.Write([]byte(cached))
 	if err != nil {
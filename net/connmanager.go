@@ -16,11 +16,16 @@ const (
 	MaxRetryCount = 5
 )
 
+// The maximum number of connection attempts in flight, the others wait for a free slot,
+// so filling the connections will not open many sockets at once
+var MaxConcurrentDials = 8
+
 type ConnManager struct {
 	sync.Mutex
 
 	connList  []string
 	retryList map[string]int
+	dialSlots chan struct{}
 
 	OnDiscardAddr func(add string)
 }
@@ -28,6 +33,9 @@ type ConnManager struct {
 func newConnManager(onDiscardAddr func(add string)) *ConnManager {
 	cm := new(ConnManager)
 	cm.retryList = make(map[string]int)
+	if MaxConcurrentDials > 0 {
+		cm.dialSlots = make(chan struct{}, MaxConcurrentDials)
+	}
 	cm.OnDiscardAddr = onDiscardAddr
 	return cm
 }
@@ -64,8 +72,17 @@ func (cm *ConnManager) removeAddrFromConnectingList(addr string) {
 	}
 }
 
+// Dial the address when a dial slot is free, see MaxConcurrentDials
+func (cm *ConnManager) dial(addr string) (net.Conn, error) {
+	if cm.dialSlots != nil {
+		cm.dialSlots <- struct{}{}
+		defer func() { <-cm.dialSlots }()
+	}
+	return dial(addr)
+}
+
 func (cm *ConnManager) connectPeer(addr string) {
-	conn, err := net.DialTimeout("tcp", addr, time.Second*ConnTimeOut)
+	conn, err := cm.dial(addr)
 	if err != nil {
 		log.Error("Connect to addr ", addr, " failed, err", err)
 		cm.retry(addr)
@@ -79,6 +96,8 @@ func (cm *ConnManager) connectPeer(addr string) {
 
 	// Send version message to remote peer
 	go remote.Send(pm.local.NewVersionMsg())
+
+	pm.waitHandshake(remote)
 }
 
 func (cm *ConnManager) retry(addr string) {
@@ -0,0 +1,92 @@
+package net
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// The number of peers to connect on a cold start during initial block download,
+// it's increased one by one toward MinConnCount as sync proves stable. 0 to disable the ramp.
+var ConnRampStart = 0
+
+// Seconds of continuous sync progress before connecting one more peer during the ramp
+var ConnRampInterval uint32 = 30
+
+// connRamp limits the connections during initial block download, so a slow link
+// will not be overwhelmed by many peers at once. The ramp finishes when the target
+// reaches MinConnCount or the initial sync finished, and never starts again.
+type connRamp struct {
+	sync.Mutex
+	target       int // 0 when ramp finished
+	stableSince  time.Time
+	lastProgress time.Time
+}
+
+func newConnRamp() *connRamp {
+	ramp := new(connRamp)
+	if ConnRampStart > 0 && ConnRampStart < MinConnCount {
+		ramp.target = ConnRampStart
+	}
+	return ramp
+}
+
+// Get the current connection target, ramping is false when ramp finished
+func (ramp *connRamp) Target() (target int, ramping bool) {
+	ramp.Lock()
+	defer ramp.Unlock()
+
+	if ramp.target == 0 {
+		return MinConnCount, false
+	}
+	return ramp.target, true
+}
+
+func (ramp *connRamp) progressed(now time.Time) {
+	ramp.Lock()
+	defer ramp.Unlock()
+
+	if ramp.target == 0 {
+		return
+	}
+
+	// No progress for an interval means sync stalled, start counting again
+	interval := time.Duration(ConnRampInterval) * time.Second
+	if ramp.lastProgress.IsZero() || now.Sub(ramp.lastProgress) > interval {
+		ramp.stableSince = now
+	}
+	ramp.lastProgress = now
+
+	if now.Sub(ramp.stableSince) < interval {
+		return
+	}
+	ramp.target++
+	ramp.stableSince = now
+	if ramp.target >= MinConnCount {
+		log.Info("Connection ramp finished, connect ", MinConnCount, " peers")
+		ramp.target = 0
+		return
+	}
+	log.Info("Sync is stable, ramp connections to ", ramp.target)
+}
+
+func (ramp *connRamp) finish() {
+	ramp.Lock()
+	defer ramp.Unlock()
+
+	if ramp.target != 0 {
+		log.Info("Initial sync finished, connect ", MinConnCount, " peers")
+		ramp.target = 0
+	}
+}
+
+// Notify the initial block download made progress, more peers will be connected if sync is stable
+func (pm *PeerManager) SyncProgressed() {
+	pm.connRamp.progressed(time.Now())
+}
+
+// Notify the chain is synced, the connection ramp finishes and MinConnCount peers will be connected
+func (pm *PeerManager) SyncFinished() {
+	pm.connRamp.finish()
+}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Delay before starting the connection attempt to the next resolved address,
+// an attempt failed earlier starts the next one immediately.
+var DialStagger = 250 * time.Millisecond
+
+// The local IP address outbound connections are made from, empty to let the OS choose
+var BindAddress string
+
+// Replaced in tests
+var (
+	lookupHost  = net.LookupHost
+	dialTimeout = dialFrom
+)
+
+// Connect to the address from BindAddress if it's set
+func dialFrom(network, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	if BindAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(BindAddress)}
+	}
+	return dialer.Dial(network, addr)
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+/*
+Connect to the address in host:port format. A host name is resolved to all of its
+IPv6 and IPv4 addresses, connection attempts are started in alternating families with
+a short stagger, the first one connected is used and the others are closed, so an
+unreachable address family on a dual-stack host will not fail the connection.
+*/
+func dial(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialTimeout("tcp", addr, time.Second*ConnTimeOut)
+	}
+
+	hosts, err := lookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	return dialRace(interleaveFamilies(hosts, port))
+}
+
+// Order the addresses IPv6 first then alternate between IPv6 and IPv4
+func interleaveFamilies(hosts []string, port string) []string {
+	var ipv6, ipv4 []string
+	for _, host := range hosts {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			ipv4 = append(ipv4, net.JoinHostPort(host, port))
+		} else {
+			ipv6 = append(ipv6, net.JoinHostPort(host, port))
+		}
+	}
+
+	addrs := make([]string, 0, len(ipv6)+len(ipv4))
+	for i := 0; i < len(ipv6) || i < len(ipv4); i++ {
+		if i < len(ipv6) {
+			addrs = append(addrs, ipv6[i])
+		}
+		if i < len(ipv4) {
+			addrs = append(addrs, ipv4[i])
+		}
+	}
+	return addrs
+}
+
+func dialRace(addrs []string) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no address resolved")
+	}
+
+	results := make(chan dialResult, len(addrs))
+	var next, pending int
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dialTimeout("tcp", addr, time.Second*ConnTimeOut)
+			results <- dialResult{conn: conn, err: err}
+		}()
+	}
+
+	start()
+	stagger := time.NewTimer(DialStagger)
+	defer stagger.Stop()
+	for {
+		select {
+		case <-stagger.C:
+			if next < len(addrs) {
+				start()
+				stagger.Reset(DialStagger)
+			}
+
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				go closeLosers(results, pending)
+				return result.conn, nil
+			}
+			if next < len(addrs) {
+				start()
+				if !stagger.Stop() {
+					select {
+					case <-stagger.C:
+					default:
+					}
+				}
+				stagger.Reset(DialStagger)
+				continue
+			}
+			if pending == 0 {
+				return nil, result.err
+			}
+		}
+	}
+}
+
+// Close the connections of the attempts still pending after the race is won
+func closeLosers(results chan dialResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if result := <-results; result.err == nil {
+			result.conn.Close()
+		}
+	}
+}
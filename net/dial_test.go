@@ -0,0 +1,170 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	hosts := []string{"1.1.1.1", "2.2.2.2", "::1", "3.3.3.3", "::2", "invalid"}
+	expect := []string{"[::1]:20866", "1.1.1.1:20866", "[::2]:20866", "2.2.2.2:20866", "3.3.3.3:20866"}
+	if addrs := interleaveFamilies(hosts, "20866"); !reflect.DeepEqual(addrs, expect) {
+		t.Errorf("interleaved addresses %v, expect %v", addrs, expect)
+	}
+}
+
+type closedConn struct {
+	net.Conn
+	sync.Mutex
+	closed bool
+}
+
+func (conn *closedConn) Close() error {
+	conn.Lock()
+	defer conn.Unlock()
+	conn.closed = true
+	return nil
+}
+
+func (conn *closedConn) isClosed() bool {
+	conn.Lock()
+	defer conn.Unlock()
+	return conn.closed
+}
+
+func TestDial_HappyEyeballs(t *testing.T) {
+	defer func(lookup func(string) ([]string, error), dialer func(string, string, time.Duration) (net.Conn, error)) {
+		lookupHost, dialTimeout = lookup, dialer
+	}(lookupHost, dialTimeout)
+
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"::1", "1.1.1.1", "2.2.2.2"}, nil
+	}
+
+	// Attempts start at 0, 1 and 2 staggers, IPv6 hangs then fails,
+	// the first IPv4 connects at 3 staggers, the second IPv4 connects too late
+	fast, slow := new(closedConn), new(closedConn)
+	loserDone := make(chan struct{})
+	dialTimeout = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		switch addr {
+		case "[::1]:20866":
+			time.Sleep(DialStagger * 4)
+			return nil, errors.New("network unreachable")
+		case "1.1.1.1:20866":
+			time.Sleep(DialStagger * 2)
+			return fast, nil
+		default:
+			defer close(loserDone)
+			time.Sleep(DialStagger * 3)
+			return slow, nil
+		}
+	}
+
+	conn, err := dial("seed.elastos.org:20866")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != fast {
+		t.Fatal("first connected address not used")
+	}
+
+	<-loserDone
+	time.Sleep(DialStagger)
+	if fast.isClosed() {
+		t.Error("winning connection closed")
+	}
+	if !slow.isClosed() {
+		t.Error("losing connection not closed")
+	}
+}
+
+func TestDial_AllFailed(t *testing.T) {
+	defer func(lookup func(string) ([]string, error), dialer func(string, string, time.Duration) (net.Conn, error)) {
+		lookupHost, dialTimeout = lookup, dialer
+	}(lookupHost, dialTimeout)
+
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"::1", "1.1.1.1"}, nil
+	}
+	var attempts []string
+	var lock sync.Mutex
+	dialTimeout = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		lock.Lock()
+		attempts = append(attempts, addr)
+		lock.Unlock()
+		return nil, errors.New("connection refused")
+	}
+
+	if _, err := dial("seed.elastos.org:20866"); err == nil {
+		t.Fatal("dial succeeded with all addresses failed")
+	}
+	if len(attempts) != 2 {
+		t.Errorf("attempts %v, expect both addresses", attempts)
+	}
+}
+
+func TestDial_BindAddress(t *testing.T) {
+	defer func(addr string) { BindAddress = addr }(BindAddress)
+	BindAddress = "127.0.0.1"
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := dial(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.TCPAddr)
+	if !local.IP.Equal(net.ParseIP(BindAddress)) {
+		t.Errorf("connection made from %s, expect %s", local.IP, BindAddress)
+	}
+}
+
+func TestConnManager_MaxConcurrentDials(t *testing.T) {
+	defer func(dialer func(string, string, time.Duration) (net.Conn, error), max int) {
+		dialTimeout, MaxConcurrentDials = dialer, max
+	}(dialTimeout, MaxConcurrentDials)
+
+	var lock sync.Mutex
+	var inFlight, maxInFlight int
+	dialTimeout = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		return nil, errors.New("connection refused")
+	}
+
+	MaxConcurrentDials = 3
+	cm := newConnManager(func(string) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cm.dial(net.JoinHostPort(net.IPv4(10, 0, 0, byte(i)).String(), "20866"))
+		}(i)
+	}
+	wg.Wait()
+
+	if maxInFlight != MaxConcurrentDials {
+		t.Errorf("%d dials in flight, expect at most %d", maxInFlight, MaxConcurrentDials)
+	}
+}
@@ -0,0 +1,82 @@
+package net
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+/*
+A peer reporting a height more than this below the highest height it reported recently is
+misbehaving, a smaller drop is a reorganize on its side. 0 to never score a height drop.
+*/
+var MaxHeightDrop uint64 = 0
+
+// The number of recently reported heights kept for each peer
+const heightHistorySize = 8
+
+// heightHistory keeps the heights recently reported by a peer
+type heightHistory struct {
+	sync.Mutex
+	heights []uint64
+}
+
+// Record the height and get how much it's below the current height or the highest in the history
+func (history *heightHistory) add(current, height uint64) uint64 {
+	history.Lock()
+	defer history.Unlock()
+
+	highest := current
+	for _, h := range history.heights {
+		if h > highest {
+			highest = h
+		}
+	}
+	history.heights = append(history.heights, height)
+	if len(history.heights) > heightHistorySize {
+		history.heights = history.heights[1:]
+	}
+	if height >= highest {
+		return 0
+	}
+	return highest - height
+}
+
+// heightDrops keeps the listeners of peers reporting lower heights
+type heightDrops struct {
+	sync.Mutex
+	listeners []func(peer *Peer, drop uint64)
+}
+
+// Register a listener to be notified when a peer reported a height lower than it reported recently
+func (pm *PeerManager) OnHeightDrop(listener func(peer *Peer, drop uint64)) {
+	pm.heightDrops.Lock()
+	defer pm.heightDrops.Unlock()
+
+	pm.heightDrops.listeners = append(pm.heightDrops.listeners, listener)
+}
+
+/*
+Update the height reported by the peer in ping and pong messages. A height lower than the peer
+reported recently is notified to the height drop listeners, and the peer is scored as misbehaving
+if the drop is more than MaxHeightDrop, as a reorganize that deep is implausible.
+*/
+func (pm *PeerManager) UpdatePeerHeight(peer *Peer, height uint64) {
+	drop := peer.heights.add(peer.Height(), height)
+	peer.SetHeight(height)
+	if drop == 0 {
+		return
+	}
+
+	log.Debug("Peer ", peer.ID(), " reported height ", height, " dropped by ", drop)
+	if MaxHeightDrop > 0 && drop > MaxHeightDrop {
+		pm.Misbehaved(peer, fmt.Sprintf("reported height dropped by %d", drop))
+	}
+
+	pm.heightDrops.Lock()
+	defer pm.heightDrops.Unlock()
+	for _, listener := range pm.heightDrops.listeners {
+		go listener(peer, drop)
+	}
+}
@@ -0,0 +1,101 @@
+package net
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// The number of connection slots reserved for manual peers, they are not counted in MinConnCount
+var MaxManualPeers = 2
+
+// manualPeers are the addresses added by AddManualPeer, they are kept connected
+// until removed by RemoveManualPeer, and never disconnected by the inactive peer sweep.
+type manualPeers struct {
+	sync.RWMutex
+	addrs map[string]bool
+}
+
+func newManualPeers() *manualPeers {
+	return &manualPeers{addrs: make(map[string]bool)}
+}
+
+func (m *manualPeers) contains(addr string) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.addrs[addr]
+}
+
+func (m *manualPeers) list() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	addrs := make([]string, 0, len(m.addrs))
+	for addr := range m.addrs {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// Add a trusted peer address and connect to it, the address is in IP:Port format.
+// Manual peers occupy the reserved slots and are reconnected when disconnected.
+func (pm *PeerManager) AddManualPeer(addr string) error {
+	pm.manualPeers.Lock()
+	if !pm.manualPeers.addrs[addr] {
+		if len(pm.manualPeers.addrs) >= MaxManualPeers {
+			pm.manualPeers.Unlock()
+			return fmt.Errorf("manual peers reach the limit %d", MaxManualPeers)
+		}
+		pm.manualPeers.addrs[addr] = true
+	}
+	pm.manualPeers.Unlock()
+
+	log.Info("Add manual peer ", addr)
+	pm.ConnectPeer(addr)
+	return nil
+}
+
+// Remove the manual peer address and disconnect it
+func (pm *PeerManager) RemoveManualPeer(addr string) {
+	pm.manualPeers.Lock()
+	delete(pm.manualPeers.addrs, addr)
+	pm.manualPeers.Unlock()
+
+	for _, peer := range pm.ConnectedPeers() {
+		if peer.Addr().String() == addr {
+			pm.DisconnectPeerWithReason(peer, "manual peer removed")
+		}
+	}
+}
+
+// Get the manual peer addresses
+func (pm *PeerManager) ManualPeers() []string {
+	return pm.manualPeers.list()
+}
+
+// Connect the manual peers not connected
+func (pm *PeerManager) connectManualPeers() {
+	connected := make(map[string]bool)
+	for _, peer := range pm.ConnectedPeers() {
+		connected[peer.Addr().String()] = true
+	}
+
+	for _, addr := range pm.manualPeers.list() {
+		if !connected[addr] {
+			pm.ConnectPeer(addr)
+		}
+	}
+}
+
+// The number of connected peers except manual peers
+func (pm *PeerManager) autoPeersCount() int {
+	var count int
+	for _, peer := range pm.ConnectedPeers() {
+		if !peer.Manual() {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,74 @@
+package net
+
+import (
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+	. "github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+type messageType struct {
+	factory func() Message
+	handler func(*Peer, Message) error
+
+	// Handshake messages can be handled before peer established
+	handshake bool
+}
+
+// messages is the dispatch table of the message types handled by PeerManager,
+// commands not in the table are passed to the MessageHandler.
+type messages struct {
+	sync.RWMutex
+	types map[string]*messageType
+}
+
+func newMessages() *messages {
+	return &messages{types: make(map[string]*messageType)}
+}
+
+func (m *messages) register(cmd string, msgType *messageType) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.types[cmd] = msgType
+}
+
+func (m *messages) get(cmd string) (*messageType, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	msgType, ok := m.types[cmd]
+	return msgType, ok
+}
+
+/*
+Register a message type with the command, factory creates a message instance to decode the
+received message into, and handler handles the decoded message. Registered messages are only
+handled after the peer established. Register a command that already exists will replace it.
+*/
+func (pm *PeerManager) RegisterMessage(cmd string, factory func() Message, handler func(*Peer, Message) error) {
+	pm.messages.register(cmd, &messageType{factory: factory, handler: handler})
+}
+
+// Register the messages handled by PeerManager itself, only version and verack
+// are handled before the handshake completed.
+func (pm *PeerManager) registerMessages() {
+	pm.messages.register("version", &messageType{
+		factory:   func() Message { return new(Version) },
+		handler:   func(peer *Peer, msg Message) error { return pm.OnVersion(peer, msg.(*Version)) },
+		handshake: true,
+	})
+	pm.messages.register("verack", &messageType{
+		factory:   func() Message { return new(VerAck) },
+		handler:   func(peer *Peer, msg Message) error { return pm.OnVerAck(peer, msg.(*VerAck)) },
+		handshake: true,
+	})
+	pm.messages.register("getaddr", &messageType{
+		factory: func() Message { return new(AddrsReq) },
+		handler: func(peer *Peer, msg Message) error { return pm.OnAddrsReq(peer, msg.(*AddrsReq)) },
+	})
+	pm.messages.register("addr", &messageType{
+		factory: func() Message { return new(Addrs) },
+		handler: func(peer *Peer, msg Message) error { return pm.OnAddrs(peer, msg.(*Addrs)) },
+	})
+}
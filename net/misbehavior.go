@@ -0,0 +1,40 @@
+package net
+
+import (
+	"sync/atomic"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Peers violate the protocol this many times will be disconnected and their addresses discarded
+var MaxMisbehaviors int32 = 10
+
+/*
+Record a protocol violation of the established peer, like sending data not requested.
+The peer is banned when it misbehaved MaxMisbehaviors times, the connection is closed
+and the address is discarded, so it will not be connected again.
+*/
+func (pm *PeerManager) Misbehaved(peer *Peer, reason string) {
+	count := atomic.AddInt32(&peer.misbehaviors, 1)
+	log.WarnLimited("misbehaved", "Peer ", peer.ID(), " misbehaved ", count, " times, ", reason)
+	if count < MaxMisbehaviors {
+		return
+	}
+
+	pm.DisconnectPeerWithReason(peer, "misbehaving, "+reason)
+	pm.BanAddr(peer.Addr().String(), "misbehaving, "+reason)
+}
+
+// Get the number of protocol violations of the peer
+func (peer *Peer) Misbehaviors() int32 {
+	return atomic.LoadInt32(&peer.misbehaviors)
+}
+
+// Close the connection of a peer not established yet, it's not in the connected peers list
+func (pm *PeerManager) disconnectUnestablished(peer *Peer, reason string) {
+	addr := peer.Addr().String()
+	log.Warn("Peer ", addr, " ", reason, ", disconnect it")
+	peer.Disconnect()
+	pm.connManager.removeAddrFromConnectingList(addr)
+	pm.addrManager.DisconnectedAddr(addr)
+}
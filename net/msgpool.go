@@ -0,0 +1,64 @@
+package net
+
+import (
+	"sync/atomic"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+const (
+	DefaultMessageWorkers = 8
+	MessageQueueSize      = 100 // Max messages waiting in each worker queue
+)
+
+// The number of goroutines handling inbound messages, set it before InitPeerManager
+var MessageWorkers = DefaultMessageWorkers
+
+type peerMessage struct {
+	peer *Peer
+	msg  Message
+}
+
+// msgPool handles inbound messages with a fixed number of workers.
+// Messages from the same connection are always handled by the same worker,
+// so they are handled in the order they are received,
+// and messages from different peers can be handled concurrently.
+type msgPool struct {
+	workers []chan peerMessage
+	depth   int32
+	handler func(*Peer, Message)
+}
+
+func newMsgPool(size int, handler func(*Peer, Message)) *msgPool {
+	if size <= 0 {
+		size = DefaultMessageWorkers
+	}
+	pool := &msgPool{
+		workers: make([]chan peerMessage, size),
+		handler: handler,
+	}
+	for i := range pool.workers {
+		pool.workers[i] = make(chan peerMessage, MessageQueueSize)
+		go pool.work(pool.workers[i])
+	}
+	return pool
+}
+
+// Put the message into the worker queue of the peer,
+// this method blocks when the worker queue is filled.
+func (pool *msgPool) handle(peer *Peer, msg Message) {
+	atomic.AddInt32(&pool.depth, 1)
+	pool.workers[peer.ConnID()%uint64(len(pool.workers))] <- peerMessage{peer: peer, msg: msg}
+}
+
+func (pool *msgPool) work(queue chan peerMessage) {
+	for m := range queue {
+		pool.handler(m.peer, m.msg)
+		atomic.AddInt32(&pool.depth, -1)
+	}
+}
+
+// The number of messages waiting or being handled
+func (pool *msgPool) QueueDepth() int {
+	return int(atomic.LoadInt32(&pool.depth))
+}
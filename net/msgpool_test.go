@@ -0,0 +1,52 @@
+package net
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+	. "github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+func TestMsgPool_OrderAcrossHandshake(t *testing.T) {
+	var lock sync.Mutex
+	var handled []Message
+	pool := newMsgPool(8, func(peer *Peer, msg Message) {
+		// Slow down the first message, a message handled by another worker would overtake it
+		lock.Lock()
+		first := len(handled) == 0
+		lock.Unlock()
+		if first {
+			time.Sleep(20 * time.Millisecond)
+		}
+		lock.Lock()
+		handled = append(handled, msg)
+		lock.Unlock()
+	})
+
+	// The peer id is set by the version message, after the first messages are queued
+	peer := newTestPeer(0)
+	version, verack := NewPing(0), NewPing(1)
+	pool.handle(peer, version)
+	peer.SetID(3)
+	pool.handle(peer, verack)
+
+	for start := time.Now(); pool.QueueDepth() > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("messages not handled")
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(handled) != 2 || handled[0] != version || handled[1] != verack {
+		t.Error("messages of the peer handled out of order after its id changed")
+	}
+}
+
+func TestNewPeer_ConnID(t *testing.T) {
+	first, second := newTestPeer(1), newTestPeer(1)
+	if first.ConnID() == 0 || first.ConnID() == second.ConnID() {
+		t.Errorf("connection ids %d and %d, expect unique non zero ids", first.ConnID(), second.ConnID())
+	}
+}
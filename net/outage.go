@@ -0,0 +1,86 @@
+package net
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Seconds between connection attempts while all peers are disconnected, so the connection is
+// restored soon after the network is back. 0 to try every InfoUpdateDuration as usual.
+var OutageReconnectInterval uint32 = 0
+
+// outage tracks the network lost when the last connected peer disconnected
+type outage struct {
+	sync.Mutex
+	connected bool // If any peer has connected
+	lost      bool
+	since     time.Time
+
+	lostListeners     []func()
+	restoredListeners []func(duration time.Duration)
+}
+
+// Register a listener to be notified when all connected peers disconnected
+func (pm *PeerManager) OnNetworkLost(listener func()) {
+	pm.outage.Lock()
+	defer pm.outage.Unlock()
+
+	pm.outage.lostListeners = append(pm.outage.lostListeners, listener)
+}
+
+// Register a listener to be notified when a peer connected after the network lost,
+// with how long the network was lost
+func (pm *PeerManager) OnNetworkRestored(listener func(duration time.Duration)) {
+	pm.outage.Lock()
+	defer pm.outage.Unlock()
+
+	pm.outage.restoredListeners = append(pm.outage.restoredListeners, listener)
+}
+
+// Check if all peers disconnected and not connected again
+func (pm *PeerManager) IsNetworkLost() bool {
+	pm.outage.Lock()
+	defer pm.outage.Unlock()
+
+	return pm.outage.lost
+}
+
+// Update the network state by the connected peers count, after a peer connected or disconnected
+func (pm *PeerManager) updateOutage() {
+	pm.outage.Lock()
+	defer pm.outage.Unlock()
+
+	if pm.PeersCount() > 0 {
+		pm.outage.connected = true
+		if !pm.outage.lost {
+			return
+		}
+		duration := time.Since(pm.outage.since)
+		pm.outage.lost = false
+		log.Info("Network restored after ", duration)
+		for _, listener := range pm.outage.restoredListeners {
+			go listener(duration)
+		}
+		return
+	}
+
+	if !pm.outage.connected || pm.outage.lost {
+		return
+	}
+	pm.outage.lost = true
+	pm.outage.since = time.Now()
+	log.Warn("Network lost, all peers disconnected")
+	for _, listener := range pm.outage.lostListeners {
+		go listener()
+	}
+}
+
+// The interval between connection attempts, shorter while the network is lost if configured
+func (pm *PeerManager) connectInterval() time.Duration {
+	if OutageReconnectInterval > 0 && pm.IsNetworkLost() {
+		return time.Second * time.Duration(OutageReconnectInterval)
+	}
+	return time.Second * InfoUpdateDuration
+}
@@ -3,8 +3,9 @@ package net
 import (
 	"fmt"
 	"net"
-	"strings"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
@@ -13,7 +14,22 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/p2p/msg"
 )
 
+// The last connection id assigned, accessed atomically
+var lastConnID uint64
+
 type Peer struct {
+	// height is accessed atomically, keep it 64-bit aligned on 32-bit platforms
+	height uint64
+
+	// The number of protocol violations, accessed atomically
+	misbehaviors int32
+
+	// The heights recently reported in ping and pong messages
+	heights heightHistory
+
+	// Assigned locally when the connection is created, unlike id chosen by the peer
+	connID uint64
+
 	// info
 	id         uint64
 	version    uint32
@@ -21,8 +37,8 @@ type Peer struct {
 	ip16       [16]byte
 	port       uint16
 	lastActive time.Time
-	height     uint64
 	relay      uint8 // 1 for true 0 for false
+	manual     bool  // connected from a manual peer address
 
 	PeerState
 	conn net.Conn
@@ -37,8 +53,9 @@ func (peer *Peer) String() string {
 		"\n\tServices:", peer.services,
 		"\n\tPort:", peer.port,
 		"\n\tLastActive:", peer.lastActive,
-		"\n\tHeight:", peer.height,
+		"\n\tHeight:", peer.Height(),
 		"\n\tRelay:", peer.relay,
+		"\n\tManual:", peer.manual,
 		"\n\tState:", peer.PeerState.String(),
 		"\n\tAddr:", peer.Addr().String(),
 		"\n}")
@@ -46,6 +63,7 @@ func (peer *Peer) String() string {
 
 func NewPeer(conn net.Conn) *Peer {
 	peer := new(Peer)
+	peer.connID = atomic.AddUint64(&lastConnID, 1)
 	peer.conn = conn
 	peer.ip16, peer.port = addrFromConn(conn)
 	peer.reader = NewMsgReader(conn, peer)
@@ -64,6 +82,12 @@ func addrFromConn(conn net.Conn) ([16]byte, uint16) {
 	return ip16, uint16(port)
 }
 
+// Get the local id of the connection, it's unique and never changes, messages received
+// before the version handshake can be told apart by it
+func (peer *Peer) ConnID() uint64 {
+	return peer.connID
+}
+
 func (peer *Peer) ID() uint64 {
 	return peer.id
 }
@@ -116,6 +140,11 @@ func (peer *Peer) SetRelay(relay uint8) {
 	peer.relay = relay
 }
 
+// Check if the peer is added by PeerManager.AddManualPeer
+func (peer *Peer) Manual() bool {
+	return peer.manual
+}
+
 func (peer *Peer) Disconnect() {
 	if peer.State() != INACTIVITY {
 		peer.SetState(INACTIVITY)
@@ -128,27 +157,39 @@ func (peer *Peer) SetInfo(msg *Version) {
 	peer.version = msg.Version
 	peer.services = msg.Services
 	peer.lastActive = time.Now()
-	peer.height = msg.Height
+	peer.SetHeight(msg.Height)
 	peer.relay = msg.Relay
 }
 
+// Height is updated by ping and pong messages while read by other goroutines
 func (peer *Peer) SetHeight(height uint64) {
-	peer.height = height
+	atomic.StoreUint64(&peer.height, height)
 }
 
 func (peer *Peer) Height() uint64 {
-	return peer.height
+	return atomic.LoadUint64(&peer.height)
 }
 
 func (peer *Peer) OnDecodeError(err error) {
 	switch err {
 	case ErrDisconnected:
-		pm.DisconnectPeer(peer)
+		// Disconnect sets the state before closing the connection, it's not closed by the peer
+		if peer.State() == INACTIVITY {
+			pm.DisconnectPeerWithReason(peer, "disconnected locally")
+			return
+		}
+		pm.DisconnectPeerWithReason(peer, "connection closed")
 	case ErrUnmatchedMagic:
 		log.Error("Decode message error:", ErrUnmatchedMagic)
 		peer.Disconnect()
 	default:
-		log.Error(err, ", peer id is: ", peer.ID())
+		// Nodes send messages the SPV client doesn't use, it's not misbehaving
+		if _, ok := err.(*unsupportedMessageError); ok {
+			log.Debug("Ignore message from peer ", peer.ID(), ", ", err)
+			return
+		}
+		log.ErrorLimited("decode message", err, ", peer id is: ", peer.ID())
+		pm.Misbehaved(peer, "malformed message")
 	}
 }
 
@@ -157,10 +198,21 @@ func (peer *Peer) OnMakeMessage(cmd string) (Message, error) {
 }
 
 func (peer *Peer) OnMessageDecoded(msg Message) {
-	pm.handleMessage(peer, msg)
+	pm.msgPool.handle(peer, msg)
 }
 
+/*
+Read messages from the connection until it's closed. A panic decoding a malformed message is
+recovered and only disconnects the peer, so a hostile peer can not crash the process.
+*/
 func (peer *Peer) Read() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Read message from peer ", peer.conn.RemoteAddr(), " panic, ", r)
+			pm.DisconnectPeerWithReason(peer, "decode message panic")
+			peer.Disconnect()
+		}
+	}()
 	peer.reader.Read()
 }
 
@@ -177,8 +229,8 @@ func (peer *Peer) Send(msg Message) {
 
 	_, err = peer.conn.Write(buf)
 	if err != nil {
-		log.Error("Error sending message to peer ", err)
-		pm.DisconnectPeer(peer)
+		log.ErrorLimited("send message", "Error sending message to peer ", err)
+		pm.DisconnectPeerWithReason(peer, "send message failed")
 	}
 }
 
@@ -186,6 +238,7 @@ func (peer *Peer) NewVersionMsg() *Version {
 	version := new(Version)
 	version.Version = peer.Version()
 	version.Services = peer.Services()
+	// Same as the ELA nodes, the nanoseconds truncated to 32 bits
 	version.TimeStamp = uint32(time.Now().UnixNano())
 	version.Port = peer.Port()
 	version.Nonce = peer.ID()
@@ -0,0 +1,97 @@
+package net
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+const (
+	MaxPeerEventsQueue = 100
+)
+
+type PeerEventType int
+
+const (
+	PeerConnected PeerEventType = iota
+	PeerDisconnected
+	PeerBanned
+)
+
+func (t PeerEventType) String() string {
+	switch t {
+	case PeerConnected:
+		return "connected"
+	case PeerDisconnected:
+		return "disconnected"
+	case PeerBanned:
+		return "banned"
+	default:
+		return "unknown"
+	}
+}
+
+// PeerEvent describes a peer connection state change
+type PeerEvent struct {
+	Type   PeerEventType
+	Addr   string
+	Reason string
+}
+
+// peerEvents delivers peer events to listeners in order on it's own goroutine,
+// so firing an event will never block the peer manager. The goroutine is started
+// when events are fired and exits when all of them are delivered.
+type peerEvents struct {
+	sync.Mutex
+	listeners  []func(PeerEvent)
+	queue      []PeerEvent
+	delivering bool
+}
+
+func newPeerEvents() *peerEvents {
+	return new(peerEvents)
+}
+
+func (events *peerEvents) addListener(listener func(PeerEvent)) {
+	events.Lock()
+	defer events.Unlock()
+
+	events.listeners = append(events.listeners, listener)
+}
+
+func (events *peerEvents) fire(eventType PeerEventType, addr, reason string) {
+	events.Lock()
+	defer events.Unlock()
+
+	if len(events.listeners) == 0 {
+		return
+	}
+	if len(events.queue) >= MaxPeerEventsQueue {
+		log.Warn("Peer events queue is full, drop ", eventType.String(), " event of ", addr)
+		return
+	}
+	events.queue = append(events.queue, PeerEvent{Type: eventType, Addr: addr, Reason: reason})
+	if !events.delivering {
+		events.delivering = true
+		go events.deliver()
+	}
+}
+
+func (events *peerEvents) deliver() {
+	for {
+		events.Lock()
+		if len(events.queue) == 0 {
+			events.delivering = false
+			events.Unlock()
+			return
+		}
+		event := events.queue[0]
+		events.queue = events.queue[1:]
+		listeners := events.listeners
+		events.Unlock()
+
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+func TestPeerManager_PeerBannedEvent(t *testing.T) {
+	pm, _ := newTestPeerManager()
+	events := make(chan PeerEvent, 10)
+	pm.OnPeerEvent(func(event PeerEvent) { events <- event })
+
+	// Addresses discarded after failed connection attempts are not banned
+	pm.OnDiscardAddr("127.0.0.2:20866")
+
+	peer := newTestPeer(1)
+	peer.SetState(ESTABLISH)
+	pm.AddPeer(peer)
+	for i := int32(0); i < MaxMisbehaviors; i++ {
+		pm.Misbehaved(peer, "unsolicited data")
+	}
+
+	expect := []PeerEvent{
+		{Type: PeerDisconnected, Addr: peer.Addr().String(), Reason: "misbehaving, unsolicited data"},
+		{Type: PeerBanned, Addr: peer.Addr().String(), Reason: "misbehaving, unsolicited data"},
+	}
+	for _, e := range expect {
+		select {
+		case event := <-events:
+			if event != e {
+				t.Errorf("peer event %+v, expect %+v", event, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("peer event %+v not delivered", e)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected peer event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPeerEvents_Deliver(t *testing.T) {
+	events := newPeerEvents()
+	// Not queued without listeners
+	events.fire(PeerConnected, "127.0.0.1:20866", "")
+	if len(events.queue) != 0 || events.delivering {
+		t.Error("event queued without listeners")
+	}
+
+	delivered := make(chan PeerEvent, MaxPeerEventsQueue)
+	block := make(chan struct{})
+	events.addListener(func(event PeerEvent) {
+		<-block
+		delivered <- event
+	})
+	for i := 0; i < MaxPeerEventsQueue+2; i++ {
+		events.fire(PeerConnected, "127.0.0.1:20866", string(rune('a'+i%26)))
+	}
+	close(block)
+
+	// Delivered in order, the ones beyond the queue size are dropped
+	for i := 0; i < MaxPeerEventsQueue; i++ {
+		select {
+		case event := <-delivered:
+			if event.Reason != string(rune('a'+i%26)) {
+				t.Fatalf("event %d delivered out of order", i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d events delivered, expect %d", i, MaxPeerEventsQueue)
+		}
+	}
+
+	// The delivering goroutine exits when the queue is empty
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		events.Lock()
+		delivering := events.delivering
+		events.Unlock()
+		if !delivering {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("events still delivering after the queue is empty")
+}
@@ -3,6 +3,7 @@ package net
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"time"
 
@@ -17,8 +18,13 @@ const (
 	InfoUpdateDuration = 5
 	KeepAliveTimeout   = 3
 	MaxOutboundCount   = 6
+
+	DefaultHandshakeTimeout = 10
 )
 
+// Seconds to wait for a connected peer to complete version and verack handshake
+var HandshakeTimeout = DefaultHandshakeTimeout
+
 // Handle the message creation, allocation etc.
 type MessageHandler interface {
 	// Create a message instance by the given cmd parameter
@@ -41,30 +47,67 @@ type PeerManager struct {
 	*Peers
 	addrManager *AddrManager
 	connManager *ConnManager
+	peerEvents  *peerEvents
+	msgPool     *msgPool
+	messages    *messages
 	msgHandler  MessageHandler
+	random      *random
+	manualPeers *manualPeers
+	connRamp    *connRamp
+	outage      outage
+	heightDrops heightDrops
 }
 
 func InitPeerManager(localPeer *Peer, seeds []string) *PeerManager {
 	// Initiate PeerManager
 	pm = new(PeerManager)
-	pm.Peers = newPeers(localPeer)
-	pm.addrManager = newAddrManager(seeds)
+	pm.random = newRandom()
+	pm.manualPeers = newManualPeers()
+	pm.connRamp = newConnRamp()
+	pm.Peers = newPeers(localPeer, pm.random)
+	pm.addrManager = newAddrManager(seeds, pm.random)
 	pm.connManager = newConnManager(pm.OnDiscardAddr)
+	pm.peerEvents = newPeerEvents()
+	pm.msgPool = newMsgPool(MessageWorkers, pm.handleMessage)
+	pm.messages = newMessages()
+	pm.registerMessages()
 	return pm
 }
 
+// Replace the source of randomness used to choose addresses to connect and the sync peer,
+// with a seeded source, peer selection will be deterministic for tests.
+func (pm *PeerManager) SetRandSource(src rand.Source) {
+	pm.random.setSource(src)
+}
+
 func (pm *PeerManager) SetMessageHandler(msgHandler MessageHandler) {
 	pm.msgHandler = msgHandler
 }
 
+// Get the number of inbound messages waiting or being handled
+func (pm *PeerManager) MessageQueueDepth() int {
+	return pm.msgPool.QueueDepth()
+}
+
+// Register a listener to receive peer connected, disconnected and banned events,
+// events are delivered in order on a separate goroutine.
+func (pm *PeerManager) OnPeerEvent(listener func(PeerEvent)) {
+	pm.peerEvents.addListener(listener)
+}
+
 func (pm *PeerManager) Start() {
 	log.Info("PeerManager start")
 	go pm.keepConnections()
 	go pm.listenConnection()
+	if SeedRefreshInterval > 0 {
+		go pm.refreshSeeds()
+	}
 }
 
+// Manual peers are in reserved slots, they are not counted
 func (pm *PeerManager) NeedMorePeers() bool {
-	return pm.PeersCount() < MinConnCount
+	target, _ := pm.connRamp.Target()
+	return pm.autoPeersCount() < target
 }
 
 func (pm *PeerManager) ConnectPeer(addr string) {
@@ -72,20 +115,29 @@ func (pm *PeerManager) ConnectPeer(addr string) {
 }
 
 func (pm *PeerManager) AddConnectedPeer(peer *Peer) {
+	addr := peer.Addr().String()
+	peer.manual = pm.manualPeers.contains(addr)
+
 	log.Trace("PeerManager add connected peer:", peer)
 	// Add peer to list
 	pm.Peers.AddPeer(peer)
 
-	addr := peer.Addr().String()
-
 	// Remove addr from connecting list
 	pm.connManager.removeAddrFromConnectingList(addr)
 
 	// Mark addr as connected
 	pm.addrManager.AddAddr(addr)
+
+	pm.updateOutage()
+	pm.peerEvents.fire(PeerConnected, addr, "")
 }
 
 func (pm *PeerManager) DisconnectPeer(peer *Peer) {
+	pm.DisconnectPeerWithReason(peer, "")
+}
+
+// Disconnect the peer, the reason will be passed to the peer disconnected event
+func (pm *PeerManager) DisconnectPeerWithReason(peer *Peer, reason string) {
 	if peer == nil {
 		return
 	}
@@ -96,6 +148,9 @@ func (pm *PeerManager) DisconnectPeer(peer *Peer) {
 		peer.Disconnect()
 		pm.connManager.removeAddrFromConnectingList(addr)
 		pm.addrManager.DisconnectedAddr(addr)
+
+		pm.updateOutage()
+		pm.peerEvents.fire(PeerDisconnected, addr, reason)
 	}
 }
 
@@ -103,6 +158,12 @@ func (pm *PeerManager) OnDiscardAddr(addr string) {
 	pm.addrManager.DiscardAddr(addr)
 }
 
+// Discard the address of a peer not to be connected again, and fire the peer banned event
+func (pm *PeerManager) BanAddr(addr, reason string) {
+	pm.addrManager.DiscardAddr(addr)
+	pm.peerEvents.fire(PeerBanned, addr, reason)
+}
+
 func (pm *PeerManager) RandAddrs() []Addr {
 	peers := pm.ConnectedPeers()
 
@@ -123,7 +184,12 @@ func (pm *PeerManager) RandAddrs() []Addr {
 
 func (pm *PeerManager) connectPeers() {
 	if pm.NeedMorePeers() {
-		addrs := pm.addrManager.GetIdleAddrs(MaxOutboundCount)
+		count := MaxOutboundCount
+		// Connect only the missing peers during the connection ramp
+		if target, ramping := pm.connRamp.Target(); ramping {
+			count = target - pm.autoPeersCount()
+		}
+		addrs := pm.addrManager.GetIdleAddrs(count)
 		for _, addr := range addrs {
 			go pm.ConnectPeer(addr)
 		}
@@ -133,10 +199,12 @@ func (pm *PeerManager) connectPeers() {
 func (pm *PeerManager) keepConnections() {
 	pm.connectPeers()
 
-	ticker := time.NewTicker(time.Second * InfoUpdateDuration)
-	defer ticker.Stop()
-	for range ticker.C {
+	timer := time.NewTimer(pm.connectInterval())
+	defer timer.Stop()
+	for range timer.C {
+		pm.connectManualPeers()
 		pm.connectPeers()
+		timer.Reset(pm.connectInterval())
 	}
 }
 
@@ -158,44 +226,64 @@ func (pm *PeerManager) listenConnection() {
 
 		peer := NewPeer(conn)
 		go peer.Read()
+
+		pm.waitHandshake(peer)
 	}
 }
 
+// Disconnect the peer if it does not complete the handshake in HandshakeTimeout,
+// so peers stalled in handshake will not occupy the connection slots.
+// HANDSHAKE and HANDSHAKED are the states that version exchanged and waiting for verack.
+func (pm *PeerManager) waitHandshake(peer *Peer) {
+	time.AfterFunc(time.Second*time.Duration(HandshakeTimeout), func() {
+		switch peer.State() {
+		case ESTABLISH, INACTIVITY:
+			return
+		}
+
+		pm.disconnectUnestablished(peer, "handshake timeout")
+	})
+}
+
+// A message command neither the peer manager nor the message handler supports
+type unsupportedMessageError struct {
+	err error
+}
+
+func (e *unsupportedMessageError) Error() string {
+	return e.err.Error()
+}
+
 func (pm *PeerManager) makeMessage(cmd string) (Message, error) {
-	var msg Message
-	switch cmd {
-	case "version":
-		msg = new(Version)
-	case "verack":
-		msg = new(VerAck)
-	case "getaddr":
-		msg = new(AddrsReq)
-	case "addr":
-		msg = new(Addrs)
-	default:
-		return pm.msgHandler.MakeMessage(cmd)
+	if msgType, ok := pm.messages.get(cmd); ok {
+		return msgType.factory(), nil
+	}
+	msg, err := pm.msgHandler.MakeMessage(cmd)
+	if err != nil {
+		return nil, &unsupportedMessageError{err: err}
 	}
-
 	return msg, nil
 }
 
 func (pm *PeerManager) handleMessage(peer *Peer, msg Message) {
 	var err error
-	switch msg := msg.(type) {
-	case *Version:
-		err = pm.OnVersion(peer, msg)
-	case *VerAck:
-		err = pm.OnVerAck(peer, msg)
-	case *AddrsReq:
-		err = pm.OnAddrsReq(peer, msg)
-	case *Addrs:
-		err = pm.OnAddrs(peer, msg)
-	default:
+	msgType, ok := pm.messages.get(msg.CMD())
+
+	// Messages other than handshake must come after the handshake completed,
+	// a peer sends them in the wrong state is not following the protocol.
+	if (!ok || !msgType.handshake) && peer.State() != ESTABLISH {
+		err = fmt.Errorf("receive message %s before handshake completed", msg.CMD())
+		if peer.State() != INACTIVITY {
+			pm.disconnectUnestablished(peer, "message before handshake completed")
+		}
+	} else if ok {
+		err = msgType.handler(peer, msg)
+	} else {
 		err = pm.msgHandler.HandleMessage(peer, msg)
 	}
 
 	if err != nil {
-		log.Error("Handle message error,", err)
+		log.ErrorLimited("handle message", "Handle message error,", err)
 	}
 }
 
@@ -203,7 +291,7 @@ func (pm *PeerManager) OnVersion(peer *Peer, v *Version) error {
 	// Check if handshake with itself
 	if v.Nonce == pm.Local().ID() {
 		log.Error("SPV disconnect peer, peer handshake with itself")
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, "handshake with itself")
 		pm.OnDiscardAddr(peer.Addr().String())
 		return errors.New("Peer handshake with itself")
 	}
@@ -227,7 +315,7 @@ func (pm *PeerManager) OnVersion(peer *Peer, v *Version) error {
 
 	// Handle peer handshake
 	if err := pm.msgHandler.OnHandshake(v); err != nil {
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, err.Error())
 		return err
 	}
 
@@ -256,12 +344,13 @@ func (pm *PeerManager) OnVerAck(peer *Peer, va *VerAck) error {
 
 	peer.SetState(ESTABLISH)
 
+	// Notify peer connected before adding it to connected peers, so the messages sent on establish,
+	// like filterload, go before any data request from the sync or broadcast of others
+	pm.msgHandler.OnPeerEstablish(peer)
+
 	// Add to connected peer
 	pm.AddConnectedPeer(peer)
 
-	// Notify peer connected
-	pm.msgHandler.OnPeerEstablish(peer)
-
 	if pm.NeedMorePeers() {
 		go peer.Send(new(AddrsReq))
 	}
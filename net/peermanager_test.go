@@ -0,0 +1,407 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+	. "github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+type testConn struct {
+	net.Conn
+}
+
+func (conn *testConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 20866}
+}
+
+type testMsgHandler struct {
+	handled     []Message
+	onEstablish func(*Peer)
+}
+
+func (h *testMsgHandler) MakeMessage(cmd string) (Message, error) {
+	return nil, errors.New("unsupported message " + cmd)
+}
+
+func (h *testMsgHandler) OnHandshake(v *Version) error { return nil }
+
+func (h *testMsgHandler) OnPeerEstablish(peer *Peer) {
+	if h.onEstablish != nil {
+		h.onEstablish(peer)
+	}
+}
+
+func (h *testMsgHandler) HandleMessage(peer *Peer, msg Message) error {
+	h.handled = append(h.handled, msg)
+	return nil
+}
+
+func newTestPeer(id uint64) *Peer {
+	conn, _ := net.Pipe()
+	peer := NewPeer(&testConn{Conn: conn})
+	peer.SetID(id)
+	peer.SetServices(serviceSPV)
+	return peer
+}
+
+func newTestPeerManager() (*PeerManager, *testMsgHandler) {
+	log.Init()
+	handler := new(testMsgHandler)
+	pm := InitPeerManager(new(Peer), nil)
+	pm.SetMessageHandler(handler)
+	return pm, handler
+}
+
+func TestPeerManager_HandleMessageBeforeHandshake(t *testing.T) {
+	pm, handler := newTestPeerManager()
+
+	for _, state := range []uint{INIT, HAND, HANDSHAKE, HANDSHAKED} {
+		// The address messages are application data, not part of the handshake
+		for _, message := range []Message{new(Ping), new(AddrsReq), new(Addrs)} {
+			peer := newTestPeer(1)
+			peer.SetState(state)
+
+			pm.handleMessage(peer, message)
+			if len(handler.handled) != 0 {
+				t.Fatalf("message %s handled from peer in state %d", message.CMD(), state)
+			}
+			if peer.State() != INACTIVITY {
+				t.Errorf("peer in state %d not disconnected on message %s", state, message.CMD())
+			}
+		}
+	}
+
+	peer := newTestPeer(2)
+	peer.SetState(ESTABLISH)
+	pm.handleMessage(peer, new(Ping))
+	if len(handler.handled) != 1 {
+		t.Errorf("message from established peer not handled")
+	}
+}
+
+func TestPeerManager_Misbehaved(t *testing.T) {
+	pm, _ := newTestPeerManager()
+
+	peer := newTestPeer(1)
+	peer.SetState(ESTABLISH)
+	pm.AddPeer(peer)
+
+	for i := int32(1); i < MaxMisbehaviors; i++ {
+		pm.Misbehaved(peer, "unsolicited data")
+		if !pm.Exist(peer) {
+			t.Fatalf("peer banned after %d misbehaviors", i)
+		}
+	}
+
+	pm.Misbehaved(peer, "unsolicited data")
+	if pm.Exist(peer) {
+		t.Error("peer not banned after MaxMisbehaviors")
+	}
+	if peer.State() != INACTIVITY {
+		t.Error("banned peer not disconnected")
+	}
+}
+
+func TestPeerManager_ManualPeers(t *testing.T) {
+	pm, _ := newTestPeerManager()
+
+	// Manual peers are in reserved slots
+	for i := 0; i < MaxManualPeers; i++ {
+		peer := newTestPeer(uint64(i + 1))
+		peer.manual = true
+		peer.SetState(ESTABLISH)
+		pm.AddPeer(peer)
+	}
+	for i := 0; i < MinConnCount-1; i++ {
+		peer := newTestPeer(uint64(MaxManualPeers + i + 1))
+		peer.SetState(ESTABLISH)
+		pm.AddPeer(peer)
+	}
+	if !pm.NeedMorePeers() {
+		t.Error("manual peers counted in auto connect slots")
+	}
+
+	for i := 0; i < MaxManualPeers; i++ {
+		pm.manualPeers.addrs[fmt.Sprint("127.0.0.1:", i+1)] = true
+	}
+	if err := pm.AddManualPeer("127.0.0.1:20866"); err == nil {
+		t.Errorf("manual peers added beyond limit %d", MaxManualPeers)
+	}
+	if len(pm.ManualPeers()) != MaxManualPeers {
+		t.Errorf("manual peers count %d, expect %d", len(pm.ManualPeers()), MaxManualPeers)
+	}
+}
+
+func TestPeerManager_ConnRamp(t *testing.T) {
+	ConnRampStart = 2
+	defer func() { ConnRampStart = 0 }()
+	pm, _ := newTestPeerManager()
+
+	for i := 0; i < ConnRampStart; i++ {
+		peer := newTestPeer(uint64(i + 1))
+		peer.SetState(ESTABLISH)
+		pm.AddPeer(peer)
+	}
+	if pm.NeedMorePeers() {
+		t.Fatal("more peers needed before sync proves stable")
+	}
+
+	// Continuous progress for an interval connects one more peer
+	interval := time.Duration(ConnRampInterval) * time.Second
+	now := time.Now()
+	pm.connRamp.progressed(now)
+	pm.connRamp.progressed(now.Add(interval / 2))
+	if pm.NeedMorePeers() {
+		t.Fatal("more peers needed before interval elapsed")
+	}
+	pm.connRamp.progressed(now.Add(interval))
+	if target, _ := pm.connRamp.Target(); target != ConnRampStart+1 {
+		t.Fatalf("connection target %d, expect %d", target, ConnRampStart+1)
+	}
+
+	// Progress after a stall starts counting again
+	now = now.Add(interval * 3)
+	pm.connRamp.progressed(now)
+	pm.connRamp.progressed(now.Add(interval / 2))
+	if target, _ := pm.connRamp.Target(); target != ConnRampStart+1 {
+		t.Fatalf("connection target %d after stall, expect %d", target, ConnRampStart+1)
+	}
+
+	pm.SyncFinished()
+	if target, ramping := pm.connRamp.Target(); ramping || target != MinConnCount {
+		t.Errorf("connection target %d after sync finished, expect %d", target, MinConnCount)
+	}
+	if !pm.NeedMorePeers() {
+		t.Error("no more peers needed after sync finished")
+	}
+}
+
+func TestPeerManager_EstablishBeforeConnected(t *testing.T) {
+	pm, handler := newTestPeerManager()
+
+	var sent []string
+	// Data requests are sent to the connected peers
+	requestData := func(id uint64) {
+		for _, peer := range pm.ConnectedPeers() {
+			if peer.ID() == id {
+				sent = append(sent, "getdata")
+			}
+		}
+	}
+	handler.onEstablish = func(peer *Peer) {
+		requestData(peer.ID())
+		sent = append(sent, "filterload")
+	}
+
+	peer := newTestPeer(1)
+	peer.SetState(HANDSHAKED)
+	if err := pm.OnVerAck(peer, new(VerAck)); err != nil {
+		t.Fatal(err)
+	}
+	requestData(peer.ID())
+
+	if len(sent) != 2 || sent[0] != "filterload" || sent[1] != "getdata" {
+		t.Errorf("messages sent %v, expect filterload before getdata", sent)
+	}
+}
+
+func TestPeerManager_NetworkOutage(t *testing.T) {
+	pm, _ := newTestPeerManager()
+
+	lost := make(chan struct{}, 2)
+	restored := make(chan time.Duration, 2)
+	pm.OnNetworkLost(func() { lost <- struct{}{} })
+	pm.OnNetworkRestored(func(duration time.Duration) { restored <- duration })
+
+	peer1, peer2 := newTestPeer(1), newTestPeer(2)
+	pm.AddConnectedPeer(peer1)
+	pm.AddConnectedPeer(peer2)
+
+	// Not lost until the last peer disconnected
+	pm.DisconnectPeer(peer1)
+	if pm.IsNetworkLost() {
+		t.Fatal("network lost with a peer connected")
+	}
+	pm.DisconnectPeer(peer2)
+	if !pm.IsNetworkLost() {
+		t.Fatal("network not lost after all peers disconnected")
+	}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("network lost listener not notified")
+	}
+
+	OutageReconnectInterval = 1
+	defer func() { OutageReconnectInterval = 0 }()
+	if interval := pm.connectInterval(); interval != time.Second {
+		t.Errorf("connect interval %s during outage, expect 1s", interval)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	pm.AddConnectedPeer(newTestPeer(3))
+	if pm.IsNetworkLost() {
+		t.Error("network still lost after a peer connected")
+	}
+	select {
+	case duration := <-restored:
+		if duration < 10*time.Millisecond {
+			t.Errorf("outage duration %s, expect at least 10ms", duration)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("network restored listener not notified")
+	}
+	if interval := pm.connectInterval(); interval != time.Second*InfoUpdateDuration {
+		t.Errorf("connect interval %s after outage, expect %ds", interval, InfoUpdateDuration)
+	}
+}
+
+func TestPeerManager_UpdatePeerHeight(t *testing.T) {
+	defer func(max uint64) { MaxHeightDrop = max }(MaxHeightDrop)
+	MaxHeightDrop = 10
+
+	pm, _ := newTestPeerManager()
+	drops := make(chan uint64, 10)
+	pm.OnHeightDrop(func(peer *Peer, drop uint64) {
+		drops <- drop
+	})
+
+	peer := newTestPeer(1)
+	peer.SetHeight(100)
+	expectDrop := func(expect uint64) {
+		select {
+		case drop := <-drops:
+			if drop != expect {
+				t.Errorf("height dropped by %d, expect %d", drop, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("height drop not notified")
+		}
+	}
+
+	// Growing height
+	pm.UpdatePeerHeight(peer, 101)
+	pm.UpdatePeerHeight(peer, 102)
+	if peer.Height() != 102 {
+		t.Errorf("peer height %d, expect 102", peer.Height())
+	}
+
+	// A reorganize on the peer side
+	pm.UpdatePeerHeight(peer, 99)
+	expectDrop(3)
+	if peer.Misbehaviors() != 0 {
+		t.Error("small height drop scored as misbehaving")
+	}
+
+	// The drop is measured from the highest recent height
+	pm.UpdatePeerHeight(peer, 90)
+	expectDrop(12)
+	if peer.Misbehaviors() != 1 {
+		t.Errorf("misbehaviors %d after large height drop, expect 1", peer.Misbehaviors())
+	}
+
+	select {
+	case drop := <-drops:
+		t.Errorf("unexpected height drop %d", drop)
+	default:
+	}
+}
+
+func TestPeer_ReadGarbage(t *testing.T) {
+	pm, _ := newTestPeerManager()
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	hostile := NewPeer(&testConn{Conn: local})
+	hostile.SetID(1)
+	hostile.SetState(ESTABLISH)
+	pm.AddConnectedPeer(hostile)
+
+	other := newTestPeer(2)
+	other.SetState(ESTABLISH)
+	pm.AddConnectedPeer(other)
+
+	done := make(chan struct{})
+	go func() {
+		hostile.Read()
+		close(done)
+	}()
+	go remote.Write([]byte("garbage bytes, not a message header of the protocol"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read loop not stopped by garbage")
+	}
+	if hostile.State() != INACTIVITY {
+		t.Error("peer sent garbage not disconnected")
+	}
+	if other.State() != ESTABLISH || !pm.Exist(other) {
+		t.Error("other peer affected by garbage")
+	}
+}
+
+func TestPeer_OnDecodeErrorUnsupported(t *testing.T) {
+	pm, _ := newTestPeerManager()
+	peer := newTestPeer(1)
+	peer.SetState(ESTABLISH)
+	pm.AddConnectedPeer(peer)
+
+	// Commands the client doesn't handle are valid messages of the protocol
+	for _, cmd := range []string{"reject", "getheaders", "mempool", "filteradd"} {
+		_, err := peer.OnMakeMessage(cmd)
+		if err == nil {
+			t.Fatalf("message %s made", cmd)
+		}
+		peer.OnDecodeError(err)
+	}
+	if peer.Misbehaviors() != 0 {
+		t.Errorf("misbehaviors %d after unsupported messages, expect 0", peer.Misbehaviors())
+	}
+
+	peer.OnDecodeError(errors.New("invalid payload"))
+	if peer.Misbehaviors() != 1 {
+		t.Errorf("misbehaviors %d after malformed message, expect 1", peer.Misbehaviors())
+	}
+}
+
+func TestPeer_OnDecodeErrorDisconnected(t *testing.T) {
+	pm, _ := newTestPeerManager()
+	reasons := make(chan string, 2)
+	pm.OnPeerEvent(func(event PeerEvent) {
+		if event.Type == PeerDisconnected {
+			reasons <- event.Reason
+		}
+	})
+
+	// Disconnected by us, the read loop stops with the connection closed
+	local := newTestPeer(1)
+	local.SetState(ESTABLISH)
+	pm.AddConnectedPeer(local)
+	local.Disconnect()
+	local.OnDecodeError(ErrDisconnected)
+
+	// Disconnected by the remote peer
+	remote := newTestPeer(2)
+	remote.SetState(ESTABLISH)
+	pm.AddConnectedPeer(remote)
+	remote.OnDecodeError(ErrDisconnected)
+
+	for _, expect := range []string{"disconnected locally", "connection closed"} {
+		select {
+		case reason := <-reasons:
+			if reason != expect {
+				t.Errorf("disconnected reason %q, expect %q", reason, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("peer disconnected event %q not fired", expect)
+		}
+	}
+}
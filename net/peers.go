@@ -6,6 +6,10 @@ import (
 	. "github.com/elastos/Elastos.ELA.Utility/p2p"
 )
 
+// The SPV service bit of the version message services, same as sdk.ServiveSPV. Only peers advertising
+// it can be the sync peer, the SPV clients accepted as downstream peers in server mode do not.
+const serviceSPV = 1 << 2
+
 type Peers struct {
 	syncPeerLock *sync.Mutex
 	syncPeer     *Peer
@@ -13,11 +17,14 @@ type Peers struct {
 	peersLock *sync.RWMutex
 	local     *Peer
 	peers     map[uint64]*Peer
+
+	random *random
 }
 
-func newPeers(localPeer *Peer) *Peers {
+func newPeers(localPeer *Peer, random *random) *Peers {
 	peers := new(Peers)
 	peers.local = localPeer
+	peers.random = random
 	peers.syncPeerLock = new(sync.Mutex)
 	peers.peersLock = new(sync.RWMutex)
 	peers.peers = make(map[uint64]*Peer)
@@ -95,20 +102,32 @@ func (p *Peers) GetBestPeer() *Peer {
 }
 
 func (p *Peers) getBestPeer() *Peer {
-	var bestPeer *Peer
+	// Peers with the same height are chosen randomly
+	peers := make([]*Peer, 0, len(p.peers))
 	for _, peer := range p.peers {
+		peers = append(peers, peer)
+	}
+	p.random.shufflePeers(peers)
+
+	var bestPeer *Peer
+	for _, peer := range peers {
 
 		// Skip unestablished peer
 		if peer.State() != ESTABLISH {
 			continue
 		}
 
+		// Skip peer can not serve the chain
+		if peer.Services()&serviceSPV == 0 {
+			continue
+		}
+
 		if bestPeer == nil {
 			bestPeer = peer
 			continue
 		}
 
-		if peer.height > bestPeer.height {
+		if peer.Height() > bestPeer.Height() {
 			bestPeer = peer
 		}
 	}
@@ -136,6 +155,34 @@ func (p *Peers) Broadcast(msg Message) {
 	}
 }
 
+// Broadcast the message to count randomly chosen established relay peers,
+// all of them if count is 0, return the peers the message is sent to
+func (p *Peers) BroadcastTo(msg Message, count int) []*Peer {
+	peers := p.fanoutPeers(count)
+	for _, peer := range peers {
+		go peer.Send(msg)
+	}
+	return peers
+}
+
+func (p *Peers) fanoutPeers(count int) []*Peer {
+	p.peersLock.RLock()
+	defer p.peersLock.RUnlock()
+
+	peers := make([]*Peer, 0, len(p.peers))
+	for _, peer := range p.peers {
+		if peer.State() != ESTABLISH || peer.Relay() == 0 {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	if count <= 0 || count >= len(peers) {
+		return peers
+	}
+	p.random.shufflePeers(peers)
+	return peers[:count]
+}
+
 func (p *Peers) SetSyncPeer(peer *Peer) {
 	p.syncPeerLock.Lock()
 	defer p.syncPeerLock.Unlock()
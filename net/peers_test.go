@@ -0,0 +1,141 @@
+package net
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+func newTestPeers(seed int64) *Peers {
+	random := newRandom()
+	random.setSource(rand.NewSource(seed))
+	peers := newPeers(new(Peer), random)
+	for i := 0; i < 10; i++ {
+		peer := new(Peer)
+		peer.SetID(uint64(i + 1))
+		peer.SetHeight(100)
+		peer.SetServices(serviceSPV)
+		peer.SetState(ESTABLISH)
+		peers.AddPeer(peer)
+	}
+	return peers
+}
+
+func TestPeers_GetBestPeerDeterministic(t *testing.T) {
+	for seed := int64(0); seed < 5; seed++ {
+		best := newTestPeers(seed).GetBestPeer()
+		for i := 0; i < 10; i++ {
+			peer := newTestPeers(seed).GetBestPeer()
+			if peer.ID() != best.ID() {
+				t.Fatalf("seed %d best peer %d, expect %d", seed, peer.ID(), best.ID())
+			}
+		}
+	}
+
+	// The highest peer is always chosen
+	peers := newTestPeers(0)
+	peer := new(Peer)
+	peer.SetID(100)
+	peer.SetHeight(101)
+	peer.SetServices(serviceSPV)
+	peer.SetState(ESTABLISH)
+	peers.AddPeer(peer)
+	if best := peers.GetBestPeer(); best.ID() != peer.ID() {
+		t.Errorf("best peer %d, expect %d", best.ID(), peer.ID())
+	}
+
+	// A downstream SPV client without the SPV service is never chosen
+	client := new(Peer)
+	client.SetID(200)
+	client.SetHeight(200)
+	client.SetState(ESTABLISH)
+	peers.AddPeer(client)
+	if best := peers.GetBestPeer(); best.ID() != peer.ID() {
+		t.Errorf("best peer %d without the SPV service, expect %d", best.ID(), peer.ID())
+	}
+}
+
+func TestAddrManager_GetIdleAddrsDeterministic(t *testing.T) {
+	seeds := []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3", "127.0.0.1:4", "127.0.0.1:5"}
+	getIdleAddrs := func() []string {
+		random := newRandom()
+		random.setSource(rand.NewSource(1))
+		return newAddrManager(seeds, random).GetIdleAddrs(3)
+	}
+
+	addrs := getIdleAddrs()
+	if len(addrs) != 3 {
+		t.Fatalf("idle addrs count %d, expect 3", len(addrs))
+	}
+	for i := 0; i < 10; i++ {
+		if other := getIdleAddrs(); !reflect.DeepEqual(addrs, other) {
+			t.Fatalf("idle addrs %v, expect %v", other, addrs)
+		}
+	}
+}
+
+func TestAddrManager_GetIdleAddrsLastPeers(t *testing.T) {
+	ReconnectLastPeers = true
+	defer func() { ReconnectLastPeers = false }()
+
+	seeds := []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}
+	am := newAddrManager(seeds, newRandom())
+	am.cached = []string{"127.0.0.1:4", "127.0.0.1:5", "127.0.0.1:6"}
+
+	now := time.Now()
+	am.stats["127.0.0.1:4"] = &addrStat{lastSeen: now.Add(-time.Hour * 24), successes: 10}
+	am.stats["127.0.0.1:5"] = &addrStat{lastSeen: now, successes: 3}
+	am.stats["127.0.0.1:6"] = &addrStat{lastSeen: now.Add(-time.Hour), successes: 1}
+
+	expect := []string{"127.0.0.1:5", "127.0.0.1:6", "127.0.0.1:4"}
+	for i := 0; i < 10; i++ {
+		if addrs := am.GetIdleAddrs(3); !reflect.DeepEqual(addrs, expect) {
+			t.Fatalf("idle addrs %v, expect %v", addrs, expect)
+		}
+	}
+
+	// Connected peers are skipped, seeds fill the rest
+	am.connected["127.0.0.1:5"] = 'c'
+	addrs := am.GetIdleAddrs(3)
+	if addrs[0] != "127.0.0.1:6" || addrs[1] != "127.0.0.1:4" || !am.isSeed(addrs[2]) {
+		t.Errorf("idle addrs %v, expect good peers before seeds", addrs)
+	}
+}
+
+func TestPeers_BroadcastFanout(t *testing.T) {
+	peers := newTestPeers(1)
+	for _, peer := range peers.ConnectedPeers() {
+		peer.SetRelay(1)
+	}
+	// Peers not relaying transactions or not established are not chosen
+	quiet := new(Peer)
+	quiet.SetID(11)
+	quiet.SetState(ESTABLISH)
+	peers.AddPeer(quiet)
+	connecting := new(Peer)
+	connecting.SetID(12)
+	connecting.SetRelay(1)
+	peers.AddPeer(connecting)
+
+	chosen := peers.fanoutPeers(3)
+	if len(chosen) != 3 {
+		t.Fatalf("broadcast to %d peers, expect 3", len(chosen))
+	}
+	seen := make(map[uint64]bool)
+	for _, peer := range chosen {
+		if peer.ID() > 10 || seen[peer.ID()] {
+			t.Errorf("unexpected peer %d chosen in %v", peer.ID(), chosen)
+		}
+		seen[peer.ID()] = true
+	}
+
+	// 0 or more than the peers broadcasts to all relay peers
+	for _, count := range []int{0, 20} {
+		if chosen := peers.fanoutPeers(count); len(chosen) != 10 {
+			t.Errorf("fanout %d broadcasts to %d peers, expect 10", count, len(chosen))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The source of randomness used to order idle addresses and peers,
+// replace it by PeerManager.SetRandSource to make peer selection deterministic in tests.
+type random struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+func newRandom() *random {
+	return &random{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (r *random) setSource(src rand.Source) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.rand = rand.New(src)
+}
+
+func (r *random) shuffle(n int, swap func(i, j int)) {
+	r.Lock()
+	defer r.Unlock()
+
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.rand.Intn(i+1))
+	}
+}
+
+// Shuffle the addresses, they are sorted first so the result only depends on the source
+func (r *random) shuffleAddrs(addrs []string) {
+	sort.Strings(addrs)
+	r.shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+}
+
+// Shuffle the peers, they are sorted by ID first so the result only depends on the source
+func (r *random) shufflePeers(peers []*Peer) {
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID() < peers[j].ID()
+	})
+	r.shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+}
@@ -0,0 +1,64 @@
+package net
+
+import (
+	"net"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Seconds between resolving the host names of the seeds again, the resolved addresses are
+// added to the cached addresses, so the peers behind a seed are still known if the DNS fails later.
+// 0 to disable.
+var SeedRefreshInterval uint32 = 0
+
+func (pm *PeerManager) refreshSeeds() {
+	ticker := time.NewTicker(time.Second * time.Duration(SeedRefreshInterval))
+	defer ticker.Stop()
+	for range ticker.C {
+		pm.addrManager.resolveSeeds()
+	}
+}
+
+// Resolve the seeds in host name format and add the addresses not known yet to the cached
+// addresses, return the number of addresses added
+func (am *AddrManager) resolveSeeds() int {
+	am.RLock()
+	seeds := make([]string, len(am.seeds))
+	copy(seeds, am.seeds)
+	am.RUnlock()
+
+	// Resolve without holding the lock, a lookup may take a long time
+	var resolved []string
+	for _, seed := range seeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+		hosts, err := lookupHost(host)
+		if err != nil {
+			log.Debugf("Resolve seed %s failed, %s", seed, err)
+			continue
+		}
+		for _, host := range hosts {
+			resolved = append(resolved, net.JoinHostPort(host, port))
+		}
+	}
+
+	am.Lock()
+	defer am.Unlock()
+
+	var added int
+	for _, addr := range resolved {
+		if am.isSeed(addr) || am.isCached(addr) {
+			continue
+		}
+		am.cached = append(am.cached, addr)
+		added++
+	}
+	if added > 0 {
+		log.Infof("AddrManager added %d addresses resolved from seeds", added)
+		am.saveCached()
+	}
+	return added
+}
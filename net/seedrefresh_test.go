@@ -0,0 +1,64 @@
+package net
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+func TestAddrManager_ResolveSeeds(t *testing.T) {
+	log.Init()
+
+	// The resolved addresses are saved to the cache file in the working directory
+	dir, err := ioutil.TempDir("", "seedrefresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(lookup func(string) ([]string, error)) {
+		lookupHost = lookup
+	}(lookupHost)
+
+	var lookups []string
+	lookupHost = func(host string) ([]string, error) {
+		lookups = append(lookups, host)
+		switch host {
+		case "seed.example.org":
+			return []string{"1.1.1.1", "::1", "3.3.3.3"}, nil
+		default:
+			return nil, errors.New("no such host")
+		}
+	}
+
+	am := newAddrManager([]string{"seed.example.org:20866", "3.3.3.3:20866", "down.example.org:20866"}, newRandom())
+	am.cached = append(am.cached, "1.1.1.1:20866")
+
+	// IP seeds are not resolved, known addresses and failed lookups are skipped
+	if added := am.resolveSeeds(); added != 1 {
+		t.Errorf("added %d addresses, expect 1", added)
+	}
+	if expect := []string{"seed.example.org", "down.example.org"}; !reflect.DeepEqual(lookups, expect) {
+		t.Errorf("looked up %v, expect %v", lookups, expect)
+	}
+	if expect := []string{"1.1.1.1:20866", "[::1]:20866"}; !reflect.DeepEqual(am.cached, expect) {
+		t.Errorf("cached addresses %v, expect %v", am.cached, expect)
+	}
+
+	// Resolving again adds nothing new
+	if added := am.resolveSeeds(); added != 0 {
+		t.Errorf("added %d addresses again, expect 0", added)
+	}
+}
@@ -60,6 +60,9 @@ func (filter *AddrFilter) DeleteAddr(hash Uint168) {
 
 // Get addresses that were added into this Filter
 func (filter *AddrFilter) GetAddrs() []*Uint168 {
+	filter.Lock()
+	defer filter.Unlock()
+
 	var addrs = make([]*Uint168, 0, len(filter.addrs))
 	for _, addr := range filter.addrs {
 		addrs = append(addrs, addr)
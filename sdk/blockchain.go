@@ -2,16 +2,18 @@ package sdk
 
 import (
 	"errors"
-	"math/big"
 	"fmt"
+	"math/big"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/db"
 	"github.com/elastos/Elastos.ELA.SPV/log"
 
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 type ChainState int
@@ -25,8 +27,17 @@ const (
 	MaxBlockLocatorHashes = 100
 )
 
+var ErrHeaderNotFound = errors.New("[Blockchain], header not found")
+
 var PowLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
 
+var (
+	// A block timestamp must be greater than the median timestamp of this many previous blocks
+	MedianTimeBlocks = 11
+	// Seconds a block timestamp can be ahead of the network adjusted time
+	MaxFutureBlockTime uint32 = 2 * 60 * 60
+)
+
 /*
 StateListener is an interface to listen blockchain data change.
 Call AddStateListener() method to register your callbacks to the notify list.
@@ -50,10 +61,24 @@ Blockchain is the database of blocks, also when a new transaction or block commi
 Blockchain will verify them with stored blocks.
 */
 type Blockchain struct {
-	lock           *sync.RWMutex
-	state          ChainState
+	lock  *sync.RWMutex
+	state ChainState
 	db.DataStore
 	stateListeners []StateListener
+	processors     []func(block *bloom.MerkleBlock, txs []Transaction) error
+	reorgListeners []func(detached, attached []Uint256, commonAncestor uint32)
+
+	// The number of reorganizes since created
+	reorgs int
+
+	// Reports the commits taking longer than CommitTimeout
+	watchdog commitWatchdog
+
+	// The number of blocks committed in the current batch, 0 if not batching
+	batched    int
+	batching   bool
+	batchStart time.Time
+	lastFlush  time.Time
 }
 
 // Create a instance of *Blockchain
@@ -67,15 +92,34 @@ func NewBlockchain(dataStore db.DataStore) (*Blockchain, error) {
 
 // Register a blockchain state listener, multiple registration is supported.
 func (bc *Blockchain) AddStateListener(listener StateListener) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
 	bc.stateListeners = append(bc.stateListeners, listener)
 }
 
 // Close the blockchain
 func (bc *Blockchain) Close() {
 	bc.lock.Lock()
+	bc.commitBatch()
 	bc.DataStore.Close()
 }
 
+/*
+Register a block processor to inspect the block and the matched transactions before they are committed.
+Processors are called in the order registered, if a processor returns an error, the block
+is not committed and CommitBlock returns the error, then the SPV service will restart sync with
+another peer, so the block will be downloaded again.
+Processors are called while holding the blockchain lock, they must return fast and
+must not call Blockchain methods, or the sync will be slowed down or blocked.
+*/
+func (bc *Blockchain) RegisterBlockProcessor(processor func(block *bloom.MerkleBlock, txs []Transaction) error) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.processors = append(bc.processors, processor)
+}
+
 // Set the current state of blockchain
 func (bc *Blockchain) SetChainState(state ChainState) {
 	bc.lock.Lock()
@@ -92,7 +136,7 @@ func (bc *Blockchain) IsSyncing() bool {
 	return bc.state == SYNCING
 }
 
-// Get current blockchain height
+// Get current blockchain height, it's safe to call concurrently with commits
 func (bc *Blockchain) Height() uint32 {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
@@ -100,7 +144,7 @@ func (bc *Blockchain) Height() uint32 {
 	return bc.DataStore.GetChainHeight()
 }
 
-// Get current blockchain tip
+// Get current blockchain tip, it's safe to call concurrently with commits
 func (bc *Blockchain) ChainTip() *db.StoreHeader {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
@@ -108,6 +152,11 @@ func (bc *Blockchain) ChainTip() *db.StoreHeader {
 	return bc.chainTip()
 }
 
+// Get the cumulative work of the headers on the best chain, the chain with the most work wins a reorganize
+func (bc *Blockchain) ChainWork() *big.Int {
+	return new(big.Int).Set(bc.ChainTip().TotalWork)
+}
+
 func (bc *Blockchain) chainTip() *db.StoreHeader {
 	tip, err := bc.GetChainTip()
 	if err != nil { // Empty blockchain, return empty header
@@ -116,13 +165,86 @@ func (bc *Blockchain) chainTip() *db.StoreHeader {
 	return tip
 }
 
+// Get the header on the best chain at the given height, from the height index if the DataStore
+// implements db.HeightIndex, or headers are walked back from the chain tip.
+func (bc *Blockchain) GetHeaderByHeight(height uint32) (*Header, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	if index, ok := bc.DataStore.(db.HeightIndex); ok {
+		header, err := index.HeaderAtHeight(height)
+		if err != nil {
+			return nil, ErrHeaderNotFound
+		}
+		return &header.Header, nil
+	}
+
+	header, err := bc.GetChainTip()
+	if err != nil || height == 0 || height > header.Height {
+		return nil, ErrHeaderNotFound
+	}
+	for header.Height > height {
+		header, err = bc.GetPrevious(header)
+		if err != nil {
+			return nil, ErrHeaderNotFound
+		}
+	}
+	return &header.Header, nil
+}
+
+// Get the stored header with the given hash, it may not be on the best chain
+func (bc *Blockchain) GetHeaderByHash(hash Uint256) (*Header, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	header, err := bc.GetHeader(hash)
+	if err != nil {
+		return nil, ErrHeaderNotFound
+	}
+	return &header.Header, nil
+}
+
+// Check if the header is the next block of current chain tip,
+// when the chain is empty, only the genesis block is the next block.
+func (bc *Blockchain) IsNextBlock(header *Header) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	tip, err := bc.GetChainTip()
+	if err != nil || tip == nil { // Empty blockchain
+		return header.Height == 1
+	}
+	return header.Previous.IsEqual(tip.Hash())
+}
+
+/*
+Get the height sync starts from, the blocks above it are requested from peers, 0 for an empty chain.
+It's the committed chain tip, including the headers imported by ImportHeaders. Checkpoints do not
+move the start, they only validate the blocks, as the blocks below them are still scanned for transactions.
+*/
+func (bc *Blockchain) SyncStartHeight() uint32 {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	start, err := bc.syncStart()
+	if err != nil {
+		return 0
+	}
+	return start.Height
+}
+
+// The header sync starts from, the block locator begins with it
+func (bc *Blockchain) syncStart() (*db.StoreHeader, error) {
+	return bc.GetChainTip()
+}
+
 // Create a block locator which is a array of block hashes stored in blockchain
 func (bc *Blockchain) GetBlockLocatorHashes() []*Uint256 {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
 
 	var ret []*Uint256
-	parent, err := bc.GetChainTip()
+	parent, err := bc.syncStart()
 	if err != nil { // No headers stored return empty locator
 		return ret
 	}
@@ -158,10 +280,20 @@ func (bc *Blockchain) GetBlockLocatorHashes() []*Uint256 {
 	return ret
 }
 
+// Run the function holding the blockchain read lock, no block or transaction is committed meanwhile,
+// so the function reads a consistent state of the data store. It must not call Blockchain methods.
+func (bc *Blockchain) View(fn func()) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	fn()
+}
+
 // Commit tx commits a transaction and return is false positive and error
 func (bc *Blockchain) CommitTx(tx Transaction) (bool, error) {
 	bc.lock.Lock()
 	defer bc.lock.Unlock()
+	defer bc.watchCommit(fmt.Sprint("transaction ", tx.Hash().String()))()
 
 	return bc.commitTx(tx, 0)
 }
@@ -170,10 +302,27 @@ func (bc *Blockchain) CommitTx(tx Transaction) (bool, error) {
 func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (bool, int, error) {
 	bc.lock.Lock()
 	defer bc.lock.Unlock()
+	defer bc.watchCommit(fmt.Sprint("block at height ", block.Header.Height))()
+
+	bc.beginBatch()
+	reorg, fPositives, err := bc.commitBlock(block, txs)
+	if err != nil {
+		return reorg, fPositives, err
+	}
+	// Only the blocks committed count to the batch
+	bc.batchCommitted()
+	return reorg, fPositives, nil
+}
 
+func (bc *Blockchain) commitBlock(block bloom.MerkleBlock, txs []Transaction) (bool, int, error) {
 	header := block.Header
 	commitHeader := &db.StoreHeader{Header: header}
 
+	// Blocks conflict with the checkpoints are not committed
+	if err := bc.CheckCheckpoint(header); err != nil {
+		return false, 0, err
+	}
+
 	// Get current chain tip
 	tip := bc.chainTip()
 	tipHash := tip.Hash()
@@ -199,6 +348,15 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 
 	log.Debug("Find parent header height: ", parentHeader.Height)
 
+	// Check the timestamp with the previous blocks, the genesis block has no previous blocks
+	if commitHeader.Height != 1 {
+		median := bc.medianTime(parentHeader)
+		if header.Timestamp <= median {
+			return false, 0, fmt.Errorf("[Blockchain], block timestamp %d is not after median time %d of previous blocks",
+				header.Timestamp, median)
+		}
+	}
+
 	// If this block is already the tip, return
 	if tipHash.IsEqual(header.Hash()) {
 		return false, 0, nil
@@ -211,6 +369,7 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 	// then we have a new best header. Update the chain tip and check for a reorg.
 	var reorg = false
 	var reorgPoint *db.StoreHeader
+	var detached, attached []Uint256
 	if cumulativeWork.Cmp(tip.TotalWork) == 1 {
 		newTip = true
 		// If this header is not extending the previous best header then we have a reorg.
@@ -221,6 +380,17 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 				log.Errorf("error calculating common ancestor: %s", err.Error())
 				return false, 0, err
 			}
+			if err := checkReorgPoint(tip, reorgPoint); err != nil {
+				return false, 0, err
+			}
+			detached, err = bc.branchHashes(tip, reorgPoint)
+			if err != nil {
+				return false, 0, err
+			}
+			attached, err = bc.branchHashes(commitHeader, reorgPoint)
+			if err != nil {
+				return false, 0, err
+			}
 			fmt.Printf("Reorganize At block %d, Wiped out %d blocks\n",
 				int(tip.Height), int(tip.Height-reorgPoint.Height))
 		}
@@ -239,9 +409,18 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 		if err != nil {
 			return reorg, 0, err
 		}
+		bc.reorgs++
+		bc.notifyReorg(detached, attached, reorgPoint.Height)
 		return true, 0, nil
 	}
 
+	// Let the block processors inspect the block before commit
+	for _, processor := range bc.processors {
+		if err := processor(&block, txs); err != nil {
+			return false, 0, fmt.Errorf("[Blockchain], block %s rejected by processor, %s", header.Hash().String(), err)
+		}
+	}
+
 	fPositives := 0
 	if newTip {
 		// Save transactions
@@ -399,6 +578,39 @@ func (bc *Blockchain) CheckProofOfWork(header Header) error {
 	return nil
 }
 
+// Check the block timestamp is not too far ahead of the network adjusted time now
+func (bc *Blockchain) CheckTimestamp(header Header, now time.Time) error {
+	maxTime := now.Add(time.Second * time.Duration(MaxFutureBlockTime))
+	if time.Unix(int64(header.Timestamp), 0).After(maxTime) {
+		return fmt.Errorf("[Blockchain], block timestamp %d is too far in the future", header.Timestamp)
+	}
+	return nil
+}
+
+// Get the median timestamp of the last MedianTimeBlocks blocks ending with the given header
+func (bc *Blockchain) medianTime(header *db.StoreHeader) uint32 {
+	timestamps := make([]uint32, 0, MedianTimeBlocks)
+	for header != nil && len(timestamps) < MedianTimeBlocks {
+		timestamps = append(timestamps, header.Timestamp)
+		if header.Height <= 1 {
+			break
+		}
+		previous, err := bc.GetPrevious(header)
+		if err != nil {
+			break
+		}
+		header = previous
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2]
+}
+
 func HashToBig(hash *Uint256) *big.Int {
 	// A Hash is in little-endian, but the big package wants the bytes in
 	// big-endian, so reverse them.
@@ -0,0 +1,733 @@
+package sdk
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// An in memory DataStore, the Blockchain lock is expected to protect it
+type testDataStore struct {
+	headers map[Uint256]*db.StoreHeader
+	tip     *db.StoreHeader
+	height  uint32
+}
+
+func newTestDataStore() *testDataStore {
+	return &testDataStore{headers: make(map[Uint256]*db.StoreHeader)}
+}
+
+func (store *testDataStore) PutHeader(header *db.StoreHeader, newTip bool) error {
+	store.headers[header.Hash()] = header
+	if newTip {
+		store.tip = header
+	}
+	return nil
+}
+
+func (store *testDataStore) GetPrevious(header *db.StoreHeader) (*db.StoreHeader, error) {
+	return store.GetHeader(header.Previous)
+}
+
+func (store *testDataStore) GetHeader(hash Uint256) (*db.StoreHeader, error) {
+	header, ok := store.headers[hash]
+	if !ok {
+		return nil, errors.New("header not found")
+	}
+	return header, nil
+}
+
+func (store *testDataStore) GetChainTip() (*db.StoreHeader, error) {
+	if store.tip == nil {
+		return nil, errors.New("empty chain")
+	}
+	return store.tip, nil
+}
+
+func (store *testDataStore) PutChainHeight(height uint32) { store.height = height }
+
+func (store *testDataStore) GetChainHeight() uint32 { return store.height }
+
+func (store *testDataStore) CommitTx(tx *db.StoreTx) (bool, error) { return false, nil }
+
+func (store *testDataStore) Rollback(height uint32) error { return nil }
+
+func (store *testDataStore) Reset() error { return nil }
+
+func (store *testDataStore) Close() {}
+
+// Run with -race to check the chain height and tip can be read while committing blocks
+func TestBlockchain_ConcurrentReadCommit(t *testing.T) {
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const blocks = 200
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint32
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				height := chain.Height()
+				if height < last {
+					t.Errorf("chain height decreased from %d to %d", last, height)
+					return
+				}
+				last = height
+				if tip := chain.ChainTip(); tip.TotalWork == nil {
+					t.Error("chain tip without total work")
+					return
+				}
+			}
+		}()
+	}
+
+	var previous Uint256
+	for height := uint32(1); height <= blocks; height++ {
+		block := bloom.MerkleBlock{Header: Header{
+			Previous:  previous,
+			Timestamp: height,
+			Bits:      0x1d00ffff,
+			Height:    height,
+		}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatalf("commit block at height %d failed, %s", height, err)
+		}
+		previous = block.Header.Hash()
+	}
+	close(done)
+	wg.Wait()
+
+	if chain.Height() != blocks {
+		t.Errorf("chain height %d, expect %d", chain.Height(), blocks)
+	}
+	if chain.ChainTip().TotalWork.Cmp(new(big.Int).Mul(CalcWork(0x1d00ffff), big.NewInt(blocks))) != 0 {
+		t.Error("unexpected chain tip total work")
+	}
+	if chain.ChainWork().Cmp(chain.ChainTip().TotalWork) != 0 {
+		t.Error("chain work not the total work of chain tip")
+	}
+}
+
+func TestBlockchain_IsNextBlock(t *testing.T) {
+	// Start from a truly empty store
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chain.Height() != 0 {
+		t.Errorf("empty chain height %d, expect 0", chain.Height())
+	}
+	if tip := chain.ChainTip(); tip == nil || tip.TotalWork == nil {
+		t.Fatal("empty chain tip must not be nil")
+	}
+
+	genesis := bloom.MerkleBlock{Header: Header{Bits: 0x1d00ffff, Height: 1}}
+	later := bloom.MerkleBlock{Header: Header{Previous: Uint256{1}, Bits: 0x1d00ffff, Height: 5}}
+	if !chain.IsNextBlock(&genesis.Header) {
+		t.Error("genesis block is not the next block of empty chain")
+	}
+	if chain.IsNextBlock(&later.Header) {
+		t.Error("block at height 5 is the next block of empty chain")
+	}
+
+	if _, _, err := chain.CommitBlock(genesis, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	next := bloom.MerkleBlock{Header: Header{Previous: genesis.Header.Hash(), Bits: 0x1d00ffff, Height: 2}}
+	if !chain.IsNextBlock(&next.Header) {
+		t.Error("block extends genesis is not the next block")
+	}
+	if chain.IsNextBlock(&later.Header) {
+		t.Error("block not extends chain tip is the next block")
+	}
+}
+
+func TestBlockchain_CheckTimestamp(t *testing.T) {
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Timestamps 100, 110, 120 ... the median of the last 11 blocks is 150 at height 11
+	var previous Uint256
+	for height := uint32(1); height <= 11; height++ {
+		block := bloom.MerkleBlock{Header: Header{
+			Previous:  previous,
+			Timestamp: 90 + height*10,
+			Bits:      0x1d00ffff,
+			Height:    height,
+		}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatalf("commit block at height %d failed, %s", height, err)
+		}
+		previous = block.Header.Hash()
+	}
+
+	for _, timestamp := range []uint32{0, 140, 150} {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: timestamp, Bits: 0x1d00ffff, Height: 12}}
+		if _, _, err := chain.CommitBlock(block, nil); err == nil {
+			t.Errorf("block with timestamp %d not after median time committed", timestamp)
+		}
+	}
+	if chain.Height() != 11 {
+		t.Fatalf("chain height %d, expect 11", chain.Height())
+	}
+
+	// Earlier than the tip but after the median is accepted
+	block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: 151, Bits: 0x1d00ffff, Height: 12}}
+	if _, _, err := chain.CommitBlock(block, nil); err != nil {
+		t.Errorf("block with timestamp after median time rejected, %s", err)
+	}
+
+	now := time.Now()
+	future := Header{Timestamp: uint32(now.Unix()) + MaxFutureBlockTime + 60}
+	if err := chain.CheckTimestamp(future, now); err == nil {
+		t.Error("block too far in the future accepted")
+	}
+	ahead := Header{Timestamp: uint32(now.Unix()) + MaxFutureBlockTime - 60}
+	if err := chain.CheckTimestamp(ahead, now); err != nil {
+		t.Errorf("block within max future time rejected, %s", err)
+	}
+	// The network adjusted time is used, so the future block is accepted if local clock is behind
+	if err := chain.CheckTimestamp(future, now.Add(time.Minute*2)); err != nil {
+		t.Errorf("block within max future time of network time rejected, %s", err)
+	}
+}
+
+func TestBlockchain_RegisterBlockProcessor(t *testing.T) {
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var processed []uint32
+	reject := uint32(2)
+	chain.RegisterBlockProcessor(func(block *bloom.MerkleBlock, txs []Transaction) error {
+		if block.Header.Height == reject {
+			return errors.New("rejected")
+		}
+		processed = append(processed, block.Header.Height)
+		return nil
+	})
+
+	genesis := bloom.MerkleBlock{Header: Header{Timestamp: 1, Bits: 0x1d00ffff, Height: 1}}
+	if _, _, err := chain.CommitBlock(genesis, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	next := bloom.MerkleBlock{Header: Header{Previous: genesis.Header.Hash(), Timestamp: 2, Bits: 0x1d00ffff, Height: 2}}
+	if _, _, err := chain.CommitBlock(next, nil); err == nil {
+		t.Error("block rejected by processor committed")
+	}
+	if chain.Height() != 1 {
+		t.Errorf("chain height %d after rejected block, expect 1", chain.Height())
+	}
+
+	// Retry after the processor accepts it
+	reject = 0
+	if _, _, err := chain.CommitBlock(next, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 2 || processed[0] != 1 || processed[1] != 2 {
+		t.Errorf("processed blocks %v, expect [1 2]", processed)
+	}
+}
+
+func TestBlockchain_GetHeader(t *testing.T) {
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GetHeaderByHeight(1); err != ErrHeaderNotFound {
+		t.Errorf("header found in empty chain")
+	}
+
+	var hashes []Uint256
+	var previous Uint256
+	for height := uint32(1); height <= 5; height++ {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x1d00ffff, Height: height}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+		hashes = append(hashes, previous)
+	}
+
+	for height := uint32(1); height <= 5; height++ {
+		header, err := chain.GetHeaderByHeight(height)
+		if err != nil {
+			t.Fatalf("header at height %d not found, %s", height, err)
+		}
+		if header.Height != height || header.Hash() != hashes[height-1] {
+			t.Errorf("unexpected header at height %d", height)
+		}
+		header, err = chain.GetHeaderByHash(hashes[height-1])
+		if err != nil || header.Height != height {
+			t.Errorf("header with hash of height %d not found", height)
+		}
+	}
+
+	for _, height := range []uint32{0, 6} {
+		if _, err := chain.GetHeaderByHeight(height); err != ErrHeaderNotFound {
+			t.Errorf("header at height %d found", height)
+		}
+	}
+	if _, err := chain.GetHeaderByHash(Uint256{1}); err != ErrHeaderNotFound {
+		t.Error("header with unknown hash found")
+	}
+}
+
+// A DataStore supports batches, counts the batches begun and committed
+type testBatchStore struct {
+	*testDataStore
+	begun     int
+	committed []int // The number of headers put in each batch
+	puts      int
+}
+
+func (store *testBatchStore) PutHeader(header *db.StoreHeader, newTip bool) error {
+	store.puts++
+	return store.testDataStore.PutHeader(header, newTip)
+}
+
+func (store *testBatchStore) BeginBatch() error {
+	store.begun++
+	store.puts = 0
+	return nil
+}
+
+func (store *testBatchStore) CommitBatch() error {
+	store.committed = append(store.committed, store.puts)
+	return nil
+}
+
+func TestBlockchain_CommitBatch(t *testing.T) {
+	CommitBatchSize = 4
+	defer func() { CommitBatchSize = 1 }()
+
+	store := &testBatchStore{testDataStore: newTestDataStore()}
+	chain, err := NewBlockchain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var previous Uint256
+	for height := uint32(1); height <= 10; height++ {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x1d00ffff, Height: height}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+	}
+	if len(store.committed) != 2 || store.committed[0] != 4 || store.committed[1] != 4 {
+		t.Fatalf("batches committed %v, expect [4 4]", store.committed)
+	}
+
+	// The unfinished batch is written by flush
+	if err := chain.FlushBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.committed) != 3 || store.committed[2] != 2 {
+		t.Errorf("batches committed %v, expect [4 4 2]", store.committed)
+	}
+	if store.begun != 3 {
+		t.Errorf("batches begun %d, expect 3", store.begun)
+	}
+	if err := chain.FlushBatch(); err != nil || len(store.committed) != 3 {
+		t.Error("empty batch committed")
+	}
+	if chain.Height() != 10 {
+		t.Errorf("chain height %d, expect 10", chain.Height())
+	}
+}
+
+func TestBlockchain_CommitBatchFailedBlock(t *testing.T) {
+	CommitBatchSize = 2
+	defer func() { CommitBatchSize = 1 }()
+
+	store := &testBatchStore{testDataStore: newTestDataStore()}
+	chain, err := NewBlockchain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block1 := bloom.MerkleBlock{Header: Header{Timestamp: 1, Bits: 0x1d00ffff, Height: 1}}
+	if _, _, err := chain.CommitBlock(block1, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The block does not extend any known headers, it's not counted to the batch
+	orphan := bloom.MerkleBlock{Header: Header{Previous: Uint256{1}, Timestamp: 3, Bits: 0x1d00ffff, Height: 3}}
+	if _, _, err := chain.CommitBlock(orphan, nil); err == nil {
+		t.Fatal("orphan block committed")
+	}
+	if len(store.committed) != 0 {
+		t.Fatalf("batch committed after a failed block, batches %v", store.committed)
+	}
+
+	block2 := bloom.MerkleBlock{Header: Header{Previous: block1.Header.Hash(), Timestamp: 2, Bits: 0x1d00ffff, Height: 2}}
+	if _, _, err := chain.CommitBlock(block2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.committed) != 1 || store.committed[0] != 2 {
+		t.Errorf("batches committed %v, expect [2]", store.committed)
+	}
+}
+
+func TestBlockchain_CommitFlushInterval(t *testing.T) {
+	CommitBatchSize, CommitFlushInterval = 100, 60
+	defer func() { CommitBatchSize, CommitFlushInterval = 1, 0 }()
+
+	store := &testBatchStore{testDataStore: newTestDataStore()}
+	chain, err := NewBlockchain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var previous Uint256
+	commit := func(height uint32) {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x1d00ffff, Height: height}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+	}
+
+	commit(1)
+	commit(2)
+	if len(store.committed) != 0 || !chain.LastFlush().IsZero() {
+		t.Fatalf("batch written before the flush interval, batches %v", store.committed)
+	}
+	if err := chain.flushIfDue(); err != nil || len(store.committed) != 0 {
+		t.Fatal("batch written by periodic check before the flush interval")
+	}
+
+	// The next commit after the interval writes the batch
+	chain.batchStart = chain.batchStart.Add(-time.Minute)
+	commit(3)
+	if len(store.committed) != 1 || store.committed[0] != 3 {
+		t.Fatalf("batches committed %v, expect [3]", store.committed)
+	}
+	flushed := chain.LastFlush()
+	if flushed.IsZero() {
+		t.Fatal("last flush time not recorded")
+	}
+
+	// The periodic check writes the batch when no more blocks committed
+	commit(4)
+	chain.batchStart = chain.batchStart.Add(-time.Minute)
+	if err := chain.flushIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.committed) != 2 || store.committed[1] != 1 {
+		t.Errorf("batches committed %v, expect [3 1]", store.committed)
+	}
+	if chain.LastFlush().Before(flushed) {
+		t.Error("last flush time not updated")
+	}
+}
+
+func TestBlockchain_Checkpoints(t *testing.T) {
+	defer func() { Checkpoints = nil }()
+
+	var main []bloom.MerkleBlock
+	var previous Uint256
+	for height := uint32(1); height <= 5; height++ {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x1d00ffff, Height: height}}
+		previous = block.Header.Hash()
+		main = append(main, block)
+	}
+	Checkpoints = []Checkpoint{{Height: 3, Hash: main[2].Header.Hash()}}
+
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, block := range main[:2] {
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A chain violates the checkpoint is rejected at the checkpoint height
+	bogus := Header{Previous: main[1].Header.Hash(), Timestamp: 10, Bits: 0x1d00ffff, Height: 3}
+	if err := chain.CheckCheckpoint(bogus); err == nil {
+		t.Error("header conflicts with checkpoint passed check")
+	}
+	if _, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: bogus}, nil); err == nil {
+		t.Error("block conflicts with checkpoint committed")
+	}
+	if chain.Height() != 2 {
+		t.Errorf("chain height %d, expect 2", chain.Height())
+	}
+
+	// The main chain passes the checkpoint
+	for _, block := range main[2:] {
+		if err := chain.CheckCheckpoint(block.Header); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chain.Height() != 5 {
+		t.Fatalf("chain height %d, expect 5", chain.Height())
+	}
+
+	// A fork with more work below the checkpoint does not reorganize the chain
+	heavy := Header{Previous: main[0].Header.Hash(), Timestamp: 20, Bits: 0x1b00ffff, Height: 2}
+	if _, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: heavy}, nil); err == nil {
+		t.Error("reorganize below checkpoint accepted")
+	}
+	if tip := chain.ChainTip(); tip.Hash() != main[4].Header.Hash() {
+		t.Error("chain tip changed by fork below checkpoint")
+	}
+}
+
+func TestBlockchain_WrongGenesis(t *testing.T) {
+	defer func() { Checkpoints = nil }()
+	Checkpoints = []Checkpoint{{Height: 0, Hash: Uint256{1}}}
+
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A peer with the same magic number but another genesis block
+	wrong := Header{Previous: Uint256{2}, Timestamp: 1, Bits: 0x1d00ffff, Height: 1}
+	if err := chain.CheckCheckpoint(wrong); err != ErrWrongChain {
+		t.Errorf("block not following genesis returns %v, expect ErrWrongChain", err)
+	}
+	if _, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: wrong}, nil); err == nil {
+		t.Error("block not following genesis committed")
+	}
+
+	right := Header{Previous: Uint256{1}, Timestamp: 1, Bits: 0x1d00ffff, Height: 1}
+	if err := chain.CheckCheckpoint(right); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: right}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != 1 {
+		t.Errorf("chain height %d, expect 1", chain.Height())
+	}
+}
+
+func TestBlockchain_OnReorg(t *testing.T) {
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type reorg struct {
+		detached, attached []Uint256
+		commonAncestor     uint32
+	}
+	reorgs := make(chan reorg, 1)
+	chain.OnReorg(func(detached, attached []Uint256, commonAncestor uint32) {
+		reorgs <- reorg{detached, attached, commonAncestor}
+	})
+
+	var main []bloom.MerkleBlock
+	var previous Uint256
+	for height := uint32(1); height <= 4; height++ {
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x1d00ffff, Height: height}}
+		if _, _, err := chain.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+		main = append(main, block)
+	}
+
+	// A side block with less work does not reorganize the chain
+	side := Header{Previous: main[1].Header.Hash(), Timestamp: 10, Bits: 0x1d00ffff, Height: 3}
+	if reorged, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: side}, nil); err != nil || reorged {
+		t.Fatalf("side block reorganized %v, error %v", reorged, err)
+	}
+
+	// The side branch becomes the best chain with a heavy block
+	heavy := Header{Previous: side.Hash(), Timestamp: 11, Bits: 0x1b00ffff, Height: 4}
+	if reorged, _, err := chain.CommitBlock(bloom.MerkleBlock{Header: heavy}, nil); err != nil || !reorged {
+		t.Fatalf("heavy block reorganized %v, error %v", reorged, err)
+	}
+	if chain.Reorgs() != 1 {
+		t.Errorf("reorgs %d, expect 1", chain.Reorgs())
+	}
+
+	select {
+	case r := <-reorgs:
+		if r.commonAncestor != 2 {
+			t.Errorf("common ancestor %d, expect 2", r.commonAncestor)
+		}
+		if len(r.detached) != 2 || r.detached[0] != main[2].Header.Hash() || r.detached[1] != main[3].Header.Hash() {
+			t.Errorf("unexpected detached blocks %v", r.detached)
+		}
+		if len(r.attached) != 2 || r.attached[0] != side.Hash() || r.attached[1] != heavy.Hash() {
+			t.Errorf("unexpected attached blocks %v", r.attached)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reorg listener not notified")
+	}
+}
+
+func TestBlockchain_ExportImportHeaders(t *testing.T) {
+	log.Init()
+	defer func() { Checkpoints = nil }()
+
+	source, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var previous Uint256
+	for height := uint32(1); height <= 5; height++ {
+		// The headers above the checkpoint need valid proof of work to be imported
+		block := bloom.MerkleBlock{Header: Header{Previous: previous, Timestamp: height, Bits: 0x207fffff, Height: height}}
+		for source.CheckProofOfWork(block.Header) != nil {
+			block.Header.AuxPow.ParBlockHeader.Nonce++
+		}
+		if _, _, err := source.CommitBlock(block, nil); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+	}
+
+	buf := new(bytes.Buffer)
+	if err := source.ExportHeaders(buf); err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.Bytes()
+
+	// Headers conflict with a checkpoint are not imported
+	Checkpoints = []Checkpoint{{Height: 3, Hash: Uint256{1}}}
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.ImportHeaders(bytes.NewReader(exported)); err == nil {
+		t.Error("headers conflict with checkpoint imported")
+	}
+	if chain.Height() != 0 {
+		t.Errorf("chain height %d after failed import, expect 0", chain.Height())
+	}
+	if chain.SyncStartHeight() != 0 {
+		t.Errorf("empty chain sync starts at %d, expect 0", chain.SyncStartHeight())
+	}
+
+	checkpoint, err := source.GetHeaderByHeight(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Checkpoints = []Checkpoint{{Height: 3, Hash: checkpoint.Hash()}}
+	if err := chain.ImportHeaders(bytes.NewReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != 5 || chain.ChainTip().Hash() != source.ChainTip().Hash() {
+		t.Errorf("imported chain tip at height %d, expect the source tip", chain.Height())
+	}
+	if chain.ChainTip().TotalWork.Cmp(source.ChainTip().TotalWork) != 0 {
+		t.Error("imported chain tip total work differs from the source")
+	}
+	if chain.SyncStartHeight() != 5 {
+		t.Errorf("sync starts at %d after import, expect 5", chain.SyncStartHeight())
+	}
+
+	// The chain must be empty
+	if err := chain.ImportHeaders(bytes.NewReader(exported)); err != ErrChainNotEmpty {
+		t.Errorf("import into synced chain returns %v, expect ErrChainNotEmpty", err)
+	}
+}
+
+// A DataStore hanging on committing transactions
+type slowDataStore struct {
+	*testDataStore
+	delay time.Duration
+}
+
+func (store *slowDataStore) CommitTx(tx *db.StoreTx) (bool, error) {
+	time.Sleep(store.delay)
+	return false, nil
+}
+
+func TestBlockchain_CommitTimeout(t *testing.T) {
+	CommitTimeout = 1
+	defer func() { CommitTimeout = 0 }()
+
+	chain, err := NewBlockchain(&slowDataStore{testDataStore: newTestDataStore(), delay: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type stuckEvent struct {
+		commit string
+		done   bool
+	}
+	events := make(chan stuckEvent, 2)
+	chain.OnCommitStuck(func(commit string, elapsed time.Duration, done bool) {
+		events <- stuckEvent{commit: commit, done: done}
+	})
+
+	block := bloom.MerkleBlock{Header: Header{Timestamp: 1, Bits: 0x1d00ffff, Height: 1}}
+	committed := make(chan error, 1)
+	go func() {
+		_, _, err := chain.CommitBlock(block, []Transaction{{TxType: TransferAsset}})
+		committed <- err
+	}()
+
+	// Reported stuck while the commit is still running
+	select {
+	case event := <-events:
+		if event.done || event.commit != "block at height 1" {
+			t.Fatalf("unexpected stuck event %+v", event)
+		}
+	case <-committed:
+		t.Fatal("commit returned before reported stuck")
+	case <-time.After(time.Second * 3):
+		t.Fatal("stuck commit not reported")
+	}
+
+	if err := <-committed; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if !event.done {
+			t.Errorf("stuck commit returned not reported done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stuck commit returned not reported")
+	}
+
+	// A fast commit is not reported
+	chain.DataStore.(*slowDataStore).delay = 0
+	next := bloom.MerkleBlock{Header: Header{Previous: block.Header.Hash(), Timestamp: 2, Bits: 0x1d00ffff, Height: 2}}
+	if _, _, err := chain.CommitBlock(next, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("fast commit reported stuck %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
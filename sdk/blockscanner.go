@@ -0,0 +1,26 @@
+package sdk
+
+import (
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// In full block mode, the SPV service will not send filterload message to peers,
+// full blocks are downloaded and scanned locally with the bloom filter instead.
+// This keeps the addresses private from peers, but costs much more bandwidth.
+// Peers must support sending full blocks to SPV clients for this to work.
+var FullBlockMode = false
+
+// Scan the full block with the bloom filter locally, returns a merkle block
+// and the matched transactions, just like the merkleblock and txn messages
+// received from a peer with the bloom filter loaded.
+func ScanBlock(block *core.Block, filter *bloom.Filter) (*bloom.MerkleBlock, []core.Transaction) {
+	merkleBlock, matches := bloom.NewMerkleBlock(block, filter)
+
+	txs := make([]core.Transaction, 0, len(matches))
+	for _, index := range matches {
+		txs = append(txs, *block.Transactions[index])
+	}
+
+	return merkleBlock, txs
+}
@@ -0,0 +1,135 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+In server mode, the SPV service advertises the SPV service bit and answers filterload and getdata
+messages from other SPV clients, by serving merkle blocks built from the recent full blocks it received.
+Only blocks received in full block mode can be served, so server mode requires FullBlockMode,
+and only the latest ServedBlocks committed blocks are kept. Transactions not in a served block
+are not available, getdata of transactions is answered with notfound.
+*/
+var ServerMode = false
+
+// The number of recent full blocks kept to serve in server mode
+var ServedBlocks = 100
+
+type blockServer struct {
+	sync.Mutex
+	chain   *Blockchain
+	pm      *net.PeerManager
+	blocks  map[Uint256]*core.Block
+	order   []Uint256                // Block hashes in the order they are received
+	filters map[uint64]*bloom.Filter // By the connection ID of the peers
+}
+
+func newBlockServer(chain *Blockchain, pm *net.PeerManager) *blockServer {
+	return &blockServer{
+		chain:   chain,
+		pm:      pm,
+		blocks:  make(map[Uint256]*core.Block),
+		filters: make(map[uint64]*bloom.Filter),
+	}
+}
+
+func (server *blockServer) registerMessages() {
+	server.pm.RegisterMessage("filterload",
+		func() p2p.Message { return new(msg.FilterLoad) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return server.OnFilterLoad(peer, message.(*msg.FilterLoad))
+		})
+	server.pm.RegisterMessage("getdata",
+		func() p2p.Message { return new(msg.DataReq) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return server.OnDataReq(peer, message.(*msg.DataReq))
+		})
+}
+
+// Keep the full block to serve, the oldest block is removed when ServedBlocks reached
+func (server *blockServer) AddBlock(block *core.Block) {
+	server.Lock()
+	defer server.Unlock()
+
+	hash := block.Header.Hash()
+	if _, ok := server.blocks[hash]; ok {
+		return
+	}
+	server.blocks[hash] = block
+	server.order = append(server.order, hash)
+	for len(server.order) > ServedBlocks {
+		delete(server.blocks, server.order[0])
+		server.order = server.order[1:]
+	}
+}
+
+func (server *blockServer) OnFilterLoad(peer *net.Peer, filterLoad *msg.FilterLoad) error {
+	server.Lock()
+	defer server.Unlock()
+
+	// Remove the filters of disconnected peers, the filters are kept by connection,
+	// as the peer ID is chosen by the remote peer
+	established := make(map[uint64]bool)
+	for _, p := range server.pm.ConnectedPeers() {
+		if p.State() == p2p.ESTABLISH {
+			established[p.ConnID()] = true
+		}
+	}
+	for connID := range server.filters {
+		if !established[connID] {
+			delete(server.filters, connID)
+		}
+	}
+	server.filters[peer.ConnID()] = bloom.LoadFilter(filterLoad)
+	return nil
+}
+
+func (server *blockServer) OnDataReq(peer *net.Peer, req *msg.DataReq) error {
+	if req.Type != p2p.BlockData {
+		go peer.Send(msg.NewNotFound(req.Hash))
+		return nil
+	}
+
+	block, filter := server.getBlock(req.Hash, peer)
+	if block == nil || filter == nil {
+		go peer.Send(msg.NewNotFound(req.Hash))
+		return nil
+	}
+
+	merkleBlock, txs := ScanBlock(block, filter)
+	log.Debug("Serve merkle block ", req.Hash.String(), " with ", len(txs), " transactions to peer ", peer.ID())
+	go func() {
+		peer.Send(merkleBlock)
+		for i := range txs {
+			peer.Send(&txs[i])
+		}
+	}()
+
+	return nil
+}
+
+// Get the block and the filter of the peer, the block is only served after it's committed
+// and the chain is synced, so the downstream clients will not get blocks from a stale chain.
+func (server *blockServer) getBlock(hash Uint256, peer *net.Peer) (*core.Block, *bloom.Filter) {
+	if server.chain.IsSyncing() {
+		return nil, nil
+	}
+	if _, err := server.chain.GetHeader(hash); err != nil {
+		return nil, nil
+	}
+
+	server.Lock()
+	defer server.Unlock()
+
+	return server.blocks[hash], server.filters[peer.ConnID()]
+}
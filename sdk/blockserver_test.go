@@ -0,0 +1,40 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+func TestBlockServer_OnFilterLoad(t *testing.T) {
+	log.Init()
+
+	pm := net.InitPeerManager(new(net.Peer), nil)
+	server := newBlockServer(nil, pm)
+	honest := newTestPeer(1)
+	pm.AddPeer(honest)
+	if err := server.OnFilterLoad(honest, &msg.FilterLoad{Filter: []byte{1}, Tweak: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another connection claiming the same peer ID does not replace the filter
+	impostor := newTestPeer(1)
+	if err := server.OnFilterLoad(impostor, &msg.FilterLoad{Filter: []byte{2}, Tweak: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for peer, tweak := range map[*net.Peer]uint32{honest: 1, impostor: 2} {
+		filter := server.filters[peer.ConnID()]
+		if filter == nil || filter.GetFilterLoadMsg().Tweak != tweak {
+			t.Errorf("filter of connection %d not the one it loaded", peer.ConnID())
+		}
+	}
+
+	// The filters of the connections not established are removed
+	server.OnFilterLoad(honest, &msg.FilterLoad{Filter: []byte{1}, Tweak: 1})
+	if _, ok := server.filters[impostor.ConnID()]; ok {
+		t.Error("filter of the disconnected peer kept")
+	}
+}
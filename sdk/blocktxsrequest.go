@@ -4,20 +4,68 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+/*
+The number of transaction requests of a block sent at the same time, the others are sent one by one
+as the requested transactions are received, so a block matching many transactions, or a filter
+with a high false positive rate, does not burst requests to the peer. 0 to request all at once.
+*/
+var MaxBlockTxRequests = 0
+
 type BlockTxsRequest struct {
 	sync.Mutex
 	BlockHash      Uint256
 	Block          bloom.MerkleBlock
 	txRequestQueue map[Uint256]*Request
 	Txs            []Transaction
+
+	// The transaction requests not sent yet, in order
+	pending []Uint256
+	queued  map[Uint256]bool
+
+	// Requested by the sync batch, see SyncCacheSize
+	inFlight bool
+}
+
+// Send the transaction requests, at most MaxBlockTxRequests outstanding at the same time
+func (req *BlockTxsRequest) start() {
+	for txId, request := range req.txRequestQueue {
+		if MaxBlockTxRequests <= 0 {
+			request.Start()
+			continue
+		}
+		if req.queued == nil {
+			req.queued = make(map[Uint256]bool)
+		}
+		req.pending = append(req.pending, txId)
+		req.queued[txId] = true
+	}
+	req.startPending()
+}
+
+// Send the pending requests until MaxBlockTxRequests are outstanding
+func (req *BlockTxsRequest) startPending() {
+	for len(req.pending) > 0 && len(req.txRequestQueue)-len(req.queued) < MaxBlockTxRequests {
+		txId := req.pending[0]
+		req.pending = req.pending[1:]
+		if !req.queued[txId] {
+			continue
+		}
+		delete(req.queued, txId)
+		req.txRequestQueue[txId].Start()
+	}
 }
 
 func (req *BlockTxsRequest) Finish() {
+	req.Lock()
+	defer req.Unlock()
+
 	// Finish transaction requests
 	for hash, request := range req.txRequestQueue {
 		request.Finish()
@@ -25,6 +73,21 @@ func (req *BlockTxsRequest) Finish() {
 	}
 }
 
+// Send the transaction requests not received yet to the given peer,
+// transactions already received are kept.
+func (req *BlockTxsRequest) Reassign(peer *net.Peer) {
+	req.Lock()
+	defer req.Unlock()
+
+	for txId, request := range req.txRequestQueue {
+		if req.queued[txId] {
+			request.setPeer(peer)
+			continue
+		}
+		request.Reassign(peer)
+	}
+}
+
 func (req *BlockTxsRequest) OnTxReceived(tx *Transaction) (bool, error) {
 	req.Lock()
 	defer req.Unlock()
@@ -40,8 +103,10 @@ func (req *BlockTxsRequest) OnTxReceived(tx *Transaction) (bool, error) {
 	// Remove from map
 	txRequest.Finish()
 	delete(req.txRequestQueue, txId)
+	delete(req.queued, txId)
 
 	req.Txs = append(req.Txs, *tx)
+	req.startPending()
 
 	return len(req.txRequestQueue) == 0, nil
 }
@@ -1,15 +1,91 @@
 package sdk
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA/bloom"
 	"github.com/elastos/Elastos.ELA/core"
-	"github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+/*
+The maximum number of addresses and outpoints recommended to add into a bloom filter.
+With the false positive rate 0.00003 used by NewBloomFilter, a filter reaches the 36000 bytes
+limit of the filterload message at about 13000 elements, with more elements the false positive
+rate rises quickly until the filter matches almost everything. Raise it only when a higher
+false positive rate is acceptable.
+*/
+var MaxFilterElements = 13000
+
+// The false positive rate a bloom filter is sized for by NewBloomFilter
+const BloomFalsePositiveRate = 0.00003
+
+// FilterUpdateMode decides the outpoints of the received outputs added into the bloom filter,
+// the values follow the BIP37 filter update flags
+type FilterUpdateMode uint8
+
+const (
+	// No outpoint is added. Peers learn the least about the wallet outputs, but the transactions
+	// spending them are only matched when they pay to the wallet addresses too, like change outputs,
+	// so spends to other addresses are missed unless the outpoints are managed explicitly.
+	FilterUpdateNone FilterUpdateMode = 0
+
+	// The outpoints of all received outputs are added, so all spends of the wallet outputs are matched.
+	// It's the most convenient, and the filter grows with the outputs, giving peers more information.
+	FilterUpdateAll FilterUpdateMode = 1
+
+	// BIP37 adds only the outpoints of pay-to-pubkey and multisig outputs. All outputs pay to program
+	// hashes, the standard single signature addresses are pay-to-pubkey-hash, so only the outpoints of the
+	// outputs received by multi signature addresses are added, the spends of standard outputs are matched
+	// only when they pay to the wallet addresses.
+	FilterUpdateP2PubkeyOnly FilterUpdateMode = 2
+)
+
+// The filter update mode used to build the bloom filter
+var FilterUpdate = FilterUpdateAll
+
+var filterUpdateModes = map[string]FilterUpdateMode{
+	"none":         FilterUpdateNone,
+	"all":          FilterUpdateAll,
+	"p2pubkeyonly": FilterUpdateP2PubkeyOnly,
+}
+
+// Parse the filter update mode name, none, all or p2pubkeyonly, case insensitive
+func ParseFilterUpdateMode(name string) (FilterUpdateMode, error) {
+	mode, ok := filterUpdateModes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown filter update mode %q, must be none, all or p2pubkeyonly", name)
+	}
+	return mode, nil
+}
+
+func (mode FilterUpdateMode) String() string {
+	for name, m := range filterUpdateModes {
+		if m == mode {
+			return name
+		}
+	}
+	return fmt.Sprintf("FilterUpdateMode(%d)", uint8(mode))
+}
+
+// Check if the outpoint of an output should be added into the bloom filter,
+// multisig means the output is received by a multi signature address
+func (mode FilterUpdateMode) AddsOutPoint(multisig bool) bool {
+	switch mode {
+	case FilterUpdateAll:
+		return true
+	case FilterUpdateP2PubkeyOnly:
+		return multisig
+	default:
+		return false
+	}
+}
+
 // Create a new bloom filter instance
 // elements are how many elements will be added to this filter.
 func NewBloomFilter(elements uint32) *bloom.Filter {
-	return bloom.NewFilter(elements, 0, 0.00003)
+	return bloom.NewFilter(elements, 0, BloomFalsePositiveRate)
 }
 
 // Build a bloom filter by giving the interested addresses and outpoints
@@ -0,0 +1,33 @@
+package sdk
+
+import "testing"
+
+func TestParseFilterUpdateMode(t *testing.T) {
+	for name, expect := range map[string]FilterUpdateMode{
+		"none": FilterUpdateNone, "All": FilterUpdateAll, "P2PubkeyOnly": FilterUpdateP2PubkeyOnly,
+	} {
+		mode, err := ParseFilterUpdateMode(name)
+		if err != nil || mode != expect {
+			t.Errorf("parse %q returns %v %v, expect %v", name, mode, err, expect)
+		}
+	}
+	if _, err := ParseFilterUpdateMode("p2sh"); err == nil {
+		t.Error("unknown mode parsed")
+	}
+}
+
+func TestFilterUpdateMode_AddsOutPoint(t *testing.T) {
+	for _, test := range []struct {
+		mode               FilterUpdateMode
+		standard, multisig bool
+	}{
+		{FilterUpdateNone, false, false},
+		{FilterUpdateAll, true, true},
+		{FilterUpdateP2PubkeyOnly, false, true},
+	} {
+		if test.mode.AddsOutPoint(false) != test.standard || test.mode.AddsOutPoint(true) != test.multisig {
+			t.Errorf("mode %s adds outpoints of standard %v multisig %v, expect %v %v", test.mode,
+				test.mode.AddsOutPoint(false), test.mode.AddsOutPoint(true), test.standard, test.multisig)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Checkpoint is a known block hash at the height of the main chain
+type Checkpoint struct {
+	Height uint32
+	Hash   Uint256
+}
+
+/*
+The known blocks of the main chain, a block at the height of a checkpoint must have the same hash,
+and the chain is not reorganized below the highest checkpoint it has passed. A peer serving a
+chain that conflicts with a checkpoint is lying or on a wrong fork. Empty by default.
+The genesis block is the checkpoint at height 0, it's never synced, the block at height 1 must follow it.
+*/
+var Checkpoints []Checkpoint
+
+// The block does not follow the genesis block, the peer is on another chain sharing our magic number
+var ErrWrongChain = errors.New("block does not follow the genesis block of our chain")
+
+// Get the checkpoint at the height
+func checkpointAt(height uint32) (Checkpoint, bool) {
+	for _, checkpoint := range Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint, true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// Get the highest checkpoint at or below the height
+func lastCheckpoint(height uint32) (Checkpoint, bool) {
+	var last Checkpoint
+	var found bool
+	for _, checkpoint := range Checkpoints {
+		if checkpoint.Height <= height && (!found || checkpoint.Height > last.Height) {
+			last, found = checkpoint, true
+		}
+	}
+	return last, found
+}
+
+// Check the header has the hash of the checkpoint at its height and follows the checkpoint
+// at the previous height, ErrWrongChain is returned if it does not follow the genesis block
+func (bc *Blockchain) CheckCheckpoint(header Header) error {
+	if header.Height > 0 {
+		previous, ok := checkpointAt(header.Height - 1)
+		if ok && !header.Previous.IsEqual(previous.Hash) {
+			if previous.Height == 0 {
+				return ErrWrongChain
+			}
+			return fmt.Errorf("block at height %d does not follow checkpoint %s",
+				header.Height, previous.Hash.String())
+		}
+	}
+
+	checkpoint, ok := checkpointAt(header.Height)
+	if !ok {
+		return nil
+	}
+	if hash := header.Hash(); !hash.IsEqual(checkpoint.Hash) {
+		return fmt.Errorf("block %s conflicts with checkpoint %s at height %d",
+			hash.String(), checkpoint.Hash.String(), checkpoint.Height)
+	}
+	return nil
+}
+
+// Get the height the header connects at, the height of its stored previous block plus one,
+// 1 if it follows the genesis checkpoint, 0 if the previous block is unknown
+func (bc *Blockchain) connectHeight(header *Header) uint32 {
+	if genesis, ok := checkpointAt(0); ok && header.Previous.IsEqual(genesis.Hash) {
+		return 1
+	}
+
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	previous, err := bc.GetHeader(header.Previous)
+	if err != nil {
+		return 0
+	}
+	return previous.Height + 1
+}
+
+// Check the reorganize does not roll back the chain below the checkpoint it has passed
+func checkReorgPoint(tip, reorgPoint *db.StoreHeader) error {
+	checkpoint, ok := lastCheckpoint(tip.Height)
+	if ok && reorgPoint.Height < checkpoint.Height {
+		return fmt.Errorf("reorganize at height %d is below checkpoint at height %d",
+			reorgPoint.Height, checkpoint.Height)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package sdk
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+/*
+The number of blocks committed in one database transaction, when the DataStore implements
+db.BatchStore. Each database transaction syncs to disk, writing a batch of blocks at once
+instead of each header and transaction on its own saves most of the disk syncs on initial sync.
+Blocks in an unfinished batch are lost if the process crashes, they are downloaded again
+on restart. 1 disables batching.
+*/
+var CommitBatchSize = 1
+
+/*
+Seconds an unfinished batch is kept before it's written to database, it's written on the next block
+commit or the periodic check after the interval, so a crash loses about this long of committed blocks
+at most. 0 to write the batch only when it's full or the requested blocks are all committed.
+*/
+var CommitFlushInterval uint32 = 0
+
+// Start a batch before committing a block if batching is enabled and not started yet
+func (bc *Blockchain) beginBatch() {
+	if bc.batching || CommitBatchSize <= 1 {
+		return
+	}
+	store, ok := bc.DataStore.(db.BatchStore)
+	if !ok {
+		return
+	}
+	if err := store.BeginBatch(); err != nil {
+		log.Error("Begin commit batch failed, ", err)
+		return
+	}
+	bc.batching = true
+	bc.batchStart = time.Now()
+}
+
+// Count the committed block and commit the batch when CommitBatchSize blocks reached
+func (bc *Blockchain) batchCommitted() {
+	// Without batching, each block is written on commit
+	if !bc.batching {
+		bc.lastFlush = time.Now()
+		return
+	}
+	bc.batched++
+	if bc.batched >= CommitBatchSize || bc.flushDue() {
+		if err := bc.commitBatch(); err != nil {
+			log.Error("Commit batch failed, ", err)
+		}
+	}
+}
+
+func (bc *Blockchain) commitBatch() error {
+	if !bc.batching {
+		return nil
+	}
+	log.Debug("Commit batch of ", bc.batched, " blocks")
+	bc.batching = false
+	bc.batched = 0
+	err := bc.DataStore.(db.BatchStore).CommitBatch()
+	if err != nil {
+		return err
+	}
+	bc.lastFlush = time.Now()
+	return nil
+}
+
+// Check if the batch has been kept for CommitFlushInterval
+func (bc *Blockchain) flushDue() bool {
+	return bc.batching && CommitFlushInterval > 0 &&
+		time.Since(bc.batchStart) >= time.Second*time.Duration(CommitFlushInterval)
+}
+
+// Write the batch if it has been kept for CommitFlushInterval, called periodically
+// so the blocks committed before the chain goes idle are written too
+func (bc *Blockchain) flushIfDue() error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	defer bc.watchCommit("batch")()
+
+	if !bc.flushDue() {
+		return nil
+	}
+	return bc.commitBatch()
+}
+
+// Get the time the committed blocks were last written to database, zero if nothing written yet
+func (bc *Blockchain) LastFlush() time.Time {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.lastFlush
+}
+
+// Write the blocks in the current batch to database, call it when there are
+// no more blocks to commit for now, so the committed blocks will not wait for a full batch.
+func (bc *Blockchain) FlushBatch() error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	defer bc.watchCommit("batch")()
+
+	return bc.commitBatch()
+}
@@ -0,0 +1,74 @@
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+/*
+Seconds a commit to the DataStore can take before it's reported as stuck. The blockchain lock is
+held during a commit, a store hanging on a disk issue wedges the sync and every query of the chain.
+A commit can not be aborted, the stuck listeners are notified so the hang is visible and handled,
+and notified again when the commit finally returns. 0 to disable.
+*/
+var CommitTimeout uint32 = 0
+
+// commitWatchdog notifies the listeners when a commit takes longer than CommitTimeout
+type commitWatchdog struct {
+	sync.Mutex
+	listeners []func(commit string, elapsed time.Duration, done bool)
+}
+
+/*
+Register a listener to be notified when a commit has run for CommitTimeout without returning,
+commit describes what is being committed and done is false. If the stuck commit returns later,
+the listener is notified again with the whole time it took and done is true.
+*/
+func (bc *Blockchain) OnCommitStuck(listener func(commit string, elapsed time.Duration, done bool)) {
+	bc.watchdog.Lock()
+	defer bc.watchdog.Unlock()
+
+	bc.watchdog.listeners = append(bc.watchdog.listeners, listener)
+}
+
+// Start watching the commit, the returned function must be called when the commit returns
+func (bc *Blockchain) watchCommit(commit string) func() {
+	if CommitTimeout == 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	var lock sync.Mutex
+	var stuck bool
+	timer := time.AfterFunc(time.Second*time.Duration(CommitTimeout), func() {
+		lock.Lock()
+		stuck = true
+		lock.Unlock()
+
+		log.Error(fmt.Sprintf("!!! Commit of %s stuck for %s, the data store is not responding !!!",
+			commit, time.Since(start)))
+		bc.notifyCommitStuck(commit, time.Since(start), false)
+	})
+
+	return func() {
+		timer.Stop()
+		lock.Lock()
+		defer lock.Unlock()
+		if stuck {
+			log.Warn("Commit of ", commit, " returned after ", time.Since(start))
+			bc.notifyCommitStuck(commit, time.Since(start), true)
+		}
+	}
+}
+
+func (bc *Blockchain) notifyCommitStuck(commit string, elapsed time.Duration, done bool) {
+	bc.watchdog.Lock()
+	defer bc.watchdog.Unlock()
+
+	for _, listener := range bc.watchdog.listeners {
+		go listener(commit, elapsed, done)
+	}
+}
@@ -0,0 +1,31 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+// An SPVClient with the peer manager only
+type testClient struct {
+	pm *net.PeerManager
+}
+
+func (client *testClient) SetMessageHandler(SPVMessageHandler) {}
+
+func (client *testClient) Start() {}
+
+func (client *testClient) PeerManager() *net.PeerManager { return client.pm }
+
+// Create a service on the data store with a new peer manager and an empty bloom filter
+func newTestService(t *testing.T, dataStore db.DataStore) *SPVServiceImpl {
+	service, err := NewSPVServiceImpl(&testClient{pm: net.InitPeerManager(new(net.Peer), nil)},
+		dataStore, func() *bloom.Filter { return BuildBloomFilter(nil, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+// The minimum fee rate per KB of a transaction configured locally, the rate learned from peers is used if higher
+var MinRelayFeeFloor Fixed64 = 0
+
+// FeeFilter message tells the minimum fee rate per KB of the transactions the peer will relay
+type FeeFilter struct {
+	Fee Fixed64
+}
+
+func (msg *FeeFilter) CMD() string {
+	return "feefilter"
+}
+
+func (msg *FeeFilter) Serialize(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, int64(msg.Fee))
+}
+
+func (msg *FeeFilter) Deserialize(r io.Reader) error {
+	var fee int64
+	err := binary.Read(r, binary.LittleEndian, &fee)
+	if err != nil {
+		return err
+	}
+	msg.Fee = Fixed64(fee)
+	return nil
+}
+
+// relayFees keeps the minimum relay fees announced by peers
+type relayFees struct {
+	sync.Mutex
+	pm   *net.PeerManager
+	fees map[uint64]Fixed64
+}
+
+func newRelayFees(pm *net.PeerManager) *relayFees {
+	return &relayFees{pm: pm, fees: make(map[uint64]Fixed64)}
+}
+
+func (rf *relayFees) registerMessages() {
+	rf.pm.RegisterMessage("feefilter",
+		func() p2p.Message { return new(FeeFilter) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return rf.OnFeeFilter(peer, message.(*FeeFilter))
+		})
+}
+
+func (rf *relayFees) OnFeeFilter(peer *net.Peer, feeFilter *FeeFilter) error {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if feeFilter.Fee < 0 {
+		rf.pm.Misbehaved(peer, "negative feefilter")
+		return nil
+	}
+	rf.fees[peer.ID()] = feeFilter.Fee
+	return nil
+}
+
+/*
+Get the minimum relay fee rate per KB, it's the minimum rate announced by the connected peers, as a
+transaction relayed by any of them will reach the network, and the configured MinRelayFeeFloor if it's higher.
+*/
+func (rf *relayFees) MinRelayFee() Fixed64 {
+	rf.Lock()
+	defer rf.Unlock()
+
+	// Remove the fees of disconnected peers
+	connected := make(map[uint64]bool)
+	for _, peer := range rf.pm.ConnectedPeers() {
+		connected[peer.ID()] = true
+	}
+	for id := range rf.fees {
+		if !connected[id] {
+			delete(rf.fees, id)
+		}
+	}
+
+	var minFee Fixed64 = -1
+	for _, fee := range rf.fees {
+		if minFee < 0 || fee < minFee {
+			minFee = fee
+		}
+	}
+	if minFee < MinRelayFeeFloor {
+		return MinRelayFeeFloor
+	}
+	return minFee
+}
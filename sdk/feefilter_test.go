@@ -0,0 +1,79 @@
+package sdk
+
+import (
+	"bytes"
+	gonet "net"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+type testConn struct {
+	gonet.Conn
+}
+
+func (conn *testConn) RemoteAddr() gonet.Addr {
+	return &gonet.TCPAddr{IP: gonet.ParseIP("127.0.0.1"), Port: 20866}
+}
+
+func newTestPeer(id uint64) *net.Peer {
+	conn, _ := gonet.Pipe()
+	peer := net.NewPeer(&testConn{Conn: conn})
+	peer.SetID(id)
+	peer.SetState(p2p.ESTABLISH)
+	return peer
+}
+
+func TestFeeFilter_Serialize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := (&FeeFilter{Fee: 12345}).Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	feeFilter := new(FeeFilter)
+	if err := feeFilter.Deserialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if feeFilter.Fee != 12345 {
+		t.Errorf("deserialized fee %d, expect 12345", feeFilter.Fee)
+	}
+}
+
+func TestRelayFees_MinRelayFee(t *testing.T) {
+	log.Init()
+	defer func() { MinRelayFeeFloor = 0 }()
+
+	pm := net.InitPeerManager(new(net.Peer), nil)
+	rf := newRelayFees(pm)
+	if fee := rf.MinRelayFee(); fee != 0 {
+		t.Errorf("min relay fee %d without peers, expect 0", fee)
+	}
+
+	peers := []*net.Peer{newTestPeer(1), newTestPeer(2), newTestPeer(3)}
+	for i, peer := range peers {
+		pm.AddPeer(peer)
+		rf.OnFeeFilter(peer, &FeeFilter{Fee: Fixed64(300 - i*100)})
+	}
+	if fee := rf.MinRelayFee(); fee != 100 {
+		t.Errorf("min relay fee %d, expect the minimum of peers 100", fee)
+	}
+
+	// Fees of disconnected peers are removed
+	pm.DisconnectPeer(peers[2])
+	if fee := rf.MinRelayFee(); fee != 200 {
+		t.Errorf("min relay fee %d after peer disconnected, expect 200", fee)
+	}
+
+	// The configured floor is used if higher
+	MinRelayFeeFloor = 250
+	if fee := rf.MinRelayFee(); fee != 250 {
+		t.Errorf("min relay fee %d, expect the floor 250", fee)
+	}
+	MinRelayFeeFloor = 150
+	if fee := rf.MinRelayFee(); fee != 200 {
+		t.Errorf("min relay fee %d, expect 200 above the floor", fee)
+	}
+}
@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"math"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+/*
+FilterCache keeps a snapshot of the bloom filter, so peers connecting at the same time
+and addresses added at the same time will not race on building or reading the filter.
+The snapshot is rebuilt with the given build function when reloaded or invalidated,
+and swapped in at once, readers always get a complete filter, never a half built one.
+*/
+type FilterCache struct {
+	sync.Mutex
+	build  func() *bloom.Filter
+	filter *msg.FilterLoad
+}
+
+// Create a FilterCache with the function to build the bloom filter,
+// the filter is built when it's first used.
+func NewFilterCache(build func() *bloom.Filter) *FilterCache {
+	return &FilterCache{build: build}
+}
+
+// Rebuild the bloom filter and swap it in, return the filterload message of the new snapshot
+func (cache *FilterCache) Reload() *msg.FilterLoad {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.reload()
+	return cache.filter
+}
+
+func (cache *FilterCache) reload() {
+	cache.filter = copyFilterLoad(cache.build().GetFilterLoadMsg())
+}
+
+// Drop the snapshot, the bloom filter will be rebuilt when it's used next time
+func (cache *FilterCache) Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.filter = nil
+}
+
+// Get the filterload message of the current snapshot, the message must not be modified
+func (cache *FilterCache) FilterLoadMsg() *msg.FilterLoad {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.filter == nil {
+		cache.reload()
+	}
+	return cache.filter
+}
+
+// Get a copy of the current bloom filter, the copy can be updated
+// by matching transactions without changing the snapshot.
+func (cache *FilterCache) Filter() *bloom.Filter {
+	return bloom.LoadFilter(copyFilterLoad(cache.FilterLoadMsg()))
+}
+
+// FilterStats tells how full the bloom filter snapshot is
+type FilterStats struct {
+	// The estimated number of elements added into the filter
+	Elements int
+
+	// The number of elements the filter is sized for at BloomFalsePositiveRate
+	Capacity int
+
+	// The false positive rate with the bits set in the filter
+	FalsePositiveRate float64
+
+	// The ratio of the bits set in the filter
+	FillRatio float64
+}
+
+/*
+Get the stats of the current snapshot. The number of elements is not kept in the filter, it's
+estimated by the bits set, so it's close to the number of addresses and outpoints added
+until the filter saturates. A saturated filter reports the capacity as the elements.
+*/
+func (cache *FilterCache) Stats() FilterStats {
+	filterLoad := cache.FilterLoadMsg()
+
+	var stats FilterStats
+	bits := float64(len(filterLoad.Filter) * 8)
+	if bits == 0 || filterLoad.HashFuncs == 0 {
+		return stats
+	}
+	hashFuncs := float64(filterLoad.HashFuncs)
+
+	var set int
+	for _, b := range filterLoad.Filter {
+		for ; b != 0; b &= b - 1 {
+			set++
+		}
+	}
+	stats.Capacity = int(-bits * math.Ln2 * math.Ln2 / math.Log(BloomFalsePositiveRate))
+	stats.FillRatio = float64(set) / bits
+	stats.FalsePositiveRate = math.Pow(stats.FillRatio, hashFuncs)
+	if stats.FillRatio < 1 {
+		stats.Elements = int(math.Round(-bits / hashFuncs * math.Log(1-stats.FillRatio)))
+	} else {
+		stats.Elements = stats.Capacity
+	}
+	return stats
+}
+
+func copyFilterLoad(filter *msg.FilterLoad) *msg.FilterLoad {
+	return &msg.FilterLoad{
+		Filter:    append([]byte(nil), filter.Filter...),
+		HashFuncs: filter.HashFuncs,
+		Tweak:     filter.Tweak,
+	}
+}
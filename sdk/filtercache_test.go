@@ -0,0 +1,117 @@
+package sdk
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+func TestFilterCache_Concurrent(t *testing.T) {
+	var addrsLock sync.Mutex
+	var addrs []*common.Uint168
+	cache := NewFilterCache(func() *bloom.Filter {
+		addrsLock.Lock()
+		defer addrsLock.Unlock()
+		return BuildBloomFilter(addrs, nil)
+	})
+
+	var wg sync.WaitGroup
+	// Peers connecting
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				filterLoad := cache.FilterLoadMsg()
+				filter := cache.Filter()
+				filter.Add([]byte{byte(j)})
+				if len(filterLoad.Filter) == 0 {
+					t.Error("empty filterload message")
+				}
+			}
+		}()
+	}
+	// Addresses adding
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				addrsLock.Lock()
+				addrs = append(addrs, &common.Uint168{byte(i), byte(j)})
+				addrsLock.Unlock()
+				if j%2 == 0 {
+					cache.Reload()
+				} else {
+					cache.Invalidate()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFilterCache_Snapshot(t *testing.T) {
+	cache := NewFilterCache(func() *bloom.Filter {
+		return BuildBloomFilter([]*common.Uint168{{1}}, nil)
+	})
+
+	filterLoad := cache.FilterLoadMsg()
+	snapshot := append([]byte(nil), filterLoad.Filter...)
+
+	// Updating the copy must not change the snapshot
+	filter := cache.Filter()
+	for i := 0; i < 256; i++ {
+		filter.Add([]byte{byte(i)})
+	}
+	if !bytes.Equal(cache.FilterLoadMsg().Filter, snapshot) {
+		t.Error("snapshot changed by updating the filter copy")
+	}
+	if cache.FilterLoadMsg() != filterLoad {
+		t.Error("snapshot rebuilt without reload")
+	}
+
+	cache.Invalidate()
+	if cache.FilterLoadMsg() == filterLoad {
+		t.Error("snapshot not rebuilt after invalidate")
+	}
+	if cache.Reload() == filterLoad {
+		t.Error("snapshot not swapped on reload")
+	}
+}
+
+func TestFilterCache_Stats(t *testing.T) {
+	// 8 of the 32 bits set
+	filterLoad := &msg.FilterLoad{Filter: []byte{0x0f, 0x0f, 0x00, 0x00}, HashFuncs: 2}
+	cache := NewFilterCache(func() *bloom.Filter {
+		return bloom.LoadFilter(copyFilterLoad(filterLoad))
+	})
+
+	stats := cache.Stats()
+	if stats.FillRatio != 0.25 {
+		t.Errorf("fill ratio %f, expect 0.25", stats.FillRatio)
+	}
+	if stats.FalsePositiveRate != 0.0625 {
+		t.Errorf("false positive rate %f, expect 0.0625", stats.FalsePositiveRate)
+	}
+	// -(32 / 2) * ln(1 - 0.25) = 4.6
+	if stats.Elements != 5 {
+		t.Errorf("elements %d, expect 5", stats.Elements)
+	}
+	// -32 * ln(2)^2 / ln(0.00003) = 1.48
+	if stats.Capacity != 1 {
+		t.Errorf("capacity %d, expect 1", stats.Capacity)
+	}
+
+	// A saturated filter
+	filterLoad = &msg.FilterLoad{Filter: []byte{0xff, 0xff, 0xff, 0xff}, HashFuncs: 2}
+	cache.Invalidate()
+	stats = cache.Stats()
+	if stats.FillRatio != 1 || stats.FalsePositiveRate != 1 || stats.Elements != stats.Capacity {
+		t.Errorf("saturated filter stats %+v", stats)
+	}
+}
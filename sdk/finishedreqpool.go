@@ -2,19 +2,88 @@ package sdk
 
 import (
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 
-	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
 )
 
+// An orphan block is a received block waiting for it's previous block to be committed
+type OrphanBlock struct {
+	Hash     Uint256
+	Previous Uint256
+	Height   uint32
+	Received time.Time
+}
+
+/*
+The number of received blocks kept in the finished pool waiting for their previous blocks,
+when blocks arrive out of the requested order. No more blocks are requested while the pool is full,
+so a missing block can not make the blocks after it buffered without limit. 0 to not limit.
+*/
+var MaxBlocksAhead = 0
+
+/*
+The memory in bytes the blocks and transactions kept in the finished pool may use, 0 to not limit.
+When exceeded, the least recently used blocks not requested by the sync batch are evicted,
+and no more blocks are requested until the batch blocks are committed. The blocks of the sync
+batch are never evicted, they would be requested again. The orphan transactions are limited
+apart by MaxOrphanTxsPerPeer.
+*/
+var SyncCacheSize = 0
+
 type FinishedReqPool struct {
 	sync.Mutex
+	space    *sync.Cond // Signaled when blocks are taken out of the pool
 	genesis  *Uint256
 	blocks   map[Uint256]*bloom.MerkleBlock
 	requests map[Uint256]*BlockTxsRequest
+	received map[Uint256]time.Time
 	lastPop  *Uint256
+
+	// The estimated size of each block with its transactions, and the total
+	sizes map[Uint256]int
+	size  int
+	// The use count when each block was last added or looked up, the lowest is least recently used
+	used   map[Uint256]uint64
+	uses   uint64
+	hits   uint64
+	misses uint64
+}
+
+func newFinishedReqPool() *FinishedReqPool {
+	pool := &FinishedReqPool{
+		blocks:   make(map[Uint256]*bloom.MerkleBlock),
+		requests: make(map[Uint256]*BlockTxsRequest),
+		received: make(map[Uint256]time.Time),
+		sizes:    make(map[Uint256]int),
+		used:     make(map[Uint256]uint64),
+	}
+	pool.space = sync.NewCond(pool)
+	return pool
+}
+
+// The number of bytes written, to size the blocks and transactions as they are serialized
+type sizeCounter int
+
+func (c *sizeCounter) Write(p []byte) (int, error) {
+	*c += sizeCounter(len(p))
+	return len(p), nil
+}
+
+func requestSize(request *BlockTxsRequest) int {
+	var size sizeCounter
+	request.Block.Header.Serialize(&size)
+	for _, hash := range request.Block.Hashes {
+		size += sizeCounter(len(hash.Bytes()))
+	}
+	size += sizeCounter(len(request.Block.Flags))
+	for i := range request.Txs {
+		request.Txs[i].Serialize(&size)
+	}
+	return int(size)
 }
 
 func (pool *FinishedReqPool) Add(request *BlockTxsRequest) {
@@ -27,11 +96,57 @@ func (pool *FinishedReqPool) Add(request *BlockTxsRequest) {
 	if request.Block.Header.Height == 1 {
 		pool.genesis = &previous
 	}
+	// Replace the block received before with the same previous block
+	if replaced, ok := pool.requests[previous]; ok {
+		pool.remove(replaced)
+	}
 	pool.requests[previous] = request
 	// Save finished block
 	pool.blocks[request.BlockHash] = &request.Block
+	pool.received[request.BlockHash] = time.Now()
+	pool.sizes[request.BlockHash] = requestSize(request)
+	pool.size += pool.sizes[request.BlockHash]
+	pool.use(request.BlockHash)
 
 	log.Debug("Finished pool add block: ", previous.String(), ", height: ", request.Block.Header.Height)
+
+	pool.evict()
+}
+
+func (pool *FinishedReqPool) use(hash Uint256) {
+	pool.uses++
+	pool.used[hash] = pool.uses
+}
+
+// Remove the block of the request from pool, the lock must be held
+func (pool *FinishedReqPool) remove(request *BlockTxsRequest) {
+	delete(pool.requests, request.Block.Header.Previous)
+	delete(pool.blocks, request.BlockHash)
+	delete(pool.received, request.BlockHash)
+	pool.size -= pool.sizes[request.BlockHash]
+	delete(pool.sizes, request.BlockHash)
+	delete(pool.used, request.BlockHash)
+	pool.space.Broadcast()
+}
+
+// Evict the least recently used blocks not in the sync batch until SyncCacheSize is not exceeded
+func (pool *FinishedReqPool) evict() {
+	for SyncCacheSize > 0 && pool.size > SyncCacheSize {
+		var lru *BlockTxsRequest
+		for _, request := range pool.requests {
+			if request.inFlight {
+				continue
+			}
+			if lru == nil || pool.used[request.BlockHash] < pool.used[lru.BlockHash] {
+				lru = request
+			}
+		}
+		if lru == nil {
+			return
+		}
+		log.Debug("Finished pool evict block: ", lru.BlockHash.String(), ", height: ", lru.Block.Header.Height)
+		pool.remove(lru)
+	}
 }
 
 func (pool *FinishedReqPool) Contain(hash Uint256) (*bloom.MerkleBlock, bool) {
@@ -39,7 +154,13 @@ func (pool *FinishedReqPool) Contain(hash Uint256) (*bloom.MerkleBlock, bool) {
 	defer pool.Unlock()
 
 	block, ok := pool.blocks[hash]
-	return block, ok
+	if !ok {
+		pool.misses++
+		return nil, false
+	}
+	pool.hits++
+	pool.use(hash)
+	return block, true
 }
 
 func (pool *FinishedReqPool) Next(current Uint256) (*BlockTxsRequest, bool) {
@@ -54,8 +175,7 @@ func (pool *FinishedReqPool) Next(current Uint256) (*BlockTxsRequest, bool) {
 
 	log.Debug("Finished pool get next key: ", current.String())
 	if request, ok := pool.requests[current]; ok {
-		delete(pool.requests, current)
-		delete(pool.blocks, request.BlockHash)
+		pool.remove(request)
 		pool.lastPop = &request.BlockHash
 		return request, ok
 	}
@@ -76,7 +196,33 @@ func (pool *FinishedReqPool) Clear() {
 	for hash := range pool.requests {
 		delete(pool.requests, hash)
 	}
+	for hash := range pool.received {
+		delete(pool.received, hash)
+	}
+	pool.sizes = make(map[Uint256]int)
+	pool.used = make(map[Uint256]uint64)
+	pool.size = 0
 	pool.lastPop = nil
+	pool.space.Broadcast()
+}
+
+// Wait until less than max blocks are in the pool and SyncCacheSize is not reached, 0 to not wait
+func (pool *FinishedReqPool) waitSpace(max int) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	for (max > 0 && len(pool.requests) >= max) || (SyncCacheSize > 0 && pool.size >= SyncCacheSize) {
+		pool.space.Wait()
+	}
+}
+
+// Get the memory in bytes used by the blocks in pool, and how many times a block was looked up
+// and found or not in pool
+func (pool *FinishedReqPool) Stats() (size int, hits, misses uint64) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	return pool.size, pool.hits, pool.misses
 }
 
 func (pool *FinishedReqPool) Length() int {
@@ -85,3 +231,34 @@ func (pool *FinishedReqPool) Length() int {
 
 	return len(pool.requests)
 }
+
+// Get the blocks in pool with their previous block hashes, for diagnostics
+func (pool *FinishedReqPool) Orphans() []OrphanBlock {
+	pool.Lock()
+	defer pool.Unlock()
+
+	orphans := make([]OrphanBlock, 0, len(pool.blocks))
+	for hash, block := range pool.blocks {
+		orphans = append(orphans, OrphanBlock{
+			Hash:     hash,
+			Previous: block.Header.Previous,
+			Height:   block.Header.Height,
+			Received: pool.received[hash],
+		})
+	}
+	return orphans
+}
+
+// Get the received time of the oldest block in pool, zero time if pool is empty
+func (pool *FinishedReqPool) Oldest() time.Time {
+	pool.Lock()
+	defer pool.Unlock()
+
+	var oldest time.Time
+	for _, received := range pool.received {
+		if oldest.IsZero() || received.Before(oldest) {
+			oldest = received
+		}
+	}
+	return oldest
+}
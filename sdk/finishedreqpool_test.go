@@ -0,0 +1,85 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func newTestFinishedRequest(height uint32, inFlight bool) *BlockTxsRequest {
+	block := bloom.MerkleBlock{Header: Header{Previous: Uint256{byte(height)}, Height: height}}
+	return &BlockTxsRequest{
+		BlockHash: block.Header.Hash(),
+		Block:     block,
+		Txs:       []Transaction{{LockTime: height}},
+		inFlight:  inFlight,
+	}
+}
+
+func TestFinishedReqPool_SyncCacheSize(t *testing.T) {
+	defer func(size int) { SyncCacheSize = size }(SyncCacheSize)
+
+	pool := newFinishedReqPool()
+	batch := newTestFinishedRequest(10, true)
+	used := newTestFinishedRequest(11, false)
+	unused := newTestFinishedRequest(12, false)
+	SyncCacheSize = requestSize(batch) * 3
+	for _, request := range []*BlockTxsRequest{batch, used, unused} {
+		pool.Add(request)
+	}
+	if _, ok := pool.Contain(used.BlockHash); !ok {
+		t.Fatal("block 11 not in pool")
+	}
+
+	// The least recently used block not in the sync batch is evicted
+	added := newTestFinishedRequest(13, false)
+	pool.Add(added)
+	if _, ok := pool.Contain(unused.BlockHash); ok {
+		t.Error("least recently used block 12 not evicted")
+	}
+	for _, request := range []*BlockTxsRequest{batch, used, added} {
+		if _, ok := pool.Contain(request.BlockHash); !ok {
+			t.Errorf("block %d evicted", request.Block.Header.Height)
+		}
+	}
+
+	// The blocks of the sync batch are kept over the budget, no more blocks are requested
+	for height := uint32(14); height < 17; height++ {
+		pool.Add(newTestFinishedRequest(height, true))
+	}
+	if pool.Length() != 4 {
+		t.Fatalf("%d blocks in pool, expect the 4 blocks of the sync batch", pool.Length())
+	}
+	for height := uint32(14); height < 17; height++ {
+		if _, ok := pool.Contain(newTestFinishedRequest(height, true).BlockHash); !ok {
+			t.Errorf("sync batch block %d evicted", height)
+		}
+	}
+	waited := make(chan struct{})
+	go func() {
+		pool.waitSpace(0)
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("more blocks requested over SyncCacheSize")
+	case <-time.After(100 * time.Millisecond):
+	}
+	for height := uint32(10); height < 16; height++ {
+		pool.Next(Uint256{byte(height)})
+	}
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("blocks not requested after the sync batch committed")
+	}
+
+	size, hits, misses := pool.Stats()
+	if size != requestSize(batch) || hits != 7 || misses != 1 {
+		t.Errorf("stats size %d, %d hits, %d misses, expect size %d, 7 hits, 1 miss",
+			size, hits, misses, requestSize(batch))
+	}
+}
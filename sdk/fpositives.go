@@ -0,0 +1,58 @@
+package sdk
+
+import (
+	"sync"
+)
+
+// FalsePositiveStats tells how many transactions matched by the bloom filter are false positives
+type FalsePositiveStats struct {
+	// The transactions matched by the filter and committed, in blocks or relayed
+	Matched uint64
+
+	// The matched transactions not related to the wallet
+	FalsePositives uint64
+
+	// The times the filter is reloaded on peers for the false positives
+	Reloads uint64
+}
+
+// falsePositives counts the false positives committed, during sync and after
+type falsePositives struct {
+	sync.Mutex
+	stats   FalsePositiveStats
+	pending int // The false positives since the filter reloaded
+}
+
+// Count the transactions committed, return true if the filter should be reloaded on peers,
+// when the false positives accumulated over MaxFalsePositives, or at once if reload is true
+func (fp *falsePositives) add(matched, fPositives int, reload bool) bool {
+	fp.Lock()
+	defer fp.Unlock()
+
+	fp.stats.Matched += uint64(matched)
+	fp.stats.FalsePositives += uint64(fPositives)
+	fp.pending += fPositives
+	if !reload && fp.pending <= MaxFalsePositives {
+		return false
+	}
+	fp.pending = 0
+	// No filter loaded on peers in full block mode
+	if FullBlockMode {
+		return false
+	}
+	fp.stats.Reloads++
+	return true
+}
+
+func (fp *falsePositives) get() FalsePositiveStats {
+	fp.Lock()
+	defer fp.Unlock()
+
+	return fp.stats
+}
+
+// Get the false positives counted since the service started, the ratio of false positives
+// to matched transactions tells if the bloom filter is sized well for the addresses.
+func (service *SPVServiceImpl) FalsePositiveStats() FalsePositiveStats {
+	return service.fPositives.get()
+}
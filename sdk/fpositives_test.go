@@ -0,0 +1,59 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// A DataStore taking the transactions with lock time 1 as false positives
+type fpDataStore struct {
+	*testDataStore
+}
+
+func (store fpDataStore) CommitTx(tx *db.StoreTx) (bool, error) {
+	return tx.Data.LockTime == 1, nil
+}
+
+func TestSPVServiceImpl_FalsePositivesDuringSync(t *testing.T) {
+	log.Init()
+
+	service := newTestService(t, fpDataStore{newTestDataStore()})
+	service.chain.SetChainState(SYNCING)
+
+	// Each block synced has a wallet transaction and a false positive
+	const blocks = 50
+	var previous Uint256
+	for height := uint32(1); height <= blocks; height++ {
+		block := bloom.MerkleBlock{Header: Header{
+			Previous:  previous,
+			Timestamp: height,
+			Bits:      0x1d00ffff,
+			Height:    height,
+		}}
+		txs := []Transaction{
+			{TxType: TransferAsset, LockTime: 0, PayloadVersion: byte(height)},
+			{TxType: TransferAsset, LockTime: 1, PayloadVersion: byte(height)},
+		}
+		blockHash := block.Header.Hash()
+		service.queue.OnRequestFinished(&BlockTxsRequest{BlockHash: blockHash, Block: block, Txs: txs})
+		previous = blockHash
+	}
+	if height := service.chain.Height(); height != blocks {
+		t.Fatalf("chain height %d, expect %d", height, blocks)
+	}
+
+	// The filter is reloaded every time more than MaxFalsePositives accumulated
+	stats := service.FalsePositiveStats()
+	if stats.Matched != 2*blocks || stats.FalsePositives != blocks {
+		t.Errorf("%d false positives in %d matched, expect %d in %d", stats.FalsePositives, stats.Matched, blocks, 2*blocks)
+	}
+	if expect := uint64(blocks / (MaxFalsePositives + 1)); stats.Reloads != expect {
+		t.Errorf("filter reloaded %d times during sync, expect %d", stats.Reloads, expect)
+	}
+}
@@ -0,0 +1,157 @@
+package sdk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	HeadersFileVersion = 1 // The version of the exported headers format
+)
+
+var ErrChainNotEmpty = errors.New("headers can only be imported into an empty chain")
+
+/*
+Export the headers of the best chain from height 1 to the tip. The format is the version and
+the number of headers in little endian uint32, followed by the serialized headers ordered by height.
+*/
+func (bc *Blockchain) ExportHeaders(w io.Writer) error {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	tip := bc.chainTip()
+	headers := make([]*db.StoreHeader, tip.Height)
+	for header := tip; header.Height > 0; {
+		headers[header.Height-1] = header
+		if header.Height == 1 {
+			break
+		}
+		var err error
+		header, err = bc.GetPrevious(header)
+		if err != nil {
+			return fmt.Errorf("get previous header failed, %s", err)
+		}
+	}
+
+	err := binary.Write(w, binary.LittleEndian, uint32(HeadersFileVersion))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint32(len(headers)))
+	if err != nil {
+		return err
+	}
+	for _, header := range headers {
+		err = header.Header.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Import the headers exported by ExportHeaders into an empty chain, the last header becomes the chain tip.
+The headers must link to each other from height 1 and must not conflict with the checkpoints.
+Headers above the highest checkpoint they contain must have valid proof of work, headers below it
+are proved by linking to the checkpoint. Nothing is imported if any header is invalid.
+The blocks of the imported headers are not scanned for transactions, sync continues from the tip.
+*/
+func (bc *Blockchain) ImportHeaders(r io.Reader) error {
+	var version, count uint32
+	err := binary.Read(r, binary.LittleEndian, &version)
+	if err != nil {
+		return fmt.Errorf("read headers version failed, %s", err)
+	}
+	if version != HeadersFileVersion {
+		return fmt.Errorf("unsupported headers version %d", version)
+	}
+	err = binary.Read(r, binary.LittleEndian, &count)
+	if err != nil {
+		return fmt.Errorf("read headers count failed, %s", err)
+	}
+
+	var headers []Header
+	for i := uint32(0); i < count; i++ {
+		var header Header
+		err = header.Deserialize(r)
+		if err != nil {
+			return fmt.Errorf("read header %d failed, %s", i+1, err)
+		}
+		headers = append(headers, header)
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	if bc.chainTip().Height > 0 {
+		return ErrChainNotEmpty
+	}
+
+	// Check the linkage and the checkpoints, and find the highest checkpoint covering the headers
+	var covered int
+	for i, header := range headers {
+		if header.Height != uint32(i+1) {
+			return fmt.Errorf("header at index %d has height %d", i, header.Height)
+		}
+		if i > 0 && !header.Previous.IsEqual(headers[i-1].Hash()) {
+			return fmt.Errorf("header at height %d does not follow the previous header", header.Height)
+		}
+		if err := bc.CheckCheckpoint(header); err != nil {
+			return err
+		}
+		if _, ok := checkpointAt(header.Height); ok {
+			covered = i + 1
+		}
+	}
+	for _, header := range headers[covered:] {
+		if err := bc.CheckProofOfWork(header); err != nil {
+			return fmt.Errorf("header at height %d, %s", header.Height, err)
+		}
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+
+	// Write the headers at once if the DataStore supports batches
+	store, batch := bc.DataStore.(db.BatchStore)
+	if batch {
+		err = store.BeginBatch()
+		if err != nil {
+			return err
+		}
+	}
+	err = bc.putHeaders(headers)
+	if batch {
+		if commitErr := store.CommitBatch(); err == nil {
+			err = commitErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("Imported ", len(headers), " headers, ", covered, " covered by checkpoints")
+	return nil
+}
+
+func (bc *Blockchain) putHeaders(headers []Header) error {
+	totalWork := new(big.Int)
+	for i, header := range headers {
+		totalWork = new(big.Int).Add(totalWork, CalcWork(header.Bits))
+		err := bc.PutHeader(&db.StoreHeader{Header: header, TotalWork: totalWork}, i == len(headers)-1)
+		if err != nil {
+			return err
+		}
+	}
+	bc.DataStore.PutChainHeight(headers[len(headers)-1].Height)
+	return nil
+}
@@ -0,0 +1,63 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Inventory hashes seen within InvDedupWindow seconds will not be requested again,
+// this reduces the duplicate downloads when several peers announce the same blocks.
+var InvDedupWindow uint32 = 120
+
+// InvCache is a time bounded set of recently seen inventory hashes
+type InvCache struct {
+	sync.Mutex
+	window time.Duration
+	seen   map[Uint256]time.Time
+	order  []Uint256 // Hashes in the order they are seen
+}
+
+func NewInvCache(window time.Duration) *InvCache {
+	return &InvCache{
+		window: window,
+		seen:   make(map[Uint256]time.Time),
+	}
+}
+
+// Add the hash into cache, return false if the hash has been seen within the window.
+// Expired hashes are removed at the same time.
+func (cache *InvCache) Add(hash Uint256) bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	now := time.Now()
+	for len(cache.order) > 0 && now.Sub(cache.seen[cache.order[0]]) >= cache.window {
+		delete(cache.seen, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+
+	if _, ok := cache.seen[hash]; ok {
+		return false
+	}
+	cache.seen[hash] = now
+	cache.order = append(cache.order, hash)
+	return true
+}
+
+// Remove all hashes from cache
+func (cache *InvCache) Clear() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.seen = make(map[Uint256]time.Time)
+	cache.order = nil
+}
+
+func (cache *InvCache) Length() int {
+	cache.Lock()
+	defer cache.Unlock()
+
+	return len(cache.seen)
+}
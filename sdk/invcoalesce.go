@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+/*
+Milliseconds to collect the block inventories from the sync peer before the hashes are queued for
+request. During catch-up peers send many inventories close together, they are queued in one batch
+in the order announced, and the next block hashes are requested once for the batch instead of
+once for each inventory. 0 to queue each inventory as it's received.
+Inventories received while not syncing start the sync at once, they are not collected.
+*/
+var BlockInvWindow uint32 = 0
+
+// blockInvs collects the block hashes announced by the sync peer within BlockInvWindow
+type blockInvs struct {
+	sync.Mutex
+	window time.Duration
+	peer   *net.Peer
+	hashes []*Uint256
+	seen   map[Uint256]bool
+	timer  *time.Timer
+	flush  func(peer *net.Peer, hashes []*Uint256)
+}
+
+func newBlockInvs(window time.Duration, flush func(peer *net.Peer, hashes []*Uint256)) *blockInvs {
+	return &blockInvs{window: window, seen: make(map[Uint256]bool), flush: flush}
+}
+
+// Add the announced hashes, the hashes collected from another peer are dropped
+// as the sync peer changed
+func (invs *blockInvs) add(peer *net.Peer, hashes []*Uint256) {
+	invs.Lock()
+	defer invs.Unlock()
+
+	if invs.peer != peer {
+		invs.reset()
+		invs.peer = peer
+	}
+	for _, hash := range hashes {
+		if invs.seen[*hash] {
+			continue
+		}
+		invs.seen[*hash] = true
+		invs.hashes = append(invs.hashes, hash)
+	}
+	if invs.timer == nil {
+		invs.timer = time.AfterFunc(invs.window, invs.fire)
+	}
+}
+
+// Flush the hashes collected when the window is over
+func (invs *blockInvs) fire() {
+	invs.Lock()
+	peer, hashes := invs.peer, invs.hashes
+	invs.timer = nil
+	invs.peer = nil
+	invs.hashes = nil
+	invs.seen = make(map[Uint256]bool)
+	invs.Unlock()
+
+	if peer != nil && len(hashes) > 0 {
+		invs.flush(peer, hashes)
+	}
+}
+
+// Drop the hashes collected when sync stopped
+func (invs *blockInvs) clear() {
+	invs.Lock()
+	defer invs.Unlock()
+
+	invs.reset()
+}
+
+func (invs *blockInvs) reset() {
+	if invs.timer != nil {
+		invs.timer.Stop()
+		invs.timer = nil
+	}
+	invs.peer = nil
+	invs.hashes = nil
+	invs.seen = make(map[Uint256]bool)
+}
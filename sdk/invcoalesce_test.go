@@ -0,0 +1,64 @@
+package sdk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestBlockInvs_Coalesce(t *testing.T) {
+	type batch struct {
+		peer   *net.Peer
+		hashes []*Uint256
+	}
+	batches := make(chan batch, 4)
+	invs := newBlockInvs(50*time.Millisecond, func(peer *net.Peer, hashes []*Uint256) {
+		batches <- batch{peer: peer, hashes: hashes}
+	})
+
+	// Inventories within the window are queued in one batch in the order announced
+	peer := new(net.Peer)
+	invs.add(peer, []*Uint256{{1}, {2}})
+	invs.add(peer, []*Uint256{{2}, {3}})
+	invs.add(peer, []*Uint256{{4}})
+	select {
+	case b := <-batches:
+		expect := []*Uint256{{1}, {2}, {3}, {4}}
+		if b.peer != peer || !reflect.DeepEqual(b.hashes, expect) {
+			t.Errorf("batch of %d hashes, expect 4 in order", len(b.hashes))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inventories not flushed")
+	}
+	select {
+	case b := <-batches:
+		t.Fatalf("unexpected second batch of %d hashes", len(b.hashes))
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The hashes of the previous sync peer are dropped
+	other := new(net.Peer)
+	invs.add(peer, []*Uint256{{5}})
+	invs.add(other, []*Uint256{{6}})
+	select {
+	case b := <-batches:
+		if b.peer != other || len(b.hashes) != 1 || *b.hashes[0] != (Uint256{6}) {
+			t.Errorf("unexpected batch of %d hashes", len(b.hashes))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inventories not flushed")
+	}
+
+	// Nothing is flushed after cleared
+	invs.add(peer, []*Uint256{{7}})
+	invs.clear()
+	select {
+	case b := <-batches:
+		t.Errorf("batch of %d hashes flushed after cleared", len(b.hashes))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,114 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+// Send a mempool message to the newly connected peer when the chain is synced,
+// the peer will announce the unconfirmed transactions matched the bloom filter,
+// so the payments received while the wallet is offline can be found before confirmed.
+var RequestMemPool = false
+
+// Request the unconfirmed transactions matched the bloom filter from the peer
+func (service *SPVServiceImpl) requestMemPool(peer *net.Peer) {
+	// Only peers relay transactions can announce them
+	if !RequestMemPool || peer.Relay() == 0 {
+		return
+	}
+	// Unconfirmed transactions are useless before the chain synced, unless RelayWhileSyncing is enabled
+	if !RelayWhileSyncing && (service.chain.IsSyncing() || peer.Height() > uint64(service.chain.Height())) {
+		return
+	}
+
+	log.Debug("Request mempool from peer ", peer.ID())
+	go peer.Send(new(msg.MemPool))
+}
+
+// Announced transactions not responded in time are forgotten, a notfound after that is unsolicited
+const TxRequestTimeout = 2 * time.Minute
+
+/*
+txRequests keeps the announced transactions requested out of the request queue by peer,
+a transaction may leave the mempool of the peer before requested, so a notfound for them is expected.
+*/
+type txRequests struct {
+	sync.Mutex
+	requests map[Uint256]map[uint64]time.Time
+}
+
+func newTxRequests() *txRequests {
+	return &txRequests{requests: make(map[Uint256]map[uint64]time.Time)}
+}
+
+func (r *txRequests) add(peer *net.Peer, txId Uint256) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for id, peers := range r.requests {
+		for connID, requested := range peers {
+			if now.Sub(requested) > TxRequestTimeout {
+				delete(peers, connID)
+			}
+		}
+		if len(peers) == 0 {
+			delete(r.requests, id)
+		}
+	}
+
+	peers, ok := r.requests[txId]
+	if !ok {
+		peers = make(map[uint64]time.Time)
+		r.requests[txId] = peers
+	}
+	peers[peer.ConnID()] = now
+}
+
+// Remove the request of the transaction from the peer, return false if it's not requested
+func (r *txRequests) remove(peer *net.Peer, txId Uint256) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	peers, ok := r.requests[txId]
+	if !ok {
+		return false
+	}
+	if _, ok := peers[peer.ConnID()]; !ok {
+		return false
+	}
+	delete(peers, peer.ConnID())
+	if len(peers) == 0 {
+		delete(r.requests, txId)
+	}
+	return true
+}
+
+// Request the announced transactions not seen before
+func (service *SPVServiceImpl) HandleTxInvMsg(peer *net.Peer, inv *msg.Inventory) error {
+	// Transactions received while syncing are kept as orphans, do not request them
+	// unless RelayWhileSyncing is enabled
+	if !service.relayEnabled() {
+		return nil
+	}
+
+	for _, hash := range inv.Hashes {
+		if !service.txInvs.Add(*hash) {
+			continue
+		}
+		if service.chain.IsSyncing() {
+			service.relayed.add(*hash)
+		}
+		service.txRequests.add(peer, *hash)
+		go peer.Send(msg.NewDataReq(p2p.TxData, *hash))
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+func TestTxRequests(t *testing.T) {
+	requests := newTxRequests()
+	peerA, peerB := newTestPeer(1), newTestPeer(2)
+	txId := Uint256{1}
+
+	requests.add(peerA, txId)
+	if requests.remove(peerB, txId) {
+		t.Error("transaction not requested from the peer removed")
+	}
+	if !requests.remove(peerA, txId) {
+		t.Error("requested transaction not removed")
+	}
+	if requests.remove(peerA, txId) {
+		t.Error("transaction removed twice")
+	}
+}
+
+func TestSPVServiceImpl_NotFoundAnnouncedTx(t *testing.T) {
+	log.Init()
+
+	service := newTestService(t, newTestDataStore())
+	peer := newTestPeer(1)
+	service.PeerManager().AddPeer(peer)
+
+	// The transactions announced by the mempool are requested, the peer may not have them anymore
+	txId := Uint256{1}
+	inv := &msg.Inventory{Type: p2p.TxData, Hashes: []*Uint256{&txId}}
+	if err := service.OnInventory(peer, inv); err != nil {
+		t.Fatal(err)
+	}
+	service.OnNotFound(peer, &msg.NotFound{Hash: txId})
+	if peer.Misbehaviors() != 0 {
+		t.Errorf("misbehaviors %d after notfound for requested transaction, expect 0", peer.Misbehaviors())
+	}
+
+	// Responded already, another notfound is unsolicited
+	service.OnNotFound(peer, &msg.NotFound{Hash: txId})
+	if peer.Misbehaviors() != 1 {
+		t.Errorf("misbehaviors %d after unsolicited notfound, expect 1", peer.Misbehaviors())
+	}
+}
@@ -0,0 +1,57 @@
+package sdk
+
+import (
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+const (
+	MaxBlockSize = 8000000 // The max size of a block in bytes
+	MinTxSize    = 60      // The min size of a transaction in bytes
+
+	// A block can not contain more transactions than this
+	MaxBlockTxs = MaxBlockSize / MinTxSize
+)
+
+// Check the transaction count, hashes and flags of the merkle block are in bounds,
+// so a crafted merkle block can not cause large allocations when rebuilding the partial merkle tree.
+func CheckMerkleBlockBounds(block *bloom.MerkleBlock) error {
+	if block.Transactions == 0 {
+		return fmt.Errorf("merkle block has no transactions")
+	}
+	if block.Transactions > MaxBlockTxs {
+		return fmt.Errorf("merkle block transactions %d exceeds the max %d", block.Transactions, MaxBlockTxs)
+	}
+
+	// Hashes are the nodes of the partial merkle tree, there are at most one hash per transaction
+	if len(block.Hashes) == 0 {
+		return fmt.Errorf("merkle block has no hashes")
+	}
+	if uint32(len(block.Hashes)) > block.Transactions {
+		return fmt.Errorf("merkle block hashes %d more than transactions %d",
+			len(block.Hashes), block.Transactions)
+	}
+
+	// Each hash needs a flag bit, and at most every node of the tree is walked
+	minFlags := (len(block.Hashes) + 7) / 8
+	maxFlags := (merkleTreeNodes(block.Transactions) + 7) / 8
+	if len(block.Flags) < minFlags || len(block.Flags) > maxFlags {
+		return fmt.Errorf("merkle block flags length %d out of range [%d, %d]",
+			len(block.Flags), minFlags, maxFlags)
+	}
+
+	return nil
+}
+
+// Get the number of nodes of the merkle tree of the transactions, the width of a level
+// is the width of the level below halved and rounded up, ending with the root
+func merkleTreeNodes(txs uint32) int {
+	nodes := 0
+	for width := int(txs); ; width = (width + 1) / 2 {
+		nodes += width
+		if width <= 1 {
+			return nodes
+		}
+	}
+}
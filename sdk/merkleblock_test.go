@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+func newTestMerkleBlock(txs uint32, hashes int, flags int) *bloom.MerkleBlock {
+	block := &bloom.MerkleBlock{
+		Transactions: txs,
+		Hashes:       make([]*Uint256, hashes),
+		Flags:        make([]byte, flags),
+	}
+	for i := range block.Hashes {
+		block.Hashes[i] = new(Uint256)
+	}
+	return block
+}
+
+func TestCheckMerkleBlockBounds(t *testing.T) {
+	cases := []struct {
+		name  string
+		block *bloom.MerkleBlock
+		valid bool
+	}{
+		{"single transaction", newTestMerkleBlock(1, 1, 1), true},
+		{"partial tree", newTestMerkleBlock(100, 10, 4), true},
+		// All transactions matched, the 41 nodes of the tree are walked
+		{"full match", newTestMerkleBlock(20, 20, 6), true},
+		{"full match odd", newTestMerkleBlock(7, 7, 2), true},
+		{"max transactions", newTestMerkleBlock(MaxBlockTxs, 1, 1), true},
+		{"no transactions", newTestMerkleBlock(0, 1, 1), false},
+		{"oversized transactions", newTestMerkleBlock(MaxBlockTxs+1, 1, 1), false},
+		{"absurd transactions", newTestMerkleBlock(^uint32(0), 1, 1), false},
+		{"no hashes", newTestMerkleBlock(10, 0, 1), false},
+		{"hashes more than transactions", newTestMerkleBlock(2, 3, 1), false},
+		{"flags too short", newTestMerkleBlock(100, 20, 2), false},
+		{"flags too long", newTestMerkleBlock(2, 1, 2), false},
+	}
+
+	for _, c := range cases {
+		err := CheckMerkleBlockBounds(c.block)
+		if c.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expect error", c.name)
+		}
+	}
+}
+
+func TestMerkleTreeNodes(t *testing.T) {
+	for txs, nodes := range map[uint32]int{1: 1, 2: 3, 3: 6, 4: 7, 7: 14, 20: 41} {
+		if n := merkleTreeNodes(txs); n != nodes {
+			t.Errorf("merkle tree of %d transactions has %d nodes, expect %d", txs, n, nodes)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sdk
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Orphan transactions are transactions received before the block transactions request
+// they belong to has started, they will be evicted after OrphanTxTimeout seconds.
+var OrphanTxTimeout uint32 = 300
+
+/*
+The number of orphan transactions a peer can keep in the pool, so one peer sending a stream of
+transactions not belonging to any block request can not take over the pool. The transactions
+beyond it are dropped and the peer is scored as misbehaving. 0 to not limit.
+*/
+var MaxOrphanTxsPerPeer = 100
+
+// The peer has MaxOrphanTxsPerPeer orphan transactions in pool, the transaction is dropped
+var ErrPeerOrphansFull = errors.New("too many orphan transactions from peer")
+
+type orphanTx struct {
+	tx       *Transaction
+	peer     uint64
+	received time.Time
+}
+
+type OrphanTxPool struct {
+	sync.Mutex
+	ttl     time.Duration
+	txs     map[Uint256]*orphanTx
+	peers   map[uint64]int // The number of orphans in pool by the peer sent them
+	evicted uint64
+}
+
+func NewOrphanTxPool(ttl time.Duration) *OrphanTxPool {
+	return &OrphanTxPool{
+		ttl:   ttl,
+		txs:   make(map[Uint256]*orphanTx),
+		peers: make(map[uint64]int),
+	}
+}
+
+// Add a transaction into the orphan pool, expired orphans will be evicted at the same time
+func (pool *OrphanTxPool) AddOrphanTxn(tx *Transaction) {
+	pool.AddPeerOrphanTxn(0, tx)
+}
+
+/*
+Add a transaction sent by the peer into the orphan pool, expired orphans will be evicted at the
+same time. The peer is the local connection id of the peer, 0 means not sent by a peer, it's not
+limited. Returns false and the transaction is not added if the peer already has MaxOrphanTxsPerPeer
+orphans in pool. A transaction already in pool is kept as it is, still accounted to the peer sent it first.
+*/
+func (pool *OrphanTxPool) AddPeerOrphanTxn(peer uint64, tx *Transaction) bool {
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.evictExpired(time.Now())
+	if peer != 0 && MaxOrphanTxsPerPeer > 0 && pool.peers[peer] >= MaxOrphanTxsPerPeer {
+		return false
+	}
+	txId := tx.Hash()
+	if _, ok := pool.txs[txId]; ok {
+		return true
+	}
+	pool.txs[txId] = &orphanTx{tx: tx, peer: peer, received: time.Now()}
+	if peer != 0 {
+		pool.peers[peer]++
+	}
+	return true
+}
+
+// Take out the orphan transaction with the given id, it will be removed from pool
+func (pool *OrphanTxPool) GetOrphanTxn(txId Uint256) (*Transaction, bool) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	orphan, ok := pool.txs[txId]
+	if !ok {
+		return nil, false
+	}
+	pool.remove(txId, orphan)
+	return orphan.tx, true
+}
+
+func (pool *OrphanTxPool) remove(txId Uint256, orphan *orphanTx) {
+	delete(pool.txs, txId)
+	if orphan.peer == 0 {
+		return
+	}
+	if pool.peers[orphan.peer]--; pool.peers[orphan.peer] <= 0 {
+		delete(pool.peers, orphan.peer)
+	}
+}
+
+// Remove orphan transactions stayed in pool longer than the ttl, return how many are evicted
+func (pool *OrphanTxPool) EvictExpired() int {
+	pool.Lock()
+	defer pool.Unlock()
+
+	return pool.evictExpired(time.Now())
+}
+
+func (pool *OrphanTxPool) evictExpired(now time.Time) int {
+	var evicted int
+	for txId, orphan := range pool.txs {
+		if now.Sub(orphan.received) < pool.ttl {
+			continue
+		}
+		pool.remove(txId, orphan)
+		log.Debug("Orphan transaction expired: ", txId.String())
+		evicted++
+	}
+	pool.evicted += uint64(evicted)
+	return evicted
+}
+
+// Get the total count of evicted orphan transactions
+func (pool *OrphanTxPool) Evicted() uint64 {
+	pool.Lock()
+	defer pool.Unlock()
+
+	return pool.evicted
+}
+
+// Get the number of orphan transactions in pool by the peer sent them, unknown peers are not included
+func (pool *OrphanTxPool) PeerOrphans() map[uint64]int {
+	pool.Lock()
+	defer pool.Unlock()
+
+	peers := make(map[uint64]int, len(pool.peers))
+	for peer, count := range pool.peers {
+		peers[peer] = count
+	}
+	return peers
+}
+
+func (pool *OrphanTxPool) Length() int {
+	pool.Lock()
+	defer pool.Unlock()
+
+	return len(pool.txs)
+}
+
+// Get the received time of the oldest orphan transaction, zero time if pool is empty
+func (pool *OrphanTxPool) Oldest() time.Time {
+	pool.Lock()
+	defer pool.Unlock()
+
+	var oldest time.Time
+	for _, orphan := range pool.txs {
+		if oldest.IsZero() || orphan.received.Before(oldest) {
+			oldest = orphan.received
+		}
+	}
+	return oldest
+}
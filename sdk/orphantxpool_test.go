@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestOrphanTxPool_EvictExpired(t *testing.T) {
+	pool := NewOrphanTxPool(time.Millisecond * 50)
+
+	tx := &Transaction{TxType: TransferAsset}
+	pool.AddOrphanTxn(tx)
+
+	// Not expired yet
+	if evicted := pool.EvictExpired(); evicted != 0 {
+		t.Errorf("orphan evicted before ttl, evicted %d", evicted)
+	}
+	if pool.Length() != 1 {
+		t.Errorf("orphan pool length %d, expect 1", pool.Length())
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	if evicted := pool.EvictExpired(); evicted != 1 {
+		t.Errorf("orphan not evicted after ttl, evicted %d", evicted)
+	}
+	if pool.Length() != 0 {
+		t.Errorf("orphan pool length %d, expect 0", pool.Length())
+	}
+	if pool.Evicted() != 1 {
+		t.Errorf("evicted count %d, expect 1", pool.Evicted())
+	}
+	if _, ok := pool.GetOrphanTxn(tx.Hash()); ok {
+		t.Error("evicted orphan still can be taken out from pool")
+	}
+}
+
+func TestOrphanTxPool_GetOrphanTxn(t *testing.T) {
+	pool := NewOrphanTxPool(time.Minute)
+
+	tx := &Transaction{TxType: TransferAsset}
+	pool.AddOrphanTxn(tx)
+
+	orphan, ok := pool.GetOrphanTxn(tx.Hash())
+	if !ok || orphan != tx {
+		t.Fatal("orphan transaction not found in pool")
+	}
+	if pool.Length() != 0 {
+		t.Errorf("orphan not removed after taken out, length %d", pool.Length())
+	}
+}
+
+func TestOrphanTxPool_AddPeerOrphanTxn(t *testing.T) {
+	defer func(max int) { MaxOrphanTxsPerPeer = max }(MaxOrphanTxsPerPeer)
+	MaxOrphanTxsPerPeer = 3
+
+	pool := NewOrphanTxPool(time.Minute)
+	for i := uint32(0); i < 5; i++ {
+		added := pool.AddPeerOrphanTxn(1, &Transaction{TxType: TransferAsset, LockTime: i})
+		if added != (i < 3) {
+			t.Errorf("orphan %d from the flooding peer added %v", i, added)
+		}
+	}
+
+	// Other peers and unknown peers are not affected
+	if !pool.AddPeerOrphanTxn(2, &Transaction{TxType: TransferAsset, LockTime: 100}) {
+		t.Error("orphan from another peer not added")
+	}
+	if !pool.AddPeerOrphanTxn(0, &Transaction{TxType: TransferAsset, LockTime: 101}) {
+		t.Error("orphan from unknown peer not added")
+	}
+	if peers := pool.PeerOrphans(); len(peers) != 2 || peers[1] != 3 || peers[2] != 1 {
+		t.Errorf("orphans by peer %v, expect 3 from peer 1 and 1 from peer 2", peers)
+	}
+
+	// Taking an orphan out makes room for the peer
+	if _, ok := pool.GetOrphanTxn((&Transaction{TxType: TransferAsset, LockTime: 0}).Hash()); !ok {
+		t.Fatal("orphan from the flooding peer not found")
+	}
+	if !pool.AddPeerOrphanTxn(1, &Transaction{TxType: TransferAsset, LockTime: 5}) {
+		t.Error("orphan not added after the peer's orphan taken out")
+	}
+	if pool.Length() != 5 {
+		t.Errorf("orphan pool length %d, expect 5", pool.Length())
+	}
+
+	// Resending the orphan of another peer does not take it over or evict it
+	other := &Transaction{TxType: TransferAsset, LockTime: 100}
+	if pool.AddPeerOrphanTxn(1, other) {
+		t.Error("orphan added from the peer reached the limit")
+	}
+	if !pool.AddPeerOrphanTxn(3, other) {
+		t.Error("orphan already in pool not accepted")
+	}
+	if peers := pool.PeerOrphans(); peers[1] != 3 || peers[2] != 1 || peers[3] != 0 {
+		t.Errorf("orphans by peer %v after resent, expect 3 from peer 1 and 1 from peer 2", peers)
+	}
+	if pool.Length() != 5 {
+		t.Errorf("orphan pool length %d after resent, expect 5", pool.Length())
+	}
+}
@@ -11,6 +11,17 @@ import (
 	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
 )
 
+// No seed addresses to start connecting peers from
+var ErrNoSeeds = errors.New("Seeds list is empty, no peers to connect, set the seed addresses in SeedList")
+
+var (
+	// The services advertised to peers in the version message, ServiveSPV is added in ServerMode
+	AdvertisedServices uint64 = 0
+
+	// Ask peers in the version message to relay unconfirmed transactions to us
+	RequestRelay = false
+)
+
 type P2PClientImpl struct {
 	msgHandler  P2PMessageHandler
 	peerManager *net.PeerManager
@@ -22,6 +33,10 @@ func NewP2PClientImpl(magic uint32, clientId uint64, seeds []string) (*P2PClient
 	local.SetID(clientId)
 	local.SetVersion(ProtocolVersion)
 	local.SetPort(SPVClientPort)
+	local.SetServices(AdvertisedServices)
+	if RequestRelay {
+		local.SetRelay(1)
+	}
 
 	if magic == 0 {
 		return nil, errors.New("Magic number has not been set ")
@@ -29,15 +44,17 @@ func NewP2PClientImpl(magic uint32, clientId uint64, seeds []string) (*P2PClient
 	// Set Magic number of the P2P network
 	p2p.Magic = magic
 
+	// Blank seeds would leave nothing to connect without telling
+	seeds = toSPVAddr(seeds)
 	if len(seeds) == 0 {
-		return nil, errors.New("Seeds list is empty ")
+		return nil, ErrNoSeeds
 	}
 
 	// Create client instance
 	client := new(P2PClientImpl)
 
 	// Initialize peer manager
-	client.peerManager = net.InitPeerManager(local, toSPVAddr(seeds))
+	client.peerManager = net.InitPeerManager(local, seeds)
 
 	// Set message handler
 	client.peerManager.SetMessageHandler(client)
@@ -54,15 +71,19 @@ func (client *P2PClientImpl) Start() {
 	client.peerManager.Start()
 }
 
-// Convert seed addresses to SPVServerPort according to the SPV protocol
+// Convert seed addresses to SPVServerPort according to the SPV protocol, blank seeds are dropped
 func toSPVAddr(seeds []string) []string {
-	var addrs = make([]string, len(seeds))
-	for i, seed := range seeds {
+	var addrs = make([]string, 0, len(seeds))
+	for _, seed := range seeds {
+		seed = strings.TrimSpace(seed)
+		if seed == "" {
+			continue
+		}
 		portIndex := strings.LastIndex(seed, ":")
 		if portIndex > 0 {
-			addrs[i] = fmt.Sprint(string([]byte(seed)[:portIndex]), ":", SPVServerPort)
+			addrs = append(addrs, fmt.Sprint(string([]byte(seed)[:portIndex]), ":", SPVServerPort))
 		} else {
-			addrs[i] = fmt.Sprint(seed, ":", SPVServerPort)
+			addrs = append(addrs, fmt.Sprint(seed, ":", SPVServerPort))
 		}
 	}
 	return addrs
@@ -74,7 +95,8 @@ func (client *P2PClientImpl) OnHandshake(v *msg.Version) error {
 		return errors.New(fmt.Sprint("To support SPV protocol, peer version must greater than ", ProtocolVersion))
 	}
 
-	if v.Services/ServiveSPV&1 == 0 {
+	// In server mode, SPV clients without the SPV service are accepted as downstream peers
+	if v.Services/ServiveSPV&1 == 0 && !ServerMode {
 		return errors.New("SPV service not enabled on connected peer")
 	}
 
@@ -0,0 +1,22 @@
+package sdk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToSPVAddr(t *testing.T) {
+	seeds := []string{"1.1.1.1:20338", " ", "seed.example.org", ""}
+	expect := []string{"1.1.1.1:20866", "seed.example.org:20866"}
+	if addrs := toSPVAddr(seeds); !reflect.DeepEqual(addrs, expect) {
+		t.Errorf("seed addresses %v, expect %v", addrs, expect)
+	}
+}
+
+func TestNewP2PClientImpl_NoSeeds(t *testing.T) {
+	for _, seeds := range [][]string{nil, {}, {"", "  "}} {
+		if _, err := NewP2PClientImpl(MainNetMagic, 1, seeds); err != ErrNoSeeds {
+			t.Errorf("client with seeds %q returns %v, expect ErrNoSeeds", seeds, err)
+		}
+	}
+}
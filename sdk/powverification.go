@@ -0,0 +1,85 @@
+package sdk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// PoWVerificationMode decides the received blocks whose proof-of-work is verified
+type PoWVerificationMode uint8
+
+const (
+	// The proof-of-work of every block is verified from the genesis block. It's the most secure,
+	// a peer can not feed a fake chain without the hash power, and the slowest on the initial sync.
+	PoWVerifyFull PoWVerificationMode = 0
+
+	// The proof-of-work is verified only for the blocks above the highest checkpoint. The blocks below
+	// are trusted to be on the main chain as they must connect to the checkpoint hash, a fake chain is
+	// rejected when it reaches the checkpoint, but not before. Same as full without checkpoints.
+	PoWVerifyCheckpoints PoWVerificationMode = 1
+
+	// The proof-of-work of the blocks from the trusted peers, added by PeerManager.AddManualPeer,
+	// is not verified, the blocks from other peers are verified in full. It's the fastest and
+	// only as secure as the trusted peers, use it with peers under your control.
+	PoWVerifyTrusted PoWVerificationMode = 2
+)
+
+// The mode used to verify the proof-of-work of the received blocks
+var PoWVerification = PoWVerifyCheckpoints
+
+var powVerificationModes = map[string]PoWVerificationMode{
+	"full":        PoWVerifyFull,
+	"checkpoints": PoWVerifyCheckpoints,
+	"trusted":     PoWVerifyTrusted,
+}
+
+// Parse the proof-of-work verification mode name, full, checkpoints or trusted, case insensitive
+func ParsePoWVerificationMode(name string) (PoWVerificationMode, error) {
+	mode, ok := powVerificationModes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown proof-of-work verification mode %q, must be full, checkpoints or trusted", name)
+	}
+	return mode, nil
+}
+
+func (mode PoWVerificationMode) String() string {
+	for name, m := range powVerificationModes {
+		if m == mode {
+			return name
+		}
+	}
+	return fmt.Sprintf("PoWVerificationMode(%d)", uint8(mode))
+}
+
+/*
+Check if the proof-of-work of the block received from a trusted peer or not should be verified.
+The height is where the block connects to the stored chain, 0 if its previous block is unknown,
+and tip is the local chain height. The height claimed in the header is not trusted.
+*/
+func (mode PoWVerificationMode) Verifies(height, tip uint32, trusted bool) bool {
+	switch mode {
+	case PoWVerifyCheckpoints:
+		highest, ok := lastCheckpoint(^uint32(0))
+		return !ok || height == 0 || height > highest.Height || tip >= highest.Height
+	case PoWVerifyTrusted:
+		return !trusted
+	default:
+		return true
+	}
+}
+
+// Check the proof-of-work of the header received from the peer as PoWVerification requires
+func (service *SPVServiceImpl) checkProofOfWork(peer *net.Peer, header Header) error {
+	height := service.chain.connectHeight(&header)
+	if height != header.Height {
+		height = 0
+	}
+	if !PoWVerification.Verifies(height, service.chain.Height(), peer.Manual()) {
+		return nil
+	}
+	return service.chain.CheckProofOfWork(header)
+}
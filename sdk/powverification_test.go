@@ -0,0 +1,139 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestPoWVerificationMode_Verifies(t *testing.T) {
+	defer func(checkpoints []Checkpoint) { Checkpoints = checkpoints }(Checkpoints)
+	Checkpoints = []Checkpoint{{Height: 0, Hash: Uint256{0xee}}, {Height: 100, Hash: Uint256{0x64}}}
+
+	tests := []struct {
+		mode        PoWVerificationMode
+		height, tip uint32
+		trusted     bool
+		verifies    bool
+	}{
+		{PoWVerifyFull, 1, 0, false, true},
+		{PoWVerifyFull, 100, 99, true, true},
+		{PoWVerifyCheckpoints, 1, 0, false, false},
+		{PoWVerifyCheckpoints, 100, 99, false, false},
+		{PoWVerifyCheckpoints, 101, 100, true, true},
+		// The previous block is unknown
+		{PoWVerifyCheckpoints, 0, 50, false, true},
+		// The local chain passed the checkpoint, the block is on a fork below it
+		{PoWVerifyCheckpoints, 50, 100, false, true},
+		{PoWVerifyTrusted, 1, 0, true, false},
+		{PoWVerifyTrusted, 101, 100, true, false},
+		{PoWVerifyTrusted, 1, 0, false, true},
+	}
+	for _, test := range tests {
+		if verifies := test.mode.Verifies(test.height, test.tip, test.trusted); verifies != test.verifies {
+			t.Errorf("%s verifies height %d at tip %d trusted %v: %v, expect %v",
+				test.mode, test.height, test.tip, test.trusted, verifies, test.verifies)
+		}
+	}
+
+	// Without checkpoints every block is verified
+	Checkpoints = nil
+	if !PoWVerifyCheckpoints.Verifies(1, 0, false) {
+		t.Error("checkpoints mode does not verify without checkpoints")
+	}
+}
+
+func TestParsePoWVerificationMode(t *testing.T) {
+	for _, mode := range []PoWVerificationMode{PoWVerifyFull, PoWVerifyCheckpoints, PoWVerifyTrusted} {
+		parsed, err := ParsePoWVerificationMode(mode.String())
+		if err != nil || parsed != mode {
+			t.Errorf("parse %q got %v, %v", mode.String(), parsed, err)
+		}
+	}
+	if _, err := ParsePoWVerificationMode("none"); err == nil {
+		t.Error("unknown mode parsed")
+	}
+}
+
+func TestSPVServiceImpl_PoWVerification(t *testing.T) {
+	log.Init()
+	defer func(mode PoWVerificationMode, checkpoints []Checkpoint) {
+		PoWVerification, Checkpoints = mode, checkpoints
+	}(PoWVerification, Checkpoints)
+
+	// A chain of blocks with a target easier than PowLimit allows, the checkpoint is at height 3
+	genesis := Uint256{0xee}
+	unmined := func(previous Uint256, height uint32) *bloom.MerkleBlock {
+		coinbase := Uint256{byte(height)}
+		return &bloom.MerkleBlock{
+			Header: Header{
+				Previous:   previous,
+				MerkleRoot: coinbase,
+				Timestamp:  uint32(time.Now().Unix()) - 100 + height,
+				Bits:       0x2100ffff,
+				Height:     height,
+			},
+			Transactions: 1,
+			Hashes:       []*Uint256{&coinbase},
+			Flags:        []byte{0},
+		}
+	}
+	previous := genesis
+	var blocks []*bloom.MerkleBlock
+	for height := uint32(1); height <= 4; height++ {
+		block := unmined(previous, height)
+		blocks = append(blocks, block)
+		previous = block.Header.Hash()
+	}
+	Checkpoints = []Checkpoint{{Height: 0, Hash: genesis}, {Height: 3, Hash: blocks[2].Header.Hash()}}
+
+	tests := []struct {
+		mode    PoWVerificationMode
+		trusted bool
+		// The number of blocks accepted in order
+		accepted int
+	}{
+		{PoWVerifyFull, false, 0},
+		{PoWVerifyCheckpoints, false, 3},
+		{PoWVerifyTrusted, false, 0},
+		{PoWVerifyTrusted, true, 4},
+	}
+	for _, test := range tests {
+		PoWVerification = test.mode
+		service := newTestService(t, newTestDataStore())
+		pm := service.PeerManager()
+		peer := newTestPeer(1)
+		if test.trusted {
+			pm.AddManualPeer(peer.Addr().String())
+			pm.AddConnectedPeer(peer)
+		}
+
+		var accepted int
+		for _, block := range blocks {
+			if service.OnMerkleBlock(peer, block) != nil {
+				break
+			}
+			accepted++
+
+			// A block extending the tip claiming a height below the checkpoint is verified
+			if block.Header.Height == 2 && !test.trusted {
+				forged := unmined(block.Header.Hash(), 2)
+				if err := service.OnMerkleBlock(peer, forged); err == nil {
+					t.Errorf("%s accepted a block claiming height 2 at height 3 without proof-of-work", test.mode)
+				}
+			}
+		}
+		if accepted != test.accepted {
+			t.Errorf("%s accepted %d blocks without proof-of-work from trusted %v peer, expect %d",
+				test.mode, accepted, test.trusted, test.accepted)
+		}
+		if height := service.Blockchain().Height(); height != uint32(test.accepted) {
+			t.Errorf("%s chain height %d, expect %d", test.mode, height, test.accepted)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sdk
+
+import (
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Inputs with sequence not greater than this signal the transaction can be replaced by a higher fee one
+const MaxRBFSequence uint32 = 0xfffffffd
+
+// Check if any input of the transaction signals replace-by-fee
+func SignalsReplacement(tx *core.Transaction) bool {
+	for _, input := range tx.Inputs {
+		if input.Sequence <= MaxRBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Check if the unconfirmed transaction replaces the old unconfirmed one.
+A replacement spends the same inputs as the old transaction signaled replace-by-fee,
+and pays a higher fee, as the inputs are the same, it means a lower output amount.
+*/
+func IsReplacement(old, tx *core.Transaction) bool {
+	if old.Hash() == tx.Hash() || !SignalsReplacement(old) {
+		return false
+	}
+	if len(old.Inputs) != len(tx.Inputs) {
+		return false
+	}
+
+	inputs := make(map[core.OutPoint]bool, len(old.Inputs))
+	for _, input := range old.Inputs {
+		inputs[input.Previous] = true
+	}
+	for _, input := range tx.Inputs {
+		if !inputs[input.Previous] {
+			return false
+		}
+	}
+
+	return outputAmount(tx) < outputAmount(old)
+}
+
+func outputAmount(tx *core.Transaction) common.Fixed64 {
+	var amount common.Fixed64
+	for _, output := range tx.Outputs {
+		amount += output.Value
+	}
+	return amount
+}
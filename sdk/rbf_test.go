@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+func newRBFTx(lockTime uint32, sequence uint32, amount common.Fixed64, inputs ...core.OutPoint) *core.Transaction {
+	tx := &core.Transaction{TxType: core.TransferAsset, LockTime: lockTime}
+	for _, op := range inputs {
+		tx.Inputs = append(tx.Inputs, &core.Input{Previous: op, Sequence: sequence})
+	}
+	tx.Outputs = append(tx.Outputs, &core.Output{Value: amount})
+	return tx
+}
+
+func TestIsReplacement(t *testing.T) {
+	op1 := core.OutPoint{TxID: common.Uint256{1}, Index: 0}
+	op2 := core.OutPoint{TxID: common.Uint256{2}, Index: 1}
+
+	// Replacement chain, each pays a higher fee than the previous one
+	tx1 := newRBFTx(1, 0, 100, op1, op2)
+	tx2 := newRBFTx(2, 0, 90, op2, op1)
+	tx3 := newRBFTx(3, MaxRBFSequence+1, 80, op1, op2)
+
+	if !IsReplacement(tx1, tx2) {
+		t.Error("tx2 should replace tx1")
+	}
+	if !IsReplacement(tx2, tx3) {
+		t.Error("tx3 should replace tx2")
+	}
+	if !IsReplacement(tx1, tx3) {
+		t.Error("tx3 should replace tx1")
+	}
+	// tx3 does not signal replacement, it's final
+	if IsReplacement(tx3, newRBFTx(4, 0, 70, op1, op2)) {
+		t.Error("transaction not signaled replaced")
+	}
+	// Lower fee can not replace
+	if IsReplacement(tx2, tx1) {
+		t.Error("replaced by a lower fee transaction")
+	}
+	if IsReplacement(tx1, tx1) {
+		t.Error("transaction replaced by itself")
+	}
+	// Different inputs is a double spend, not a replacement
+	if IsReplacement(tx1, newRBFTx(5, 0, 50, op1)) {
+		t.Error("replaced by a transaction with different inputs")
+	}
+	if IsReplacement(tx1, newRBFTx(6, 0, 50, op1, core.OutPoint{TxID: common.Uint256{3}})) {
+		t.Error("replaced by a transaction with different inputs")
+	}
+}
+
+func TestSignalsReplacement(t *testing.T) {
+	op := core.OutPoint{TxID: common.Uint256{1}}
+	if !SignalsReplacement(newRBFTx(1, MaxRBFSequence, 1, op)) {
+		t.Error("sequence MaxRBFSequence should signal replacement")
+	}
+	if SignalsReplacement(newRBFTx(1, MaxRBFSequence+1, 1, op)) {
+		t.Error("sequence above MaxRBFSequence should not signal replacement")
+	}
+}
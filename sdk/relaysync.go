@@ -0,0 +1,57 @@
+package sdk
+
+import (
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+/*
+Request the transactions announced by peers and the mempool of new peers while syncing, so the
+unconfirmed payments are found before the chain synced. By default the relay traffic is ignored
+until synced, to leave the bandwidth to the blocks download.
+*/
+var RelayWhileSyncing = false
+
+// relayedTxs keeps the transactions requested by announcements while syncing,
+// they are received out of the block download and committed as unconfirmed.
+type relayedTxs struct {
+	sync.Mutex
+	txs map[Uint256]bool
+}
+
+func newRelayedTxs() *relayedTxs {
+	return &relayedTxs{txs: make(map[Uint256]bool)}
+}
+
+func (relayed *relayedTxs) add(txId Uint256) {
+	relayed.Lock()
+	defer relayed.Unlock()
+
+	relayed.txs[txId] = true
+}
+
+// Remove the transaction, return false if it's not requested by an announcement
+func (relayed *relayedTxs) remove(txId Uint256) bool {
+	relayed.Lock()
+	defer relayed.Unlock()
+
+	if !relayed.txs[txId] {
+		return false
+	}
+	delete(relayed.txs, txId)
+	return true
+}
+
+// Forget the requests not responded when sync stopped
+func (relayed *relayedTxs) clear() {
+	relayed.Lock()
+	defer relayed.Unlock()
+
+	relayed.txs = make(map[Uint256]bool)
+}
+
+// Check if the relay traffic is handled at the moment
+func (service *SPVServiceImpl) relayEnabled() bool {
+	return RelayWhileSyncing || !service.chain.IsSyncing()
+}
@@ -0,0 +1,31 @@
+package sdk
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestRelayedTxs(t *testing.T) {
+	relayed := newRelayedTxs()
+	txA := Uint256{1}
+	txB := Uint256{2}
+
+	relayed.add(txA)
+	if relayed.remove(txB) {
+		t.Error("transaction not announced removed as relayed")
+	}
+	if !relayed.remove(txA) {
+		t.Error("announced transaction not relayed")
+	}
+	if relayed.remove(txA) {
+		t.Error("relayed transaction received twice")
+	}
+
+	// Requests not responded are forgotten when sync stopped
+	relayed.add(txB)
+	relayed.clear()
+	if relayed.remove(txB) {
+		t.Error("relayed transaction kept after cleared")
+	}
+}
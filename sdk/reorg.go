@@ -0,0 +1,49 @@
+package sdk
+
+import (
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+/*
+Register a listener to be notified when the chain is reorganized. The detached blocks are
+rolled back from the chain, the attached blocks are the known blocks of the new best chain,
+both are ordered by height from the common ancestor. The attached blocks are downloaded and
+committed by the sync restarted after the reorganize. Transactions confirmed in the detached
+blocks are rolled back with OnChainRollback of the state listeners.
+*/
+func (bc *Blockchain) OnReorg(listener func(detached, attached []Uint256, commonAncestor uint32)) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.reorgListeners = append(bc.reorgListeners, listener)
+}
+
+// Get the number of reorganizes happened since the blockchain is created
+func (bc *Blockchain) Reorgs() int {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.reorgs
+}
+
+func (bc *Blockchain) notifyReorg(detached, attached []Uint256, commonAncestor uint32) {
+	for _, listener := range bc.reorgListeners {
+		go listener(detached, attached, commonAncestor)
+	}
+}
+
+// Get the hashes of the branch from the header back to the ancestor, ordered by height
+func (bc *Blockchain) branchHashes(header, ancestor *db.StoreHeader) ([]Uint256, error) {
+	var hashes []Uint256
+	var err error
+	for header.Height > ancestor.Height {
+		hashes = append([]Uint256{header.Hash()}, hashes...)
+		header, err = bc.GetPrevious(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
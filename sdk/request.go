@@ -2,10 +2,11 @@ package sdk
 
 import (
 	"errors"
+	"sync"
 	"time"
 
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.SPV/net"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 const (
@@ -19,43 +20,106 @@ type RequestHandler interface {
 }
 
 type Request struct {
-	peer       *net.Peer
-	hash       Uint256
-	reqType    uint8
-	retryTimes int
-	doneChan   chan byte
-	handler    RequestHandler
+	sync.Mutex
+	peer     *net.Peer
+	hash     Uint256
+	reqType  uint8
+	doneChan chan byte
+	handler  RequestHandler
+	// The connection IDs of the peers responded notfound to this request
+	notFound map[uint64]bool
 }
 
 func (r *Request) Start() error {
 	if r.handler == nil {
 		return errors.New("RequestHandler not set")
 	}
+	r.Lock()
 	r.doneChan = make(chan byte)
-	go r.sendRequest()
+	done := r.doneChan
+	r.Unlock()
+	go r.sendRequest(done)
 	return nil
 }
 
-func (r *Request) sendRequest() {
-	r.handler.OnSendRequest(r.peer, r.reqType, r.hash)
-	timer := time.NewTimer(time.Second * RequestTimeout)
-	select {
-	case <-timer.C:
-		if r.retryTimes >= MaxRetryTimes {
-			r.Finish()
-			r.handler.OnRequestTimeout(r.hash)
-			break
+// Send the request and retry on timeout, until done is closed. The retries are counted
+// by the goroutine of each start, so a reassigned request is retried MaxRetryTimes again.
+func (r *Request) sendRequest(done chan byte) {
+	for retryTimes := 0; ; retryTimes++ {
+		r.handler.OnSendRequest(r.Peer(), r.reqType, r.hash)
+		timer := time.NewTimer(time.Second * RequestTimeout)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+		if retryTimes < MaxRetryTimes {
+			continue
+		}
+
+		r.Lock()
+		// Finished or reassigned when timeout
+		if r.doneChan != done {
+			r.Unlock()
+			return
 		}
-		r.retryTimes++
-		r.sendRequest()
-	case <-r.doneChan:
-		timer.Stop()
+		r.doneChan = nil
+		r.Unlock()
+		r.handler.OnRequestTimeout(r.hash)
+		return
 	}
 }
 
+// Get the peer this request is sending to
+func (r *Request) Peer() *net.Peer {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.peer
+}
+
+// Set the peer of a request not started yet
+func (r *Request) setPeer(peer *net.Peer) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.peer = peer
+}
+
+// Stop the current request and send it again to the given peer
+func (r *Request) Reassign(peer *net.Peer) {
+	r.Finish()
+	r.setPeer(peer)
+	r.Start()
+}
+
+// Mark the peer does not have the requested data
+func (r *Request) setNotFound(peer *net.Peer) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.notFound == nil {
+		r.notFound = make(map[uint64]bool)
+	}
+	r.notFound[peer.ConnID()] = true
+}
+
+// Check if the peer responded notfound to this request
+func (r *Request) isNotFound(peer *net.Peer) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.notFound[peer.ConnID()]
+}
+
 func (r *Request) Finish() {
-	if r.doneChan != nil {
-		r.doneChan <- 1
-		r.doneChan = nil
+	r.Lock()
+	done := r.doneChan
+	r.doneChan = nil
+	r.Unlock()
+
+	if done != nil {
+		close(done)
 	}
 }
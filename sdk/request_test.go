@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+type countRequestHandler struct {
+	sync.Mutex
+	sent map[uint64]int
+}
+
+func (h *countRequestHandler) OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.sent[peer.ID()]++
+}
+
+func (h *countRequestHandler) OnRequestTimeout(hash Uint256) {}
+
+func TestRequest_ReassignConcurrently(t *testing.T) {
+	handler := &countRequestHandler{sent: make(map[uint64]int)}
+	peer := new(net.Peer)
+	peer.SetID(1)
+	request := &Request{peer: peer, hash: Uint256{1}, handler: handler}
+	if err := request.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reassigned while the sending goroutines are running, run with -race to check
+	var wg sync.WaitGroup
+	for i := uint64(2); i < 12; i++ {
+		other := new(net.Peer)
+		other.SetID(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request.Reassign(other)
+		}()
+	}
+	wg.Wait()
+	request.Finish()
+	request.Finish()
+
+	if request.Peer() == peer {
+		t.Error("request not reassigned")
+	}
+	if request.doneChan != nil {
+		t.Error("request not finished")
+	}
+}
@@ -4,14 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/net"
 
-	"github.com/elastos/Elastos.ELA/bloom"
-	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type RequestQueueHandler interface {
@@ -22,6 +23,7 @@ type RequestQueueHandler interface {
 
 type RequestQueue struct {
 	size             int
+	peerLock         *sync.RWMutex
 	peer             *net.Peer
 	hashesQueue      chan Uint256
 	blocksQueue      chan Uint256
@@ -32,12 +34,15 @@ type RequestQueue struct {
 	blockTxsRequests map[Uint256]*BlockTxsRequest
 	blockTxs         map[Uint256]Uint256
 	finished         *FinishedReqPool
+	orphans          *OrphanTxPool
+	invs             *InvCache
 	handler          RequestQueueHandler
 }
 
 func NewRequestQueue(size int, handler RequestQueueHandler) *RequestQueue {
 	queue := new(RequestQueue)
 	queue.size = size
+	queue.peerLock = new(sync.RWMutex)
 	queue.hashesQueue = make(chan Uint256, size)
 	queue.blocksQueue = make(chan Uint256, size)
 	queue.blockTxsQueue = make(chan Uint256, size)
@@ -46,10 +51,9 @@ func NewRequestQueue(size int, handler RequestQueueHandler) *RequestQueue {
 	queue.blockTxsReqsLock = new(sync.Mutex)
 	queue.blockTxsRequests = make(map[Uint256]*BlockTxsRequest)
 	queue.blockTxs = make(map[Uint256]Uint256)
-	queue.finished = &FinishedReqPool{
-		blocks:   make(map[Uint256]*bloom.MerkleBlock),
-		requests: make(map[Uint256]*BlockTxsRequest),
-	}
+	queue.finished = newFinishedReqPool()
+	queue.orphans = NewOrphanTxPool(time.Second * time.Duration(OrphanTxTimeout))
+	queue.invs = NewInvCache(time.Second * time.Duration(InvDedupWindow))
 	queue.handler = handler
 
 	go queue.start()
@@ -58,16 +62,28 @@ func NewRequestQueue(size int, handler RequestQueueHandler) *RequestQueue {
 
 func (queue *RequestQueue) start() {
 	for hash := range queue.hashesQueue {
-		queue.StartBlockRequest(queue.peer, hash)
+		// Do not request more blocks while too many received out of order
+		queue.finished.waitSpace(MaxBlocksAhead)
+		queue.StartBlockRequest(queue.Peer(), hash)
 	}
 }
 
-// This method will block when request queue is filled
-func (queue *RequestQueue) PushHashes(peer *net.Peer, hashes []*Uint256) {
-	queue.peer = peer
+// This method will block when request queue is filled, the hashes are requested in order
+// and at most size block requests are outstanding at the same time.
+// Hashes seen within InvDedupWindow will be skipped.
+// Returns false if the queue is cleared or reassigned to another peer before all hashes pushed.
+func (queue *RequestQueue) PushHashes(peer *net.Peer, hashes []*Uint256) bool {
+	queue.setPeer(peer)
 	for _, hash := range hashes {
+		if queue.Peer() != peer {
+			return false
+		}
+		if !queue.invs.Add(*hash) {
+			continue
+		}
 		queue.hashesQueue <- *hash
 	}
+	return true
 }
 
 func (queue *RequestQueue) StartBlockRequest(peer *net.Peer, hash Uint256) {
@@ -95,6 +111,12 @@ func (queue *RequestQueue) StartBlockRequest(peer *net.Peer, hash Uint256) {
 }
 
 func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.MerkleBlock, txIds []*Uint256) {
+	queue.startBlockTxsRequest(peer, block, txIds, false)
+}
+
+// Same as StartBlockTxsRequest, inFlight is true for the blocks requested by the sync batch,
+// they are not evicted from the finished pool.
+func (queue *RequestQueue) startBlockTxsRequest(peer *net.Peer, block *bloom.MerkleBlock, txIds []*Uint256, inFlight bool) {
 	blockHash := block.Header.Hash()
 	// No block transactions to request, notify request finished.
 	if len(txIds) == 0 {
@@ -102,6 +124,7 @@ func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.Mer
 		queue.OnRequestFinished(&BlockTxsRequest{
 			BlockHash: blockHash,
 			Block:     *block,
+			inFlight:  inFlight,
 		})
 		return
 	}
@@ -109,12 +132,32 @@ func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.Mer
 	if queue.InBlockTxsRequestQueue(blockHash) {
 		return
 	}
+	// Take out transactions already received as orphans
+	var txs []Transaction
+	var missing []*Uint256
+	for _, txId := range txIds {
+		if tx, ok := queue.orphans.GetOrphanTxn(*txId); ok {
+			txs = append(txs, *tx)
+			continue
+		}
+		missing = append(missing, txId)
+	}
+	// All block transactions received, notify request finished.
+	if len(missing) == 0 {
+		queue.OnRequestFinished(&BlockTxsRequest{
+			BlockHash: blockHash,
+			Block:     *block,
+			Txs:       txs,
+			inFlight:  inFlight,
+		})
+		return
+	}
 	// Block the method when queue is filled
 	queue.blockTxsQueue <- blockHash
 
 	queue.blockTxsReqsLock.Lock()
 	txRequestQueue := make(map[Uint256]*Request)
-	for _, txId := range txIds {
+	for _, txId := range missing {
 		// Mark txId related block
 		queue.blockTxs[*txId] = blockHash
 		// Start a tx request
@@ -125,14 +168,18 @@ func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.Mer
 			handler: queue,
 		}
 		txRequestQueue[*txId] = txRequest
-		txRequest.Start()
 	}
 
 	blockTxsRequest := &BlockTxsRequest{
 		BlockHash:      blockHash,
 		Block:          *block,
 		txRequestQueue: txRequestQueue,
+		Txs:            txs,
+		inFlight:       inFlight,
 	}
+	blockTxsRequest.Lock()
+	blockTxsRequest.start()
+	blockTxsRequest.Unlock()
 
 	queue.blockTxsRequests[blockHash] = blockTxsRequest
 	queue.blockTxsReqsLock.Unlock()
@@ -154,11 +201,120 @@ func (queue *RequestQueue) InBlockTxsRequestQueue(blockHash Uint256) bool {
 	return ok
 }
 
+// Check if the block or transaction is requested and not received yet
+func (queue *RequestQueue) IsRequested(hash Uint256) bool {
+	if queue.InBlockRequestQueue(hash) {
+		return true
+	}
+
+	queue.blockTxsReqsLock.Lock()
+	defer queue.blockTxsReqsLock.Unlock()
+
+	_, ok := queue.blockTxs[hash]
+	return ok
+}
+
+// Get the request of the block or transaction not received yet, nil if not requested
+func (queue *RequestQueue) getRequest(hash Uint256) *Request {
+	queue.blockReqsLock.Lock()
+	request, ok := queue.blockRequests[hash]
+	queue.blockReqsLock.Unlock()
+	if ok {
+		return request
+	}
+
+	queue.blockTxsReqsLock.Lock()
+	defer queue.blockTxsReqsLock.Unlock()
+
+	blockHash, ok := queue.blockTxs[hash]
+	if !ok {
+		return nil
+	}
+	blockTxsRequest, ok := queue.blockTxsRequests[blockHash]
+	if !ok {
+		return nil
+	}
+	blockTxsRequest.Lock()
+	defer blockTxsRequest.Unlock()
+
+	// A queued request is not sent yet
+	if blockTxsRequest.queued[hash] {
+		return nil
+	}
+	return blockTxsRequest.txRequestQueue[hash]
+}
+
+// Check if the block or transaction is requested from the peer and not received yet
+func (queue *RequestQueue) IsRequestedFrom(hash Uint256, peer *net.Peer) bool {
+	request := queue.getRequest(hash)
+	if request == nil {
+		return false
+	}
+	requested := request.Peer()
+	return requested != nil && requested.ConnID() == peer.ConnID()
+}
+
+/*
+The peer does not have the block or transaction requested from it, send the request to the first
+of the given peers that has not responded notfound to it. Returns the peer the request is sent to,
+nil if it's not requested from the peer or all the peers do not have it.
+*/
+func (queue *RequestQueue) RequestFromAlternate(hash Uint256, notFound *net.Peer, peers []*net.Peer) *net.Peer {
+	request := queue.getRequest(hash)
+	if request == nil || !queue.IsRequestedFrom(hash, notFound) {
+		return nil
+	}
+	request.setNotFound(notFound)
+
+	for _, peer := range peers {
+		if !request.isNotFound(peer) {
+			request.Reassign(peer)
+			return peer
+		}
+	}
+	return nil
+}
+
 func (queue *RequestQueue) InFinishedPool(blockHash Uint256) bool {
 	_, ok := queue.finished.Contain(blockHash)
 	return ok
 }
 
+// Get the orphan transactions pool of this queue
+func (queue *RequestQueue) OrphanTxs() *OrphanTxPool {
+	return queue.orphans
+}
+
+// Get the numbers of orphan blocks and transactions, and the received time of the oldest one
+func (queue *RequestQueue) OrphanStats() (blocks int, txns int, oldest time.Time) {
+	oldest = queue.finished.Oldest()
+	if txOldest := queue.orphans.Oldest(); oldest.IsZero() || (!txOldest.IsZero() && txOldest.Before(oldest)) {
+		oldest = txOldest
+	}
+	return queue.finished.Length(), queue.orphans.Length(), oldest
+}
+
+// Get the memory in bytes used by the blocks received ahead of the chain tip,
+// and how many times a block was found or not in them before requesting it
+func (queue *RequestQueue) CacheStats() (size int, hits, misses uint64) {
+	return queue.finished.Stats()
+}
+
+// Get the orphan blocks waiting for their previous blocks
+func (queue *RequestQueue) OrphanBlocks() []OrphanBlock {
+	return queue.finished.Orphans()
+}
+
+// Get the number of block hashes and block transactions requests not finished
+func (queue *RequestQueue) PendingRequests() int {
+	return len(queue.hashesQueue) + len(queue.blocksQueue) + len(queue.blockTxsQueue)
+}
+
+// Get the number of block requests, including the hashes waiting for request, and block transactions requests
+func (queue *RequestQueue) pendingByType() (blocks int, txs int) {
+	return len(queue.hashesQueue) + len(queue.blocksQueue), len(queue.blockTxsQueue)
+}
+
 func (queue *RequestQueue) IsRunning() bool {
 	return len(queue.hashesQueue) > 0 || len(queue.blocksQueue) > 0 || len(queue.blockTxsQueue) > 0
 }
@@ -190,19 +346,64 @@ func (queue *RequestQueue) OnBlockReceived(block *bloom.MerkleBlock, txIds []*Ui
 	<-queue.blocksQueue
 
 	// Request block transactions
-	queue.StartBlockTxsRequest(request.peer, block, txIds)
+	queue.startBlockTxsRequest(request.Peer(), block, txIds, true)
+
+	return nil
+}
+
+// In full block mode, the matched transactions are scanned out from the full block,
+// so the block request is finished directly without requesting transactions.
+func (queue *RequestQueue) OnFullBlockReceived(block *bloom.MerkleBlock, txs []Transaction) error {
+	queue.blockReqsLock.Lock()
+
+	blockHash := block.Header.Hash()
+	// Check if received block is in the request queue
+	request, ok := queue.blockRequests[blockHash]
+	if !ok {
+		queue.blockReqsLock.Unlock()
+		log.Debug("Unknown full block received: ", blockHash.String())
+		return nil
+	}
+
+	// Remove from block request list
+	request.Finish()
+	delete(queue.blockRequests, blockHash)
+	<-queue.blocksQueue
+	queue.blockReqsLock.Unlock()
+
+	queue.OnRequestFinished(&BlockTxsRequest{
+		BlockHash: blockHash,
+		Block:     *block,
+		Txs:       txs,
+		inFlight:  true,
+	})
 
 	return nil
 }
 
 func (queue *RequestQueue) OnTxReceived(tx *Transaction) error {
+	return queue.OnPeerTxReceived(nil, tx)
+}
+
+// Same as OnTxReceived, and the orphan transactions are accounted to the peer sent them,
+// ErrPeerOrphansFull is returned if the peer has too many orphans to keep another one.
+func (queue *RequestQueue) OnPeerTxReceived(peer *net.Peer, tx *Transaction) error {
 	queue.blockTxsReqsLock.Lock()
 	txId := tx.Hash()
 	var ok bool
 	var blockHash Uint256
 	if blockHash, ok = queue.blockTxs[txId]; !ok {
-		fmt.Println("Unknown transaction received: ", txId.String())
+		// Keep it as orphan, the block transactions request may start later
+		log.Debug("Orphan transaction received: ", txId.String())
+		var peerId uint64
+		if peer != nil {
+			peerId = peer.ConnID()
+		}
+		added := queue.orphans.AddPeerOrphanTxn(peerId, tx)
 		queue.blockTxsReqsLock.Unlock()
+		if !added {
+			return ErrPeerOrphansFull
+		}
 		return nil
 	}
 
@@ -242,6 +443,40 @@ func (queue *RequestQueue) OnRequestFinished(request *BlockTxsRequest) {
 	queue.handler.OnRequestFinished(queue.finished)
 }
 
+// Send the outstanding block and transaction requests to the given peer,
+// used when the sync peer disconnected in the middle of a batch.
+// Blocks and transactions already received are kept, so they will not be downloaded again.
+func (queue *RequestQueue) ReassignRequests(peer *net.Peer) {
+	queue.setPeer(peer)
+
+	queue.blockReqsLock.Lock()
+	for _, request := range queue.blockRequests {
+		request.Reassign(peer)
+	}
+	queue.blockReqsLock.Unlock()
+
+	queue.blockTxsReqsLock.Lock()
+	for _, request := range queue.blockTxsRequests {
+		request.Reassign(peer)
+	}
+	queue.blockTxsReqsLock.Unlock()
+}
+
+// Get the peer which block requests are sending to
+func (queue *RequestQueue) Peer() *net.Peer {
+	queue.peerLock.RLock()
+	defer queue.peerLock.RUnlock()
+
+	return queue.peer
+}
+
+func (queue *RequestQueue) setPeer(peer *net.Peer) {
+	queue.peerLock.Lock()
+	defer queue.peerLock.Unlock()
+
+	queue.peer = peer
+}
+
 func (queue *RequestQueue) Clear() {
 	// Clear hashes chan
 	for len(queue.hashesQueue) > 0 {
@@ -274,4 +509,9 @@ func (queue *RequestQueue) Clear() {
 
 	// Clear finished requests pool
 	queue.finished.Clear()
+
+	// Blocks not finished will be requested again when restart
+	queue.invs.Clear()
+
+	queue.setPeer(nil)
 }
@@ -0,0 +1,475 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+type sentRequest struct {
+	peer *net.Peer
+	hash Uint256
+}
+
+type testQueueHandler struct {
+	sent chan sentRequest
+}
+
+func (h *testQueueHandler) OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256) {
+	h.sent <- sentRequest{peer: peer, hash: hash}
+}
+
+func (h *testQueueHandler) OnRequestError(err error) {}
+
+func (h *testQueueHandler) OnRequestFinished(pool *FinishedReqPool) {}
+
+func TestRequestQueue_ReassignRequests(t *testing.T) {
+	handler := &testQueueHandler{sent: make(chan sentRequest, 10)}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peerA := new(net.Peer)
+	peerA.SetID(1)
+	peerB := new(net.Peer)
+	peerB.SetID(2)
+
+	blocks := []*bloom.MerkleBlock{
+		{Header: Header{Height: 1}},
+		{Header: Header{Height: 2}},
+	}
+	received := blocks[0].Header.Hash()
+	outstanding := blocks[1].Header.Hash()
+
+	for _, block := range blocks {
+		queue.StartBlockRequest(peerA, block.Header.Hash())
+	}
+	for range blocks {
+		select {
+		case req := <-handler.sent:
+			if req.peer.ID() != peerA.ID() {
+				t.Fatalf("request sent to peer %d, expect %d", req.peer.ID(), peerA.ID())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("block request not sent")
+		}
+	}
+
+	// Sync peer disconnected after the first block received
+	if err := queue.OnBlockReceived(blocks[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	queue.ReassignRequests(peerB)
+
+	select {
+	case req := <-handler.sent:
+		if req.peer.ID() != peerB.ID() {
+			t.Errorf("request reassigned to peer %d, expect %d", req.peer.ID(), peerB.ID())
+		}
+		if !req.hash.IsEqual(outstanding) {
+			t.Errorf("reassigned request hash %s, expect %s", req.hash.String(), outstanding.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("outstanding request not reassigned")
+	}
+
+	select {
+	case req := <-handler.sent:
+		t.Errorf("unexpected request %s sent to peer %d", req.hash.String(), req.peer.ID())
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	if !queue.InFinishedPool(received) {
+		t.Error("received block not kept after reassign")
+	}
+	if !queue.InBlockRequestQueue(outstanding) {
+		t.Error("outstanding block not in request queue after reassign")
+	}
+	if queue.Peer().ID() != peerB.ID() {
+		t.Errorf("queue peer %d, expect %d", queue.Peer().ID(), peerB.ID())
+	}
+
+	queue.Clear()
+}
+
+func TestRequestQueue_PushHashesDuplicate(t *testing.T) {
+	handler := &testQueueHandler{sent: make(chan sentRequest, 10)}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	block := &bloom.MerkleBlock{Header: Header{Height: 1}}
+	hash := block.Header.Hash()
+
+	var peers []*net.Peer
+	for i := 0; i < 3; i++ {
+		peer := new(net.Peer)
+		peer.SetID(uint64(i + 1))
+		peers = append(peers, peer)
+	}
+
+	// Several peers announce the same block
+	for _, peer := range peers[:2] {
+		queue.PushHashes(peer, []*Uint256{&hash})
+	}
+
+	select {
+	case req := <-handler.sent:
+		if !req.hash.IsEqual(hash) {
+			t.Errorf("request hash %s, expect %s", req.hash.String(), hash.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("block request not sent")
+	}
+
+	// Block downloaded and committed, then announced again by another peer
+	if err := queue.OnBlockReceived(block, nil); err != nil {
+		t.Fatal(err)
+	}
+	queue.finished.Next(block.Header.Previous)
+	queue.PushHashes(peers[2], []*Uint256{&hash})
+
+	select {
+	case req := <-handler.sent:
+		t.Errorf("duplicate request %s sent to peer %d", req.hash.String(), req.peer.ID())
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	queue.Clear()
+}
+
+func TestRequestQueue_PushHashesLargeInventory(t *testing.T) {
+	const count = 500
+	handler := &testQueueHandler{sent: make(chan sentRequest, count)}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peer := new(net.Peer)
+	peer.SetID(1)
+
+	blocks := make([]*bloom.MerkleBlock, count)
+	hashes := make([]*Uint256, count)
+	for i := range blocks {
+		blocks[i] = &bloom.MerkleBlock{Header: Header{Height: uint32(i + 1)}}
+		hash := blocks[i].Header.Hash()
+		hashes[i] = &hash
+	}
+
+	// A large inventory announced after downtime
+	pushed := make(chan bool, 1)
+	go func() { pushed <- queue.PushHashes(peer, hashes) }()
+
+	// Requests are sent concurrently, so check the hash is in the expected range
+	expectRequest := func(from, to int) {
+		select {
+		case req := <-handler.sent:
+			for _, hash := range hashes[from:to] {
+				if req.hash.IsEqual(*hash) {
+					return
+				}
+			}
+			t.Fatalf("request %s not in range [%d, %d)", req.hash.String(), from, to)
+		case <-time.After(time.Second):
+			t.Fatalf("request in range [%d, %d) not sent", from, to)
+		}
+	}
+	expectPaced := func() {
+		select {
+		case req := <-handler.sent:
+			t.Fatalf("request %s sent beyond download window", req.hash.String())
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+	// Only the download window is requested at first
+	for i := 0; i < MaxRequests; i++ {
+		expectRequest(0, MaxRequests)
+	}
+	expectPaced()
+
+	// Each received block makes room for the next request
+	for i := MaxRequests; i < count; i++ {
+		if err := queue.OnBlockReceived(blocks[i-MaxRequests], nil); err != nil {
+			t.Fatal(err)
+		}
+		expectRequest(i, i+1)
+	}
+	expectPaced()
+
+	select {
+	case ok := <-pushed:
+		if !ok {
+			t.Error("push hashes interrupted")
+		}
+	case <-time.After(time.Second):
+		t.Error("push hashes not returned")
+	}
+
+	queue.Clear()
+}
+
+func TestRequestQueue_RequestFromAlternate(t *testing.T) {
+	handler := &testQueueHandler{sent: make(chan sentRequest, 10)}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peerA := newTestPeer(1)
+	peerB := newTestPeer(2)
+	peers := []*net.Peer{peerA, peerB}
+
+	block := &bloom.MerkleBlock{Header: Header{Height: 1}}
+	hash := block.Header.Hash()
+	queue.StartBlockRequest(peerA, hash)
+	<-handler.sent
+
+	// Only the peer requested from can claim notfound
+	if alternate := queue.RequestFromAlternate(hash, peerB, peers); alternate != nil {
+		t.Fatal("request moved by notfound of a peer not requested from")
+	}
+
+	// Peer A announced the block but can not serve it, peer B is asked
+	alternate := queue.RequestFromAlternate(hash, peerA, peers)
+	if alternate == nil || alternate.ID() != peerB.ID() {
+		t.Fatal("request not sent to alternate peer")
+	}
+	select {
+	case req := <-handler.sent:
+		if req.peer.ID() != peerB.ID() || !req.hash.IsEqual(hash) {
+			t.Errorf("request %s sent to peer %d, expect peer %d", req.hash.String(), req.peer.ID(), peerB.ID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not sent to alternate peer")
+	}
+	if queue.IsRequestedFrom(hash, peerA) || !queue.IsRequestedFrom(hash, peerB) {
+		t.Error("block not requested from alternate peer")
+	}
+
+	// Peer B serves the block
+	if err := queue.OnBlockReceived(block, nil); err != nil {
+		t.Fatal(err)
+	}
+	if queue.IsRequested(hash) {
+		t.Error("block served by alternate peer still requested")
+	}
+
+	// No peer left to ask when all of them do not have the data
+	other := &bloom.MerkleBlock{Header: Header{Height: 2}}
+	otherHash := other.Header.Hash()
+	queue.StartBlockRequest(peerA, otherHash)
+	<-handler.sent
+	queue.RequestFromAlternate(otherHash, peerA, peers)
+	<-handler.sent
+	if alternate := queue.RequestFromAlternate(otherHash, peerB, peers); alternate != nil {
+		t.Errorf("request sent to peer %d already responded notfound", alternate.ID())
+	}
+
+	// A peer claiming the ID of the alternate peer does not make it skipped
+	impostor := newTestPeer(peerB.ID())
+	third := &bloom.MerkleBlock{Header: Header{Height: 3}}
+	thirdHash := third.Header.Hash()
+	queue.StartBlockRequest(impostor, thirdHash)
+	<-handler.sent
+	if queue.IsRequestedFrom(thirdHash, peerB) {
+		t.Error("block requested from the impostor counted as requested from peer B")
+	}
+	alternate = queue.RequestFromAlternate(thirdHash, impostor, []*net.Peer{impostor, peerB})
+	if alternate != peerB {
+		t.Error("peer sharing the ID of the notfound peer not asked")
+	}
+	<-handler.sent
+
+	queue.Clear()
+}
+
+func TestRequestQueue_MaxBlockTxRequests(t *testing.T) {
+	defer func(max int) { MaxBlockTxRequests = max }(MaxBlockTxRequests)
+	MaxBlockTxRequests = 3
+
+	handler := &testQueueHandler{sent: make(chan sentRequest, 20)}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peer := new(net.Peer)
+	peer.SetID(1)
+
+	// A block matching many transactions
+	txs := make(map[Uint256]*Transaction)
+	var txIds []*Uint256
+	for i := 0; i < 10; i++ {
+		tx := &Transaction{LockTime: uint32(i)}
+		txId := tx.Hash()
+		txs[txId] = tx
+		txIds = append(txIds, &txId)
+	}
+	block := &bloom.MerkleBlock{Header: Header{Height: 1}}
+	queue.StartBlockTxsRequest(peer, block, txIds)
+
+	receiveSent := func() Uint256 {
+		select {
+		case req := <-handler.sent:
+			return req.hash
+		case <-time.After(time.Second):
+			t.Fatal("transaction request not sent")
+		}
+		return Uint256{}
+	}
+	noneSent := func() {
+		select {
+		case req := <-handler.sent:
+			t.Fatalf("transaction request %s sent over MaxBlockTxRequests", req.hash.String())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	var outstanding []Uint256
+	for i := 0; i < MaxBlockTxRequests; i++ {
+		outstanding = append(outstanding, receiveSent())
+	}
+	noneSent()
+
+	// Each transaction received sends the next request
+	received := 0
+	for len(outstanding) > 0 {
+		txId := outstanding[0]
+		outstanding = outstanding[1:]
+		if err := queue.OnTxReceived(txs[txId]); err != nil {
+			t.Fatal(err)
+		}
+		received++
+		if received+len(outstanding) < len(txIds) {
+			outstanding = append(outstanding, receiveSent())
+		}
+		noneSent()
+	}
+
+	if received != len(txIds) {
+		t.Errorf("received %d transactions, expect %d", received, len(txIds))
+	}
+	if queue.InBlockTxsRequestQueue(block.Header.Hash()) {
+		t.Error("block transactions request not finished")
+	}
+}
+
+// orderedHandler commits the finished blocks in chain order like the SPV service
+type orderedHandler struct {
+	testQueueHandler
+	tip       Uint256
+	committed []uint32
+}
+
+func (h *orderedHandler) OnRequestFinished(pool *FinishedReqPool) {
+	for request, ok := pool.Next(h.tip); ok; request, ok = pool.Next(h.tip) {
+		h.committed = append(h.committed, request.Block.Header.Height)
+		h.tip = request.Block.Header.Hash()
+	}
+}
+
+func newTestChain(count int) []*bloom.MerkleBlock {
+	var blocks []*bloom.MerkleBlock
+	var previous Uint256
+	for i := 1; i <= count; i++ {
+		block := &bloom.MerkleBlock{Header: Header{Height: uint32(i), Previous: previous}}
+		previous = block.Header.Hash()
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestRequestQueue_OutOfOrderBlocks(t *testing.T) {
+	handler := &orderedHandler{testQueueHandler: testQueueHandler{sent: make(chan sentRequest, 10)}}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peer := new(net.Peer)
+	peer.SetID(1)
+
+	blocks := newTestChain(5)
+	for _, block := range blocks {
+		queue.StartBlockRequest(peer, block.Header.Hash())
+		<-handler.sent
+	}
+
+	// The batch delivered in reverse order
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err := queue.OnBlockReceived(blocks[i], nil); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && len(handler.committed) > 0 {
+			t.Fatalf("block committed before block 1 received, committed %v", handler.committed)
+		}
+	}
+
+	if len(handler.committed) != len(blocks) {
+		t.Fatalf("committed %d blocks, expect %d", len(handler.committed), len(blocks))
+	}
+	for i, height := range handler.committed {
+		if height != uint32(i+1) {
+			t.Errorf("committed blocks in order %v", handler.committed)
+			break
+		}
+	}
+	if queue.finished.Length() != 0 {
+		t.Errorf("%d blocks left in finished pool", queue.finished.Length())
+	}
+
+	queue.Clear()
+}
+
+func TestRequestQueue_MaxBlocksAhead(t *testing.T) {
+	defer func(max int) { MaxBlocksAhead = max }(MaxBlocksAhead)
+	MaxBlocksAhead = 2
+
+	handler := &orderedHandler{testQueueHandler: testQueueHandler{sent: make(chan sentRequest, 10)}}
+	queue := NewRequestQueue(MaxRequests, handler)
+
+	peer := new(net.Peer)
+	peer.SetID(1)
+
+	blocks := newTestChain(5)
+	var hashes []*Uint256
+	for _, block := range blocks[:4] {
+		hash := block.Header.Hash()
+		hashes = append(hashes, &hash)
+	}
+	queue.PushHashes(peer, hashes)
+	for range hashes {
+		select {
+		case <-handler.sent:
+		case <-time.After(time.Second):
+			t.Fatal("block request not sent")
+		}
+	}
+
+	// Blocks 3 and 4 arrive before 1 and 2, the pool is full
+	queue.OnBlockReceived(blocks[3], nil)
+	queue.OnBlockReceived(blocks[2], nil)
+
+	last := blocks[4].Header.Hash()
+	go queue.PushHashes(peer, []*Uint256{&last})
+	select {
+	case req := <-handler.sent:
+		t.Fatalf("block %s requested with the pool full", req.hash.String())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Block 1 is committed, block 2 is still missing
+	queue.OnBlockReceived(blocks[0], nil)
+	select {
+	case req := <-handler.sent:
+		t.Fatalf("block %s requested with the pool full", req.hash.String())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Block 2 arrives, the blocks waiting are committed and the next block is requested
+	queue.OnBlockReceived(blocks[1], nil)
+	select {
+	case req := <-handler.sent:
+		if !req.hash.IsEqual(last) {
+			t.Errorf("requested block %s, expect %s", req.hash.String(), last.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("block not requested after the pool has space")
+	}
+	if len(handler.committed) != 4 {
+		t.Errorf("committed %d blocks, expect 4", len(handler.committed))
+	}
+
+	queue.Clear()
+}
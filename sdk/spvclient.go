@@ -5,9 +5,9 @@ import (
 
 	"github.com/elastos/Elastos.ELA.SPV/net"
 
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
 	"github.com/elastos/Elastos.ELA/bloom"
 	"github.com/elastos/Elastos.ELA/core"
-	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
 )
 
 /*
@@ -49,6 +49,10 @@ type SPVMessageHandler interface {
 	// with invType TRANSACTION
 	OnMerkleBlock(*net.Peer, *bloom.MerkleBlock) error
 
+	// In full block mode, a data request with invType BLOCK will return a block message
+	// through this method, which includes the block header and all transactions in the block.
+	OnBlock(*net.Peer, *core.Block) error
+
 	// After sent a data request with invType TRANSACTION, a txn message will return through this method.
 	// these transactions are matched to the bloom filter you have sent with the filterload message.
 	OnTxn(*net.Peer, *core.Transaction) error
@@ -6,10 +6,10 @@ import (
 
 	"github.com/elastos/Elastos.ELA.SPV/net"
 
-	"github.com/elastos/Elastos.ELA/bloom"
-	"github.com/elastos/Elastos.ELA/core"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
 	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
 )
 
 type SPVClientImpl struct {
@@ -26,6 +26,7 @@ func NewSPVClientImpl(magic uint32, clientId uint64, seeds []string) (*SPVClient
 
 	client := &SPVClientImpl{p2p: p2p}
 	p2p.SetMessageHandler(client)
+	client.registerMessages()
 
 	return client, nil
 }
@@ -42,43 +43,53 @@ func (client *SPVClientImpl) PeerManager() *net.PeerManager {
 	return client.p2p.PeerManager()
 }
 
-func (client *SPVClientImpl) MakeMessage(cmd string) (message p2p.Message, err error) {
-	switch cmd {
-	case "ping":
-		message = new(msg.Ping)
-	case "pong":
-		message = new(msg.Pong)
-	case "inv":
-		message = new(msg.Inventory)
-	case "tx":
-		message = new(core.Transaction)
-	case "merkleblock":
-		message = new(bloom.MerkleBlock)
-	case "notfound":
-		message = new(msg.NotFound)
-	default:
-		return nil, errors.New("Received unsupported message, CMD " + cmd)
-	}
-	return message, nil
+// The SPV messages are registered in the peer manager, other messages are not supported
+func (client *SPVClientImpl) MakeMessage(cmd string) (p2p.Message, error) {
+	return nil, errors.New("Received unsupported message, CMD " + cmd)
 }
 
 func (client *SPVClientImpl) HandleMessage(peer *net.Peer, message p2p.Message) error {
-	switch msg := message.(type) {
-	case *msg.Ping:
-		return client.OnPing(peer, msg)
-	case *msg.Pong:
-		return client.OnPong(peer, msg)
-	case *msg.Inventory:
-		return client.msgHandler.OnInventory(peer, msg)
-	case *bloom.MerkleBlock:
-		return client.msgHandler.OnMerkleBlock(peer, msg)
-	case *core.Transaction:
-		return client.msgHandler.OnTxn(peer, msg)
-	case *msg.NotFound:
-		return client.msgHandler.OnNotFound(peer, msg)
-	default:
-		return errors.New("handle message unknown type")
-	}
+	return errors.New("handle message unknown type")
+}
+
+// Register the SPV messages, they are dispatched to the message handler
+func (client *SPVClientImpl) registerMessages() {
+	pm := client.PeerManager()
+	pm.RegisterMessage("ping",
+		func() p2p.Message { return new(msg.Ping) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.OnPing(peer, message.(*msg.Ping))
+		})
+	pm.RegisterMessage("pong",
+		func() p2p.Message { return new(msg.Pong) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.OnPong(peer, message.(*msg.Pong))
+		})
+	pm.RegisterMessage("inv",
+		func() p2p.Message { return new(msg.Inventory) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.msgHandler.OnInventory(peer, message.(*msg.Inventory))
+		})
+	pm.RegisterMessage("tx",
+		func() p2p.Message { return new(core.Transaction) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.msgHandler.OnTxn(peer, message.(*core.Transaction))
+		})
+	pm.RegisterMessage("merkleblock",
+		func() p2p.Message { return new(bloom.MerkleBlock) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.msgHandler.OnMerkleBlock(peer, message.(*bloom.MerkleBlock))
+		})
+	pm.RegisterMessage("block",
+		func() p2p.Message { return new(core.Block) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.msgHandler.OnBlock(peer, message.(*core.Block))
+		})
+	pm.RegisterMessage("notfound",
+		func() p2p.Message { return new(msg.NotFound) },
+		func(peer *net.Peer, message p2p.Message) error {
+			return client.msgHandler.OnNotFound(peer, message.(*msg.NotFound))
+		})
 }
 
 func (client *SPVClientImpl) OnPeerEstablish(peer *net.Peer) {
@@ -86,14 +97,14 @@ func (client *SPVClientImpl) OnPeerEstablish(peer *net.Peer) {
 }
 
 func (client *SPVClientImpl) OnPing(peer *net.Peer, p *msg.Ping) error {
-	peer.SetHeight(p.Height)
+	client.PeerManager().UpdatePeerHeight(peer, p.Height)
 	// Return pong message to peer
 	go peer.Send(msg.NewPong(uint32(client.PeerManager().Local().Height())))
 	return nil
 }
 
 func (client *SPVClientImpl) OnPong(peer *net.Peer, p *msg.Pong) error {
-	peer.SetHeight(p.Height)
+	client.PeerManager().UpdatePeerHeight(peer, p.Height)
 	return nil
 }
 
@@ -106,10 +117,10 @@ func (client *SPVClientImpl) keepUpdate() {
 		for _, peer := range client.PeerManager().ConnectedPeers() {
 			if peer.State() == p2p.ESTABLISH {
 
-				// Disconnect inactive peer
-				if peer.LastActive().Before(
-					time.Now().Add(-time.Second * net.InfoUpdateDuration * net.KeepAliveTimeout)) {
-					client.PeerManager().DisconnectPeer(peer)
+				// Disconnect inactive peer, manual peers are only disconnected when removed
+				if !peer.Manual() && peer.LastActive().Before(
+					time.Now().Add(-time.Second*net.InfoUpdateDuration*net.KeepAliveTimeout)) {
+					client.PeerManager().DisconnectPeerWithReason(peer, "inactive timeout")
 					continue
 				}
 
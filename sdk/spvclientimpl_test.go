@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// testSPVMsgHandler passes the handled messages to the channel
+type testSPVMsgHandler struct {
+	handled chan p2p.Message
+}
+
+func (h *testSPVMsgHandler) OnPeerEstablish(peer *net.Peer) {}
+
+func (h *testSPVMsgHandler) OnInventory(peer *net.Peer, inv *msg.Inventory) error {
+	h.handled <- inv
+	return nil
+}
+
+func (h *testSPVMsgHandler) OnMerkleBlock(peer *net.Peer, block *bloom.MerkleBlock) error {
+	h.handled <- block
+	return nil
+}
+
+func (h *testSPVMsgHandler) OnBlock(peer *net.Peer, block *core.Block) error {
+	h.handled <- block
+	return nil
+}
+
+func (h *testSPVMsgHandler) OnTxn(peer *net.Peer, tx *core.Transaction) error {
+	h.handled <- tx
+	return nil
+}
+
+func (h *testSPVMsgHandler) OnNotFound(peer *net.Peer, notFound *msg.NotFound) error {
+	h.handled <- notFound
+	return nil
+}
+
+func TestSPVClientImpl_RegisterMessages(t *testing.T) {
+	log.Init()
+
+	client, err := NewSPVClientImpl(TestNetMagic, 1, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &testSPVMsgHandler{handled: make(chan p2p.Message, 1)}
+	client.SetMessageHandler(handler)
+	peer := newTestPeer(2)
+	client.PeerManager().AddPeer(peer)
+
+	// The messages are made and handled through the peer manager
+	for _, cmd := range []string{"inv", "tx", "merkleblock", "block", "notfound"} {
+		message, err := peer.OnMakeMessage(cmd)
+		if err != nil {
+			t.Errorf("make message %s error %v", cmd, err)
+			continue
+		}
+		if message.CMD() != cmd {
+			t.Errorf("made message %s for %s", message.CMD(), cmd)
+			continue
+		}
+		peer.OnMessageDecoded(message)
+		select {
+		case handled := <-handler.handled:
+			if handled != message {
+				t.Errorf("handled message %s for %s", handled.CMD(), cmd)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("message %s not passed to the message handler", cmd)
+		}
+	}
+
+	// Ping and pong update the peer height
+	for _, cmd := range []string{"ping", "pong"} {
+		if _, err := peer.OnMakeMessage(cmd); err != nil {
+			t.Errorf("make message %s error %v", cmd, err)
+		}
+	}
+	peer.OnMessageDecoded(&msg.Pong{Height: 10})
+	deadline := time.Now().Add(time.Second)
+	for peer.Height() != 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if peer.Height() != 10 {
+		t.Errorf("peer height %d after pong, expect 10", peer.Height())
+	}
+
+	if _, err := peer.OnMakeMessage("unknown"); err == nil {
+		t.Error("unknown message made")
+	}
+}
@@ -1,10 +1,14 @@
 package sdk
 
 import (
+	"time"
+
 	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/net"
 
-	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA/bloom"
 )
 
 /*
@@ -28,6 +32,70 @@ type SPVService interface {
 
 	// Broadcast a message to the peer to peer network.
 	BroadCastMessage(message p2p.Message)
+
+	// Get the median time offset between the timestamps of new blocks and local clock,
+	// a positive offset means local clock is behind the network time.
+	NetworkTimeOffset() time.Duration
+
+	// Set the callback when the network time offset is beyond MaxTimeOffsetWarning.
+	OnTimeOffsetWarning(callback func(offset time.Duration))
+
+	// Register a listener to observe peer connected, disconnected and banned events.
+	OnPeerEvent(listener func(net.PeerEvent))
+
+	// Register listeners to be notified when all peers disconnected and when a peer connected again,
+	// the restored listener receives how long the network was lost.
+	OnNetworkLost(listener func())
+	OnNetworkRestored(listener func(duration time.Duration))
+
+	// Register a listener to be notified when sync is paused after MaxSyncRestarts
+	// restarts without progress, sync resumes after SyncStallCooldown or a new peer connected.
+	OnSyncStalled(listener func(restarts int))
+
+	// Register a listener to be notified when a peer sent a block conflicts with the checkpoints,
+	// ErrWrongChain if the block does not follow the genesis block.
+	OnCheckpointConflict(listener func(err error))
+
+	// Pause block synchronize without disconnecting peers, ping and pong messages are still
+	// exchanged to keep peers alive. Outstanding requests are discarded.
+	PauseSync()
+
+	// Resume block synchronize from the current chain tip.
+	ResumeSync()
+
+	// Check if block synchronize is paused by PauseSync.
+	IsSyncPaused() bool
+
+	// Get the state of block synchronize, with the sync peer, the heights being synced
+	// and when the state changed. It tells more than Blockchain().IsSyncing() for debugging and UIs.
+	SyncState() SyncState
+
+	// Estimate the time to catch up with the best peer by the average blocks committed per second
+	// within SyncRateWindow, returns 0 if synced and UnknownSyncTime if it can not be estimated yet.
+	EstimatedSyncTime() time.Duration
+
+	// Get the numbers of orphan blocks and transactions, and the received time of the oldest one,
+	// orphan blocks are received blocks waiting for their previous blocks to be committed.
+	OrphanStats() (blocks int, txns int, oldest time.Time)
+
+	// Get the number of orphan transactions by the local connection id of the peer sent them,
+	// at most MaxOrphanTxsPerPeer each.
+	PeerOrphans() map[uint64]int
+
+	// List the orphan blocks with their previous block hashes, to find out the missing blocks.
+	OrphanBlocks() []OrphanBlock
+
+	// Get the memory in bytes used by the blocks and transactions received ahead of the chain tip,
+	// and how many times a block was found or not in them before requesting it, see SyncCacheSize.
+	SyncCacheStats() (size int, hits, misses uint64)
+
+	// Get how many transactions matched by the bloom filter are false positives, counted in the
+	// blocks synced and the relayed transactions, and how many times the filter is reloaded for them.
+	FalsePositiveStats() FalsePositiveStats
+
+	// Get the minimum fee rate per KB of a transaction to be relayed, the higher one of MinRelayFeeFloor
+	// and the minimum rate announced by connected peers in feefilter messages.
+	MinRelayFee() common.Fixed64
 }
 
 /*
@@ -3,23 +3,42 @@ package sdk
 import (
 	"errors"
 	"fmt"
-	"time"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/db"
-	"github.com/elastos/Elastos.ELA.SPV/net"
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
 
-	"github.com/elastos/Elastos.ELA/bloom"
-	"github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
 	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
 )
 
 const (
-	MaxRequests       = 100
+	MaxRequests = 100
+
+	// A merkle block with all of this many or more transactions matched is considered unfiltered
+	unfilteredBlockTxs = 10
+)
+
+var (
+	// The false positives accumulated, in blocks synced or relayed transactions, to reload the filter on peers
 	MaxFalsePositives = 7
+
+	// A block with more false positives than this reloads the filter on peers at once,
+	// without waiting for MaxFalsePositives accumulated. 0 to disable
+	MaxBlockFalsePositives = 0
+
+	// Pause sync after restarts this many times in a row without committing a block
+	MaxSyncRestarts = 10
+	// Seconds to pause sync when it's stalled
+	SyncStallCooldown uint32 = 60
+	// Seconds to wait for the outstanding requests on stop, so the received blocks can be committed
+	StopFlushTimeout uint32 = 10
 )
 
 // The SPV service implementation
@@ -29,7 +48,29 @@ type SPVServiceImpl struct {
 	chain      *Blockchain
 	queue      *RequestQueue
 	getFilter  func() *bloom.Filter
-	fPositives int
+	fPositives falsePositives
+	stopping   int32
+	paused     int32
+	server     *blockServer
+	rate       *syncRate
+	timeOffset *TimeOffset
+	txInvs     *InvCache
+	relayed    *relayedTxs
+	txRequests *txRequests
+	relayFees  *relayFees
+	reconnect  *syncReconnect
+	blockInvs  *blockInvs
+
+	// When the sync status changed, see SyncState
+	transitions syncTransitions
+
+	stallLock      sync.Mutex
+	restarts       int
+	stalledUntil   time.Time
+	stallListeners []func(restarts int)
+
+	conflictLock      sync.Mutex
+	conflictListeners []func(err error)
 }
 
 // Create a instance of SPV service implementation.
@@ -52,14 +93,62 @@ func NewSPVServiceImpl(client SPVClient, database db.DataStore, getBloomFilter f
 	// Initialize request queue
 	service.queue = NewRequestQueue(MaxRequests, service)
 
+	// Initialize transaction inventory cache to skip the transactions already requested
+	service.txInvs = NewInvCache(time.Second * time.Duration(InvDedupWindow))
+	service.relayed = newRelayedTxs()
+	service.txRequests = newTxRequests()
+
+	// Collect the block inventories received close together during catch-up
+	service.blockInvs = newBlockInvs(time.Millisecond*time.Duration(BlockInvWindow), service.queueBlockHashes)
+
+	// Initialize sync rate to estimate sync time
+	service.rate = newSyncRate(time.Second * time.Duration(SyncRateWindow))
+
+	// Collect the timestamps of new blocks to calculate network time offset
+	service.timeOffset = newTimeOffset()
+
 	// Set get bloom filter method
 	service.getFilter = getBloomFilter
 
+	// Reassign sync requests when sync peer disconnected,
+	// and resume stalled sync when new peer connected
+	service.PeerManager().OnPeerEvent(service.onPeerEvent)
+
+	// Choose a new sync peer when the sync peer reported a lower height than other peers
+	service.PeerManager().OnHeightDrop(service.onHeightDrop)
+
+	// Learn the minimum relay fee from feefilter messages
+	service.relayFees = newRelayFees(service.PeerManager())
+	service.relayFees.registerMessages()
+
+	// Serve merkle blocks to other SPV clients and advertise the SPV service
+	if ServerMode {
+		service.server = newBlockServer(service.chain, service.PeerManager())
+		service.server.registerMessages()
+		local := service.PeerManager().Local()
+		local.SetServices(local.Services() | ServiveSPV)
+	}
+
 	return service, nil
 }
 
 func (service *SPVServiceImpl) OnPeerEstablish(peer *net.Peer) {
-	// Send filterload message
+	// Full blocks are filtered locally, do not leak the filter to peers
+	if FullBlockMode {
+		return
+	}
+	// Send filterload message, the peer is not visible to data requests until it's sent
+	service.sendFilterLoad(peer)
+
+	// Request unconfirmed transactions after the filter loaded
+	service.requestMemPool(peer)
+}
+
+// Load the bloom filter on the peer, it's sent synchronously so it goes before the requests sent after
+func (service *SPVServiceImpl) sendFilterLoad(peer *net.Peer) {
+	if FullBlockMode {
+		return
+	}
 	peer.Send(service.getFilter().GetFilterLoadMsg())
 }
 
@@ -70,11 +159,58 @@ func (service *SPVServiceImpl) Start() {
 }
 
 func (service *SPVServiceImpl) Stop() {
+	atomic.StoreInt32(&service.stopping, 1)
+	service.flushPending()
 	service.stopSyncing()
 	service.chain.Close()
 	log.Info("SPV service stopped...")
 }
 
+func (service *SPVServiceImpl) isStopping() bool {
+	return atomic.LoadInt32(&service.stopping) == 1
+}
+
+// Wait for the outstanding requests within StopFlushTimeout, the finished blocks
+// are committed as usual, so they will not be downloaded again after restart.
+// Blocks not connected to the chain tip when timeout are discarded.
+func (service *SPVServiceImpl) flushPending() {
+	deadline := time.Now().Add(time.Second * time.Duration(StopFlushTimeout))
+	for service.queue.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if pending := service.queue.PendingRequests(); pending > 0 {
+		log.Warn("Stop with ", pending, " requests not finished, discard them")
+	}
+	if finished := service.queue.finished.Length(); finished > 0 {
+		log.Warn("Stop with ", finished, " received blocks not connected to chain tip, discard them")
+	}
+}
+
+// Pause sync and discard the outstanding requests, peers are kept connected.
+// Sync resumes from the chain tip when ResumeSync is called.
+func (service *SPVServiceImpl) PauseSync() {
+	if !atomic.CompareAndSwapInt32(&service.paused, 0, 1) {
+		return
+	}
+	service.stopSyncing()
+	service.syncStateChanged()
+	log.Info("SPV service sync paused")
+}
+
+func (service *SPVServiceImpl) ResumeSync() {
+	if !atomic.CompareAndSwapInt32(&service.paused, 1, 0) {
+		return
+	}
+	log.Info("SPV service sync resumed")
+	service.syncStateChanged()
+	service.syncBlocks()
+}
+
+func (service *SPVServiceImpl) IsSyncPaused() bool {
+	return atomic.LoadInt32(&service.paused) == 1
+}
+
 func (service *SPVServiceImpl) Blockchain() *Blockchain {
 	return service.chain
 }
@@ -83,11 +219,107 @@ func (service *SPVServiceImpl) BroadCastMessage(message p2p.Message) {
 	service.PeerManager().Broadcast(message)
 }
 
+func (service *SPVServiceImpl) OnPeerEvent(listener func(net.PeerEvent)) {
+	service.PeerManager().OnPeerEvent(listener)
+}
+
+func (service *SPVServiceImpl) OnNetworkLost(listener func()) {
+	service.PeerManager().OnNetworkLost(listener)
+}
+
+func (service *SPVServiceImpl) OnNetworkRestored(listener func(duration time.Duration)) {
+	service.PeerManager().OnNetworkRestored(listener)
+}
+
+func (service *SPVServiceImpl) OnSyncStalled(listener func(restarts int)) {
+	service.stallLock.Lock()
+	defer service.stallLock.Unlock()
+
+	service.stallListeners = append(service.stallListeners, listener)
+}
+
+func (service *SPVServiceImpl) OnCheckpointConflict(listener func(err error)) {
+	service.conflictLock.Lock()
+	defer service.conflictLock.Unlock()
+
+	service.conflictListeners = append(service.conflictListeners, listener)
+}
+
+func (service *SPVServiceImpl) NetworkTimeOffset() time.Duration {
+	return service.timeOffset.Offset()
+}
+
+func (service *SPVServiceImpl) OnTimeOffsetWarning(callback func(offset time.Duration)) {
+	service.timeOffset.Lock()
+	defer service.timeOffset.Unlock()
+
+	service.timeOffset.OnOffsetWarning = callback
+}
+
+// Get the local time adjusted by the network time offset
+func (service *SPVServiceImpl) networkTime() time.Time {
+	return time.Now().Add(service.NetworkTimeOffset())
+}
+
+// Estimate the time to catch up with the best peer by the recent sync rate,
+// returns 0 if synced and UnknownSyncTime if no peer connected or no blocks committed recently.
+func (service *SPVServiceImpl) EstimatedSyncTime() time.Duration {
+	bestPeer := service.PeerManager().GetBestPeer()
+	if bestPeer == nil {
+		return UnknownSyncTime
+	}
+
+	height := uint64(service.chain.Height())
+	if bestPeer.Height() <= height {
+		return 0
+	}
+
+	rate := service.rate.BlocksPerSecond()
+	if rate == 0 {
+		return UnknownSyncTime
+	}
+	remaining := float64(bestPeer.Height() - height)
+	return time.Duration(remaining / rate * float64(time.Second))
+}
+
+func (service *SPVServiceImpl) OrphanStats() (blocks int, txns int, oldest time.Time) {
+	return service.queue.OrphanStats()
+}
+
+func (service *SPVServiceImpl) PeerOrphans() map[uint64]int {
+	return service.queue.OrphanTxs().PeerOrphans()
+}
+
+func (service *SPVServiceImpl) OrphanBlocks() []OrphanBlock {
+	return service.queue.OrphanBlocks()
+}
+
+func (service *SPVServiceImpl) SyncCacheStats() (size int, hits, misses uint64) {
+	return service.queue.CacheStats()
+}
+
+func (service *SPVServiceImpl) MinRelayFee() Fixed64 {
+	return service.relayFees.MinRelayFee()
+}
+
 func (service *SPVServiceImpl) keepUpdate() {
 	ticker := time.NewTicker(time.Second * net.InfoUpdateDuration)
 	defer ticker.Stop()
 	for range ticker.C {
-		// Keep synchronizing blocks
+		// Evict expired orphan transactions
+		if evicted := service.queue.OrphanTxs().EvictExpired(); evicted > 0 {
+			log.Info("Orphan transactions evicted: ", evicted, ", total evicted: ", service.queue.OrphanTxs().Evicted())
+		}
+
+		// Write the batch kept too long while waiting for more blocks
+		if err := service.chain.flushIfDue(); err != nil {
+			log.Error("Flush committed blocks failed, ", err)
+		}
+
+		// Keep synchronizing blocks unless sync is paused
+		if service.IsSyncPaused() {
+			continue
+		}
 		service.syncBlocks()
 	}
 }
@@ -105,6 +337,11 @@ func (service *SPVServiceImpl) needSync() bool {
 }
 
 func (service *SPVServiceImpl) syncBlocks() {
+	// Sync is paused for stalled, stopping or paused by user
+	if service.isStalled() || service.isStopping() || service.IsSyncPaused() {
+		return
+	}
+
 	// Check if blockchain need sync
 	if service.needSync() {
 		// Check if blockchain is in syncing state
@@ -113,10 +350,17 @@ func (service *SPVServiceImpl) syncBlocks() {
 		}
 		// Set blockchain state to syncing
 		service.chain.SetChainState(SYNCING)
+		service.syncStateChanged()
 		// Request blocks
 		service.requestBlocks()
 	} else {
 		service.stopSyncing()
+		// Connect all peers after the chain synced
+		if service.PeerManager().GetBestPeer() != nil {
+			service.PeerManager().SyncFinished()
+		}
+		// Peers may be all behind the chain tip
+		service.syncStateChanged()
 	}
 }
 
@@ -128,6 +372,11 @@ func (service *SPVServiceImpl) stopSyncing() {
 		service.chain.SetChainState(WAITING)
 		// Remove sync peer
 		service.PeerManager().SetSyncPeer(nil)
+		// Forget the relayed transactions not received
+		service.relayed.clear()
+		// Drop the block inventories collected not queued yet
+		service.blockInvs.clear()
+		service.syncStateChanged()
 	}
 }
 
@@ -145,17 +394,147 @@ func (service *SPVServiceImpl) requestBlocks() {
 	go syncPeer.Send(request)
 }
 
+func (service *SPVServiceImpl) onPeerEvent(event net.PeerEvent) {
+	if event.Type == net.PeerConnected {
+		service.onSyncPeerReconnected(event.Addr)
+		service.resumeStalled()
+		return
+	}
+	if event.Type != net.PeerDisconnected {
+		return
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	// Check if the disconnected peer is the one requests are sending to
+	peer := service.queue.Peer()
+	if !service.chain.IsSyncing() || peer == nil || service.PeerManager().Exist(peer) {
+		return
+	}
+
+	// Wait for the sync peer to reconnect if it's disconnected by a transient error
+	if peer.Addr().String() == event.Addr && service.reconnectSyncPeer(event) {
+		return
+	}
+
+	service.reassignSyncPeer()
+}
+
+func (service *SPVServiceImpl) onHeightDrop(peer *net.Peer, drop uint64) {
+	service.Lock()
+	defer service.Unlock()
+
+	pm := service.PeerManager()
+	if !pm.IsSyncPeer(peer) {
+		return
+	}
+	var better *net.Peer
+	for _, other := range pm.ConnectedPeers() {
+		if other.Height() > peer.Height() {
+			better = other
+			break
+		}
+	}
+	if better == nil {
+		return
+	}
+
+	log.Info("Sync peer height dropped by ", drop, ", choose the sync peer again")
+	pm.SetSyncPeer(nil)
+	if service.chain.IsSyncing() {
+		service.reassignSyncPeer()
+	}
+}
+
+// Send the outstanding requests to a new sync peer and continue syncing,
+// blocks and transactions already received will not be requested again.
+func (service *SPVServiceImpl) reassignSyncPeer() {
+	syncPeer := service.PeerManager().GetSyncPeer()
+	if syncPeer == nil {
+		log.Warn("Sync peer disconnected, no peer to continue syncing")
+		service.stopSyncing()
+		return
+	}
+	// Nothing to fetch from a peer behind the chain tip, the best peer is chosen so all peers are behind
+	if syncPeer.Height() < uint64(service.chain.Height()) {
+		log.Warn("Sync peer disconnected, the other peers are behind the chain height")
+		service.stopSyncing()
+		return
+	}
+	log.Info("Sync peer disconnected, reassign requests to peer ", syncPeer.String())
+
+	service.queue.ReassignRequests(syncPeer)
+
+	// Continue requesting block hashes from the new sync peer
+	request := msg.NewBlocksReq(service.chain.GetBlockLocatorHashes(), Uint256{})
+	go syncPeer.Send(request)
+}
+
 func (service *SPVServiceImpl) changeSyncPeerAndRestart() {
 	log.Debug("Change sync peer and restart")
 	// Disconnect current sync peer
 	syncPeer := service.PeerManager().GetSyncPeer()
-	service.PeerManager().DisconnectPeer(syncPeer)
+	service.PeerManager().DisconnectPeerWithReason(syncPeer, "change sync peer")
 
 	service.stopSyncing()
+
+	// Pause sync instead of restarting over and over when all peers are bad
+	if service.addRestart() {
+		service.syncStateChanged()
+		return
+	}
+
 	// Restart
 	service.syncBlocks()
 }
 
+// Count a sync restart, return true if sync is stalled and paused
+func (service *SPVServiceImpl) addRestart() bool {
+	service.stallLock.Lock()
+	defer service.stallLock.Unlock()
+
+	service.restarts++
+	if service.restarts < MaxSyncRestarts {
+		return false
+	}
+
+	cooldown := time.Second * time.Duration(SyncStallCooldown)
+	service.stalledUntil = time.Now().Add(cooldown)
+	log.Warn("Sync restarted ", service.restarts, " times without progress, pause sync for ", cooldown)
+	for _, listener := range service.stallListeners {
+		go listener(service.restarts)
+	}
+	service.restarts = 0
+	return true
+}
+
+func (service *SPVServiceImpl) isStalled() bool {
+	service.stallLock.Lock()
+	defer service.stallLock.Unlock()
+
+	return time.Now().Before(service.stalledUntil)
+}
+
+// Reset restarts count when sync makes progress
+func (service *SPVServiceImpl) resetRestarts() {
+	service.stallLock.Lock()
+	defer service.stallLock.Unlock()
+
+	service.restarts = 0
+}
+
+// Resume stalled sync, it will be restarted by keepUpdate
+func (service *SPVServiceImpl) resumeStalled() {
+	service.stallLock.Lock()
+	defer service.stallLock.Unlock()
+
+	if time.Now().Before(service.stalledUntil) {
+		log.Info("New peer connected, resume stalled sync")
+	}
+	service.stalledUntil = time.Time{}
+}
+
 func (service *SPVServiceImpl) OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256) {
 	peer.Send(msg.NewDataReq(reqType, hash))
 }
@@ -171,6 +550,13 @@ func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
 	service.Lock()
 	defer service.Unlock()
 
+	// Write the blocks committed in batch to database
+	defer func() {
+		if err := service.chain.FlushBatch(); err != nil {
+			log.Error("Flush committed blocks failed, ", err)
+		}
+	}()
+
 	// By default, last pop from FinishedReqPool is the current, otherwise get chain tip as current
 	var current = pool.LastPop()
 	if current == nil {
@@ -178,7 +564,14 @@ func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
 		*current = service.chain.ChainTip().Hash()
 	}
 
-	var fPositives int
+	// Reload the filter when the false positives of the blocks committed are too many,
+	// even if sync is restarted before all blocks in pool are committed
+	var reload bool
+	defer func() {
+		if reload {
+			go service.reloadFilter()
+		}
+	}()
 	for request, ok := pool.Next(*current); ok; request, ok = pool.Next(request.Block.Header.Hash()) {
 		// Try to commit next block
 		reorg, fp, err := service.chain.CommitBlock(request.Block, request.Txs)
@@ -187,8 +580,17 @@ func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
 			service.changeSyncPeerAndRestart()
 			return
 		}
+		// Count the false positives during sync too, a poorly sized filter is reloaded in the middle
+		tooMany := MaxBlockFalsePositives > 0 && fp > MaxBlockFalsePositives
+		if service.fPositives.add(len(request.Txs), fp, tooMany) {
+			reload = true
+		}
+
 		// Update local height after block committed
 		service.updateLocalHeight()
+		service.resetRestarts()
+		service.rate.Add()
+		service.PeerManager().SyncProgressed()
 
 		// If we meet a reorganize, restart sync process
 		if reorg {
@@ -197,25 +599,19 @@ func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
 			service.syncBlocks()
 			return
 		}
-		fPositives += fp
 	}
-
-	go service.handleFPositive(fPositives)
 }
 
-func (service *SPVServiceImpl) handleFPositive(fPositives int) {
-	service.fPositives += fPositives
-	if service.fPositives > MaxFalsePositives {
-		// Broadcast filterload message to connected peers
-		service.PeerManager().Broadcast(service.getFilter().GetFilterLoadMsg())
-		service.fPositives = 0
-	}
+// Reload the filter on peers for the false positives accumulated
+func (service *SPVServiceImpl) reloadFilter() {
+	// Broadcast filterload message to connected peers
+	service.PeerManager().Broadcast(service.getFilter().GetFilterLoadMsg())
 }
 
 func (service *SPVServiceImpl) OnInventory(peer *net.Peer, inv *msg.Inventory) error {
 	switch inv.Type {
 	case p2p.TxData:
-		// Do nothing, transaction inventory is not supported
+		return service.HandleTxInvMsg(peer, inv)
 	case p2p.BlockData:
 		return service.HandleBlockInvMsg(peer, inv)
 	}
@@ -223,45 +619,111 @@ func (service *SPVServiceImpl) OnInventory(peer *net.Peer, inv *msg.Inventory) e
 }
 
 func (service *SPVServiceImpl) HandleBlockInvMsg(peer *net.Peer, inv *msg.Inventory) error {
+	// Responses of the requests sent before pause
+	if service.IsSyncPaused() {
+		return nil
+	}
+
+	// If no more blocks or stopping, return
+	if len(inv.Hashes) == 0 || service.isStopping() {
+		return nil
+	}
+
+	// Peers announce the new blocks after the wallet is back online, sync them from the chain tip
 	if !service.chain.IsSyncing() {
-		peer.Disconnect()
-		return errors.New("receive inventory message in non syncing mode")
+		service.syncFromPeer(peer)
+		return nil
 	}
 
-	// If no more blocks, return
-	if len(inv.Hashes) == 0 {
+	// Block hashes are only requested from the sync peer
+	if !service.PeerManager().IsSyncPeer(peer) {
 		return nil
 	}
 
-	// Put hashes to request queue
-	service.queue.PushHashes(peer, inv.Hashes)
+	// Queue the hashes with the others received within the window
+	if BlockInvWindow > 0 {
+		service.blockInvs.add(peer, inv.Hashes)
+		return nil
+	}
 
-	// Request more blocks
-	locator := []*Uint256{inv.Hashes[len(inv.Hashes)-1]}
-	go peer.Send(msg.NewBlocksReq(locator, Uint256{}))
+	// Put hashes to request queue, this blocks until the hashes are taken by the download window,
+	// so do it out of the message handler, then the requested blocks can be received meanwhile.
+	go service.queueBlockHashes(peer, inv.Hashes)
 
 	return nil
 }
 
+func (service *SPVServiceImpl) queueBlockHashes(peer *net.Peer, hashes []*Uint256) {
+	if !service.queue.PushHashes(peer, hashes) {
+		return
+	}
+
+	// Request more blocks after the hashes queued, so the block hashes
+	// are requested at the pace of the blocks download
+	locator := []*Uint256{hashes[len(hashes)-1]}
+	peer.Send(msg.NewBlocksReq(locator, Uint256{}))
+}
+
+// Start syncing with the peer which announced new blocks
+func (service *SPVServiceImpl) syncFromPeer(peer *net.Peer) {
+	if service.isStalled() || service.IsSyncPaused() {
+		return
+	}
+	if service.chain.IsSyncing() || service.queue.IsRunning() {
+		return
+	}
+
+	log.Info("Block inventory received from peer ", peer.ID(), ", start syncing")
+	service.chain.SetChainState(SYNCING)
+	service.PeerManager().SetSyncPeer(peer)
+	service.syncStateChanged()
+	service.requestBlocks()
+}
+
 func (service *SPVServiceImpl) OnMerkleBlock(peer *net.Peer, block *bloom.MerkleBlock) error {
 	blockHash := block.Header.Hash()
 	log.Debug("Receive merkle block hash: ", blockHash.String())
 
 	header := block.Header
-	err := service.chain.CheckProofOfWork(header)
+	err := service.checkProofOfWork(peer, header)
 	if err != nil {
 		return err
 	}
 
+	err = service.chain.CheckTimestamp(header, service.networkTime())
+	if err != nil {
+		return err
+	}
+
+	err = service.chain.CheckCheckpoint(header)
+	if err != nil {
+		service.onCheckpointConflict(peer, err)
+		return err
+	}
+
+	// Reject crafted merkle block before rebuilding the merkle tree
+	err = CheckMerkleBlockBounds(block)
+	if err != nil {
+		service.PeerManager().DisconnectPeerWithReason(peer, "invalid merkle block")
+		service.PeerManager().BanAddr(peer.Addr().String(), "invalid merkle block")
+		return errors.New("Invalid merkle block received: " + err.Error())
+	}
+
 	txIds, err := bloom.CheckMerkleBlock(*block)
 	if err != nil {
 		return errors.New("Invalid merkle block received: " + err.Error())
 	}
 
+	// All transactions of a large block matched, the peer seems to have lost our filter
+	if block.Transactions >= unfilteredBlockTxs && len(txIds) == int(block.Transactions) {
+		log.Warn("Unfiltered merkle block from peer ", peer.ID(), ", load filter again")
+		service.sendFilterLoad(peer)
+	}
+
 	if service.chain.IsSyncing() { // When blockchain in syncing mode
-		if service.PeerManager().GetSyncPeer() != nil && service.PeerManager().GetSyncPeer().ID() != peer.ID() {
+		if !service.isSyncPeerOrRequested(peer, blockHash) {
 			peer.Disconnect()
-			return fmt.Errorf("receive message from non sync peer: %d\n", peer.ID())
+			return fmt.Errorf("receive message from non sync peer: %d", peer.ID())
 		}
 
 		// Add block to sync queue
@@ -272,6 +734,21 @@ func (service *SPVServiceImpl) OnMerkleBlock(peer *net.Peer, block *bloom.Merkle
 		}
 	} else {
 
+		// New blocks will be synced after resume
+		if service.IsSyncPaused() {
+			return nil
+		}
+
+		// The chain is behind or empty, let sync download the blocks in order
+		if !service.chain.IsNextBlock(&header) {
+			log.Debug("Block ", blockHash.String(), " does not extend chain tip, start sync")
+			service.syncBlocks()
+			return nil
+		}
+
+		// A new block at the chain tip, its timestamp is a sample of the network time
+		service.timeOffset.AddTimeSample(header.Height, time.Unix(int64(header.Timestamp), 0))
+
 		// Just request block transactions.
 		// After transactions are received, the block will be put into finished blocks pool
 		service.queue.StartBlockTxsRequest(peer, block, txIds)
@@ -280,19 +757,126 @@ func (service *SPVServiceImpl) OnMerkleBlock(peer *net.Peer, block *bloom.Merkle
 	return nil
 }
 
+func (service *SPVServiceImpl) OnBlock(peer *net.Peer, block *core.Block) error {
+	blockHash := block.Header.Hash()
+	log.Debug("Receive block hash: ", blockHash.String())
+
+	if !FullBlockMode {
+		return errors.New("receive block message in non full block mode")
+	}
+
+	err := service.checkProofOfWork(peer, block.Header)
+	if err != nil {
+		return err
+	}
+
+	err = service.chain.CheckTimestamp(block.Header, service.networkTime())
+	if err != nil {
+		return err
+	}
+
+	err = service.chain.CheckCheckpoint(block.Header)
+	if err != nil {
+		service.onCheckpointConflict(peer, err)
+		return err
+	}
+
+	// Keep the block to serve other SPV clients
+	if service.server != nil {
+		service.server.AddBlock(block)
+	}
+
+	// Scan the block locally for relevant transactions
+	merkleBlock, txs := ScanBlock(block, service.getFilter())
+
+	if service.chain.IsSyncing() { // When blockchain in syncing mode
+		if !service.isSyncPeerOrRequested(peer, blockHash) {
+			peer.Disconnect()
+			return fmt.Errorf("receive message from non sync peer: %d", peer.ID())
+		}
+
+		// Add block to sync queue
+		err = service.queue.OnFullBlockReceived(merkleBlock, txs)
+		if err != nil {
+			service.changeSyncPeerAndRestart()
+			return err
+		}
+	} else {
+
+		// New blocks will be synced after resume
+		if service.IsSyncPaused() {
+			return nil
+		}
+
+		// The chain is behind or empty, let sync download the blocks in order
+		if !service.chain.IsNextBlock(&block.Header) {
+			log.Debug("Block ", blockHash.String(), " does not extend chain tip, start sync")
+			service.syncBlocks()
+			return nil
+		}
+
+		// A new block at the chain tip, its timestamp is a sample of the network time
+		service.timeOffset.AddTimeSample(block.Header.Height, time.Unix(int64(block.Header.Timestamp), 0))
+
+		// Put the block into finished blocks pool directly, transactions are already there
+		service.queue.OnRequestFinished(&BlockTxsRequest{
+			BlockHash: blockHash,
+			Block:     *merkleBlock,
+			Txs:       txs,
+		})
+	}
+
+	return nil
+}
+
+/*
+The peer sent a block conflicts with a checkpoint, sync from another peer if it's the sync peer.
+A peer on another chain is disconnected and its address discarded, as none of its blocks is useful.
+*/
+func (service *SPVServiceImpl) onCheckpointConflict(peer *net.Peer, err error) {
+	syncPeer := service.PeerManager().GetSyncPeer()
+	isSyncPeer := syncPeer != nil && syncPeer.ID() == peer.ID()
+
+	if err == ErrWrongChain {
+		service.PeerManager().BanAddr(peer.Addr().String(), "on another chain")
+		if !isSyncPeer {
+			service.PeerManager().DisconnectPeerWithReason(peer, "on another chain")
+		}
+	} else {
+		service.PeerManager().Misbehaved(peer, "block conflicts with checkpoint")
+	}
+
+	service.conflictLock.Lock()
+	for _, listener := range service.conflictListeners {
+		go listener(err)
+	}
+	service.conflictLock.Unlock()
+
+	if isSyncPeer {
+		service.changeSyncPeerAndRestart()
+	}
+}
+
 func (service *SPVServiceImpl) OnTxn(peer *net.Peer, txn *core.Transaction) error {
 	log.Debug("Receive transaction hash: ", txn.Hash().String())
 
-	if service.chain.IsSyncing() && service.PeerManager().GetSyncPeer() != nil &&
-		service.PeerManager().GetSyncPeer().ID() != peer.ID() {
+	// Transactions announced while syncing are committed as unconfirmed, unless requested for a block
+	txId := txn.Hash()
+	service.txRequests.remove(peer, txId)
+	relayed := service.relayed.remove(txId) && !service.queue.IsRequested(txId)
 
+	if service.chain.IsSyncing() && !relayed && !service.isSyncPeerOrRequested(peer, txId) {
 		peer.Disconnect()
-		return fmt.Errorf("receive message from non sync peer: %d\n", peer.ID())
+		return fmt.Errorf("receive message from non sync peer: %d", peer.ID())
 	}
 
-	if service.chain.IsSyncing() || service.queue.IsRunning() {
+	if !relayed && (service.chain.IsSyncing() || service.queue.IsRunning()) {
 		// Add transaction to queue
-		err := service.queue.OnTxReceived(txn)
+		err := service.queue.OnPeerTxReceived(peer, txn)
+		if err == ErrPeerOrphansFull {
+			service.PeerManager().Misbehaved(peer, "too many orphan transactions")
+			return err
+		}
 		if err != nil {
 			service.changeSyncPeerAndRestart()
 			return err
@@ -303,8 +887,12 @@ func (service *SPVServiceImpl) OnTxn(peer *net.Peer, txn *core.Transaction) erro
 			return err
 		}
 
+		var fp int
 		if isFPositive {
-			service.handleFPositive(1)
+			fp = 1
+		}
+		if service.fPositives.add(1, fp, false) {
+			go service.reloadFilter()
 		}
 	}
 
@@ -314,10 +902,42 @@ func (service *SPVServiceImpl) OnTxn(peer *net.Peer, txn *core.Transaction) erro
 func (service *SPVServiceImpl) OnNotFound(peer *net.Peer, msg *msg.NotFound) error {
 	log.Debug("Receive not found: ", msg.Hash.String())
 
+	// An announced transaction may leave the mempool of the peer before it's requested
+	if service.txRequests.remove(peer, msg.Hash) {
+		return nil
+	}
+
+	// Data not requested can not be not found
+	if !service.queue.IsRequested(msg.Hash) {
+		service.PeerManager().Misbehaved(peer, "unsolicited notfound")
+		return nil
+	}
+
+	// The peer announced the data but can not serve it, try another peer before restarting sync
+	service.PeerManager().Misbehaved(peer, "notfound for announced data")
+	alternate := service.queue.RequestFromAlternate(msg.Hash, peer, service.PeerManager().ConnectedPeers())
+	if alternate != nil {
+		log.Info("Data ", msg.Hash.String(), " not found on peer ", peer.ID(), ", request from peer ", alternate.ID())
+		return nil
+	}
+
+	// Merkle blocks are not found on a peer without our filter, load it again
+	// in case the peer is not the sync peer to be disconnected
+	service.sendFilterLoad(peer)
+
 	service.changeSyncPeerAndRestart()
 	return nil
 }
 
+// Check if the peer is the sync peer, or the data is requested from it when it's not found on others
+func (service *SPVServiceImpl) isSyncPeerOrRequested(peer *net.Peer, hash Uint256) bool {
+	syncPeer := service.PeerManager().GetSyncPeer()
+	if syncPeer == nil || syncPeer.ID() == peer.ID() {
+		return true
+	}
+	return service.queue.IsRequestedFrom(hash, peer)
+}
+
 // Update local peer height with current chain height
 func (service *SPVServiceImpl) updateLocalHeight() {
 	service.PeerManager().Local().SetHeight(uint64(service.chain.Height()))
@@ -0,0 +1,150 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// A merkle block with a coinbase transaction not matched, mined at the lowest difficulty
+func newMinedMerkleBlock(chain *Blockchain, previous Uint256, height uint32) *bloom.MerkleBlock {
+	coinbase := Uint256{byte(height)}
+	block := &bloom.MerkleBlock{
+		Header: Header{
+			Previous:   previous,
+			MerkleRoot: coinbase,
+			Timestamp:  uint32(time.Now().Unix()) - 100 + height,
+			Bits:       0x207fffff,
+			Height:     height,
+		},
+		Transactions: 1,
+		Hashes:       []*Uint256{&coinbase},
+		Flags:        []byte{0},
+	}
+	for chain.CheckProofOfWork(block.Header) != nil {
+		block.Header.AuxPow.ParBlockHeader.Nonce++
+	}
+	return block
+}
+
+func TestSPVServiceImpl_OnMerkleBlockAfterGenesis(t *testing.T) {
+	log.Init()
+
+	service := newTestService(t, newTestDataStore())
+	chain := service.Blockchain()
+	peer := newTestPeer(1)
+
+	// The chain has only the genesis block, which is never stored, block 1 is announced not syncing
+	genesis := Uint256{0xee}
+	block := newMinedMerkleBlock(chain, genesis, 1)
+	if err := service.OnMerkleBlock(peer, block); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != 1 || chain.ChainTip().Hash() != block.Header.Hash() {
+		t.Fatalf("block 1 not committed after genesis, chain height %d", chain.Height())
+	}
+	if blocks, _, _ := service.OrphanStats(); blocks != 0 {
+		t.Errorf("%d orphan blocks, expect none", blocks)
+	}
+
+	// The next block connects to block 1
+	next := newMinedMerkleBlock(chain, block.Header.Hash(), 2)
+	if err := service.OnMerkleBlock(peer, next); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != 2 || chain.ChainTip().Hash() != next.Header.Hash() {
+		t.Errorf("block 2 not committed, chain height %d", chain.Height())
+	}
+}
+
+func TestSPVServiceImpl_OrphanTxFlood(t *testing.T) {
+	log.Init()
+	defer func(max int) { MaxOrphanTxsPerPeer = max }(MaxOrphanTxsPerPeer)
+	MaxOrphanTxsPerPeer = 10
+
+	service := newTestService(t, newTestDataStore())
+	flooder, honest := newTestPeer(1), newTestPeer(2)
+	service.PeerManager().AddPeer(flooder)
+	service.PeerManager().AddPeer(honest)
+
+	// Transactions not belonging to any block request are kept as orphans while syncing
+	service.chain.SetChainState(SYNCING)
+	service.PeerManager().SetSyncPeer(flooder)
+	for i := uint32(0); i < uint32(MaxOrphanTxsPerPeer)+uint32(net.MaxMisbehaviors); i++ {
+		service.OnTxn(flooder, &Transaction{TxType: TransferAsset, LockTime: i})
+	}
+
+	// Sync from the other peer after the flooding peer disconnected
+	service.PeerManager().SetSyncPeer(honest)
+	if err := service.OnTxn(honest, &Transaction{TxType: TransferAsset, LockTime: 1000}); err != nil {
+		t.Errorf("orphan from the other peer rejected, %v", err)
+	}
+
+	peers := service.PeerOrphans()
+	if peers[flooder.ConnID()] != MaxOrphanTxsPerPeer || peers[honest.ConnID()] != 1 {
+		t.Errorf("orphans by peer %v, expect %d from the flooding peer and 1 from the other",
+			peers, MaxOrphanTxsPerPeer)
+	}
+	if _, txns, _ := service.OrphanStats(); txns != MaxOrphanTxsPerPeer+1 {
+		t.Errorf("%d orphan transactions, expect %d", txns, MaxOrphanTxsPerPeer+1)
+	}
+
+	// Every orphan beyond the limit is a misbehavior, the flooding peer is disconnected
+	if flooder.Misbehaviors() != net.MaxMisbehaviors {
+		t.Errorf("flooding peer misbehaved %d times, expect %d", flooder.Misbehaviors(), net.MaxMisbehaviors)
+	}
+	if flooder.State() != p2p.INACTIVITY {
+		t.Error("flooding peer not disconnected")
+	}
+	if honest.Misbehaviors() != 0 || honest.State() == p2p.INACTIVITY {
+		t.Error("the other peer is affected by the flooding peer")
+	}
+}
+
+func TestSPVServiceImpl_StopFlushPending(t *testing.T) {
+	log.Init()
+	defer func(timeout uint32) { StopFlushTimeout = timeout }(StopFlushTimeout)
+	StopFlushTimeout = 1
+
+	store := newTestDataStore()
+	service := newTestService(t, store)
+	chain := service.Blockchain()
+	// The requests are not sent to the disconnected peer
+	peer := newTestPeer(1)
+	peer.SetState(p2p.INACTIVITY)
+
+	// The block requested before stop is received while flushing
+	block := newMinedMerkleBlock(chain, chain.ChainTip().Hash(), chain.Height()+1)
+	service.queue.StartBlockRequest(peer, block.Header.Hash())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if err := service.queue.OnBlockReceived(block, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	service.Stop()
+	// The chain is locked after closed, check the data store instead
+	if store.tip == nil || store.tip.Hash() != block.Header.Hash() {
+		t.Error("block received on stop not committed")
+	}
+	if !service.isStopping() {
+		t.Error("service not stopping after stop")
+	}
+
+	// The requests not finished in time are discarded
+	another := newTestService(t, newTestDataStore())
+	another.queue.StartBlockRequest(peer, Uint256{1})
+	start := time.Now()
+	another.Stop()
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 2*time.Second {
+		t.Errorf("stop took %v with the request not finished, expect the flush timeout", elapsed)
+	}
+}
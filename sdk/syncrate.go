@@ -0,0 +1,55 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+)
+
+// Returned by EstimatedSyncTime when there is no peer or no blocks committed recently to estimate
+const UnknownSyncTime time.Duration = -1
+
+// Seconds of the recent block commits used to calculate the moving average sync rate
+var SyncRateWindow uint32 = 60
+
+// syncRate keeps the times of the blocks committed within the window
+type syncRate struct {
+	sync.Mutex
+	window  time.Duration
+	commits []time.Time
+}
+
+func newSyncRate(window time.Duration) *syncRate {
+	return &syncRate{window: window}
+}
+
+func (rate *syncRate) expire(now time.Time) {
+	for len(rate.commits) > 0 && now.Sub(rate.commits[0]) > rate.window {
+		rate.commits = rate.commits[1:]
+	}
+}
+
+func (rate *syncRate) Add() {
+	rate.Lock()
+	defer rate.Unlock()
+
+	now := time.Now()
+	rate.expire(now)
+	rate.commits = append(rate.commits, now)
+}
+
+// The average blocks committed per second within the window, 0 if not enough commits
+func (rate *syncRate) BlocksPerSecond() float64 {
+	rate.Lock()
+	defer rate.Unlock()
+
+	now := time.Now()
+	rate.expire(now)
+	if len(rate.commits) < 2 {
+		return 0
+	}
+	elapsed := now.Sub(rate.commits[0]).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(len(rate.commits)) / elapsed
+}
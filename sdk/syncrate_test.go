@@ -0,0 +1,57 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+func TestSyncRate_BlocksPerSecond(t *testing.T) {
+	rate := newSyncRate(10 * time.Second)
+	if rate.BlocksPerSecond() != 0 {
+		t.Error("sync rate without commits")
+	}
+
+	// 10 blocks in the last 5 seconds, the commits before the window are expired
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		rate.commits = append(rate.commits, now.Add(-30*time.Second+time.Duration(i)*time.Second))
+	}
+	for i := 0; i < 10; i++ {
+		rate.commits = append(rate.commits, now.Add(-5*time.Second+time.Duration(i)*500*time.Millisecond))
+	}
+	if bps := rate.BlocksPerSecond(); bps < 1.9 || bps > 2.1 {
+		t.Errorf("sync rate %f blocks per second, expect 2", bps)
+	}
+}
+
+func TestSPVServiceImpl_EstimatedSyncTime(t *testing.T) {
+	log.Init()
+	service := newTestService(t, newTestDataStore())
+	if estimated := service.EstimatedSyncTime(); estimated != UnknownSyncTime {
+		t.Errorf("estimated sync time %v without peers", estimated)
+	}
+
+	peer := newTestPeer(1)
+	peer.SetServices(ServiveSPV)
+	peer.SetHeight(uint64(service.chain.Height()) + 100)
+	service.PeerManager().AddPeer(peer)
+	if estimated := service.EstimatedSyncTime(); estimated != UnknownSyncTime {
+		t.Errorf("estimated sync time %v without blocks committed", estimated)
+	}
+
+	// 10 blocks per second
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		service.rate.commits = append(service.rate.commits, now.Add(-5*time.Second+time.Duration(i)*100*time.Millisecond))
+	}
+	if estimated := service.EstimatedSyncTime(); estimated < 9*time.Second || estimated > 11*time.Second {
+		t.Errorf("estimated sync time %v for 100 blocks, expect 10s", estimated)
+	}
+
+	peer.SetHeight(uint64(service.chain.Height()))
+	if estimated := service.EstimatedSyncTime(); estimated != 0 {
+		t.Errorf("estimated sync time %v when synced", estimated)
+	}
+}
@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+)
+
+/*
+Seconds to wait for the sync peer to reconnect after it disconnected, before the sync continues
+with another peer, so a fast sync peer is not lost to a transient network blip. The sync peer is
+only reconnected if the connection is closed by the peer or it's inactive, not if it's disconnected
+by us, like for misbehaving or changing the sync peer. 0 to not reconnect.
+*/
+var SyncPeerReconnectTimeout uint32 = 0
+
+// syncReconnect is the reconnect attempt to the disconnected sync peer
+type syncReconnect struct {
+	addr  string
+	timer *time.Timer
+}
+
+// Try to reconnect the disconnected sync peer, return false if it should not be reconnected.
+// It's called holding the service lock.
+func (service *SPVServiceImpl) reconnectSyncPeer(event net.PeerEvent) bool {
+	if SyncPeerReconnectTimeout == 0 || service.reconnect != nil {
+		return false
+	}
+	if !transientDisconnect(event.Reason) {
+		return false
+	}
+
+	log.Info("Sync peer ", event.Addr, " disconnected, ", event.Reason, ", try to reconnect")
+	service.reconnect = &syncReconnect{
+		addr:  event.Addr,
+		timer: time.AfterFunc(time.Second*time.Duration(SyncPeerReconnectTimeout), service.onReconnectTimeout),
+	}
+	service.PeerManager().ConnectPeer(event.Addr)
+	return true
+}
+
+// Check if the peer is disconnected by a network problem, which may be gone on reconnect
+func transientDisconnect(reason string) bool {
+	switch reason {
+	case "connection closed", "send message failed", "inactive timeout":
+		return true
+	}
+	return false
+}
+
+// Continue syncing with the sync peer reconnected
+func (service *SPVServiceImpl) onSyncPeerReconnected(addr string) {
+	service.Lock()
+	defer service.Unlock()
+
+	if service.reconnect == nil || service.reconnect.addr != addr {
+		return
+	}
+	service.reconnect.timer.Stop()
+	service.reconnect = nil
+
+	if !service.chain.IsSyncing() {
+		return
+	}
+	for _, peer := range service.PeerManager().ConnectedPeers() {
+		if peer.Addr().String() == addr {
+			log.Info("Sync peer ", addr, " reconnected")
+			service.PeerManager().SetSyncPeer(peer)
+			service.reassignSyncPeer()
+			return
+		}
+	}
+}
+
+// Continue syncing with another peer when the sync peer is not reconnected in time
+func (service *SPVServiceImpl) onReconnectTimeout() {
+	service.Lock()
+	defer service.Unlock()
+
+	if service.reconnect == nil {
+		return
+	}
+	log.Info("Sync peer ", service.reconnect.addr, " not reconnected in time")
+	service.reconnect = nil
+
+	peer := service.queue.Peer()
+	if !service.chain.IsSyncing() || peer == nil || service.PeerManager().Exist(peer) {
+		return
+	}
+	service.reassignSyncPeer()
+}
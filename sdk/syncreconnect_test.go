@@ -0,0 +1,35 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+)
+
+func TestSPVServiceImpl_ReconnectSyncPeer(t *testing.T) {
+	log.Init()
+	SyncPeerReconnectTimeout = 10
+	defer func() { SyncPeerReconnectTimeout = 0 }()
+
+	service := newTestService(t, newTestDataStore())
+
+	// Disconnected on purpose, the sync peer is not reconnected
+	for _, reason := range []string{"disconnected locally", "change sync peer", "misbehaving, invalid block", ""} {
+		event := net.PeerEvent{Type: net.PeerDisconnected, Addr: "127.0.0.1:20866", Reason: reason}
+		if service.reconnectSyncPeer(event) {
+			t.Errorf("sync peer disconnected for %q reconnected", reason)
+			service.reconnect.timer.Stop()
+			service.reconnect = nil
+		}
+	}
+
+	event := net.PeerEvent{Type: net.PeerDisconnected, Addr: "127.0.0.1:20866", Reason: "connection closed"}
+	if !service.reconnectSyncPeer(event) {
+		t.Fatal("sync peer closed the connection not reconnected")
+	}
+	defer service.reconnect.timer.Stop()
+	if service.reconnect.addr != event.Addr {
+		t.Errorf("reconnect to %s, expect %s", service.reconnect.addr, event.Addr)
+	}
+}
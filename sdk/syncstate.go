@@ -0,0 +1,151 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// SyncStatus is the state of the block synchronize
+type SyncStatus int
+
+const (
+	// No peer connected to sync with
+	SyncIdle SyncStatus = iota
+	// Synced with the connected peers, waiting for new blocks
+	SyncCaughtUp
+	// Downloading blocks from the sync peer
+	SyncBlocks
+	// All blocks requested are received, waiting for the transactions of them
+	SyncTxs
+	// Paused after MaxSyncRestarts restarts without progress, see OnSyncStalled
+	SyncStalled
+	// Paused by PauseSync
+	SyncPaused
+	// All connected peers are behind the chain tip, waiting for a peer ahead to sync with
+	SyncAhead
+)
+
+func (status SyncStatus) String() string {
+	switch status {
+	case SyncIdle:
+		return "idle"
+	case SyncCaughtUp:
+		return "caught up"
+	case SyncBlocks:
+		return "downloading blocks"
+	case SyncTxs:
+		return "waiting for transactions"
+	case SyncStalled:
+		return "stalled"
+	case SyncPaused:
+		return "paused"
+	case SyncAhead:
+		return "ahead of peers"
+	}
+	return "unknown"
+}
+
+// SyncState is a snapshot of the block synchronize
+type SyncState struct {
+	Status SyncStatus
+
+	// The address of the sync peer, empty if not syncing
+	Peer string
+
+	// The heights being synced, from the chain height to the height of the sync peer
+	StartHeight uint32
+	EndHeight   uint32
+
+	// When the status changed to the current one
+	Since time.Time
+}
+
+// syncTransitions records when the sync status changed
+type syncTransitions struct {
+	sync.Mutex
+	status SyncStatus
+	since  time.Time
+}
+
+// Record the status, return the time it changed to the status
+func (transitions *syncTransitions) observe(status SyncStatus) time.Time {
+	since, _ := transitions.change(status)
+	return since
+}
+
+// Record the status, return the time it changed to the status and if it changed now
+func (transitions *syncTransitions) change(status SyncStatus) (time.Time, bool) {
+	transitions.Lock()
+	defer transitions.Unlock()
+
+	if !transitions.since.IsZero() && transitions.status == status {
+		return transitions.since, false
+	}
+	transitions.status = status
+	transitions.since = time.Now()
+	return transitions.since, true
+}
+
+// Get the current state of the block synchronize
+func (service *SPVServiceImpl) SyncState() SyncState {
+	var state SyncState
+	state.Status = service.syncStatus()
+	state.Since = service.transitions.observe(state.Status)
+	state.StartHeight = service.chain.Height()
+	state.EndHeight = state.StartHeight
+
+	if state.Status == SyncBlocks || state.Status == SyncTxs {
+		if peer := service.PeerManager().GetSyncPeer(); peer != nil {
+			state.Peer = peer.Addr().String()
+			if height := uint32(peer.Height()); height > state.EndHeight {
+				state.EndHeight = height
+			}
+		}
+	}
+	return state
+}
+
+func (service *SPVServiceImpl) syncStatus() SyncStatus {
+	switch {
+	case service.IsSyncPaused():
+		return SyncPaused
+	case service.isStalled():
+		return SyncStalled
+	case service.chain.IsSyncing():
+		if blocks, txs := service.queue.pendingByType(); blocks == 0 && txs > 0 {
+			return SyncTxs
+		}
+		return SyncBlocks
+	case len(service.PeerManager().ConnectedPeers()) == 0:
+		return SyncIdle
+	case service.peersBehind():
+		return SyncAhead
+	}
+	return SyncCaughtUp
+}
+
+// Check if all the connected peers report heights below the chain height,
+// they are not candidates to sync with, nothing can be fetched from them.
+func (service *SPVServiceImpl) peersBehind() bool {
+	peers := service.PeerManager().ConnectedPeers()
+	if len(peers) == 0 {
+		return false
+	}
+	height := uint64(service.chain.Height())
+	for _, peer := range peers {
+		if peer.Height() >= height {
+			return false
+		}
+	}
+	return true
+}
+
+// Record the sync status changed, so the time of the transition is known without polling
+func (service *SPVServiceImpl) syncStateChanged() {
+	status := service.syncStatus()
+	if _, changed := service.transitions.change(status); changed && status == SyncAhead {
+		log.Info("All peers are behind the chain height ", service.chain.Height(), ", waiting for a peer ahead")
+	}
+}
@@ -0,0 +1,115 @@
+package sdk
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestSPVServiceImpl_SyncState(t *testing.T) {
+	log.Init()
+
+	chain, err := NewBlockchain(newTestDataStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &SPVServiceImpl{
+		SPVClient: &testClient{pm: net.InitPeerManager(new(net.Peer), nil)},
+		chain:     chain,
+		queue:     NewRequestQueue(MaxRequests, &testQueueHandler{sent: make(chan sentRequest, 10)}),
+	}
+
+	if state := service.SyncState(); state.Status != SyncIdle || state.Since.IsZero() {
+		t.Errorf("state %s without peers, expect idle", state.Status)
+	}
+
+	peer := newTestPeer(1)
+	peer.SetHeight(100)
+	service.PeerManager().AddPeer(peer)
+	if state := service.SyncState(); state.Status != SyncCaughtUp || state.Peer != "" {
+		t.Errorf("state %s with peers not syncing, expect caught up", state.Status)
+	}
+
+	// Syncing with the peer, the range is up to the peer height
+	idle := service.SyncState().Since
+	time.Sleep(10 * time.Millisecond)
+	chain.SetChainState(SYNCING)
+	service.PeerManager().SetSyncPeer(peer)
+	service.syncStateChanged()
+	state := service.SyncState()
+	if state.Status != SyncBlocks || state.Peer != peer.Addr().String() {
+		t.Errorf("state %s with peer %q, expect downloading blocks from the sync peer", state.Status, state.Peer)
+	}
+	if state.StartHeight != 0 || state.EndHeight != 100 {
+		t.Errorf("syncing heights %d to %d, expect 0 to 100", state.StartHeight, state.EndHeight)
+	}
+	if !state.Since.After(idle) {
+		t.Error("transition time not updated")
+	}
+
+	// Only transactions of blocks requested
+	service.queue.blockTxsQueue <- Uint256{1}
+	if state := service.SyncState(); state.Status != SyncTxs {
+		t.Errorf("state %s, expect waiting for transactions", state.Status)
+	}
+	<-service.queue.blockTxsQueue
+
+	atomic.StoreInt32(&service.paused, 1)
+	if state := service.SyncState(); state.Status != SyncPaused || state.Peer != "" {
+		t.Errorf("state %s, expect paused", state.Status)
+	}
+}
+
+func TestSPVServiceImpl_PeersBehind(t *testing.T) {
+	log.Init()
+
+	store := newTestDataStore()
+	store.height = 200
+	chain, err := NewBlockchain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &testQueueHandler{sent: make(chan sentRequest, 10)}
+	service := &SPVServiceImpl{
+		SPVClient: &testClient{pm: net.InitPeerManager(new(net.Peer), nil)},
+		chain:     chain,
+		queue:     NewRequestQueue(MaxRequests, handler),
+		relayed:   newRelayedTxs(),
+	}
+	service.blockInvs = newBlockInvs(0, service.queueBlockHashes)
+
+	for id, height := range []uint64{100, 150} {
+		peer := newTestPeer(uint64(id + 1))
+		peer.SetHeight(height)
+		service.PeerManager().AddPeer(peer)
+	}
+
+	// Nothing to sync from peers behind
+	service.syncBlocks()
+	if chain.IsSyncing() {
+		t.Error("syncing with peers behind the chain height")
+	}
+	if state := service.SyncState(); state.Status != SyncAhead {
+		t.Errorf("state %s with all peers behind, expect ahead of peers", state.Status)
+	}
+
+	// The sync peer is lost while syncing, the others are behind
+	chain.SetChainState(SYNCING)
+	service.reassignSyncPeer()
+	if chain.IsSyncing() {
+		t.Error("sync reassigned to a peer behind the chain height")
+	}
+
+	// A peer at the chain height is not behind
+	peer := newTestPeer(3)
+	peer.SetHeight(200)
+	service.PeerManager().AddPeer(peer)
+	if state := service.SyncState(); state.Status != SyncCaughtUp {
+		t.Errorf("state %s with a peer at the chain height, expect caught up", state.Status)
+	}
+}
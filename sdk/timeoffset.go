@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+const (
+	MaxTimeOffsetSamples = 200
+	MinTimeOffsetSamples = 5
+	MaxTimeOffsetWarning = time.Minute * 70
+
+	// Samples further than this from local clock are dropped, a block relayed late
+	// after an outage is not a sample of the network time.
+	MaxTimeSampleOffset = time.Hour * 24
+)
+
+/*
+TimeOffset collects the time offsets between the timestamps of the new blocks and local clock,
+the median offset is the network adjusted time offset of local clock. The version timestamps
+sent by the ELA nodes are the nanoseconds truncated to 32 bits, not a time, so the timestamps
+of the blocks received at the chain tip are sampled instead, they are backed by proof of work.
+*/
+type TimeOffset struct {
+	sync.Mutex
+	samples map[uint32]time.Duration
+	order   []uint32
+	offset  time.Duration
+	warned  bool
+
+	OnOffsetWarning func(offset time.Duration)
+}
+
+func newTimeOffset() *TimeOffset {
+	return &TimeOffset{
+		samples: make(map[uint32]time.Duration),
+	}
+}
+
+// Add the timestamp of the block at the given height, only the first sample of a height is counted
+func (to *TimeOffset) AddTimeSample(height uint32, timestamp time.Time) {
+	to.Lock()
+	defer to.Unlock()
+
+	if _, ok := to.samples[height]; ok {
+		return
+	}
+
+	// Round the offset to seconds, block timestamp is in seconds
+	offset := timestamp.Sub(time.Now()).Round(time.Second)
+	if offset < -MaxTimeSampleOffset || offset > MaxTimeSampleOffset {
+		return
+	}
+
+	// Remove the oldest sample when samples are filled
+	if len(to.order) >= MaxTimeOffsetSamples {
+		delete(to.samples, to.order[0])
+		to.order = to.order[1:]
+	}
+
+	to.samples[height] = offset
+	to.order = append(to.order, height)
+
+	if len(to.samples) < MinTimeOffsetSamples {
+		return
+	}
+
+	to.offset = to.median()
+	log.Debugf("Time offset sample %v from block %d, network time offset %v", offset, height, to.offset)
+
+	if to.offset < -MaxTimeOffsetWarning || to.offset > MaxTimeOffsetWarning {
+		if !to.warned {
+			to.warned = true
+			log.Warnf("Local clock is %v away from the network time, please check your system time", to.offset)
+			if to.OnOffsetWarning != nil {
+				go to.OnOffsetWarning(to.offset)
+			}
+		}
+	} else {
+		to.warned = false
+	}
+}
+
+func (to *TimeOffset) median() time.Duration {
+	offsets := make([]time.Duration, 0, len(to.samples))
+	for _, offset := range to.samples {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	return offsets[len(offsets)/2]
+}
+
+// Get the median time offset between network time and local clock
+func (to *TimeOffset) Offset() time.Duration {
+	to.Lock()
+	defer to.Unlock()
+
+	return to.offset
+}
@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestTimeOffset_AddTimeSample(t *testing.T) {
+	log.Init()
+	to := newTimeOffset()
+	now := time.Now()
+
+	// The old blocks relayed late are not sampled
+	for height := uint32(1); height <= MinTimeOffsetSamples; height++ {
+		to.AddTimeSample(height, now.Add(-time.Hour*25))
+	}
+	if len(to.samples) != 0 {
+		t.Fatalf("%d samples of old blocks, expect none", len(to.samples))
+	}
+
+	for height := uint32(1); height <= MinTimeOffsetSamples; height++ {
+		to.AddTimeSample(height, now.Add(time.Hour*2))
+	}
+	// Only the first sample of a height is counted
+	to.AddTimeSample(MinTimeOffsetSamples, now)
+	if offset := to.Offset(); offset < time.Hour*2-time.Second || offset > time.Hour*2+time.Second {
+		t.Errorf("time offset %v, expect 2h", offset)
+	}
+}
+
+func TestSPVServiceImpl_NetworkTimeOffset(t *testing.T) {
+	log.Init()
+
+	service := newTestService(t, newTestDataStore())
+	warned := make(chan time.Duration, 1)
+	service.OnTimeOffsetWarning(func(offset time.Duration) { warned <- offset })
+	chain := service.Blockchain()
+	peer := newTestPeer(1)
+
+	// The new blocks at the chain tip are mined by a network two hours behind local clock
+	previous := Uint256{0xee}
+	for height := uint32(1); height <= MinTimeOffsetSamples; height++ {
+		block := newMinedMerkleBlock(chain, previous, height)
+		block.Header.Timestamp = uint32(time.Now().Add(-time.Hour*2).Unix()) + height
+		for chain.CheckProofOfWork(block.Header) != nil {
+			block.Header.AuxPow.ParBlockHeader.Nonce++
+		}
+		if err := service.OnMerkleBlock(peer, block); err != nil {
+			t.Fatal(err)
+		}
+		previous = block.Header.Hash()
+	}
+
+	offset := service.NetworkTimeOffset()
+	if offset > -time.Hour*2+time.Minute || offset < -time.Hour*2-time.Minute {
+		t.Errorf("network time offset %v, expect -2h", offset)
+	}
+	select {
+	case <-warned:
+	case <-time.After(time.Second):
+		t.Error("time offset warning not fired")
+	}
+}
@@ -0,0 +1,55 @@
+package spvwallet
+
+import (
+	"errors"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+var ErrTxConfirmed = errors.New("transaction already confirmed in a block")
+
+// Register a listener to be notified when an unconfirmed wallet transaction is abandoned
+func (wallet *SPVWallet) OnTxAbandoned(listener func(tx Transaction)) {
+	wallet.abandonedLock.Lock()
+	defer wallet.abandonedLock.Unlock()
+
+	wallet.abandonedListeners = append(wallet.abandonedListeners, listener)
+}
+
+func (wallet *SPVWallet) notifyTxAbandoned(tx Transaction) {
+	wallet.abandonedLock.Lock()
+	defer wallet.abandonedLock.Unlock()
+
+	for _, listener := range wallet.abandonedListeners {
+		go listener(tx)
+	}
+}
+
+/*
+Stop tracking an unconfirmed wallet transaction, like a stuck transaction replaced outside the wallet.
+The outputs it spent become spendable again and the outputs it created are removed.
+ErrTxConfirmed is returned if the transaction is already confirmed in a block.
+If the transaction is still in the network, it will be tracked again when it's relayed or confirmed.
+*/
+func (wallet *SPVWallet) AbandonTransaction(txId Uint256) error {
+	storeTx, err := wallet.dataStore.Txs().Get(&txId)
+	if err != nil {
+		return err
+	}
+	if storeTx.Height > 0 {
+		return ErrTxConfirmed
+	}
+
+	err = wallet.removeTx(storeTx)
+	if err != nil {
+		return err
+	}
+	wallet.handles.update(txId, BroadcastFailed, 0, ErrBroadcastAbandoned)
+
+	// Outpoints changed, rebuild the bloom filter when it's used next time
+	wallet.bloomFilter.Invalidate()
+
+	wallet.notifyTxAbandoned(storeTx.Data)
+	return nil
+}
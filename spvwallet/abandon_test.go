@@ -0,0 +1,72 @@
+package spvwallet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_AbandonTransaction(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+
+	abandoned := make(chan Transaction, 1)
+	wallet.OnTxAbandoned(func(tx Transaction) { abandoned <- tx })
+
+	// A confirmed transaction pays the wallet
+	funding := Transaction{LockTime: 1, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	fundingOp := *NewOutPoint(funding.Hash(), 0)
+
+	// An unconfirmed transaction spends it
+	spending := Transaction{LockTime: 2, Inputs: []*Input{{Previous: fundingOp}},
+		Outputs: []*Output{{Value: 90, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(spending, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UTXOs().Get(&fundingOp); err == nil {
+		t.Fatal("spent output still spendable")
+	}
+
+	// Confirmed transactions can not be abandoned
+	if err := wallet.AbandonTransaction(funding.Hash()); err != ErrTxConfirmed {
+		t.Errorf("abandon confirmed transaction returns %v, expect ErrTxConfirmed", err)
+	}
+	if _, err := store.Txs().Get(&fundingOp.TxID); err != nil {
+		t.Error("confirmed transaction removed")
+	}
+
+	if err := wallet.AbandonTransaction(spending.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	spendingId := spending.Hash()
+	if _, err := store.Txs().Get(&spendingId); err == nil {
+		t.Error("abandoned transaction still tracked")
+	}
+	if _, err := store.UTXOs().Get(&fundingOp); err != nil {
+		t.Error("input of abandoned transaction not spendable again")
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(spendingId, 0)); err == nil {
+		t.Error("output of abandoned transaction still spendable")
+	}
+
+	select {
+	case tx := <-abandoned:
+		if tx.Hash() != spendingId {
+			t.Error("abandoned listener notified with another transaction")
+		}
+	case <-time.After(time.Second):
+		t.Error("abandoned listener not notified")
+	}
+
+	// Unknown transactions can not be abandoned
+	if err := wallet.AbandonTransaction(spendingId); err == nil {
+		t.Error("abandon unknown transaction succeeded")
+	}
+}
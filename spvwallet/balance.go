@@ -0,0 +1,145 @@
+package spvwallet
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Balance is the total value of the wallet UTXOs
+type Balance struct {
+	// The outputs confirmed and spendable
+	Confirmed Fixed64
+
+	// The outputs of transactions not confirmed yet
+	Unconfirmed Fixed64
+
+	// The coinbase outputs not mature yet
+	Immature Fixed64
+}
+
+/*
+balanceCache keeps the totals of the wallet UTXOs, updated as the UTXOs are committed and spent,
+so getting the balance does not read all the UTXOs. The coinbase outputs are kept by their lock
+time, they become mature as the chain grows. Rollbacks and the other rare changes of the UTXOs
+reload the totals from database.
+*/
+type balanceCache struct {
+	sync.Mutex
+	loaded      bool
+	confirmed   Fixed64
+	unconfirmed Fixed64
+	locked      map[uint32]Fixed64 // Confirmed coinbase outputs by lock time
+}
+
+// Reload the totals from all the UTXOs in database
+func (cache *balanceCache) load(utxos db.UTXOs) error {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.loaded = false
+	cache.confirmed, cache.unconfirmed = 0, 0
+	cache.locked = make(map[uint32]Fixed64)
+
+	all, err := utxos.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, utxo := range all {
+		cache.update(utxo, utxo.Value)
+	}
+	cache.loaded = true
+	return nil
+}
+
+func (cache *balanceCache) add(utxo *db.UTXO) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.loaded {
+		cache.update(utxo, utxo.Value)
+	}
+}
+
+func (cache *balanceCache) remove(utxo *db.UTXO) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.loaded {
+		cache.update(utxo, -utxo.Value)
+	}
+}
+
+func (cache *balanceCache) update(utxo *db.UTXO, value Fixed64) {
+	switch {
+	case utxo.AtHeight == 0:
+		cache.unconfirmed += value
+	case utxo.LockTime > 0:
+		cache.locked[utxo.LockTime] += value
+		if cache.locked[utxo.LockTime] == 0 {
+			delete(cache.locked, utxo.LockTime)
+		}
+	default:
+		cache.confirmed += value
+	}
+}
+
+// Get the balance at the chain height, the coinbase outputs locked above the height are immature
+func (cache *balanceCache) balance(height uint32) Balance {
+	cache.Lock()
+	defer cache.Unlock()
+
+	balance := Balance{Confirmed: cache.confirmed, Unconfirmed: cache.unconfirmed}
+	for lockTime, value := range cache.locked {
+		if lockTime > height {
+			balance.Immature += value
+		} else {
+			balance.Confirmed += value
+		}
+	}
+	return balance
+}
+
+func (cache *balanceCache) isLoaded() bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	return cache.loaded
+}
+
+// Compute the balance of the UTXOs at the chain height, without the cache
+func computeBalance(utxos []*db.UTXO, height uint32) Balance {
+	var balance Balance
+	for _, utxo := range utxos {
+		switch {
+		case utxo.AtHeight == 0:
+			balance.Unconfirmed += utxo.Value
+		case utxo.LockTime > height:
+			balance.Immature += utxo.Value
+		default:
+			balance.Confirmed += utxo.Value
+		}
+	}
+	return balance
+}
+
+// Get the balance of the wallet addresses, it's kept up to date as blocks and transactions are committed
+func (wallet *SPVWallet) GetBalance() (Balance, error) {
+	if !wallet.balance.isLoaded() {
+		err := wallet.balance.load(wallet.dataStore.UTXOs())
+		if err != nil {
+			return Balance{}, err
+		}
+	}
+	return wallet.balance.balance(wallet.GetChainHeight()), nil
+}
+
+// Reload the balance after the UTXOs changed other than committing transactions
+func (wallet *SPVWallet) reloadBalance() {
+	if err := wallet.balance.load(wallet.dataStore.UTXOs()); err != nil {
+		log.Error("Reload wallet balance failed, ", err)
+	}
+}
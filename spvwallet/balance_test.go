@@ -0,0 +1,91 @@
+package spvwallet
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_GetBalance(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+
+	// The cached balance must equal the balance computed from all the UTXOs
+	check := func(step string) {
+		balance, err := wallet.GetBalance()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := wallet.stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := Balance{Confirmed: stats.Confirmed, Unconfirmed: stats.Unconfirmed, Immature: stats.Immature}
+		if balance != expect {
+			t.Errorf("%s, balance %+v, expect %+v", step, balance, expect)
+		}
+	}
+	commit := func(tx Transaction, height uint32) {
+		if _, err := wallet.CommitTx(NewStoreTx(tx, height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("empty wallet")
+
+	store.info.height = 10
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	commit(funding, 10)
+	coinbase := Transaction{TxType: CoinBase, Outputs: []*Output{{Value: 50, ProgramHash: addr}}}
+	commit(coinbase, 10)
+	check("received")
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 100 || balance.Immature != 50 {
+		t.Errorf("balance %+v, expect 100 confirmed and 50 immature", balance)
+	}
+
+	// Spend unconfirmed then confirmed, the change is unconfirmed until confirmed
+	spend := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 60, ProgramHash: Uint168{2}}, {Value: 30, ProgramHash: addr}},
+	}
+	commit(spend, 0)
+	check("spent unconfirmed")
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 0 || balance.Unconfirmed != 30 {
+		t.Errorf("balance %+v, expect 0 confirmed and 30 unconfirmed", balance)
+	}
+	store.info.height = 11
+	commit(spend, 11)
+	check("spend confirmed")
+
+	// The coinbase output becomes mature at its lock time
+	store.info.height = 110
+	check("coinbase mature")
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 80 || balance.Immature != 0 {
+		t.Errorf("balance %+v, expect 80 confirmed", balance)
+	}
+
+	// Spend the coinbase output in a block then rollback the block,
+	// the spent output is back and the change is removed
+	reward := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(coinbase.Hash(), 0)}},
+		Outputs: []*Output{{Value: 45, ProgramHash: addr}},
+	}
+	store.info.height = 111
+	commit(reward, 111)
+	check("coinbase spent")
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 75 {
+		t.Errorf("balance %+v, expect 75 confirmed", balance)
+	}
+	if err := wallet.Rollback(111); err != nil {
+		t.Fatal(err)
+	}
+	store.info.height = 110
+	check("rollback")
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 80 {
+		t.Errorf("balance %+v after rollback, expect 80 confirmed", balance)
+	}
+}
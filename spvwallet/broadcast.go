@@ -0,0 +1,197 @@
+package spvwallet
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+var ErrBroadcastTimeout = errors.New("transaction not relayed back by peers before timeout")
+
+var (
+	// The maximum number of recently sent transactions sent to a newly connected peer
+	MaxPushOnConnect = 10
+
+	// Sent transactions not confirmed within this time are no longer tracked as sent,
+	// peers have dropped them from their mempools by then
+	SentTxExpiry = 24 * time.Hour
+)
+
+type sentTx struct {
+	tx      Transaction
+	sentAt  time.Time
+	relayed chan struct{} // Closed when relayed back
+}
+
+// sentTxs keeps the transactions sent by the wallet until they are confirmed, removed or expired,
+// a transaction relayed back by peers means at least one peer accepted it.
+type sentTxs struct {
+	sync.Mutex
+	txs map[Uint256]*sentTx
+}
+
+func newSentTxs() *sentTxs {
+	return &sentTxs{txs: make(map[Uint256]*sentTx)}
+}
+
+func (sent *sentTxs) add(tx Transaction) chan struct{} {
+	sent.Lock()
+	defer sent.Unlock()
+
+	sent.expire(time.Now())
+
+	txId := tx.Hash()
+	entry, ok := sent.txs[txId]
+	if !ok {
+		entry = &sentTx{tx: tx, relayed: make(chan struct{})}
+		sent.txs[txId] = entry
+	}
+	entry.sentAt = time.Now()
+	return entry.relayed
+}
+
+// Mark the transaction relayed back, return false if it's not sent by the wallet
+func (sent *sentTxs) relayed(txId Uint256) bool {
+	sent.Lock()
+	defer sent.Unlock()
+
+	entry, ok := sent.txs[txId]
+	if !ok {
+		return false
+	}
+	select {
+	case <-entry.relayed:
+	default:
+		close(entry.relayed)
+	}
+	return true
+}
+
+func (sent *sentTxs) isRelayed(txId Uint256) bool {
+	sent.Lock()
+	defer sent.Unlock()
+
+	entry, ok := sent.txs[txId]
+	if !ok {
+		return false
+	}
+	select {
+	case <-entry.relayed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sent *sentTxs) remove(txId Uint256) {
+	sent.Lock()
+	defer sent.Unlock()
+
+	delete(sent.txs, txId)
+}
+
+// Remove the transactions sent before SentTxExpiry, they are not going to be confirmed
+func (sent *sentTxs) expire(now time.Time) {
+	for txId, entry := range sent.txs {
+		if now.Sub(entry.sentAt) > SentTxExpiry {
+			delete(sent.txs, txId)
+		}
+	}
+}
+
+// Get the transactions sent within the window, the most recently sent first, at most max
+func (sent *sentTxs) recent(window time.Duration, max int) []Transaction {
+	sent.Lock()
+	defer sent.Unlock()
+
+	var recent []*sentTx
+	for _, entry := range sent.txs {
+		if time.Since(entry.sentAt) <= window {
+			recent = append(recent, entry)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].sentAt.After(recent[j].sentAt)
+	})
+	if len(recent) > max {
+		recent = recent[:max]
+	}
+
+	txs := make([]Transaction, 0, len(recent))
+	for _, entry := range recent {
+		txs = append(txs, entry.tx)
+	}
+	return txs
+}
+
+// Broadcast the transaction and wait until it's relayed back by peers, which needs at least two
+// connected peers, one of them is left out of the broadcast to relay it back, see broadcastTx.
+// ErrBroadcastTimeout is returned if no peer relays it back within the timeout.
+func (wallet *SPVWallet) SendTransactionAndWait(tx Transaction, timeout time.Duration) error {
+	relayed, err := wallet.sendTransaction(tx, true)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-relayed:
+		return nil
+	case <-time.After(timeout):
+		return ErrBroadcastTimeout
+	}
+}
+
+/*
+Send the transactions sent within pushOnConnect to a newly connected peer until they are confirmed,
+so the peers connected after the broadcast also receive them. At most MaxPushOnConnect
+of the most recent transactions are sent, not to flood the peer.
+*/
+func (wallet *SPVWallet) pushSentTxs(event net.PeerEvent) {
+	if wallet.pushOnConnect <= 0 || event.Type != net.PeerConnected {
+		return
+	}
+	txs := wallet.sent.recent(wallet.pushOnConnect, MaxPushOnConnect)
+	if len(txs) == 0 {
+		return
+	}
+	for _, peer := range wallet.peers.ConnectedPeers() {
+		if peer.Addr().String() != event.Addr {
+			continue
+		}
+		for i := range txs {
+			peer.Send(&txs[i])
+		}
+	}
+}
+
+// Check if the unconfirmed transaction sent by the wallet has been relayed back by peers
+func (wallet *SPVWallet) TxRelayed(txId Uint256) bool {
+	return wallet.sent.isRelayed(txId)
+}
+
+/*
+Handle the wallet's own transactions relayed back by peers. The relay confirms the broadcast
+succeeded, and returns true if the transaction is already tracked so it should not be committed again.
+Transactions confirmed in a block are no longer tracked as sent.
+*/
+func (wallet *SPVWallet) handleSentTx(storeTx *StoreTx) bool {
+	if storeTx.Height > 0 {
+		wallet.sent.remove(storeTx.TxId)
+		wallet.handles.update(storeTx.TxId, BroadcastConfirmed, storeTx.Height, nil)
+		return false
+	}
+	if !wallet.sent.relayed(storeTx.TxId) {
+		return false
+	}
+	wallet.handles.update(storeTx.TxId, BroadcastAccepted, 0, nil)
+	_, err := wallet.dataStore.Txs().Get(&storeTx.TxId)
+	return err == nil || err == db.ErrTxNotAvailable
+}
@@ -0,0 +1,159 @@
+package spvwallet
+
+import (
+	"io"
+	"io/ioutil"
+	gonet "net"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSentTxs_Recent(t *testing.T) {
+	sent := newSentTxs()
+	old := Transaction{TxType: TransferAsset, LockTime: 1}
+	sent.add(old)
+	sent.txs[old.Hash()].sentAt = time.Now().Add(-time.Minute)
+
+	var txs []Transaction
+	for i := uint32(2); i <= 4; i++ {
+		tx := Transaction{TxType: TransferAsset, LockTime: i}
+		sent.add(tx)
+		sent.txs[tx.Hash()].sentAt = time.Now().Add(-time.Duration(5-i) * time.Second)
+		txs = append(txs, tx)
+	}
+
+	// Transactions out of the window are not pushed, the most recent are pushed first
+	recent := sent.recent(30*time.Second, 2)
+	if len(recent) != 2 || recent[0].LockTime != 4 || recent[1].LockTime != 3 {
+		t.Errorf("unexpected recent transactions %v", recent)
+	}
+
+	// Confirmed transactions are removed and not pushed anymore
+	sent.remove(txs[2].Hash())
+	recent = sent.recent(30*time.Second, 2)
+	if len(recent) != 2 || recent[0].LockTime != 3 || recent[1].LockTime != 2 {
+		t.Errorf("unexpected recent transactions after remove %v", recent)
+	}
+}
+
+func TestSentTxs_Expire(t *testing.T) {
+	sent := newSentTxs()
+	expired := Transaction{TxType: TransferAsset, LockTime: 1}
+	sent.add(expired)
+	sent.txs[expired.Hash()].sentAt = time.Now().Add(-SentTxExpiry - time.Minute)
+
+	// Expired transactions are removed when another one is sent
+	tx := Transaction{TxType: TransferAsset, LockTime: 2}
+	sent.add(tx)
+	if _, ok := sent.txs[expired.Hash()]; ok {
+		t.Error("expired transaction still tracked")
+	}
+	if _, ok := sent.txs[tx.Hash()]; !ok {
+		t.Error("sent transaction not tracked")
+	}
+}
+
+func TestSPVWallet_HandleSentTx(t *testing.T) {
+	addr := Uint168{1}
+	wallet, _ := newTestWallet(addr)
+
+	tx := Transaction{TxType: TransferAsset, LockTime: 1, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	relayed := wallet.sent.add(tx)
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 0)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-relayed:
+	default:
+		t.Fatal("sent transaction relayed back not marked relayed")
+	}
+
+	// Relayed again, it's tracked already and not committed again
+	if !wallet.handleSentTx(NewStoreTx(tx, 0)) {
+		t.Error("tracked transaction relayed back to be committed again")
+	}
+
+	// Confirmed transactions are no longer tracked as sent
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if wallet.TxRelayed(tx.Hash()) {
+		t.Error("confirmed transaction still tracked as sent")
+	}
+}
+
+func TestSPVWallet_RemoveTxNotSent(t *testing.T) {
+	addr := Uint168{1}
+	wallet, _ := newTestWallet(addr)
+
+	tx := Transaction{TxType: TransferAsset, LockTime: 1, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	wallet.sent.add(tx)
+	storeTx := NewStoreTx(tx, 0)
+	if _, err := wallet.CommitTx(storeTx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaced or abandoned transactions are not going to be confirmed
+	if err := wallet.removeTx(storeTx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := wallet.sent.txs[tx.Hash()]; ok {
+		t.Error("removed transaction still tracked as sent")
+	}
+}
+
+type testConn struct {
+	gonet.Conn
+}
+
+func (conn *testConn) RemoteAddr() gonet.Addr {
+	return &gonet.TCPAddr{IP: gonet.ParseIP("127.0.0.1"), Port: 20866}
+}
+
+func newTestPeer(id uint64) *net.Peer {
+	conn, remote := gonet.Pipe()
+	go io.Copy(ioutil.Discard, remote)
+	peer := net.NewPeer(&testConn{Conn: conn})
+	peer.SetID(id)
+	peer.SetRelay(1)
+	peer.SetState(p2p.ESTABLISH)
+	return peer
+}
+
+func TestSPVWallet_BroadcastTxLeavesOutPeer(t *testing.T) {
+	log.Init()
+
+	wallet, _ := newTestWallet(Uint168{1})
+	wallet.peers = net.InitPeerManager(new(net.Peer), nil)
+	tx := &Transaction{TxType: TransferAsset, LockTime: 1}
+
+	// A single peer is sent to, there is no other peer to relay it back
+	wallet.peers.AddPeer(newTestPeer(1))
+	if peers := wallet.broadcastTx(tx, true); len(peers) != 1 {
+		t.Errorf("sent to %d peers, expect 1", len(peers))
+	}
+
+	// One peer is left out to relay the transaction back only when waiting for the relay
+	for id := uint64(2); id <= 4; id++ {
+		wallet.peers.AddPeer(newTestPeer(id))
+	}
+	for _, test := range []struct {
+		fanout      int
+		leaveOneOut bool
+		sent        int
+	}{{0, false, 4}, {2, false, 2}, {0, true, 3}, {2, true, 2}, {4, true, 3}} {
+		wallet.broadcastFanout = test.fanout
+		if peers := wallet.broadcastTx(tx, test.leaveOneOut); len(peers) != test.sent {
+			t.Errorf("fanout %d leave one out %v sent to %d peers, expect %d",
+				test.fanout, test.leaveOneOut, len(peers), test.sent)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package spvwallet
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+var (
+	ErrBroadcastAbandoned = errors.New("transaction abandoned")
+	ErrBroadcastReplaced  = errors.New("transaction replaced by a higher fee transaction")
+)
+
+// The status of a transaction broadcast, it only moves forward
+type BroadcastStatus int
+
+const (
+	// Sent to the connected peers
+	BroadcastSent BroadcastStatus = iota
+	// Relayed back by peers, so at least one peer accepted it
+	BroadcastAccepted
+	// Confirmed in a block, final
+	BroadcastConfirmed
+	// Abandoned or replaced, final
+	BroadcastFailed
+)
+
+func (s BroadcastStatus) String() string {
+	switch s {
+	case BroadcastSent:
+		return "sent"
+	case BroadcastAccepted:
+		return "accepted"
+	case BroadcastConfirmed:
+		return "confirmed"
+	case BroadcastFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+BroadcastHandle tracks the status of a transaction sent by BroadcastTransaction.
+Poll it with Status, select on Changed or block with Wait. The handle stops tracking
+when the status is final, or when it's closed. A confirmed transaction rolled back by
+a reorganize is not tracked anymore, use OnTxUnconfirmed for that.
+*/
+type BroadcastHandle struct {
+	txId    Uint256
+	handles *broadcastHandles
+
+	sync.Mutex
+	status  BroadcastStatus
+	height  uint32
+	err     error
+	changed chan struct{} // Closed and replaced when the status changes
+}
+
+// The hash of the transaction broadcast
+func (h *BroadcastHandle) TxId() Uint256 {
+	return h.txId
+}
+
+// Get the current status, the height it's confirmed at, and why it failed
+func (h *BroadcastHandle) Status() (BroadcastStatus, uint32, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.status, h.height, h.err
+}
+
+// The returned channel is closed when the status changes after this call
+func (h *BroadcastHandle) Changed() <-chan struct{} {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.changed
+}
+
+/*
+Wait until the broadcast reaches the status, or a later one. The reason is returned if it failed,
+and ErrBroadcastTimeout if the status is not reached within the timeout.
+*/
+func (h *BroadcastHandle) Wait(status BroadcastStatus, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		h.Lock()
+		current, err, changed := h.status, h.err, h.changed
+		h.Unlock()
+
+		if current == BroadcastFailed {
+			return err
+		}
+		if current >= status {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return ErrBroadcastTimeout
+		}
+	}
+}
+
+// Stop tracking the broadcast, the status is not updated anymore
+func (h *BroadcastHandle) Close() {
+	h.handles.remove(h)
+}
+
+func (h *BroadcastHandle) update(status BroadcastStatus, height uint32, err error) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	if status <= h.status {
+		return false
+	}
+	h.status, h.height, h.err = status, height, err
+	close(h.changed)
+	h.changed = make(chan struct{})
+	return true
+}
+
+// broadcastHandles keeps the open handles by transaction
+type broadcastHandles struct {
+	sync.Mutex
+	handles map[Uint256][]*BroadcastHandle
+}
+
+func newBroadcastHandles() *broadcastHandles {
+	return &broadcastHandles{handles: make(map[Uint256][]*BroadcastHandle)}
+}
+
+func (handles *broadcastHandles) add(txId Uint256) *BroadcastHandle {
+	handles.Lock()
+	defer handles.Unlock()
+
+	h := &BroadcastHandle{txId: txId, handles: handles, changed: make(chan struct{})}
+	handles.handles[txId] = append(handles.handles[txId], h)
+	return h
+}
+
+func (handles *broadcastHandles) remove(h *BroadcastHandle) {
+	handles.Lock()
+	defer handles.Unlock()
+
+	list := handles.handles[h.txId]
+	for i, handle := range list {
+		if handle == h {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(handles.handles, h.txId)
+		return
+	}
+	handles.handles[h.txId] = list
+}
+
+// Update the handles of the transaction, the handles reaching a final status are removed
+func (handles *broadcastHandles) update(txId Uint256, status BroadcastStatus, height uint32, err error) {
+	handles.Lock()
+	defer handles.Unlock()
+
+	list, ok := handles.handles[txId]
+	if !ok {
+		return
+	}
+	for _, h := range list {
+		h.update(status, height, err)
+	}
+	if status >= BroadcastConfirmed {
+		delete(handles.handles, txId)
+	}
+}
+
+/*
+Broadcast the transaction like SendTransactionAndWait, and return a handle tracking its status:
+sent, accepted when relayed back by peers, confirmed in a block, or failed when it's abandoned
+or replaced. Close the handle when it's no longer needed before the status is final.
+*/
+func (wallet *SPVWallet) BroadcastTransaction(tx Transaction) (*BroadcastHandle, error) {
+	// Track before sending, not to miss a fast relay
+	h := wallet.handles.add(tx.Hash())
+	_, err := wallet.sendTransaction(tx, true)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	// Sent again after relayed before
+	if wallet.sent.isRelayed(h.txId) {
+		wallet.handles.update(h.txId, BroadcastAccepted, 0, nil)
+	}
+	return h, nil
+}
@@ -0,0 +1,103 @@
+package spvwallet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestBroadcastHandle(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.info.height = 10
+
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	tx := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 90, ProgramHash: Uint168{2}}},
+	}
+
+	// Sent like BroadcastTransaction does without the network
+	h := wallet.handles.add(tx.Hash())
+	wallet.sent.add(tx)
+	if status, _, _ := h.Status(); status != BroadcastSent {
+		t.Errorf("status %s, expect sent", status)
+	}
+	if err := h.Wait(BroadcastAccepted, 10*time.Millisecond); err != ErrBroadcastTimeout {
+		t.Errorf("wait accepted before relayed, error %v, expect timeout", err)
+	}
+
+	// Relayed back by peers
+	changed := h.Changed()
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 0)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("status change not signaled")
+	}
+	if err := h.Wait(BroadcastAccepted, time.Second); err != nil {
+		t.Errorf("wait accepted, %v", err)
+	}
+
+	// Confirmed in a block, the handle stops tracking
+	store.info.height = 11
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 11)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Wait(BroadcastConfirmed, time.Second); err != nil {
+		t.Errorf("wait confirmed, %v", err)
+	}
+	if status, height, _ := h.Status(); status != BroadcastConfirmed || height != 11 {
+		t.Errorf("status %s at height %d, expect confirmed at height 11", status, height)
+	}
+	if len(wallet.handles.handles) != 0 {
+		t.Errorf("%d transactions still tracked after confirmed", len(wallet.handles.handles))
+	}
+}
+
+func TestBroadcastHandle_Failed(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.info.height = 10
+
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	tx := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 90, ProgramHash: addr}},
+	}
+	h := wallet.handles.add(tx.Hash())
+	closed := wallet.handles.add(tx.Hash())
+	wallet.sent.add(tx)
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A closed handle is not updated anymore
+	closed.Close()
+	if err := wallet.AbandonTransaction(tx.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Wait(BroadcastConfirmed, time.Second); err != ErrBroadcastAbandoned {
+		t.Errorf("wait confirmed, error %v, expect abandoned", err)
+	}
+	if status, _, _ := closed.Status(); status != BroadcastAccepted {
+		t.Errorf("closed handle status %s, expect accepted", status)
+	}
+	if len(wallet.handles.handles) != 0 {
+		t.Errorf("%d transactions still tracked after failed", len(wallet.handles.handles))
+	}
+}
@@ -2,20 +2,244 @@ package config
 
 import (
 	"bytes"
-	"io/ioutil"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
 	ConfigFilename = "./config.json"
+
+	// Environment variables to populate config values,
+	// SeedList is a comma separated list of IP:[Port] addresses
+	EnvPrintLevel = "SPV_PRINT_LEVEL"
+	EnvSeedList   = "SPV_SEED_LIST"
+
+	MaxPrintLevel        = 5
+	DefaultLogMaxSize    = 20 // MB
+	DefaultLogMaxBackups = 5
+
+	// Same as the default of sdk.MaxOrphanTxsPerPeer
+	DefaultMaxOrphanTxsPerPeer = 100
+
+	// The SPV service bit of the version message services, same as sdk.ServiveSPV
+	serviceSPV = 1 << 2
 )
 
 var config *Config // The single instance of config
 
 type Config struct {
-	PrintLevel uint8
+	// Which level of messages are printed, 0 to 5, unset is 0, see Level()
+	PrintLevel *uint8
 	SeedList   []string
+
+	// Write logs into a rotating log file, rotated when it reaches LogMaxSize MB
+	// and keep LogMaxBackups rotated files
+	LogFile       string
+	LogMaxSize    int
+	LogMaxBackups int
+
+	// Seconds within which the repeated peer errors of the same kind are logged once,
+	// with the number of the suppressed ones logged next time, 0 to log all of them
+	LogSuppressWindow uint32
+
+	// Seconds to keep an orphan transaction before it's evicted, 0 to use the SDK default
+	OrphanTxTimeout uint32
+
+	// The orphan transactions a peer can keep, the peer sending more is scored as misbehaving,
+	// 0 to not limit, same as sdk.MaxOrphanTxsPerPeer
+	MaxOrphanTxsPerPeer int
+
+	// Run local sanity checks on transactions before broadcast
+	ValidateTxBeforeSend bool
+
+	// Verify the structure and signatures of received transactions of the wallet addresses,
+	// the ones failed are dropped, see SPVWallet.VerifyReceivedTx for what can be verified
+	VerifyReceivedTx bool
+
+	// Download full blocks and filter them locally instead of sending a bloom filter to peers,
+	// peers must support sending full blocks to SPV clients
+	FullBlockMode bool
+
+	// The transaction type values the wallet commits, other types are ignored
+	// even they touch the wallet addresses, empty to track all types
+	TrackedTxTypes []int
+
+	// Commit the coinbase transactions paying the wallet addresses, the outputs are spendable
+	// after 100 confirmations. Set to false to ignore the mining rewards. Default true
+	TrackCoinbase *bool
+
+	// Request the unconfirmed transactions from peers on connect when the chain is synced
+	RequestMemPool bool
+
+	// Request the transactions announced by peers, and the mempool if RequestMemPool is set,
+	// while syncing, by default they are deferred until synced to speed up the blocks download
+	RelayWhileSyncing bool
+
+	// Serve merkle blocks of the recent full blocks to other SPV clients, requires FullBlockMode
+	ServerMode bool
+
+	// The services advertised to peers in the version message, only the SPV service bit is
+	// supported and only in ServerMode. Request peers to relay unconfirmed transactions to us
+	AdvertisedServices uint64
+	RequestRelay       bool
+
+	// Connect the recently connected good peers first on startup, before the seeds
+	ReconnectLastPeers bool
+
+	// Trusted peer addresses in IP:Port format, they are kept connected in reserved slots
+	// besides the auto connected peers, at most MaxManualPeers, 0 to use the SDK default
+	ManualPeers    []string
+	MaxManualPeers int
+
+	// Connect ConnRampStart peers on a cold start and one more peer every ConnRampInterval
+	// seconds of stable initial sync, 0 to disable the ramp or use the SDK default interval
+	ConnRampStart    int
+	ConnRampInterval uint32
+
+	// The local IP address outbound peer connections are made from, empty to let the OS choose
+	BindAddress string
+
+	// The maximum number of outbound connection attempts in flight, 0 to use the SDK default
+	MaxConcurrentDials int
+
+	// A peer reporting a height more than this below the height it reported recently is scored
+	// as misbehaving, 0 to disable
+	MaxHeightDrop uint64
+
+	// Seconds to wait for the sync peer to reconnect after it disconnected by a transient error,
+	// before syncing with another peer, 0 to switch to another peer at once
+	SyncPeerReconnectTimeout uint32
+
+	// Seconds between resolving the seed host names again to learn new peer addresses, 0 to disable
+	SeedRefreshInterval uint32
+
+	// Seconds between connection attempts while all peers are disconnected, 0 to use the default
+	OutageReconnectInterval uint32
+
+	// Seconds after sending a transaction to also send it to newly connected peers until it's
+	// confirmed, so peers connected after the broadcast receive it too, 0 to disable
+	PushOnConnectWindow uint32
+
+	// The number of random peers a sent transaction is broadcast to, they relay it to the others,
+	// so not all peers see the wallet as the origin, 0 to broadcast to all connected peers.
+	// When waiting for the relay, one peer is left out when there are two or more to relay it back
+	BroadcastFanout int
+
+	// The number of goroutines handling inbound messages, 0 to use the default
+	MessageWorkers int
+
+	// Seconds to wait for a peer to complete the handshake, 0 to use the default
+	HandshakeTimeout int
+
+	// Seconds to skip the inventory hashes already announced, 0 to use the SDK default
+	InvDedupWindow uint32
+
+	// Milliseconds to collect the block inventories from the sync peer into one batch, 0 to disable
+	BlockInvWindow uint32
+
+	// Pause sync for SyncStallCooldown seconds after restarts MaxSyncRestarts times
+	// without progress, 0 to use the SDK defaults
+	MaxSyncRestarts   int
+	SyncStallCooldown uint32
+
+	// Seconds of the recent block commits to estimate the sync time, 0 to use the SDK default
+	SyncRateWindow uint32
+
+	// The number of blocks written to database in one transaction on sync, 0 to use the SDK default
+	CommitBatchSize int
+
+	// Seconds an unfinished batch is kept before written to database, 0 to use the SDK default
+	CommitFlushInterval uint32
+
+	// Seconds a commit to database can take before the wallet enters safe mode, 0 to disable
+	CommitTimeout uint32
+
+	// The transaction requests of a block sent at the same time, and the false positives of a block
+	// to reload the filter at once, 0 to request all at once and wait for the false positives accumulated
+	MaxBlockTxRequests     int
+	MaxBlockFalsePositives int
+
+	// The false positives accumulated, during sync and after, to reload the filter on peers,
+	// 0 to use the SDK default
+	MaxFalsePositives int
+
+	// The blocks received out of order kept waiting for their previous blocks,
+	// no more blocks are requested while reached, 0 to not limit
+	MaxBlocksAhead int
+
+	// The memory in bytes the blocks received ahead of the chain tip may use, the blocks not
+	// in the sync batch are evicted and no more blocks are requested while reached, 0 to not limit
+	SyncCacheSize int
+
+	// The minimum fee rate of a transaction in sela per KB, the higher one of it and the
+	// minimum rate announced by peers is required to send a transaction
+	MinRelayFee int64
+
+	// New addresses are refused when the addresses and outpoints in the bloom filter reach
+	// this limit, 0 to use the SDK default, see sdk.MaxFilterElements for the recommended value
+	MaxFilterElements int
+
+	// Block timestamps must be after the median of MedianTimeBlocks previous blocks and not
+	// ahead of the network time more than MaxFutureBlockTime seconds, 0 to use the SDK defaults
+	MedianTimeBlocks   int
+	MaxFutureBlockTime uint32
+
+	// Keep the raw data of the wallet transactions, only the id, height and the address and value
+	// of each output are kept when set to false to save space, and the transactions can not be
+	// retrieved. Default true
+	StoreFullTransactions *bool
+
+	// The outpoints of the received outputs added into the bloom filter, none, all or p2pubkeyonly,
+	// empty to use the SDK default all, see sdk.FilterUpdateMode for the tradeoffs of the modes
+	FilterUpdateMode string
+
+	// Rebuild the bloom filter from the database and load it on the connected peers when the
+	// network is restored after all peers disconnected, so a fresh peer set gets the complete filter
+	RebuildFilterOnReconnect bool
+
+	// Known block hashes of the main chain, blocks conflict with them are rejected
+	Checkpoints []Checkpoint
+
+	// The blocks whose proof-of-work is verified, full from the genesis block, checkpoints only above
+	// the highest checkpoint, or trusted to skip it for the blocks from ManualPeers, empty to use the
+	// SDK default checkpoints, see sdk.PoWVerificationMode for the security of the modes
+	PoWVerification string
+
+	// The genesis block hash of the chain, peers serving blocks not following it are on another
+	// chain sharing our magic number and are disconnected, empty to not check
+	GenesisHash string
+
+	// Enter safe mode, which refuses to send transactions until cleared, when a peer sent a block
+	// conflicts with the checkpoints, a reorganize detaches more than SafeModeReorgDepth blocks,
+	// or SafeModeVerifyFailures received transactions in a row fail verification. 0 to disable
+	SafeModeOnCheckpointConflict bool
+	SafeModeReorgDepth           int
+	SafeModeVerifyFailures       int
+}
+
+// Checkpoint is a block hash in hex string, as shown in block explorers, at the height
+type Checkpoint struct {
+	Height uint32
+	Hash   string
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		LogMaxSize:    DefaultLogMaxSize,
+		LogMaxBackups: DefaultLogMaxBackups,
+
+		MaxOrphanTxsPerPeer: DefaultMaxOrphanTxsPerPeer,
+	}
 }
 
 func (config *Config) readConfigFile() error {
@@ -33,13 +257,233 @@ func (config *Config) readConfigFile() error {
 	return nil
 }
 
+// Overwrite config values with the environment variables that have been set
+func (config *Config) readEnv() error {
+	if value, ok := os.LookupEnv(EnvPrintLevel); ok {
+		level, err := strconv.ParseUint(strings.TrimSpace(value), 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q, must be an integer between 0 and %d",
+				EnvPrintLevel, value, MaxPrintLevel)
+		}
+		printLevel := uint8(level)
+		config.PrintLevel = &printLevel
+	}
+
+	if value, ok := os.LookupEnv(EnvSeedList); ok {
+		var seeds []string
+		for _, seed := range strings.Split(value, ",") {
+			if seed = strings.TrimSpace(seed); seed != "" {
+				seeds = append(seeds, seed)
+			}
+		}
+		config.SeedList = seeds
+	}
+
+	return nil
+}
+
+// Overwrite config values with the non zero values in the given config,
+// the empty slices and nil pointers are zero values too
+func (config *Config) merge(explicit *Config) {
+	loaded := reflect.ValueOf(config).Elem()
+	values := reflect.ValueOf(explicit).Elem()
+	for i := 0; i < values.NumField(); i++ {
+		value := values.Field(i)
+		switch value.Kind() {
+		case reflect.Slice:
+			if value.Len() == 0 {
+				continue
+			}
+		default:
+			if value.Interface() == reflect.Zero(value.Type()).Interface() {
+				continue
+			}
+		}
+		loaded.Field(i).Set(value)
+	}
+}
+
+// Check if the required config values are set and valid
+func (config *Config) Validate() error {
+	if config.Level() > MaxPrintLevel {
+		return fmt.Errorf("invalid PrintLevel %d, must between 0 and %d", config.Level(), MaxPrintLevel)
+	}
+
+	for _, txType := range config.TrackedTxTypes {
+		if txType < 0 || txType > math.MaxUint8 {
+			return fmt.Errorf("invalid TrackedTxTypes value %d, must between 0 and %d", txType, math.MaxUint8)
+		}
+	}
+
+	if config.ServerMode && !config.FullBlockMode {
+		return errors.New("ServerMode requires FullBlockMode, only full blocks can be served")
+	}
+	if config.AdvertisedServices&^serviceSPV != 0 {
+		return fmt.Errorf("invalid AdvertisedServices %d, only the SPV service %d is supported",
+			config.AdvertisedServices, serviceSPV)
+	}
+	if config.AdvertisedServices&serviceSPV != 0 && !config.ServerMode {
+		return errors.New("advertising the SPV service requires ServerMode")
+	}
+
+	if err := checkNotNegative(map[string]int64{
+		"MessageWorkers":         int64(config.MessageWorkers),
+		"BroadcastFanout":        int64(config.BroadcastFanout),
+		"MaxManualPeers":         int64(config.MaxManualPeers),
+		"ConnRampStart":          int64(config.ConnRampStart),
+		"CommitBatchSize":        int64(config.CommitBatchSize),
+		"MaxConcurrentDials":     int64(config.MaxConcurrentDials),
+		"MaxBlockTxRequests":     int64(config.MaxBlockTxRequests),
+		"MaxBlockFalsePositives": int64(config.MaxBlockFalsePositives),
+		"MaxFalsePositives":      int64(config.MaxFalsePositives),
+		"MaxOrphanTxsPerPeer":    int64(config.MaxOrphanTxsPerPeer),
+		"MaxBlocksAhead":         int64(config.MaxBlocksAhead),
+		"SyncCacheSize":          int64(config.SyncCacheSize),
+		"MinRelayFee":            config.MinRelayFee,
+		"MaxFilterElements":      int64(config.MaxFilterElements),
+		"MedianTimeBlocks":       int64(config.MedianTimeBlocks),
+		"SafeModeReorgDepth":     int64(config.SafeModeReorgDepth),
+		"SafeModeVerifyFailures": int64(config.SafeModeVerifyFailures),
+		"HandshakeTimeout":       int64(config.HandshakeTimeout),
+	}); err != nil {
+		return err
+	}
+
+	if config.BindAddress != "" {
+		if err := checkBindAddress(config.BindAddress); err != nil {
+			return err
+		}
+	}
+
+	switch strings.ToLower(config.FilterUpdateMode) {
+	case "", "none", "all", "p2pubkeyonly":
+	default:
+		return fmt.Errorf("invalid FilterUpdateMode %q, must be none, all or p2pubkeyonly", config.FilterUpdateMode)
+	}
+
+	switch strings.ToLower(config.PoWVerification) {
+	case "", "full", "checkpoints":
+	case "trusted":
+		if len(config.ManualPeers) == 0 {
+			return errors.New("PoWVerification trusted requires ManualPeers")
+		}
+	default:
+		return fmt.Errorf("invalid PoWVerification %q, must be full, checkpoints or trusted", config.PoWVerification)
+	}
+
+	for _, checkpoint := range config.Checkpoints {
+		if !isBlockHash(checkpoint.Hash) {
+			return fmt.Errorf("invalid Checkpoints hash %q at height %d, must be 64 hex characters",
+				checkpoint.Hash, checkpoint.Height)
+		}
+	}
+
+	if config.GenesisHash != "" && !isBlockHash(config.GenesisHash) {
+		return fmt.Errorf("invalid GenesisHash %q, must be 64 hex characters", config.GenesisHash)
+	}
+	if len(config.SeedList) == 0 {
+		return errors.New("SeedList is empty, set it in " + ConfigFilename + " or " + EnvSeedList)
+	}
+	for i, seed := range config.SeedList {
+		if strings.TrimSpace(seed) == "" {
+			return fmt.Errorf("SeedList has an empty address at index %d", i)
+		}
+	}
+
+	return nil
+}
+
+// The print level of the logs, 0 if PrintLevel is not set
+func (config *Config) Level() uint8 {
+	if config.PrintLevel == nil {
+		return 0
+	}
+	return *config.PrintLevel
+}
+
+// Check the counts and limits, by the field names, are not negative
+func checkNotNegative(values map[string]int64) error {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if values[name] < 0 {
+			return fmt.Errorf("invalid %s %d, must not be negative", name, values[name])
+		}
+	}
+	return nil
+}
+
+func isBlockHash(str string) bool {
+	hash, err := hex.DecodeString(str)
+	return err == nil && len(hash) == 32
+}
+
+// Check the bind address is an IP address of this host
+func checkBindAddress(addr string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("invalid BindAddress %s, must be an IP address", addr)
+	}
+	if ip.IsUnspecified() {
+		return nil
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("invalid BindAddress %s, %s", addr, err)
+	}
+	for _, local := range addrs {
+		if ipNet, ok := local.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid BindAddress %s, not an address of this host", addr)
+}
+
+// Load config values by the precedence explicit config > environment variables > config file > defaults.
+// Fields left zero, or nil for the pointer fields, in the explicit config fall through to the lower precedence sources,
+// and when explicit config is given, the config file will not be read.
+// The loaded config is validated and replaces the instance returned by Values().
+func Load(explicit *Config) (*Config, error) {
+	loaded := defaultConfig()
+	if explicit == nil {
+		err := loaded.readConfigFile()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read config file %s failed, %s", ConfigFilename, err)
+		}
+	}
+
+	err := loaded.readEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if explicit != nil {
+		loaded.merge(explicit)
+	}
+
+	err = loaded.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	config = loaded
+	return config, nil
+}
+
 func Values() *Config {
 	if config == nil {
-		config = new(Config)
+		config = defaultConfig()
 		err := config.readConfigFile()
 		if err != nil {
 			fmt.Println("Read config file error:", err)
 		}
+		err = config.readEnv()
+		if err != nil {
+			fmt.Println("Read config environment error:", err)
+		}
 	}
 	return config
 }
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	os.Setenv(EnvPrintLevel, "3")
+	os.Setenv(EnvSeedList, "127.0.0.1, 127.0.0.2")
+	defer os.Unsetenv(EnvPrintLevel)
+	defer os.Unsetenv(EnvSeedList)
+
+	// The fields not set in the explicit config are taken from the environment
+	cfg, err := Load(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level() != 3 {
+		t.Errorf("print level %d, expect 3 from the environment", cfg.Level())
+	}
+	if len(cfg.SeedList) != 2 || cfg.SeedList[1] != "127.0.0.2" {
+		t.Errorf("seed list %v, expect the environment seeds", cfg.SeedList)
+	}
+
+	// Print level 0 set explicitly overrides the environment
+	level := uint8(0)
+	cfg, err = Load(&Config{PrintLevel: &level, SeedList: []string{"127.0.0.3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level() != 0 {
+		t.Errorf("print level %d, expect 0 set explicitly", cfg.Level())
+	}
+	if len(cfg.SeedList) != 1 || cfg.SeedList[0] != "127.0.0.3" {
+		t.Errorf("seed list %v, expect the explicit seeds", cfg.SeedList)
+	}
+	if Values() != cfg {
+		t.Error("loaded config not returned by Values()")
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load(&Config{SeedList: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level() != 0 {
+		t.Errorf("default print level %d, expect 0", cfg.Level())
+	}
+
+	if _, err := Load(&Config{}); err == nil {
+		t.Error("loaded config without seeds")
+	}
+	level := uint8(MaxPrintLevel + 1)
+	if _, err := Load(&Config{PrintLevel: &level, SeedList: []string{"127.0.0.1"}}); err == nil {
+		t.Error("loaded config with invalid print level")
+	}
+}
+
+func TestLoad_Merge(t *testing.T) {
+	os.Setenv(EnvSeedList, "127.0.0.1")
+	defer os.Unsetenv(EnvSeedList)
+
+	// The zero values and empty slices fall through to the defaults and the environment
+	cfg, err := Load(&Config{SeedList: []string{}, LogMaxSize: 0, LogFile: "spv.log", FullBlockMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.SeedList) != 1 || cfg.LogMaxSize != DefaultLogMaxSize {
+		t.Errorf("seed list %v and log max size %d overwritten by zero values", cfg.SeedList, cfg.LogMaxSize)
+	}
+	if cfg.LogFile != "spv.log" || !cfg.FullBlockMode {
+		t.Error("explicit values not merged")
+	}
+
+	if _, err := Load(&Config{MinRelayFee: -1}); err == nil {
+		t.Error("loaded config with negative MinRelayFee")
+	}
+}
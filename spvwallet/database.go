@@ -1,12 +1,16 @@
 package spvwallet
 
 import (
+	"errors"
 	"sync"
 
-	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+var ErrFilterFull = errors.New("too many addresses and outpoints for the bloom filter")
+
 type Database interface {
 	AddAddress(address *Uint168, script []byte, addrType int) error
 	GetAddress(address *Uint168) (*Addr, error)
@@ -20,16 +24,22 @@ type Database interface {
 
 var instance Database
 
-func GetDatabase() (Database, error) {
+// Get the wallet database, new addresses are refused when the bloom filter has
+// maxFilterElements elements, 0 to use sdk.MaxFilterElements.
+func GetDatabase(maxFilterElements int) (Database, error) {
 	if instance == nil {
 		dataStore, err := NewSQLiteDB()
 		if err != nil {
 			return nil, err
 		}
 
+		if maxFilterElements <= 0 {
+			maxFilterElements = sdk.MaxFilterElements
+		}
 		instance = &DatabaseImpl{
-			lock:      new(sync.RWMutex),
-			DataStore: dataStore,
+			lock:              new(sync.RWMutex),
+			DataStore:         dataStore,
+			maxFilterElements: maxFilterElements,
 		}
 	}
 
@@ -39,13 +49,73 @@ func GetDatabase() (Database, error) {
 type DatabaseImpl struct {
 	lock *sync.RWMutex
 	DataStore
+	// New addresses are refused when the bloom filter has this many elements
+	maxFilterElements int
 }
 
+// Add an address to watch, ErrFilterFull is returned when the addresses and outpoints
+// loaded into the bloom filter reach the MaxFilterElements limit.
 func (db *DatabaseImpl) AddAddress(address *Uint168, script []byte, addrType int) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	return db.DataStore.Addrs().Put(address, script, addrType)
+	// Updating an existing address does not add a filter element
+	_, err := db.DataStore.Addrs().Get(address)
+	isNew := err != nil
+	if isNew {
+		elements, err := db.filterElements()
+		if err != nil {
+			return err
+		}
+		if elements >= db.maxFilterElements {
+			return ErrFilterFull
+		}
+	}
+
+	err = db.DataStore.Addrs().Put(address, script, addrType)
+	if err != nil {
+		return err
+	}
+
+	// A new address is not scanned in the blocks synced before it's added
+	if isNew && db.DataStore.Info().ChainHeight() > 0 {
+		return db.DataStore.Info().SaveAddrScanHeight(address, 0)
+	}
+	return nil
+}
+
+// The number of addresses and outpoints loaded into the bloom filter, the tables
+// implementing Counter are counted without reading all the rows.
+func (db *DatabaseImpl) filterElements() (int, error) {
+	addrs, err := count(db.DataStore.Addrs(), func() (int, error) {
+		addrs, err := db.DataStore.Addrs().GetAll()
+		return len(addrs), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	utxos, err := count(db.DataStore.UTXOs(), func() (int, error) {
+		utxos, err := db.DataStore.UTXOs().GetAll()
+		return len(utxos), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	stxos, err := count(db.DataStore.STXOs(), func() (int, error) {
+		stxos, err := db.DataStore.STXOs().GetAll()
+		return len(stxos), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return addrs + utxos + stxos, nil
+}
+
+func count(table interface{}, getAll func() (int, error)) (int, error) {
+	if counter, ok := table.(Counter); ok {
+		return counter.Count()
+	}
+	return getAll()
 }
 
 func (db *DatabaseImpl) GetAddress(address *Uint168) (*Addr, error) {
@@ -66,7 +136,11 @@ func (db *DatabaseImpl) DeleteAddress(address *Uint168) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	return db.DataStore.Addrs().Delete(address)
+	err := db.DataStore.Addrs().Delete(address)
+	if err != nil {
+		return err
+	}
+	return db.DataStore.Info().DeleteAddrScanHeight(address)
 }
 
 func (db *DatabaseImpl) GetAddressUTXOs(address *Uint168) ([]*UTXO, error) {
@@ -0,0 +1,371 @@
+package spvwallet
+
+import (
+	"errors"
+	"math"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+var errNotFound = errors.New("not found")
+
+// An in memory wallet DataStore for tests, only the tables used by transaction tracking are kept
+type testDataStore struct {
+	// Returned by CommitBatch
+	commitErr error
+
+	info  testInfo
+	addrs testAddrs
+	txs   testTxs
+	utxos testUTXOs
+	stxos testSTXOs
+}
+
+func newTestDataStore() *testDataStore {
+	store := &testDataStore{
+		info:  testInfo{scanHeights: make(map[Uint168]uint32)},
+		addrs: testAddrs{addrs: make(map[Uint168]*db.Addr)},
+		txs:   testTxs{txs: make(map[Uint256]*StoreTx)},
+		utxos: testUTXOs{utxos: make(map[OutPoint]*db.UTXO), addrs: make(map[OutPoint]Uint168)},
+	}
+	store.stxos = testSTXOs{utxos: &store.utxos, stxos: make(map[OutPoint]*db.STXO)}
+	return store
+}
+
+func (store *testDataStore) Info() db.Info      { return &store.info }
+func (store *testDataStore) Addrs() db.Addrs    { return &store.addrs }
+func (store *testDataStore) Txs() db.Txs        { return &store.txs }
+func (store *testDataStore) UTXOs() db.UTXOs    { return &store.utxos }
+func (store *testDataStore) STXOs() db.STXOs    { return &store.stxos }
+func (store *testDataStore) Reset() error       { return nil }
+func (store *testDataStore) BeginBatch() error  { return nil }
+func (store *testDataStore) CommitBatch() error { return store.commitErr }
+func (store *testDataStore) Close()             {}
+
+// Rollback the data at the height like the SQLite DataStore does
+func (store *testDataStore) Rollback(height uint32) error {
+	for op, utxo := range store.utxos.utxos {
+		if utxo.AtHeight == height {
+			delete(store.utxos.utxos, op)
+		}
+	}
+	for op, stxo := range store.stxos.stxos {
+		if stxo.SpendHeight == height {
+			store.stxos.ToUTXO(&op)
+		}
+	}
+	for txId, tx := range store.txs.txs {
+		if tx.Height == height {
+			delete(store.txs.txs, txId)
+		}
+	}
+	return nil
+}
+
+type testInfo struct {
+	height      uint32
+	scanHeights map[Uint168]uint32
+}
+
+func (i *testInfo) ChainHeight() uint32               { return i.height }
+func (i *testInfo) SaveChainHeight(height uint32)     { i.height = height }
+func (i *testInfo) Put(key string, data []byte) error { return nil }
+func (i *testInfo) Get(key string) ([]byte, error)    { return nil, errNotFound }
+func (i *testInfo) Delete(key string) error           { return nil }
+
+func (i *testInfo) AddrScanHeight(hash *Uint168) (uint32, bool) {
+	height, ok := i.scanHeights[*hash]
+	return height, ok
+}
+
+func (i *testInfo) SaveAddrScanHeight(hash *Uint168, height uint32) error {
+	i.scanHeights[*hash] = height
+	return nil
+}
+
+func (i *testInfo) DeleteAddrScanHeight(hash *Uint168) error {
+	delete(i.scanHeights, *hash)
+	return nil
+}
+
+type testAddrs struct {
+	addrs map[Uint168]*db.Addr
+}
+
+func (a *testAddrs) Put(hash *Uint168, script []byte, addrType int) error {
+	a.addrs[*hash] = db.NewAddr(hash, script, addrType)
+	return nil
+}
+
+func (a *testAddrs) Get(hash *Uint168) (*db.Addr, error) {
+	addr, ok := a.addrs[*hash]
+	if !ok {
+		return nil, errNotFound
+	}
+	return addr, nil
+}
+
+func (a *testAddrs) GetAll() ([]*db.Addr, error) {
+	var addrs []*db.Addr
+	for _, addr := range a.addrs {
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func (a *testAddrs) Delete(hash *Uint168) error {
+	delete(a.addrs, *hash)
+	return nil
+}
+
+type testTxs struct {
+	txs map[Uint256]*StoreTx
+}
+
+func (t *testTxs) Put(tx *StoreTx) error {
+	t.txs[tx.TxId] = tx
+	return nil
+}
+
+func (t *testTxs) Get(txId *Uint256) (*StoreTx, error) {
+	tx, ok := t.txs[*txId]
+	if !ok {
+		return nil, errNotFound
+	}
+	return tx, nil
+}
+
+func (t *testTxs) GetAll() ([]*StoreTx, error) { return t.GetAllFrom(math.MaxUint32) }
+
+func (t *testTxs) GetAllFrom(height uint32) ([]*StoreTx, error) {
+	var txs []*StoreTx
+	for _, tx := range t.txs {
+		if height == math.MaxUint32 || tx.Height == height {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+func (t *testTxs) UpdateHeight(txId *Uint256, height uint32) error {
+	tx, err := t.Get(txId)
+	if err != nil {
+		return err
+	}
+	tx.Height = height
+	return nil
+}
+
+func (t *testTxs) Delete(txId *Uint256) error {
+	delete(t.txs, *txId)
+	return nil
+}
+
+type testUTXOs struct {
+	utxos map[OutPoint]*db.UTXO
+	addrs map[OutPoint]Uint168
+}
+
+func (u *testUTXOs) Put(hash *Uint168, utxo *db.UTXO) error {
+	u.utxos[utxo.Op] = utxo
+	u.addrs[utxo.Op] = *hash
+	return nil
+}
+
+func (u *testUTXOs) Get(outPoint *OutPoint) (*db.UTXO, error) {
+	utxo, ok := u.utxos[*outPoint]
+	if !ok {
+		return nil, errNotFound
+	}
+	return utxo, nil
+}
+
+func (u *testUTXOs) GetAddrAll(hash *Uint168) ([]*db.UTXO, error) {
+	var utxos []*db.UTXO
+	for op, utxo := range u.utxos {
+		if u.addrs[op] == *hash {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos, nil
+}
+
+func (u *testUTXOs) GetAll() ([]*db.UTXO, error) {
+	var utxos []*db.UTXO
+	for _, utxo := range u.utxos {
+		utxos = append(utxos, utxo)
+	}
+	return utxos, nil
+}
+
+func (u *testUTXOs) Delete(outPoint *OutPoint) error {
+	delete(u.utxos, *outPoint)
+	return nil
+}
+
+type testSTXOs struct {
+	utxos *testUTXOs
+	stxos map[OutPoint]*db.STXO
+}
+
+func (s *testSTXOs) FromUTXO(outPoint *OutPoint, spendTxId *Uint256, spendHeight uint32) error {
+	utxo, err := s.utxos.Get(outPoint)
+	if err != nil {
+		return err
+	}
+	s.stxos[*outPoint] = &db.STXO{UTXO: *utxo, SpendHeight: spendHeight, SpendTxId: *spendTxId}
+	return s.utxos.Delete(outPoint)
+}
+
+func (s *testSTXOs) ToUTXO(outPoint *OutPoint) error {
+	stxo, err := s.Get(outPoint)
+	if err != nil {
+		return err
+	}
+	utxo := stxo.UTXO
+	s.utxos.utxos[*outPoint] = &utxo
+	return s.Delete(outPoint)
+}
+
+func (s *testSTXOs) Get(outPoint *OutPoint) (*db.STXO, error) {
+	stxo, ok := s.stxos[*outPoint]
+	if !ok {
+		return nil, errNotFound
+	}
+	return stxo, nil
+}
+
+func (s *testSTXOs) GetAddrAll(hash *Uint168) ([]*db.STXO, error) {
+	var stxos []*db.STXO
+	for op, stxo := range s.stxos {
+		if s.utxos.addrs[op] == *hash {
+			stxos = append(stxos, stxo)
+		}
+	}
+	return stxos, nil
+}
+
+func (s *testSTXOs) GetAll() ([]*db.STXO, error) {
+	var stxos []*db.STXO
+	for _, stxo := range s.stxos {
+		stxos = append(stxos, stxo)
+	}
+	return stxos, nil
+}
+
+func (s *testSTXOs) Delete(outPoint *OutPoint) error {
+	delete(s.stxos, *outPoint)
+	return nil
+}
+
+// A wallet with the in memory DataStore watching the address, no network
+func newTestWallet(addr Uint168) (*SPVWallet, *testDataStore) {
+	store := newTestDataStore()
+	wallet := &SPVWallet{
+		dataStore: store,
+		filter:    sdk.NewAddrFilter([]*Uint168{&addr}),
+		sent:      newSentTxs(),
+		handles:   newBroadcastHandles(),
+	}
+	wallet.bloomFilter = sdk.NewFilterCache(wallet.buildBloomFilter)
+	return wallet, store
+}
+
+// In memory Headers, the headers put in a batch are kept apart until committed
+type testHeaders struct {
+	headers map[Uint256]*StoreHeader
+	tip     *StoreHeader
+
+	batch    map[Uint256]*StoreHeader
+	batchTip *StoreHeader
+}
+
+func newTestHeaders() *testHeaders {
+	return &testHeaders{headers: make(map[Uint256]*StoreHeader)}
+}
+
+func (h *testHeaders) Put(header *StoreHeader, newTip bool) error {
+	if h.batch != nil {
+		h.batch[header.Hash()] = header
+		if newTip {
+			h.batchTip = header
+		}
+		return nil
+	}
+	h.headers[header.Hash()] = header
+	if newTip {
+		h.tip = header
+	}
+	return nil
+}
+
+func (h *testHeaders) GetPrevious(header *StoreHeader) (*StoreHeader, error) {
+	return h.GetHeader(header.Previous)
+}
+
+func (h *testHeaders) GetHeader(hash Uint256) (*StoreHeader, error) {
+	header, ok := h.headers[hash]
+	if !ok {
+		header, ok = h.batch[hash]
+	}
+	if !ok {
+		return nil, errNotFound
+	}
+	return header, nil
+}
+
+func (h *testHeaders) GetTip() (*StoreHeader, error) {
+	if h.batchTip != nil {
+		return h.batchTip, nil
+	}
+	if h.tip == nil {
+		return nil, errNotFound
+	}
+	return h.tip, nil
+}
+
+func (h *testHeaders) GetByHeight(height uint32) (*StoreHeader, error) {
+	header, err := h.GetTip()
+	for err == nil && header.Height > height {
+		header, err = h.GetPrevious(header)
+	}
+	if err != nil || header.Height != height {
+		return nil, errNotFound
+	}
+	return header, nil
+}
+
+func (h *testHeaders) Reset() error {
+	h.headers = make(map[Uint256]*StoreHeader)
+	h.tip = nil
+	return nil
+}
+
+func (h *testHeaders) Close() {}
+
+func (h *testHeaders) BeginBatch() error {
+	if h.batch == nil {
+		h.batch = make(map[Uint256]*StoreHeader)
+	}
+	return nil
+}
+
+func (h *testHeaders) CommitBatch() error {
+	for hash, header := range h.batch {
+		h.headers[hash] = header
+	}
+	if h.batchTip != nil {
+		h.tip = h.batchTip
+	}
+	h.DiscardBatch()
+	return nil
+}
+
+func (h *testHeaders) DiscardBatch() {
+	h.batch, h.batchTip = nil, nil
+}
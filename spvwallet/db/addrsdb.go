@@ -1,7 +1,6 @@
 package db
 
 import (
-	"database/sql"
 	"sync"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -15,15 +14,15 @@ const CreateAddrsDB = `CREATE TABLE IF NOT EXISTS Addrs(
 
 type AddrsDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 }
 
-func NewAddrsDB(db *sql.DB, lock *sync.RWMutex) (Addrs, error) {
+func NewAddrsDB(db *batchDB, lock *sync.RWMutex) (Addrs, error) {
 	_, err := db.Exec(CreateAddrsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &AddrsDB{RWMutex: lock, DB: db}, nil
+	return &AddrsDB{RWMutex: lock, batchDB: db}, nil
 }
 
 // put a script to database
@@ -86,6 +85,16 @@ func (db *AddrsDB) GetAll() ([]*Addr, error) {
 	return addrs, nil
 }
 
+// count the addresses in database
+func (db *AddrsDB) Count() (int, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM Addrs").Scan(&count)
+	return count, err
+}
+
 // delete a script from database
 func (db *AddrsDB) Delete(hash *Uint168) error {
 	db.Lock()
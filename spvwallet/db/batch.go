@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// dbTx is the part of a database transaction used by the tables
+type dbTx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Commit() error
+}
+
+/*
+batchDB runs the statements of the tables in the batch transaction when a batch is begun,
+so the writes of many blocks are committed to disk at once, and reads in the batch
+see the writes not committed yet. It's protected by the lock shared by the tables.
+*/
+type batchDB struct {
+	*sql.DB
+	batch *sql.Tx
+}
+
+func (db *batchDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.batch != nil {
+		return db.batch.Exec(query, args...)
+	}
+	return db.DB.Exec(query, args...)
+}
+
+func (db *batchDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.batch != nil {
+		return db.batch.Query(query, args...)
+	}
+	return db.DB.Query(query, args...)
+}
+
+func (db *batchDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.batch != nil {
+		return db.batch.QueryRow(query, args...)
+	}
+	return db.DB.QueryRow(query, args...)
+}
+
+// Begin a transaction, in a batch it's a part of the batch and committed with the batch
+func (db *batchDB) Begin() (dbTx, error) {
+	if db.batch != nil {
+		return batchTx{db.batch}, nil
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// batchTx is a transaction in the batch, the writes are committed with the batch
+type batchTx struct {
+	*sql.Tx
+}
+
+func (tx batchTx) Commit() error {
+	return nil
+}
@@ -3,8 +3,8 @@ package db
 import (
 	"github.com/elastos/Elastos.ELA.SPV/db"
 
-	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type DataStore interface {
@@ -18,9 +18,18 @@ type DataStore interface {
 	// Reset database, clear all data
 	Reset() error
 
+	// Begin a batch, the writes are committed to database at once by CommitBatch
+	BeginBatch() error
+	CommitBatch() error
+
 	Close()
 }
 
+// Counter is implemented by the tables able to count the rows without reading them
+type Counter interface {
+	Count() (int, error)
+}
+
 type Info interface {
 	// get chain height
 	ChainHeight() uint32
@@ -28,6 +37,15 @@ type Info interface {
 	// save chain height
 	SaveChainHeight(height uint32)
 
+	// get the height an address is scanned up to, false if it's scanned with the chain
+	AddrScanHeight(hash *Uint168) (uint32, bool)
+
+	// save the scan height of an address lags behind the chain
+	SaveAddrScanHeight(hash *Uint168, height uint32) error
+
+	// delete the scan height of an address, it's scanned with the chain
+	DeleteAddrScanHeight(hash *Uint168) error
+
 	// put key and value into db
 	Put(key string, data []byte) error
 
@@ -56,10 +74,11 @@ type Txs interface {
 	// Put a new transaction to database
 	Put(txn *db.StoreTx) error
 
-	// Fetch a raw tx and it's metadata given a hash
+	// Fetch a raw tx and it's metadata given a hash,
+	// ErrTxNotAvailable if it's stored without raw data
 	Get(txId *Uint256) (*db.StoreTx, error)
 
-	// Fetch all transactions from database
+	// Fetch all transactions from database, the ones without raw data have empty Data
 	GetAll() ([]*db.StoreTx, error)
 
 	// Fetch all transactions from the given height
@@ -93,6 +112,9 @@ type STXOs interface {
 	// Move a UTXO to STXO
 	FromUTXO(outPoint *OutPoint, spendTxId *Uint256, spendHeight uint32) error
 
+	// Move a STXO back to UTXO, when the transaction spent it is replaced
+	ToUTXO(outPoint *OutPoint) error
+
 	// get a stxo from database
 	Get(outPoint *OutPoint) (*STXO, error)
 
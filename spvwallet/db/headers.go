@@ -1,15 +1,17 @@
 package db
 
 import (
-	"errors"
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
 
-	"github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.SPV/db"
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.Utility/common"
 
 	"github.com/boltdb/bolt"
 	"github.com/cevaris/ordered_map"
@@ -28,9 +30,19 @@ type Headers interface {
 	// Get the header on chain tip
 	GetTip() (*db.StoreHeader, error)
 
+	// Get the header on the best chain at the height
+	GetByHeight(height uint32) (*db.StoreHeader, error)
+
 	// Reset database, clear all data
 	Reset() error
 
+	// Begin a batch, the headers put are written to database at once by CommitBatch
+	BeginBatch() error
+	CommitBatch() error
+
+	// Drop the headers put since BeginBatch, the chain tip goes back to the one in database
+	DiscardBatch()
+
 	// Close db
 	Close()
 }
@@ -40,16 +52,26 @@ type HeadersDB struct {
 	*sync.RWMutex
 	*bolt.DB
 	cache *HeaderCache
+
+	// Headers put in the current batch, nil if not batching
+	batch    map[common.Uint256]*db.StoreHeader
+	batchTip *db.StoreHeader
 }
 
+// The file name of the headers database
+const HeadersDBName = "headers.bin"
+
 var (
 	BKTHeaders  = []byte("Headers")
 	BKTChainTip = []byte("ChainTip")
 	KEYChainTip = []byte("ChainTip")
+
+	// The hashes of the headers on the best chain by height
+	BKTHeights = []byte("Heights")
 )
 
 func NewHeadersDB() (Headers, error) {
-	db, err := bolt.Open("headers.bin", 0644, &bolt.Options{InitialMmapSize: 5000000})
+	db, err := bolt.Open(HeadersDBName, 0644, &bolt.Options{InitialMmapSize: 5000000})
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +85,10 @@ func NewHeadersDB() (Headers, error) {
 		if err != nil {
 			return err
 		}
+		_, err = btx.CreateBucketIfNotExists(BKTHeights)
+		if err != nil {
+			return err
+		}
 		return nil
 	})
 
@@ -74,9 +100,24 @@ func NewHeadersDB() (Headers, error) {
 
 	headers.initCache()
 
+	// The headers saved by earlier versions are not indexed
+	if err := headers.initHeights(); err != nil {
+		return nil, err
+	}
+
 	return headers, nil
 }
 
+func (h *HeadersDB) initHeights() error {
+	tip, err := h.GetTip()
+	if err != nil {
+		return nil
+	}
+	return h.Update(func(tx *bolt.Tx) error {
+		return h.indexHeights(tx, tip)
+	})
+}
+
 func (h *HeadersDB) initCache() {
 	best, err := h.GetTip()
 	if err != nil {
@@ -105,6 +146,13 @@ func (h *HeadersDB) Put(header *db.StoreHeader, newTip bool) error {
 	if newTip {
 		h.cache.tip = header
 	}
+	if h.batch != nil {
+		h.batch[header.Hash()] = header
+		if newTip {
+			h.batchTip = header
+		}
+		return nil
+	}
 	return h.Update(func(tx *bolt.Tx) error {
 
 		bytes, err := header.Serialize()
@@ -122,12 +170,66 @@ func (h *HeadersDB) Put(header *db.StoreHeader, newTip bool) error {
 			if err != nil {
 				return err
 			}
+			return h.indexHeights(tx, header)
 		}
 
 		return nil
 	})
 }
 
+/*
+Index the heights of the headers on the chain ending with the new tip. Headers are walked back
+from the tip until one already indexed at its height, which is the fork point on a reorganize,
+and the heights above the tip left by a longer chain are removed.
+*/
+func (h *HeadersDB) indexHeights(tx *bolt.Tx, tip *db.StoreHeader) error {
+	heights := tx.Bucket(BKTHeights)
+	cursor := heights.Cursor()
+	for k, _ := cursor.Seek(heightKey(tip.Height + 1)); k != nil; k, _ = cursor.Next() {
+		err := cursor.Delete()
+		if err != nil {
+			return err
+		}
+	}
+
+	for header := tip; header.Height > 0; {
+		hash := header.Hash()
+		key := heightKey(header.Height)
+		if bytes.Equal(heights.Get(key), hash.Bytes()) {
+			return nil
+		}
+		err := heights.Put(key, hash.Bytes())
+		if err != nil {
+			return err
+		}
+		if header.Height == 1 {
+			return nil
+		}
+		header, err = h.headerInTx(tx, header.Previous)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the header from the cache, the batch or the database in the transaction, the lock is held by the caller
+func (h *HeadersDB) headerInTx(tx *bolt.Tx, hash common.Uint256) (*db.StoreHeader, error) {
+	if header, err := h.cache.Get(hash); err == nil {
+		return header, nil
+	}
+	if header, ok := h.batch[hash]; ok {
+		return header, nil
+	}
+	return getHeader(tx, BKTHeaders, hash.Bytes())
+}
+
+func heightKey(height uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, height)
+	return key
+}
+
 // Get previous block of the given header
 func (h *HeadersDB) GetPrevious(header *db.StoreHeader) (*db.StoreHeader, error) {
 	if header.Height == 1 {
@@ -145,6 +247,9 @@ func (h *HeadersDB) GetHeader(hash common.Uint256) (header *db.StoreHeader, err
 	if err == nil {
 		return header, nil
 	}
+	if header, ok := h.batch[hash]; ok {
+		return header, nil
+	}
 
 	err = h.View(func(tx *bolt.Tx) error {
 
@@ -190,6 +295,107 @@ func (h *HeadersDB) GetTip() (header *db.StoreHeader, err error) {
 	return header, err
 }
 
+/*
+Get the header on the best chain at the height from the height index. In a batch, the headers put
+are not indexed until committed, they are walked back from the tip until an indexed header.
+*/
+func (h *HeadersDB) GetByHeight(height uint32) (header *db.StoreHeader, err error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	tip := h.cache.tip
+	if tip == nil || height == 0 || height > tip.Height {
+		return nil, fmt.Errorf("header at height %d does not exist in database", height)
+	}
+
+	err = h.View(func(tx *bolt.Tx) error {
+		heights := tx.Bucket(BKTHeights)
+		header = tip
+		for {
+			hash := header.Hash()
+			if bytes.Equal(heights.Get(heightKey(header.Height)), hash.Bytes()) {
+				break
+			}
+			if header.Height == height {
+				return nil
+			}
+			header, err = h.headerInTx(tx, header.Previous)
+			if err != nil {
+				return err
+			}
+		}
+
+		hash, err := common.Uint256FromBytes(heights.Get(heightKey(height)))
+		if err != nil {
+			return fmt.Errorf("header at height %d does not exist in database", height)
+		}
+		header, err = h.headerInTx(tx, *hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func (h *HeadersDB) BeginBatch() error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.batch == nil {
+		h.batch = make(map[common.Uint256]*db.StoreHeader)
+	}
+	return nil
+}
+
+// Write the headers put since BeginBatch in one transaction
+func (h *HeadersDB) CommitBatch() error {
+	h.Lock()
+	defer h.Unlock()
+
+	batch, tip := h.batch, h.batchTip
+	h.batch, h.batchTip = nil, nil
+	if len(batch) == 0 {
+		return nil
+	}
+	return h.Update(func(tx *bolt.Tx) error {
+		for hash, header := range batch {
+			bytes, err := header.Serialize()
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(BKTHeaders).Put(hash.Bytes(), bytes)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tip != nil {
+			bytes, err := tip.Serialize()
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(BKTChainTip).Put(KEYChainTip, bytes)
+			if err != nil {
+				return err
+			}
+			return h.indexHeights(tx, tip)
+		}
+
+		return nil
+	})
+}
+
+// Drop the headers put since BeginBatch, the cache is reloaded from database
+func (h *HeadersDB) DiscardBatch() {
+	h.Lock()
+	h.batch, h.batchTip = nil, nil
+	h.cache = newHeaderCache(100)
+	h.Unlock()
+
+	h.initCache()
+}
+
 func (h *HeadersDB) Reset() error {
 	h.Lock()
 	defer h.Unlock()
@@ -200,6 +406,11 @@ func (h *HeadersDB) Reset() error {
 			return err
 		}
 
+		err = tx.DeleteBucket(BKTHeights)
+		if err != nil {
+			return err
+		}
+
 		return tx.DeleteBucket(BKTChainTip)
 	})
 }
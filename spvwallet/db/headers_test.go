@@ -0,0 +1,131 @@
+package db
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	"github.com/boltdb/bolt"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Open the headers database in a temporary working directory
+func newTestHeadersDB(t *testing.T) (*HeadersDB, func()) {
+	dir, err := ioutil.TempDir("", "headers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	headers, err := NewHeadersDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return headers.(*HeadersDB), func() {
+		headers.(*HeadersDB).DB.Close()
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// Put the headers following the previous header, the last one is the new tip
+func putChain(t *testing.T, headers Headers, previous *db.StoreHeader, count int, nonce uint32) []*db.StoreHeader {
+	var chain []*db.StoreHeader
+	for i := 0; i < count; i++ {
+		header := &db.StoreHeader{Header: Header{Height: 1, Nonce: nonce}, TotalWork: big.NewInt(1)}
+		if previous != nil {
+			header.Previous = previous.Hash()
+			header.Height = previous.Height + 1
+		}
+		if err := headers.Put(header, i == count-1); err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, header)
+		previous = header
+	}
+	return chain
+}
+
+func expectAtHeight(t *testing.T, headers Headers, height uint32, expect *db.StoreHeader) {
+	header, err := headers.GetByHeight(height)
+	if expect == nil {
+		if err == nil {
+			t.Errorf("header found at height %d above the tip", height)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("get header at height %d error %v", height, err)
+		return
+	}
+	if header.Hash() != expect.Hash() {
+		t.Errorf("header at height %d not on the best chain", height)
+	}
+}
+
+func TestHeadersDB_GetByHeight(t *testing.T) {
+	log.Init()
+	headers, cleanup := newTestHeadersDB(t)
+	defer cleanup()
+
+	main := putChain(t, headers, nil, 5, 0)
+	for i, header := range main {
+		expectAtHeight(t, headers, uint32(i+1), header)
+	}
+	expectAtHeight(t, headers, 6, nil)
+
+	// Reorganize to a longer branch forked at height 3
+	branch := putChain(t, headers, main[2], 3, 1)
+	expectAtHeight(t, headers, 3, main[2])
+	for i, header := range branch {
+		expectAtHeight(t, headers, uint32(i+4), header)
+	}
+
+	// Reorganize to a shorter branch with more work, the heights above are removed
+	short := putChain(t, headers, main[1], 1, 2)
+	expectAtHeight(t, headers, 3, short[0])
+	expectAtHeight(t, headers, 4, nil)
+
+	// Headers put in a batch are found before committed
+	headers.BeginBatch()
+	batch := putChain(t, headers, short[0], 2, 3)
+	expectAtHeight(t, headers, 2, main[1])
+	expectAtHeight(t, headers, 5, batch[1])
+	if err := headers.CommitBatch(); err != nil {
+		t.Fatal(err)
+	}
+	expectAtHeight(t, headers, 4, batch[0])
+	expectAtHeight(t, headers, 5, batch[1])
+}
+
+func TestHeadersDB_IndexEarlierHeaders(t *testing.T) {
+	log.Init()
+	headers, cleanup := newTestHeadersDB(t)
+	defer cleanup()
+
+	chain := putChain(t, headers, nil, 3, 0)
+
+	// Saved by an earlier version without the height index
+	headers.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(BKTHeights)
+	})
+	headers.DB.Close()
+	reopened, err := NewHeadersDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers.DB = reopened.(*HeadersDB).DB
+
+	for i, header := range chain {
+		expectAtHeight(t, reopened, uint32(i+1), header)
+	}
+}
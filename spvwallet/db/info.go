@@ -1,10 +1,12 @@
 package db
 
 import (
-	"database/sql"
-	"sync"
-	"encoding/binary"
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 const CreateInfoDB = `CREATE TABLE IF NOT EXISTS Info(
@@ -14,19 +16,22 @@ const CreateInfoDB = `CREATE TABLE IF NOT EXISTS Info(
 
 const (
 	ChainHeightKey = "ChainHeight"
+
+	// Prefix of the keys of address scan heights, followed by the address hash in hex
+	AddrScanHeightKeyPrefix = "AddrScanHeight_"
 )
 
 type InfoDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 }
 
-func NewInfoDB(db *sql.DB, lock *sync.RWMutex) (Info, error) {
+func NewInfoDB(db *batchDB, lock *sync.RWMutex) (Info, error) {
 	_, err := db.Exec(CreateInfoDB)
 	if err != nil {
 		return nil, err
 	}
-	return &InfoDB{RWMutex: lock, DB: db}, nil
+	return &InfoDB{RWMutex: lock, batchDB: db}, nil
 }
 
 // get chain height
@@ -48,6 +53,39 @@ func (db *InfoDB) SaveChainHeight(height uint32) {
 	db.Put(ChainHeightKey, buf.Bytes())
 }
 
+/*
+Only the addresses added after the chain has synced blocks have scan heights, they are not scanned
+in the blocks before. The other addresses are scanned with the chain up to the chain height.
+A scan height is deleted when the chain rolls back to it, and all of them are cleared with the
+Info table on Reset, as the blocks synced again are scanned for the addresses.
+*/
+func (db *InfoDB) AddrScanHeight(hash *Uint168) (uint32, bool) {
+	value, err := db.Get(addrScanHeightKey(hash))
+	if err != nil {
+		return 0, false
+	}
+
+	var height uint32
+	binary.Read(bytes.NewReader(value), binary.LittleEndian, &height)
+	return height, true
+}
+
+// save the scan height of an address lags behind the chain
+func (db *InfoDB) SaveAddrScanHeight(hash *Uint168, height uint32) error {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, height)
+	return db.Put(addrScanHeightKey(hash), buf.Bytes())
+}
+
+// delete the scan height of an address, it's scanned with the chain
+func (db *InfoDB) DeleteAddrScanHeight(hash *Uint168) error {
+	return db.Delete(addrScanHeightKey(hash))
+}
+
+func addrScanHeightKey(hash *Uint168) string {
+	return AddrScanHeightKeyPrefix + hex.EncodeToString(hash.Bytes())
+}
+
 // put key and value into db
 func (db *InfoDB) Put(key string, value []byte) error {
 	db.Lock()
@@ -17,7 +17,7 @@ const (
 
 type SQLiteDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 
 	info  Info
 	addrs Addrs
@@ -27,11 +27,12 @@ type SQLiteDB struct {
 }
 
 func NewSQLiteDB() (*SQLiteDB, error) {
-	db, err := sql.Open(DriverName, DBName)
+	sqlDB, err := sql.Open(DriverName, DBName)
 	if err != nil {
 		fmt.Println("Open sqlite db error:", err)
 		return nil, err
 	}
+	db := &batchDB{DB: sqlDB}
 	// Use the same lock
 	lock := new(sync.RWMutex)
 
@@ -63,7 +64,7 @@ func NewSQLiteDB() (*SQLiteDB, error) {
 
 	return &SQLiteDB{
 		RWMutex: lock,
-		DB:      db,
+		batchDB: db,
 
 		info:  infoDB,
 		addrs: addrsDB,
@@ -146,8 +147,40 @@ func (db *SQLiteDB) Reset() error {
 	return tx.Commit()
 }
 
+// Begin a batch, the writes are committed to database at once by CommitBatch
+func (db *SQLiteDB) BeginBatch() error {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.batch != nil {
+		return nil
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	db.batch = tx
+	return nil
+}
+
+// Commit the writes since BeginBatch
+func (db *SQLiteDB) CommitBatch() error {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.batch == nil {
+		return nil
+	}
+	err := db.batch.Commit()
+	db.batch = nil
+	return err
+}
+
 func (db *SQLiteDB) Close() {
 	db.Lock()
+	if db.batch != nil {
+		db.batch.Commit()
+	}
 	db.DB.Close()
 	log.Debug("SQLite DB closed")
 }
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSQLiteDB_Count(t *testing.T) {
+	log.Init()
+	dir, err := ioutil.TempDir("", "sqlitedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	store, err := NewSQLiteDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, hash := range []Uint168{{1}, {2}} {
+		if err := store.Addrs().Put(&hash, nil, TypeSub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint16(0); i < 3; i++ {
+		utxo := &UTXO{Op: *NewOutPoint(Uint256{1}, i), Value: 100}
+		if err := store.UTXOs().Put(&Uint168{1}, utxo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.STXOs().FromUTXO(NewOutPoint(Uint256{1}, 0), &Uint256{2}, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		table  interface{}
+		expect int
+	}{{store.Addrs(), 2}, {store.UTXOs(), 2}, {store.STXOs(), 1}} {
+		count, err := test.table.(Counter).Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != test.expect {
+			t.Errorf("counted %d rows in %T, expect %d", count, test.table, test.expect)
+		}
+	}
+}
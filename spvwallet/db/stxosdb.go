@@ -20,15 +20,15 @@ const CreateSTXOsDB = `CREATE TABLE IF NOT EXISTS STXOs(
 
 type STXOsDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 }
 
-func NewSTXOsDB(db *sql.DB, lock *sync.RWMutex) (STXOs, error) {
+func NewSTXOsDB(db *batchDB, lock *sync.RWMutex) (STXOs, error) {
 	_, err := db.Exec(CreateSTXOsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &STXOsDB{RWMutex: lock, DB: db}, nil
+	return &STXOsDB{RWMutex: lock, batchDB: db}, nil
 }
 
 // Move a UTXO to STXO
@@ -57,6 +57,31 @@ func (db *STXOsDB) FromUTXO(outPoint *OutPoint, spendTxId *Uint256, spendHeight
 	return tx.Commit()
 }
 
+// Move a STXO back to UTXO
+func (db *STXOsDB) ToUTXO(outPoint *OutPoint) error {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	sql := `INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash)
+			SELECT OutPoint, Value, LockTime, AtHeight, ScriptHash FROM STXOs WHERE OutPoint=?`
+	_, err = tx.Exec(sql, outPoint.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM STXOs WHERE OutPoint=?", outPoint.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // get a stxo from database
 func (db *STXOsDB) Get(outPoint *OutPoint) (*STXO, error) {
 	db.RLock()
@@ -117,6 +142,16 @@ func (db *STXOsDB) GetAll() ([]*STXO, error) {
 	return db.getSTXOs(rows)
 }
 
+// count the STXOs in database
+func (db *STXOsDB) Count() (int, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM STXOs").Scan(&count)
+	return count, err
+}
+
 func (db *STXOsDB) getSTXOs(rows *sql.Rows) ([]*STXO, error) {
 	var stxos []*STXO
 	for rows.Next() {
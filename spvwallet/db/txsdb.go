@@ -2,33 +2,105 @@ package db
 
 import (
 	"bytes"
-	"database/sql"
+	"encoding/binary"
+	"errors"
+	"io"
 	"math"
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.SPV/db"
 
-	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 const CreateTXNDB = `CREATE TABLE IF NOT EXISTS TXNs(
 				Hash BLOB NOT NULL PRIMARY KEY,
 				Height INTEGER NOT NULL,
-				RawData BLOB NOT NULL
+				RawData BLOB NOT NULL,
+				Fee INTEGER NOT NULL DEFAULT -1,
+				Outputs BLOB NOT NULL DEFAULT x''
 			);`
 
+// Add the Fee column to the table created before fees were recorded
+const AddTXNFee = `ALTER TABLE TXNs ADD COLUMN Fee INTEGER NOT NULL DEFAULT -1`
+
+// Add the Outputs column to the table created before the output metadata was recorded
+const AddTXNOutputs = `ALTER TABLE TXNs ADD COLUMN Outputs BLOB NOT NULL DEFAULT x''`
+
+/*
+Keep the raw data of transactions, when false only the transaction id, height and the
+address and value of each output are kept, so balances and payments still work but
+the transactions can not be retrieved. Transactions already stored are not changed.
+*/
+var StoreFullTransactions = true
+
+// The transaction is stored without raw data, see StoreFullTransactions
+var ErrTxNotAvailable = errors.New("raw transaction not available")
+
 type TxsDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 }
 
-func NewTxsDB(db *sql.DB, lock *sync.RWMutex) (Txs, error) {
+func NewTxsDB(db *batchDB, lock *sync.RWMutex) (Txs, error) {
 	_, err := db.Exec(CreateTXNDB)
 	if err != nil {
 		return nil, err
 	}
-	return &TxsDB{RWMutex: lock, DB: db}, nil
+	// The fees of the transactions already stored are unknown
+	err = addColumn(db, "Fee", AddTXNFee)
+	if err != nil {
+		return nil, err
+	}
+	// The transactions already stored have the raw data or no outputs recorded
+	err = addColumn(db, "Outputs", AddTXNOutputs)
+	if err != nil {
+		return nil, err
+	}
+	return &TxsDB{RWMutex: lock, batchDB: db}, nil
+}
+
+// Add a column to the TXNs table if it's missing
+func addColumn(db *batchDB, name, alter string) error {
+	var count int
+	row := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('TXNs') WHERE name=?`, name)
+	err := row.Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(alter)
+	return err
+}
+
+// The program hash and value of each output, kept when the raw data is not
+func serializeOutputs(outputs []*Output) []byte {
+	buf := new(bytes.Buffer)
+	for _, output := range outputs {
+		buf.Write(output.ProgramHash.Bytes())
+		binary.Write(buf, binary.LittleEndian, int64(output.Value))
+	}
+	return buf.Bytes()
+}
+
+func deserializeOutputs(data []byte) ([]*Output, error) {
+	r := bytes.NewReader(data)
+	var outputs []*Output
+	for r.Len() > 0 {
+		var output Output
+		_, err := io.ReadFull(r, output.ProgramHash[:])
+		if err != nil {
+			return nil, err
+		}
+		var value int64
+		err = binary.Read(r, binary.LittleEndian, &value)
+		if err != nil {
+			return nil, err
+		}
+		output.Value = Fixed64(value)
+		outputs = append(outputs, &output)
+	}
+	return outputs, nil
 }
 
 // Put a new transaction to database
@@ -36,14 +108,21 @@ func (t *TxsDB) Put(storeTx *db.StoreTx) error {
 	t.Lock()
 	defer t.Unlock()
 
-	buf := new(bytes.Buffer)
-	err := storeTx.Data.SerializeUnsigned(buf)
-	if err != nil {
-		return err
+	// Kept in the wire format with the programs, so the transaction can be sent as it is
+	// The columns are not null, so empty instead of nil when not kept
+	buf := bytes.NewBuffer([]byte{})
+	outputs := []byte{}
+	if StoreFullTransactions {
+		err := storeTx.Data.Serialize(buf)
+		if err != nil {
+			return err
+		}
+	} else {
+		outputs = serializeOutputs(storeTx.Data.Outputs)
 	}
 
-	sql := `INSERT OR REPLACE INTO TXNs(Hash, Height, RawData) VALUES(?,?,?)`
-	_, err = t.Exec(sql, storeTx.TxId.Bytes(), storeTx.Height, buf.Bytes())
+	sql := `INSERT OR REPLACE INTO TXNs(Hash, Height, RawData, Fee, Outputs) VALUES(?,?,?,?,?)`
+	_, err := t.Exec(sql, storeTx.TxId.Bytes(), storeTx.Height, buf.Bytes(), int64(storeTx.Fee), outputs)
 	if err != nil {
 		return err
 	}
@@ -56,20 +135,38 @@ func (t *TxsDB) Get(txId *Uint256) (*db.StoreTx, error) {
 	t.RLock()
 	defer t.RUnlock()
 
-	row := t.QueryRow(`SELECT Height, RawData FROM TXNs WHERE Hash=?`, txId.Bytes())
+	row := t.QueryRow(`SELECT Height, RawData, Fee FROM TXNs WHERE Hash=?`, txId.Bytes())
 	var height uint32
 	var rawData []byte
-	err := row.Scan(&height, &rawData)
+	var fee int64
+	err := row.Scan(&height, &rawData, &fee)
 	if err != nil {
 		return nil, err
 	}
+	if len(rawData) == 0 {
+		return nil, ErrTxNotAvailable
+	}
+	tx, err := deserializeTx(rawData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.StoreTx{TxId: *txId, Height: height, Data: *tx, Fee: Fixed64(fee)}, nil
+}
+
+// Transactions stored by the earlier versions have no programs, they are the unsigned part only
+func deserializeTx(rawData []byte) (*Transaction, error) {
 	var tx Transaction
+	err := tx.Deserialize(bytes.NewReader(rawData))
+	if err == nil {
+		return &tx, nil
+	}
+	tx = Transaction{}
 	err = tx.DeserializeUnsigned(bytes.NewReader(rawData))
 	if err != nil {
 		return nil, err
 	}
-
-	return &db.StoreTx{TxId: *txId, Height: height, Data: tx}, nil
+	return &tx, nil
 }
 
 // Fetch all transactions from database
@@ -82,7 +179,7 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 	t.RLock()
 	defer t.RUnlock()
 
-	sql := "SELECT Hash, Height, RawData FROM TXNs"
+	sql := "SELECT Hash, Height, RawData, Fee, Outputs FROM TXNs"
 	if height != math.MaxUint32 {
 		sql += " WHERE Height=?"
 	}
@@ -97,7 +194,9 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 		var txIdBytes []byte
 		var height uint32
 		var rawData []byte
-		err := rows.Scan(&txIdBytes, &height, &rawData)
+		var fee int64
+		var outputs []byte
+		err := rows.Scan(&txIdBytes, &height, &rawData, &fee, &outputs)
 		if err != nil {
 			return txns, err
 		}
@@ -107,13 +206,22 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 			return txns, err
 		}
 
-		var tx Transaction
-		err = tx.DeserializeUnsigned(bytes.NewReader(rawData))
-		if err != nil {
-			return nil, err
+		// Transactions without raw data have only the addresses and values of the outputs
+		storeTx := &db.StoreTx{TxId: *txId, Height: height, Fee: Fixed64(fee)}
+		if len(rawData) > 0 {
+			tx, err := deserializeTx(rawData)
+			if err != nil {
+				return nil, err
+			}
+			storeTx.Data = *tx
+		} else {
+			storeTx.Data.Outputs, err = deserializeOutputs(outputs)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		txns = append(txns, &db.StoreTx{TxId: *txId, Height: height, Data: tx})
+		txns = append(txns, storeTx)
 	}
 
 	return txns, nil
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func newTestTxsDB(t *testing.T) (*TxsDB, func()) {
+	dir, err := ioutil.TempDir("", "txsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := sql.Open(DriverName, filepath.Join(dir, "txs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err := NewTxsDB(&batchDB{DB: sqlDB}, new(sync.RWMutex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txs.(*TxsDB), func() {
+		sqlDB.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTxsDB_Metadata(t *testing.T) {
+	txs, cleanup := newTestTxsDB(t)
+	defer cleanup()
+
+	StoreFullTransactions = false
+	defer func() { StoreFullTransactions = true }()
+
+	tx := Transaction{TxType: TransferAsset, Outputs: []*Output{
+		{ProgramHash: Uint168{1}, Value: 100},
+		{ProgramHash: Uint168{2}, Value: 200},
+	}}
+	txId := tx.Hash()
+	err := txs.Put(&db.StoreTx{TxId: txId, Height: 5, Data: tx, Fee: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := txs.Get(&txId); err != ErrTxNotAvailable {
+		t.Errorf("get transaction without raw data error %v, expect %v", err, ErrTxNotAvailable)
+	}
+
+	stored, err := txs.GetAllFrom(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("stored %d transactions, expect 1", len(stored))
+	}
+	if stored[0].TxId != txId || stored[0].Height != 5 || stored[0].Fee != 10 {
+		t.Errorf("stored transaction %v at %d fee %d", stored[0].TxId, stored[0].Height, stored[0].Fee)
+	}
+	outputs := stored[0].Data.Outputs
+	if len(outputs) != 2 {
+		t.Fatalf("stored %d outputs, expect 2", len(outputs))
+	}
+	for i, output := range tx.Outputs {
+		if outputs[i].ProgramHash != output.ProgramHash || outputs[i].Value != output.Value {
+			t.Errorf("output %d stored as %v %d, expect %v %d", i,
+				outputs[i].ProgramHash, outputs[i].Value, output.ProgramHash, output.Value)
+		}
+	}
+}
+
+func TestTxsDB_RawData(t *testing.T) {
+	txs, cleanup := newTestTxsDB(t)
+	defer cleanup()
+
+	// Stored in the wire format with the programs
+	tx := Transaction{TxType: TransferAsset, LockTime: 1,
+		Outputs:  []*Output{{ProgramHash: Uint168{1}, Value: 100}},
+		Programs: []*Program{{Code: []byte{0x21}, Parameter: []byte{0x40}}},
+	}
+	txId := tx.Hash()
+	if err := txs.Put(&db.StoreTx{TxId: txId, Height: 5, Data: tx, Fee: 10}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := txs.Get(&txId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Data.Hash() != txId || stored.Height != 5 || stored.Fee != 10 {
+		t.Errorf("stored transaction %v at %d fee %d", stored.Data.Hash(), stored.Height, stored.Fee)
+	}
+	if len(stored.Data.Programs) != 1 {
+		t.Errorf("stored transaction has %d programs, expect 1", len(stored.Data.Programs))
+	}
+
+	// Stored by an earlier version, the unsigned part only
+	legacy := Transaction{TxType: TransferAsset, LockTime: 2,
+		Outputs: []*Output{{ProgramHash: Uint168{2}, Value: 200}}}
+	legacyId := legacy.Hash()
+	buf := new(bytes.Buffer)
+	if err := legacy.SerializeUnsigned(buf); err != nil {
+		t.Fatal(err)
+	}
+	_, err = txs.Exec(`INSERT INTO TXNs(Hash, Height, RawData) VALUES(?,?,?)`,
+		legacyId.Bytes(), 6, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err = txs.Get(&legacyId)
+	if err != nil {
+		t.Fatalf("get legacy transaction error %v", err)
+	}
+	if stored.Data.Hash() != legacyId || len(stored.Data.Outputs) != 1 || len(stored.Data.Programs) != 0 {
+		t.Errorf("legacy transaction read as %v with %d outputs and %d programs",
+			stored.Data.Hash(), len(stored.Data.Outputs), len(stored.Data.Programs))
+	}
+	if stored.Fee != -1 {
+		t.Errorf("legacy transaction fee %d, expect -1 unknown", stored.Fee)
+	}
+
+	all, err := txs.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("got %d transactions, expect 2", len(all))
+	}
+}
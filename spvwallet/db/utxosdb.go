@@ -18,15 +18,15 @@ const CreateUTXOsDB = `CREATE TABLE IF NOT EXISTS UTXOs(
 
 type UTXOsDB struct {
 	*sync.RWMutex
-	*sql.DB
+	*batchDB
 }
 
-func NewUTXOsDB(db *sql.DB, lock *sync.RWMutex) (UTXOs, error) {
+func NewUTXOsDB(db *batchDB, lock *sync.RWMutex) (UTXOs, error) {
 	_, err := db.Exec(CreateUTXOsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &UTXOsDB{RWMutex: lock, DB: db}, nil
+	return &UTXOsDB{RWMutex: lock, batchDB: db}, nil
 }
 
 // put a utxo to database
@@ -98,6 +98,16 @@ func (db *UTXOsDB) GetAll() ([]*UTXO, error) {
 	return db.getUTXOs(rows)
 }
 
+// count the UTXOs in database
+func (db *UTXOsDB) Count() (int, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM UTXOs").Scan(&count)
+	return count, err
+}
+
 func (db *UTXOsDB) getUTXOs(rows *sql.Rows) ([]*UTXO, error) {
 	var utxos []*UTXO
 	for rows.Next() {
@@ -0,0 +1,108 @@
+package spvwallet
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+var (
+	// The wallet is not healthy with less connected peers than this
+	HealthMinPeers = 2
+	// The wallet is not healthy when the chain tip is older than this
+	HealthMaxTipAge = time.Hour
+)
+
+// HealthStatus is a snapshot of the wallet status for monitoring
+type HealthStatus struct {
+	// If there are enough peers and the chain tip is not stale
+	Healthy bool
+
+	// The number of connected peers
+	Peers int
+
+	// If the wallet is synchronizing blocks
+	Syncing bool
+
+	// The estimated time to catch up with the best peer, sdk.UnknownSyncTime if unknown
+	SyncTime time.Duration
+
+	// The chain tip height and how long ago the tip block was created
+	Height uint32
+	TipAge time.Duration
+
+	// The cumulative work of the chain
+	ChainWork *big.Int
+
+	// The number of unconfirmed wallet transactions
+	PendingTxs int
+
+	// The number of chain reorganizes since started
+	Reorgs int
+
+	// The reason the wallet entered safe mode, empty if not in safe mode
+	SafeMode string
+
+	// The last error and when it happened, nil if no error
+	LastError     error
+	LastErrorTime time.Time
+}
+
+// lastError keeps the most recent error reported to the health status
+type lastError struct {
+	sync.Mutex
+	err  error
+	time time.Time
+}
+
+func (e *lastError) set(err error) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.err = err
+	e.time = time.Now()
+}
+
+func (e *lastError) get() (error, time.Time) {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.err, e.time
+}
+
+/*
+Get a snapshot of the wallet status, suitable for a liveness probe or a health check endpoint.
+It only reads the status, so it's safe to be called at any time from any goroutine.
+*/
+func (wallet *SPVWallet) Health() HealthStatus {
+	var status HealthStatus
+	status.Peers = len(wallet.peers.ConnectedPeers())
+	status.Syncing = wallet.Blockchain().IsSyncing()
+	status.SyncTime = wallet.EstimatedSyncTime()
+
+	tip := wallet.Blockchain().ChainTip()
+	status.Height = tip.Height
+	status.Reorgs = wallet.Blockchain().Reorgs()
+	status.TipAge = time.Since(time.Unix(int64(tip.Timestamp), 0))
+	status.ChainWork = new(big.Int).Set(tip.TotalWork)
+
+	if txs, err := wallet.dataStore.Txs().GetAll(); err == nil {
+		for _, tx := range txs {
+			if tx.Height == 0 {
+				status.PendingTxs++
+			}
+		}
+	}
+
+	status.LastError, status.LastErrorTime = wallet.lastError.get()
+	_, status.SafeMode = wallet.SafeMode()
+
+	status.Healthy = status.Peers >= HealthMinPeers && status.TipAge <= HealthMaxTipAge && status.SafeMode == ""
+	return status
+}
+
+// Record the sync stalls as the last error of the health status
+func (wallet *SPVWallet) onSyncStalled(restarts int) {
+	wallet.lastError.set(fmt.Errorf("sync stalled after %d restarts", restarts))
+}
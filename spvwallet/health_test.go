@@ -0,0 +1,81 @@
+package spvwallet
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// The SPV service of the wallet with the chain on the wallet headers
+type testHealthService struct {
+	sdk.SPVService
+	chain *sdk.Blockchain
+}
+
+func (s *testHealthService) Blockchain() *sdk.Blockchain { return s.chain }
+
+func (s *testHealthService) EstimatedSyncTime() time.Duration { return 0 }
+
+func TestSPVWallet_Health(t *testing.T) {
+	log.Init()
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	headers := newTestHeaders()
+	wallet.headers = headers
+	chain, _ := sdk.NewBlockchain(wallet)
+	wallet.SPVService = &testHealthService{chain: chain}
+	wallet.peers = net.InitPeerManager(new(net.Peer), nil)
+	wallet.peers.AddPeer(newTestPeer(1))
+	wallet.peers.AddPeer(newTestPeer(2))
+
+	tip := &StoreHeader{Header: Header{Height: 10, Timestamp: uint32(time.Now().Add(-10 * time.Minute).Unix())},
+		TotalWork: big.NewInt(10)}
+	headers.Put(tip, true)
+	store.Txs().Put(NewStoreTx(Transaction{LockTime: 1}, 0))
+	store.Txs().Put(NewStoreTx(Transaction{LockTime: 2}, 9))
+
+	status := wallet.Health()
+	if !status.Healthy {
+		t.Errorf("wallet not healthy, %+v", status)
+	}
+	if status.Peers != 2 || status.Height != 10 || status.PendingTxs != 1 || status.ChainWork.Int64() != 10 {
+		t.Errorf("health status %+v, expect 2 peers, height 10 and 1 pending transaction", status)
+	}
+	if status.TipAge < 10*time.Minute || status.TipAge > 11*time.Minute {
+		t.Errorf("tip age %v, expect 10 minutes", status.TipAge)
+	}
+
+	// Not enough peers
+	defer func(min int) { HealthMinPeers = min }(HealthMinPeers)
+	HealthMinPeers = 3
+	if wallet.Health().Healthy {
+		t.Error("wallet healthy with not enough peers")
+	}
+	HealthMinPeers = 2
+
+	// The chain tip is stale
+	defer func(age time.Duration) { HealthMaxTipAge = age }(HealthMaxTipAge)
+	HealthMaxTipAge = 5 * time.Minute
+	if wallet.Health().Healthy {
+		t.Error("wallet healthy with a stale chain tip")
+	}
+	HealthMaxTipAge = time.Hour
+
+	// A stuck commit is reported and enters safe mode
+	wallet.onCommitStuck("block 11", time.Minute, false)
+	status = wallet.Health()
+	if status.Healthy || status.SafeMode == "" {
+		t.Error("wallet healthy in safe mode")
+	}
+	if status.LastError == nil || status.LastErrorTime.IsZero() {
+		t.Error("stuck commit not reported as the last error")
+	}
+}
@@ -143,7 +143,7 @@ func (store *KeystoreFile) SaveToFile() error {
 		return err
 	}
 
-	data, err := json.Marshal(*store)
+	data, err := json.Marshal(store)
 	if err != nil {
 		return err
 	}
@@ -160,7 +160,7 @@ func (store *KeystoreFile) Json() (string, error) {
 	store.Lock()
 	defer store.Unlock()
 
-	data, err := json.Marshal(*store)
+	data, err := json.Marshal(store)
 	if err != nil {
 		return "", err
 	}
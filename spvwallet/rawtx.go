@@ -0,0 +1,34 @@
+package spvwallet
+
+import (
+	"bytes"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Get the stored wallet transaction with its height and fee,
+// db.ErrTxNotAvailable is returned if it's stored without raw data, see StoreFullTransactions.
+func (wallet *SPVWallet) GetTransaction(txId Uint256) (*StoreTx, error) {
+	return wallet.dataStore.Txs().Get(&txId)
+}
+
+/*
+Get the stored wallet transaction serialized in the wire format, it can be sent to the network
+or other systems as it is. The transactions stored by the earlier versions have no programs kept,
+they are serialized without the programs. db.ErrTxNotAvailable is returned if it's stored
+without raw data.
+*/
+func (wallet *SPVWallet) GetRawTransaction(txId Uint256) ([]byte, error) {
+	storeTx, err := wallet.GetTransaction(txId)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	err = storeTx.Data.Serialize(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
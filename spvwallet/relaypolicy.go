@@ -0,0 +1,50 @@
+package spvwallet
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+var ErrRelayRefused = errors.New("transaction refused by the relay policy")
+
+/*
+RelayPolicy is consulted before a transaction is broadcast, the transaction is refused if ok is false,
+otherwise it's broadcast after a random wait around the delay, so the broadcast time does not tell
+when the transaction was created. A zero delay broadcasts immediately.
+*/
+type RelayPolicy func(tx Transaction) (delay time.Duration, ok bool)
+
+// Set the relay policy of the transactions sent by the wallet, nil to broadcast immediately
+func (wallet *SPVWallet) SetRelayPolicy(policy RelayPolicy) {
+	wallet.policyLock.Lock()
+	defer wallet.policyLock.Unlock()
+
+	wallet.relayPolicy = policy
+}
+
+// Apply the relay policy, return the wait before broadcast
+func (wallet *SPVWallet) relayDelay(tx Transaction) (time.Duration, error) {
+	wallet.policyLock.Lock()
+	policy := wallet.relayPolicy
+	wallet.policyLock.Unlock()
+
+	if policy == nil {
+		return 0, nil
+	}
+	delay, ok := policy(tx)
+	if !ok {
+		return 0, ErrRelayRefused
+	}
+	return jitter(delay), nil
+}
+
+// Get a random duration between half and one and a half of the delay
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
@@ -0,0 +1,41 @@
+package spvwallet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_RelayPolicy(t *testing.T) {
+	wallet, _ := newTestWallet(Uint168{1})
+
+	// Only small transactions are relayed
+	wallet.SetRelayPolicy(func(tx Transaction) (time.Duration, bool) {
+		return time.Second, len(tx.Outputs) <= 1
+	})
+
+	large := Transaction{TxType: TransferAsset, Outputs: []*Output{{}, {}}}
+	if _, err := wallet.sendTransaction(large, false); err != ErrRelayRefused {
+		t.Errorf("send transaction refused by policy returns %v, expect %v", err, ErrRelayRefused)
+	}
+	if _, ok := wallet.sent.txs[large.Hash()]; ok {
+		t.Error("transaction refused by policy tracked as sent")
+	}
+
+	small := Transaction{TxType: TransferAsset, Outputs: []*Output{{}}}
+	delay, err := wallet.relayDelay(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delay < time.Second/2 || delay >= time.Second*3/2 {
+		t.Errorf("relay delay %s out of the jitter range", delay)
+	}
+
+	// No policy broadcasts immediately
+	wallet.SetRelayPolicy(nil)
+	if delay, err := wallet.relayDelay(large); err != nil || delay != 0 {
+		t.Errorf("relay delay %s, %v without policy", delay, err)
+	}
+}
@@ -0,0 +1,27 @@
+package spvwallet
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+/*
+Register a listener to be notified when a confirmed wallet transaction is rolled back by a
+reorganize, height is the height it was confirmed at. The transaction is removed from the wallet,
+it will be committed again if it's confirmed in the new chain or relayed by peers.
+Use Blockchain().OnReorg to get the blocks detached and attached by the reorganize.
+*/
+func (wallet *SPVWallet) OnTxUnconfirmed(listener func(txId Uint256, height uint32)) {
+	wallet.unconfirmedLock.Lock()
+	defer wallet.unconfirmedLock.Unlock()
+
+	wallet.unconfirmedListeners = append(wallet.unconfirmedListeners, listener)
+}
+
+func (wallet *SPVWallet) notifyTxUnconfirmed(txId Uint256, height uint32) {
+	wallet.unconfirmedLock.Lock()
+	defer wallet.unconfirmedLock.Unlock()
+
+	for _, listener := range wallet.unconfirmedListeners {
+		go listener(txId, height)
+	}
+}
@@ -0,0 +1,45 @@
+package spvwallet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_OnTxUnconfirmed(t *testing.T) {
+	wallet, store := newTestWallet(Uint168{1})
+
+	confirmed := NewStoreTx(Transaction{TxType: TransferAsset, LockTime: 1}, 10)
+	other := NewStoreTx(Transaction{TxType: TransferAsset, LockTime: 2}, 9)
+	store.txs.Put(confirmed)
+	store.txs.Put(other)
+
+	unconfirmed := make(chan Uint256, 2)
+	wallet.OnTxUnconfirmed(func(txId Uint256, height uint32) {
+		if height != 10 {
+			t.Errorf("unconfirmed at height %d, expect 10", height)
+		}
+		unconfirmed <- txId
+	})
+
+	if err := wallet.Rollback(10); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case txId := <-unconfirmed:
+		if txId != confirmed.TxId {
+			t.Errorf("unconfirmed transaction %s, expect %s", txId.String(), confirmed.TxId.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unconfirmed listener not notified")
+	}
+	select {
+	case txId := <-unconfirmed:
+		t.Errorf("transaction %s not at the height notified", txId.String())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,99 @@
+package spvwallet
+
+import (
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Register a listener to be notified when an unconfirmed wallet transaction
+// is replaced by a higher fee transaction spending the same inputs.
+func (wallet *SPVWallet) OnTxReplaced(listener func(old, replacement Transaction)) {
+	wallet.replacedLock.Lock()
+	defer wallet.replacedLock.Unlock()
+
+	wallet.replacedListeners = append(wallet.replacedListeners, listener)
+}
+
+func (wallet *SPVWallet) notifyTxReplaced(old, replacement Transaction) {
+	wallet.replacedLock.Lock()
+	defer wallet.replacedLock.Unlock()
+
+	for _, listener := range wallet.replacedListeners {
+		go listener(old, replacement)
+	}
+}
+
+// Find the unconfirmed wallet transaction replaced by the given unconfirmed transaction, nil if not found.
+// The inputs of payments received are not wallet outputs, so all the unconfirmed transactions are checked.
+func (wallet *SPVWallet) findReplaced(tx *Transaction) *StoreTx {
+	unconfirmed, err := wallet.dataStore.Txs().GetAllFrom(0)
+	if err != nil {
+		return nil
+	}
+	for _, old := range unconfirmed {
+		if sdk.IsReplacement(&old.Data, tx) {
+			return old
+		}
+	}
+	return nil
+}
+
+// Remove an unconfirmed transaction and the unconfirmed transactions spending its outputs,
+// the outputs they spent become UTXOs again and the outputs they created are deleted.
+// The removed transactions are no longer tracked as sent.
+func (wallet *SPVWallet) removeTx(storeTx *StoreTx) error {
+	defer wallet.reloadBalance()
+
+	unconfirmed, err := wallet.dataStore.Txs().GetAllFrom(0)
+	if err != nil {
+		return err
+	}
+	return wallet.removeUnconfirmed(storeTx, unconfirmed)
+}
+
+func (wallet *SPVWallet) removeUnconfirmed(storeTx *StoreTx, unconfirmed []*StoreTx) error {
+	// The descendants are removed first, so the outputs they spent are deleted after
+	for _, child := range unconfirmed {
+		if !spends(&child.Data, storeTx.TxId) {
+			continue
+		}
+		err := wallet.removeUnconfirmed(child, unconfirmed)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, input := range storeTx.Data.Inputs {
+		stxo, err := wallet.dataStore.STXOs().Get(&input.Previous)
+		if err != nil || stxo.SpendTxId != storeTx.TxId {
+			continue
+		}
+		err = wallet.dataStore.STXOs().ToUTXO(&input.Previous)
+		if err != nil {
+			return err
+		}
+	}
+
+	for index := range storeTx.Data.Outputs {
+		err := wallet.dataStore.UTXOs().Delete(NewOutPoint(storeTx.TxId, uint16(index)))
+		if err != nil {
+			return err
+		}
+	}
+
+	wallet.sent.remove(storeTx.TxId)
+	return wallet.dataStore.Txs().Delete(&storeTx.TxId)
+}
+
+// Check if the transaction spends any output of the given transaction
+func spends(tx *Transaction, txId Uint256) bool {
+	for _, input := range tx.Inputs {
+		if input.Previous.TxID == txId {
+			return true
+		}
+	}
+	return false
+}
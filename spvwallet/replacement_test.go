@@ -0,0 +1,108 @@
+package spvwallet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_ReplaceOwnTx(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	replaced := make(chan [2]Transaction, 1)
+	wallet.OnTxReplaced(func(old, replacement Transaction) { replaced <- [2]Transaction{old, replacement} })
+
+	funding := Transaction{LockTime: 1, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	input := &Input{Previous: *NewOutPoint(funding.Hash(), 0), Sequence: 0}
+	spend := Transaction{LockTime: 2, Inputs: []*Input{input},
+		Outputs: []*Output{{Value: 90, ProgramHash: Uint168{2}}}}
+	if _, err := wallet.CommitTx(NewStoreTx(spend, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pays a higher fee with the same input
+	replacement := Transaction{LockTime: 3, Inputs: []*Input{input},
+		Outputs: []*Output{{Value: 80, ProgramHash: Uint168{2}}}}
+	if _, err := wallet.CommitTx(NewStoreTx(replacement, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expectReplaced(t, replaced, spend, replacement)
+
+	spendId, replacementId := spend.Hash(), replacement.Hash()
+	if _, err := store.Txs().Get(&spendId); err == nil {
+		t.Error("replaced transaction kept")
+	}
+	if _, err := store.Txs().Get(&replacementId); err != nil {
+		t.Error("replacement not committed")
+	}
+	stxo, err := store.STXOs().Get(&input.Previous)
+	if err != nil || stxo.SpendTxId != replacementId {
+		t.Error("funding output not spent by the replacement")
+	}
+}
+
+func TestSPVWallet_ReplaceIncomingPayment(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	replaced := make(chan [2]Transaction, 1)
+	wallet.OnTxReplaced(func(old, replacement Transaction) { replaced <- [2]Transaction{old, replacement} })
+
+	// The payment spends an output of the sender, not a wallet output
+	input := &Input{Previous: *NewOutPoint(Uint256{9}, 0), Sequence: 0}
+	payment := Transaction{LockTime: 1, Inputs: []*Input{input},
+		Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(payment, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The received output is spent before the payment confirmed
+	child := Transaction{LockTime: 2, Inputs: []*Input{{Previous: *NewOutPoint(payment.Hash(), 0)}},
+		Outputs: []*Output{{Value: 90, ProgramHash: Uint168{2}}}}
+	if _, err := wallet.CommitTx(NewStoreTx(child, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	replacement := Transaction{LockTime: 3, Inputs: []*Input{input},
+		Outputs: []*Output{{Value: 95, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(replacement, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expectReplaced(t, replaced, payment, replacement)
+
+	// The descendant spending the replaced payment is removed with it
+	for _, tx := range []Transaction{payment, child} {
+		txId := tx.Hash()
+		if _, err := store.Txs().Get(&txId); err == nil {
+			t.Errorf("transaction %d kept after replaced", tx.LockTime)
+		}
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(payment.Hash(), 0)); err == nil {
+		t.Error("output of the replaced payment kept")
+	}
+	if _, err := store.STXOs().Get(NewOutPoint(payment.Hash(), 0)); err == nil {
+		t.Error("output of the replaced payment kept as spent")
+	}
+	utxo, err := store.UTXOs().Get(NewOutPoint(replacement.Hash(), 0))
+	if err != nil || utxo.Value != 95 {
+		t.Error("output of the replacement not tracked")
+	}
+}
+
+func expectReplaced(t *testing.T, replaced chan [2]Transaction, old, replacement Transaction) {
+	select {
+	case txs := <-replaced:
+		if txs[0].Hash() != old.Hash() || txs[1].Hash() != replacement.Hash() {
+			t.Errorf("replaced %d by %d, expect %d by %d",
+				txs[0].LockTime, txs[1].LockTime, old.LockTime, replacement.LockTime)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replacement not notified")
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"net/http"
 	"os"
 
-	. "github.com/elastos/Elastos.ELA/core"
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 type RequestHandler interface {
@@ -17,13 +17,15 @@ type RequestHandler interface {
 
 func InitServer(handler RequestHandler) *Server {
 	server := new(Server)
-	server.Server = http.Server{Addr: ":" + RPCPort}
+	// Use it's own mux, so creating a new server will not register the handle twice
+	mux := http.NewServeMux()
+	mux.HandleFunc("/spvwallet/", server.handle)
+	server.Server = http.Server{Addr: ":" + RPCPort, Handler: mux}
 	server.methods = map[string]func(Req) Resp{
 		"notifynewaddress": server.NotifyNewAddress,
 		"sendtransaction":  server.SendTransaction,
 	}
 	server.handler = handler
-	http.HandleFunc("/spvwallet/", server.handle)
 	return server
 }
 
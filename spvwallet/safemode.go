@@ -0,0 +1,108 @@
+package spvwallet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+var ErrSafeMode = errors.New("wallet is in safe mode, sending transactions is disabled")
+
+/*
+safeMode stops sending transactions when the consistency of the chain is in doubt, so the wallet
+does not spend on a wrong view of the chain. The wallet keeps syncing and answering queries.
+It's entered by the configured triggers and left only when cleared by the operator.
+*/
+type safeMode struct {
+	sync.Mutex
+	reason    string // Empty when not in safe mode
+	failures  int    // Consecutive received transaction verify failures
+	listeners []func(reason string)
+
+	// Triggers, false or 0 to disable
+	onCheckpointConflict bool
+	reorgDepth           int
+	verifyFailures       int
+}
+
+func (mode *safeMode) enter(reason string) {
+	mode.Lock()
+	defer mode.Unlock()
+
+	if mode.reason != "" {
+		return
+	}
+	mode.reason = reason
+	for _, listener := range mode.listeners {
+		go listener(reason)
+	}
+}
+
+// Register a listener to be notified when the wallet enters safe mode with the reason
+func (wallet *SPVWallet) OnSafeMode(listener func(reason string)) {
+	wallet.safeMode.Lock()
+	defer wallet.safeMode.Unlock()
+
+	wallet.safeMode.listeners = append(wallet.safeMode.listeners, listener)
+}
+
+// Check if the wallet is in safe mode and the reason it entered
+func (wallet *SPVWallet) SafeMode() (bool, string) {
+	wallet.safeMode.Lock()
+	defer wallet.safeMode.Unlock()
+
+	return wallet.safeMode.reason != "", wallet.safeMode.reason
+}
+
+// Leave safe mode after the operator checked the chain, sending transactions is enabled again
+func (wallet *SPVWallet) ClearSafeMode() {
+	wallet.safeMode.Lock()
+	defer wallet.safeMode.Unlock()
+
+	wallet.safeMode.reason = ""
+	wallet.safeMode.failures = 0
+}
+
+func (wallet *SPVWallet) onCheckpointConflict(err error) {
+	if wallet.safeMode.onCheckpointConflict {
+		wallet.safeMode.enter(fmt.Sprint("checkpoint conflict, ", err))
+	}
+}
+
+func (wallet *SPVWallet) onReorg(detached, attached []Uint256, commonAncestor uint32) {
+	depth := wallet.safeMode.reorgDepth
+	if depth > 0 && len(detached) > depth {
+		wallet.safeMode.enter(fmt.Sprintf("reorganize of %d blocks at height %d", len(detached), commonAncestor))
+	}
+}
+
+// Count the consecutive failures of verifying received transactions, nil error resets the count
+func (wallet *SPVWallet) onVerifyReceivedTx(err error) {
+	wallet.safeMode.Lock()
+	if err == nil {
+		wallet.safeMode.failures = 0
+		wallet.safeMode.Unlock()
+		return
+	}
+	wallet.safeMode.failures++
+	failures := wallet.safeMode.failures
+	wallet.safeMode.Unlock()
+
+	max := wallet.safeMode.verifyFailures
+	if max > 0 && failures >= max {
+		wallet.safeMode.enter(fmt.Sprintf("%d received transactions failed verification, last %s", failures, err))
+	}
+}
+
+// A commit stuck in the data store leaves the wallet's view of the chain unreliable
+func (wallet *SPVWallet) onCommitStuck(commit string, elapsed time.Duration, done bool) {
+	if done {
+		return
+	}
+	reason := fmt.Sprintf("commit of %s stuck for %s", commit, elapsed)
+	wallet.lastError.set(fmt.Errorf("%s", reason))
+	wallet.safeMode.enter(reason)
+}
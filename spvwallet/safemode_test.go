@@ -0,0 +1,64 @@
+package spvwallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_SafeMode(t *testing.T) {
+	wallet, _ := newTestWallet(Uint168{1})
+	wallet.safeMode.reorgDepth = 3
+	wallet.safeMode.verifyFailures = 2
+
+	reasons := make(chan string, 2)
+	wallet.OnSafeMode(func(reason string) { reasons <- reason })
+
+	// A shallow reorganize and failures broken by a success do not trigger safe mode
+	wallet.onReorg(make([]Uint256, 3), nil, 100)
+	wallet.onVerifyReceivedTx(errors.New("invalid signature"))
+	wallet.onVerifyReceivedTx(nil)
+	wallet.onVerifyReceivedTx(errors.New("invalid signature"))
+	if safe, reason := wallet.SafeMode(); safe {
+		t.Fatalf("entered safe mode, %s", reason)
+	}
+
+	// Checkpoint conflicts are not a trigger unless configured
+	wallet.onCheckpointConflict(errors.New("conflict"))
+	if safe, _ := wallet.SafeMode(); safe {
+		t.Fatal("entered safe mode by checkpoint conflict not configured")
+	}
+
+	wallet.onReorg(make([]Uint256, 4), nil, 100)
+	safe, reason := wallet.SafeMode()
+	if !safe {
+		t.Fatal("deep reorganize did not enter safe mode")
+	}
+	select {
+	case notified := <-reasons:
+		if notified != reason {
+			t.Errorf("notified reason %q, expect %q", notified, reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("safe mode listener not notified")
+	}
+
+	// Sending is refused, more triggers are not notified again
+	if err := wallet.SendTransaction(Transaction{}); err != ErrSafeMode {
+		t.Errorf("send in safe mode returns %v, expect ErrSafeMode", err)
+	}
+	wallet.onVerifyReceivedTx(errors.New("invalid signature"))
+	select {
+	case reason := <-reasons:
+		t.Errorf("notified again, %s", reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	wallet.ClearSafeMode()
+	if safe, _ := wallet.SafeMode(); safe {
+		t.Error("safe mode not cleared")
+	}
+}
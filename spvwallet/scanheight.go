@@ -0,0 +1,55 @@
+package spvwallet
+
+import (
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+/*
+Get the height up to which the blocks have been scanned for the watched address, 0 if not watched.
+An address watched since the chain is empty is scanned as the chain syncs. An address added after
+blocks have been synced starts at 0, the gap between its scan height and the chain height is the
+range of blocks to rescan for it. When the chain rolls back to or below its scan height, the blocks
+synced again are scanned for it and it advances with the chain from then on.
+*/
+func (wallet *SPVWallet) AddressScanHeight(addr string) uint32 {
+	hash, err := Uint168FromAddress(addr)
+	if err != nil {
+		return 0
+	}
+	return wallet.addressScanHeight(hash)
+}
+
+func (wallet *SPVWallet) addressScanHeight(hash *Uint168) uint32 {
+	if !wallet.getAddrFilter().ContainAddr(*hash) {
+		return 0
+	}
+
+	chainHeight := wallet.GetChainHeight()
+	height, ok := wallet.dataStore.Info().AddrScanHeight(hash)
+	if !ok || height > chainHeight {
+		return chainHeight
+	}
+	return height
+}
+
+// The chain rolled back to the height, the blocks above it will be scanned for all watched
+// addresses, so the addresses scanned up to the height are scanned with the chain again.
+func (wallet *SPVWallet) catchUpScanHeights(height uint32) {
+	addrs, err := wallet.dataStore.Addrs().GetAll()
+	if err != nil {
+		log.Error("Get addresses to update scan heights failed, ", err)
+		return
+	}
+	info := wallet.dataStore.Info()
+	for _, addr := range addrs {
+		scanned, ok := info.AddrScanHeight(addr.Hash())
+		if !ok || scanned < height {
+			continue
+		}
+		if err := info.DeleteAddrScanHeight(addr.Hash()); err != nil {
+			log.Error("Delete scan height of address ", addr.String(), " failed, ", err)
+		}
+	}
+}
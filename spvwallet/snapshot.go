@@ -0,0 +1,124 @@
+package spvwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	StateVersion = 1 // The version of wallet state snapshot format
+)
+
+// The portable wallet state snapshot, it only contains the data
+// that can not be recovered from the network, so it does not depend on the database format.
+type walletState struct {
+	Version int
+	Height  uint32
+	Addrs   []stateAddr
+}
+
+type stateAddr struct {
+	Address string
+	Script  []byte
+	Type    int
+}
+
+// Export the watched addresses and sync height of the wallet as a versioned snapshot
+func (wallet *SPVWallet) ExportState(w io.Writer) error {
+	addrs, err := wallet.dataStore.Addrs().GetAll()
+	if err != nil {
+		return fmt.Errorf("get addresses failed, %s", err)
+	}
+
+	state := walletState{
+		Version: StateVersion,
+		Height:  wallet.GetChainHeight(),
+		Addrs:   make([]stateAddr, 0, len(addrs)),
+	}
+	for _, addr := range addrs {
+		address, err := addr.Hash().ToAddress()
+		if err != nil {
+			return fmt.Errorf("invalid address hash, %s", err)
+		}
+		state.Addrs = append(state.Addrs, stateAddr{
+			Address: address,
+			Script:  addr.Script(),
+			Type:    addr.Type(),
+		})
+	}
+
+	return json.NewEncoder(w).Encode(state)
+}
+
+/*
+Import a wallet state snapshot created by ExportState, call it before the wallet is started.
+The addresses in the snapshot are added to the watched addresses and the address filter is reloaded.
+If new addresses are imported into a wallet that has synced blocks, the chain data is reset
+so the blocks will be scanned again with the new addresses when the wallet starts.
+*/
+func (wallet *SPVWallet) ImportState(r io.Reader) error {
+	var state walletState
+	err := json.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return fmt.Errorf("decode wallet state failed, %s", err)
+	}
+	if state.Version != StateVersion {
+		return fmt.Errorf("unsupported wallet state version %d", state.Version)
+	}
+
+	var imported int
+	for _, addr := range state.Addrs {
+		hash, err := Uint168FromAddress(addr.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address %s, %s", addr.Address, err)
+		}
+		if wallet.getAddrFilter().ContainAddr(*hash) {
+			continue
+		}
+		err = wallet.dataStore.Addrs().Put(hash, addr.Script, addr.Type)
+		if err != nil {
+			return fmt.Errorf("put address %s failed, %s", addr.Address, err)
+		}
+		imported++
+	}
+
+	err = wallet.loadAddrFilter()
+	if err != nil {
+		return err
+	}
+	// Peers connecting next get the imported addresses too
+	wallet.bloomFilter.Invalidate()
+
+	height := wallet.GetChainHeight()
+	log.Info("Wallet state imported, new addresses: ", imported, ", snapshot height: ", state.Height,
+		", chain height: ", height)
+
+	// An empty chain will be synced from the beginning, nothing to rescan
+	if imported == 0 || height == 0 {
+		return nil
+	}
+
+	// Reset chain data to rescan blocks for the imported addresses, addresses are kept
+	log.Info("Reset chain data to rescan blocks for imported addresses")
+	return wallet.Reset()
+}
+
+// Export the headers of the synced chain, see sdk.Blockchain.ExportHeaders for the format
+func (wallet *SPVWallet) ExportHeaders(w io.Writer) error {
+	return wallet.Blockchain().ExportHeaders(w)
+}
+
+/*
+Import the headers exported by ExportHeaders from a trusted wallet, call it before the wallet is started.
+The wallet skips downloading the imported blocks and syncs from the last imported header, so the
+imported blocks are not scanned for transactions. Import only into a new wallet whose addresses
+have no transactions in the imported blocks, as the wallet state is not part of the headers.
+*/
+func (wallet *SPVWallet) ImportHeaders(r io.Reader) error {
+	return wallet.Blockchain().ImportHeaders(r)
+}
@@ -0,0 +1,70 @@
+package spvwallet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestSPVWallet_ExportImportState(t *testing.T) {
+	log.Init()
+	addr := Uint168{1, 1}
+	wallet, store := newTestWallet(addr)
+	store.Addrs().Put(&addr, []byte{1, 2, 3}, 1)
+	store.Info().SaveChainHeight(100)
+
+	var buf bytes.Buffer
+	if err := wallet.ExportState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Imported into a fresh wallet with an empty chain, nothing to rescan
+	other := Uint168{2, 2}
+	fresh, freshStore := newTestWallet(other)
+	headers := newTestHeaders()
+	fresh.headers = headers
+	state := buf.String()
+	if err := fresh.ImportState(strings.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := freshStore.Addrs().Get(&addr)
+	if err != nil {
+		t.Fatal("address in the snapshot not imported")
+	}
+	if !bytes.Equal(imported.Script(), []byte{1, 2, 3}) || imported.Type() != 1 {
+		t.Errorf("imported address script %x, type %d", imported.Script(), imported.Type())
+	}
+	if !fresh.getAddrFilter().ContainAddr(addr) {
+		t.Error("imported address not in the address filter")
+	}
+
+	// Imported into a synced wallet, the chain is reset to rescan the blocks
+	synced, syncedStore := newTestWallet(other)
+	synced.headers = headers
+	syncedStore.Info().SaveChainHeight(10)
+	headers.Put(&StoreHeader{}, true)
+	if err := synced.ImportState(strings.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if tip, _ := headers.GetTip(); tip != nil {
+		t.Error("chain not reset after new addresses imported into a synced wallet")
+	}
+
+	// The addresses already watched are not imported again, no reset
+	headers.Put(&StoreHeader{}, true)
+	if err := synced.ImportState(strings.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if tip, _ := headers.GetTip(); tip == nil {
+		t.Error("chain reset without new addresses imported")
+	}
+
+	if err := fresh.ImportState(strings.NewReader(`{"Version": 2}`)); err == nil {
+		t.Error("imported unsupported snapshot version")
+	}
+}
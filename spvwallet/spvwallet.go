@@ -1,19 +1,69 @@
 package spvwallet
 
 import (
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
+// Initialize SPV wallet with the given config instead of the config file,
+// environment variables still apply to the fields left empty in the given config.
+// The log is initialized again to apply the log settings of the loaded config.
+func InitWithConfig(clientId uint64, cfg *config.Config) (*SPVWallet, error) {
+	cfg, err := config.Load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Init()
+	return Init(clientId, cfg.SeedList)
+}
+
+var (
+	walletLock     sync.Mutex
+	walletInstance *SPVWallet // The initialized SPV wallet instance
+)
+
+/*
+Initialize the SPV wallet, the lifecycle of SPV wallet is Init -> Start -> Stop.
+The peer manager, databases and RPC server can only have one instance in a process,
+so calling Init again before Stop will return the existing wallet instance,
+the clientId and seeds arguments are ignored in this case.
+After Stop, Init can be called again to create a new wallet instance.
+If Init fails, the opened resources are released and Init can be called again.
+*/
 func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
+	walletLock.Lock()
+	defer walletLock.Unlock()
+
+	if walletInstance != nil {
+		log.Warn("SPV wallet already initialized, return the existing instance")
+		return walletInstance, nil
+	}
+
+	wallet, err := newSPVWallet(clientId, seeds)
+	if err != nil {
+		return nil, err
+	}
+
+	walletInstance = wallet
+	return wallet, nil
+}
+
+func newSPVWallet(clientId uint64, seeds []string) (*SPVWallet, error) {
 	var err error
 	wallet := new(SPVWallet)
 
@@ -26,20 +76,67 @@ func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
 	// Initialize wallet database
 	wallet.dataStore, err = db.NewSQLiteDB()
 	if err != nil {
+		wallet.headers.Close()
 		return nil, err
 	}
 
+	// Load address filter from database
+	wallet.filter = sdk.NewAddrFilter(nil)
+	wallet.bloomFilter = sdk.NewFilterCache(wallet.buildBloomFilter)
+	wallet.sent = newSentTxs()
+	wallet.handles = newBroadcastHandles()
+	wallet.reloadBalance()
+	err = wallet.loadAddrFilter()
+	if err != nil {
+		log.Error("Load address filter failed, ", err)
+	}
+
+	// Apply SDK parameters from config
+	cfg := config.Values()
+	configSDK(cfg)
+	wallet.validateTx = cfg.ValidateTxBeforeSend
+	wallet.verifyReceivedTx = cfg.VerifyReceivedTx
+	wallet.pushOnConnect = time.Second * time.Duration(cfg.PushOnConnectWindow)
+	wallet.rebuildFilterOnReconnect = cfg.RebuildFilterOnReconnect
+	wallet.broadcastFanout = cfg.BroadcastFanout
+	wallet.skipCoinbase = cfg.TrackCoinbase != nil && !*cfg.TrackCoinbase
+	wallet.safeMode.onCheckpointConflict = cfg.SafeModeOnCheckpointConflict
+	wallet.safeMode.reorgDepth = cfg.SafeModeReorgDepth
+	wallet.safeMode.verifyFailures = cfg.SafeModeVerifyFailures
+	if len(cfg.TrackedTxTypes) > 0 {
+		wallet.trackedTxTypes = make(map[TransactionType]bool)
+		for _, txType := range cfg.TrackedTxTypes {
+			wallet.trackedTxTypes[TransactionType(txType)] = true
+		}
+	}
+
 	// Initialize P2P network client
 	client, err := sdk.GetSPVClient(sdk.TypeMainNet, clientId, seeds)
 	if err != nil {
+		wallet.Close()
 		return nil, err
 	}
 
 	// Initialize spv service
 	wallet.SPVService, err = sdk.GetSPVService(client, wallet, wallet.getBloomFilter)
 	if err != nil {
+		wallet.Close()
 		return nil, err
 	}
+	wallet.peers = client.PeerManager()
+	wallet.OnSyncStalled(wallet.onSyncStalled)
+	wallet.OnPeerEvent(wallet.pushSentTxs)
+	wallet.OnNetworkRestored(wallet.onNetworkRestored)
+	wallet.OnCheckpointConflict(wallet.onCheckpointConflict)
+	wallet.Blockchain().OnReorg(wallet.onReorg)
+	wallet.Blockchain().OnCommitStuck(wallet.onCommitStuck)
+
+	// Keep the trusted peers connected
+	for _, addr := range cfg.ManualPeers {
+		if err := client.PeerManager().AddManualPeer(addr); err != nil {
+			log.Warn("Add manual peer ", addr, " failed, ", err)
+		}
+	}
 
 	// Initialize RPC server
 	wallet.rpcServer = rpc.InitServer(wallet)
@@ -47,13 +144,144 @@ func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
 	return wallet, nil
 }
 
+func configSDK(cfg *config.Config) {
+	setUint32(&sdk.OrphanTxTimeout, cfg.OrphanTxTimeout)
+	sdk.MaxOrphanTxsPerPeer = cfg.MaxOrphanTxsPerPeer
+	setUint32(&sdk.InvDedupWindow, cfg.InvDedupWindow)
+	sdk.BlockInvWindow = cfg.BlockInvWindow
+	setInt(&sdk.MaxSyncRestarts, cfg.MaxSyncRestarts)
+	setUint32(&sdk.SyncStallCooldown, cfg.SyncStallCooldown)
+	setUint32(&sdk.SyncRateWindow, cfg.SyncRateWindow)
+	setInt(&sdk.MedianTimeBlocks, cfg.MedianTimeBlocks)
+	setUint32(&sdk.MaxFutureBlockTime, cfg.MaxFutureBlockTime)
+	sdk.MinRelayFeeFloor = Fixed64(cfg.MinRelayFee)
+	setInt(&sdk.CommitBatchSize, cfg.CommitBatchSize)
+	setUint32(&sdk.CommitFlushInterval, cfg.CommitFlushInterval)
+	sdk.CommitTimeout = cfg.CommitTimeout
+	sdk.MaxBlockTxRequests = cfg.MaxBlockTxRequests
+	sdk.MaxBlockFalsePositives = cfg.MaxBlockFalsePositives
+	setInt(&sdk.MaxFalsePositives, cfg.MaxFalsePositives)
+	sdk.MaxBlocksAhead = cfg.MaxBlocksAhead
+	sdk.SyncCacheSize = cfg.SyncCacheSize
+	setInt(&sdk.MaxFilterElements, cfg.MaxFilterElements)
+	sdk.Checkpoints = configCheckpoints(cfg)
+	// The mode names are validated with config
+	if cfg.PoWVerification != "" {
+		sdk.PoWVerification, _ = sdk.ParsePoWVerificationMode(cfg.PoWVerification)
+	}
+	db.StoreFullTransactions = cfg.StoreFullTransactions == nil || *cfg.StoreFullTransactions
+	if cfg.FilterUpdateMode != "" {
+		sdk.FilterUpdate, _ = sdk.ParseFilterUpdateMode(cfg.FilterUpdateMode)
+	}
+	sdk.FullBlockMode = cfg.FullBlockMode
+	sdk.ServerMode = cfg.ServerMode
+	sdk.AdvertisedServices = cfg.AdvertisedServices
+	sdk.RequestRelay = cfg.RequestRelay
+	sdk.RequestMemPool = cfg.RequestMemPool
+	sdk.RelayWhileSyncing = cfg.RelayWhileSyncing
+	sdk.SyncPeerReconnectTimeout = cfg.SyncPeerReconnectTimeout
+	net.ReconnectLastPeers = cfg.ReconnectLastPeers
+	setInt(&net.MaxManualPeers, cfg.MaxManualPeers)
+	setInt(&net.ConnRampStart, cfg.ConnRampStart)
+	setUint32(&net.ConnRampInterval, cfg.ConnRampInterval)
+	net.BindAddress = cfg.BindAddress
+	setInt(&net.MaxConcurrentDials, cfg.MaxConcurrentDials)
+	net.MaxHeightDrop = cfg.MaxHeightDrop
+	net.SeedRefreshInterval = cfg.SeedRefreshInterval
+	net.OutageReconnectInterval = cfg.OutageReconnectInterval
+	setInt(&net.MessageWorkers, cfg.MessageWorkers)
+	setInt(&net.HandshakeTimeout, cfg.HandshakeTimeout)
+}
+
+// Set the SDK value with the config value, the SDK default is kept if it's 0
+func setInt(value *int, cfgValue int) {
+	if cfgValue > 0 {
+		*value = cfgValue
+	}
+}
+
+func setUint32(value *uint32, cfgValue uint32) {
+	if cfgValue > 0 {
+		*value = cfgValue
+	}
+}
+
+// Parse the block hash in hex string as shown in block explorers, the hashes are validated with config
+// The SDK checkpoints before any config is applied
+var defaultCheckpoints = sdk.Checkpoints
+
+// Build the checkpoints from the defaults instead of the current ones,
+// so the config checkpoints are not added again when Init is called after Stop
+func configCheckpoints(cfg *config.Config) []sdk.Checkpoint {
+	checkpoints := append([]sdk.Checkpoint(nil), defaultCheckpoints...)
+	for _, checkpoint := range cfg.Checkpoints {
+		checkpoints = append(checkpoints,
+			sdk.Checkpoint{Height: checkpoint.Height, Hash: blockHash(checkpoint.Hash)})
+	}
+	if cfg.GenesisHash != "" {
+		checkpoints = append(checkpoints, sdk.Checkpoint{Height: 0, Hash: blockHash(cfg.GenesisHash)})
+	}
+	return checkpoints
+}
+
+func blockHash(str string) Uint256 {
+	hash, _ := HexStringToBytes(str)
+	blockHash, _ := Uint256FromBytes(BytesReverse(hash))
+	return *blockHash
+}
+
 type SPVWallet struct {
 	sync.Mutex
 	sdk.SPVService
 	rpcServer *rpc.Server
+	peers     *net.PeerManager
 	headers   db.Headers
 	dataStore db.DataStore
 	filter    *sdk.AddrFilter
+	// The bloom filter snapshot sent to peers
+	bloomFilter *sdk.FilterCache
+	// The transactions sent and not confirmed yet
+	sent *sentTxs
+	// The handles tracking the transactions broadcast
+	handles *broadcastHandles
+
+	// Validate transaction before broadcast
+	validateTx bool
+	// Verify received transactions of the wallet addresses
+	verifyReceivedTx bool
+	// Send the recently sent transactions to newly connected peers within this time, 0 to disable
+	pushOnConnect time.Duration
+	// Rebuild the bloom filter when the network is restored
+	rebuildFilterOnReconnect bool
+	// The number of peers a transaction is broadcast to, 0 to broadcast to all
+	broadcastFanout int
+	// The transaction types to commit, nil to track all types
+	trackedTxTypes map[TransactionType]bool
+	// Ignore the coinbase transactions paying the wallet addresses
+	skipCoinbase bool
+
+	policyLock  sync.Mutex
+	relayPolicy RelayPolicy
+
+	replacedLock      sync.Mutex
+	replacedListeners []func(old, replacement Transaction)
+
+	abandonedLock      sync.Mutex
+	abandonedListeners []func(tx Transaction)
+
+	unconfirmedLock      sync.Mutex
+	unconfirmedListeners []func(txId Uint256, height uint32)
+
+	// Sending transactions is disabled in safe mode
+	safeMode safeMode
+
+	// The last error reported in the health status
+	lastError lastError
+
+	// The totals of the UTXOs
+	balance balanceCache
+
+	closeOnce sync.Once
 }
 
 func (wallet *SPVWallet) Start() {
@@ -61,9 +289,18 @@ func (wallet *SPVWallet) Start() {
 	wallet.rpcServer.Start()
 }
 
+// Stop the wallet and release it, so Init can create a new wallet instance
 func (wallet *SPVWallet) Stop() {
 	wallet.SPVService.Stop()
 	wallet.rpcServer.Close()
+	// The databases must be closed before Init opens them again
+	wallet.Close()
+
+	walletLock.Lock()
+	if walletInstance == wallet {
+		walletInstance = nil
+	}
+	walletLock.Unlock()
 }
 
 func (wallet *SPVWallet) Headers() db.Headers {
@@ -89,6 +326,22 @@ func (wallet *SPVWallet) GetHeader(hash Uint256) (*StoreHeader, error) {
 	return wallet.headers.GetHeader(hash)
 }
 
+// Get the header on the best chain at the height from the height index, see db.HeightIndex
+func (wallet *SPVWallet) HeaderAtHeight(height uint32) (*StoreHeader, error) {
+	return wallet.headers.GetByHeight(height)
+}
+
+// Get the raw block header on the best chain at the given height,
+// sdk.ErrHeaderNotFound is returned if the height is beyond the chain tip.
+func (wallet *SPVWallet) GetHeaderByHeight(height uint32) (*Header, error) {
+	return wallet.Blockchain().GetHeaderByHeight(height)
+}
+
+// Get the raw block header with the given hash, sdk.ErrHeaderNotFound is returned for unknown headers
+func (wallet *SPVWallet) GetHeaderByHash(hash Uint256) (*Header, error) {
+	return wallet.Blockchain().GetHeaderByHash(hash)
+}
+
 // Get the header on chain tip
 func (wallet *SPVWallet) GetChainTip() (*StoreHeader, error) {
 	return wallet.headers.GetTip()
@@ -96,6 +349,9 @@ func (wallet *SPVWallet) GetChainTip() (*StoreHeader, error) {
 
 // Save chain height to database
 func (wallet *SPVWallet) PutChainHeight(height uint32) {
+	if height < wallet.dataStore.Info().ChainHeight() {
+		wallet.catchUpScanHeights(height)
+	}
 	wallet.dataStore.Info().SaveChainHeight(height)
 }
 
@@ -104,8 +360,73 @@ func (wallet *SPVWallet) GetChainHeight() uint32 {
 	return wallet.dataStore.Info().ChainHeight()
 }
 
+var ErrOutpointNotFound = errors.New("outpoint not found")
+
+// Get the confirmations of the transaction that funds the outpoint, and if the outpoint has been spent
+// by a confirmed or unconfirmed transaction. ErrOutpointNotFound is returned for unknown outpoints.
+func (wallet *SPVWallet) GetOutpointConfirmations(outpoint OutPoint) (int, bool, error) {
+	if utxo, err := wallet.dataStore.UTXOs().Get(&outpoint); err == nil {
+		return wallet.confirmations(utxo.AtHeight), false, nil
+	}
+	if stxo, err := wallet.dataStore.STXOs().Get(&outpoint); err == nil {
+		return wallet.confirmations(stxo.AtHeight), true, nil
+	}
+	return 0, false, ErrOutpointNotFound
+}
+
+// Get the confirmations of a transaction at the given height, 0 for unconfirmed
+func (wallet *SPVWallet) confirmations(height uint32) int {
+	chainHeight := wallet.GetChainHeight()
+	if height == 0 || height > chainHeight {
+		return 0
+	}
+	return int(chainHeight - height + 1)
+}
+
 // Commit a transaction return if this is a false positive and error
 func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
+	// Transaction types not tracked are not saved or notified, they are matched so not false positives,
+	// but the wallet outputs they spend are spent still
+	if wallet.trackedTxTypes != nil && !wallet.trackedTxTypes[storeTx.Data.TxType] {
+		if wallet.spendInputs(storeTx) > 0 {
+			wallet.bloomFilter.Invalidate()
+		}
+		return false, nil
+	}
+	if wallet.skipCoinbase && storeTx.Data.IsCoinBaseTx() {
+		return false, nil
+	}
+
+	// Our own transactions relayed back are not committed again if already tracked
+	if wallet.handleSentTx(storeTx) {
+		return false, nil
+	}
+
+	if wallet.verifyReceivedTx && wallet.isWalletTx(&storeTx.Data) {
+		err := wallet.VerifyReceivedTx(&storeTx.Data)
+		wallet.onVerifyReceivedTx(err)
+		// The transaction is dropped, returning the error would fail the block and restart sync
+		if err != nil {
+			log.Warn("Drop received transaction ", storeTx.TxId.String(), " failed verification, ", err)
+			return false, nil
+		}
+	}
+
+	// An unconfirmed replacement supersedes the unconfirmed transaction it replaces
+	var replaced *StoreTx
+	if storeTx.Height == 0 {
+		replaced = wallet.findReplaced(&storeTx.Data)
+		if replaced != nil {
+			err := wallet.removeTx(replaced)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Record the fee when all the inputs spend wallet outputs
+	storeTx.Fee = wallet.txFee(&storeTx.Data)
+
 	hits := 0
 	// Save UTXOs
 	for index, output := range storeTx.Data.Outputs {
@@ -116,22 +437,22 @@ func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
 				lockTime = storeTx.Height + 100
 			}
 			utxo := ToUTXO(storeTx.TxId, storeTx.Height, index, output.Value, lockTime)
+			// The output committed unconfirmed before is replaced when confirmed
+			old, oldErr := wallet.dataStore.UTXOs().Get(&utxo.Op)
 			err := wallet.dataStore.UTXOs().Put(&output.ProgramHash, utxo)
 			if err != nil {
 				return false, err
 			}
+			if oldErr == nil {
+				wallet.balance.remove(old)
+			}
+			wallet.balance.add(utxo)
 			hits++
 		}
 	}
 
 	// Put spent UTXOs to STXOs
-	for _, input := range storeTx.Data.Inputs {
-		// Try to move UTXO to STXO, if a UTXO in database was spent, it will be moved to STXO
-		err := wallet.dataStore.STXOs().FromUTXO(&input.Previous, &storeTx.TxId, storeTx.Height)
-		if err == nil {
-			hits++
-		}
-	}
+	hits += wallet.spendInputs(storeTx)
 
 	// If no hits, no need to save transaction
 	if hits == 0 {
@@ -144,16 +465,95 @@ func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
 		return false, err
 	}
 
+	// Outpoints changed, rebuild the bloom filter when it's used next time
+	wallet.bloomFilter.Invalidate()
+
+	if replaced != nil {
+		wallet.handles.update(replaced.TxId, BroadcastFailed, 0, ErrBroadcastReplaced)
+		wallet.notifyTxReplaced(replaced.Data, storeTx.Data)
+	}
+
 	return false, nil
 }
 
+// Move the UTXOs spent by the transaction to STXOs, return the count of UTXOs spent
+func (wallet *SPVWallet) spendInputs(storeTx *StoreTx) int {
+	spends := 0
+	for _, input := range storeTx.Data.Inputs {
+		// Try to move UTXO to STXO, if a UTXO in database was spent, it will be moved to STXO
+		spent, spentErr := wallet.dataStore.UTXOs().Get(&input.Previous)
+		err := wallet.dataStore.STXOs().FromUTXO(&input.Previous, &storeTx.TxId, storeTx.Height)
+		if err == nil {
+			spends++
+			if spentErr == nil {
+				wallet.balance.remove(spent)
+			}
+		}
+	}
+	return spends
+}
+
+// Check if the transaction pays to the wallet addresses or spends the wallet outputs
+func (wallet *SPVWallet) isWalletTx(tx *Transaction) bool {
+	for _, output := range tx.Outputs {
+		if wallet.getAddrFilter().ContainAddr(output.ProgramHash) {
+			return true
+		}
+	}
+	for _, input := range tx.Inputs {
+		if _, err := wallet.dataStore.UTXOs().Get(&input.Previous); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Begin a batch of block commits, see sdk.CommitBatchSize
+func (wallet *SPVWallet) BeginBatch() error {
+	err := wallet.headers.BeginBatch()
+	if err != nil {
+		return err
+	}
+	return wallet.dataStore.BeginBatch()
+}
+
+// Commit the batch, transactions are written before headers, so if it's interrupted
+// the chain tip is not moved and the blocks will be committed again.
+func (wallet *SPVWallet) CommitBatch() error {
+	err := wallet.dataStore.CommitBatch()
+	if err != nil {
+		// The transactions of the batch are lost, drop the headers too,
+		// so the chain tip stays below the blocks and they are synced again
+		wallet.headers.DiscardBatch()
+		wallet.reloadBalance()
+		return err
+	}
+	return wallet.headers.CommitBatch()
+}
+
 // Rollback chain data on the given height
 func (wallet *SPVWallet) Rollback(height uint32) error {
-	return wallet.dataStore.Rollback(height)
+	defer wallet.bloomFilter.Invalidate()
+
+	// The transactions confirmed at the height become unconfirmed
+	txs, err := wallet.dataStore.Txs().GetAllFrom(height)
+	if err != nil {
+		return err
+	}
+	err = wallet.dataStore.Rollback(height)
+	if err != nil {
+		return err
+	}
+	wallet.reloadBalance()
+	for _, tx := range txs {
+		wallet.notifyTxUnconfirmed(tx.TxId, height)
+	}
+	return nil
 }
 
 // Reset database, clear all data
 func (wallet *SPVWallet) Reset() error {
+	defer wallet.bloomFilter.Invalidate()
 	err := wallet.headers.Reset()
 	if err != nil {
 		return err
@@ -162,13 +562,18 @@ func (wallet *SPVWallet) Reset() error {
 	if err != nil {
 		return err
 	}
+	wallet.reloadBalance()
 	return nil
 }
 
 // Close the database
+// Close the databases, only the first call closes them, the service closes the wallet as its
+// data store when stopped and Stop closes it again
 func (wallet *SPVWallet) Close() {
-	wallet.headers.Close()
-	wallet.dataStore.Close()
+	wallet.closeOnce.Do(func() {
+		wallet.headers.Close()
+		wallet.dataStore.Close()
+	})
 }
 
 func ToUTXO(txId Uint256, height uint32, index int, value Fixed64, lockTime uint32) *db.UTXO {
@@ -180,58 +585,231 @@ func ToUTXO(txId Uint256, height uint32, index int, value Fixed64, lockTime uint
 	return utxo
 }
 
+// Reload the filter to include the new address added to database, the hash must be a program hash.
+// Nothing is reloaded if the address is already in the filter.
 func (wallet *SPVWallet) NotifyNewAddress(hash []byte) error {
-	// Reload address filter to include new address
-	wallet.loadAddrFilter()
+	programHash, err := Uint168FromBytes(hash)
+	if err != nil {
+		return fmt.Errorf("invalid address hash %x, %s", hash, err)
+	}
+	if wallet.getAddrFilter().ContainAddr(*programHash) {
+		return nil
+	}
+	// Reload filter to include new address
+	return wallet.ReloadFilter()
+}
+
+// Reload the address filter from database and rebuild the bloom filter
+// with current addresses and outpoints, then broadcast filterload message to connected peers.
+// New connected peers will receive the filterload message when established.
+func (wallet *SPVWallet) ReloadFilter() error {
+	// Reload address filter
+	err := wallet.loadAddrFilter()
+	if err != nil {
+		return err
+	}
+	// Swap in the new bloom filter, peers connecting now will get the new one
+	filterLoad := wallet.bloomFilter.Reload()
+	// Blocks are filtered locally in full block mode, nothing to send
+	if sdk.FullBlockMode {
+		return nil
+	}
 	// Broadcast filterload message to connected peers
-	wallet.BroadCastMessage(wallet.getBloomFilter().GetFilterLoadMsg())
+	wallet.BroadCastMessage(filterLoad)
 	return nil
 }
 
+/*
+Rebuild the bloom filter after the network restored, the peers connected may be all new and
+got the snapshot taken before the outage. The rebuilt filter has all the watched addresses and
+the outpoints in database, the ones added while the filter snapshot was kept included.
+*/
+func (wallet *SPVWallet) onNetworkRestored(duration time.Duration) {
+	if !wallet.rebuildFilterOnReconnect {
+		return
+	}
+	log.Info("Network restored after ", duration, ", rebuild the bloom filter")
+	if err := wallet.ReloadFilter(); err != nil {
+		log.Error("Rebuild bloom filter failed, ", err)
+	}
+}
+
 func (wallet *SPVWallet) SendTransaction(tx Transaction) error {
+	_, err := wallet.sendTransaction(tx, false)
+	return err
+}
+
+// Broadcast the transaction, the returned channel is closed when it's relayed back by peers,
+// leaveOneOut to keep a peer out of the broadcast to relay it back, see broadcastTx.
+func (wallet *SPVWallet) sendTransaction(tx Transaction, leaveOneOut bool) (chan struct{}, error) {
+	if safe, _ := wallet.SafeMode(); safe {
+		return nil, ErrSafeMode
+	}
+
+	if wallet.validateTx {
+		err := wallet.ValidateTransaction(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	delay, err := wallet.relayDelay(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	relayed := wallet.sent.add(tx)
+
 	// Broadcast transaction to connected peers
-	wallet.BroadCastMessage(&tx)
-	return nil
+	if delay > 0 {
+		time.AfterFunc(delay, func() { wallet.broadcastTx(&tx, leaveOneOut) })
+		return relayed, nil
+	}
+	wallet.broadcastTx(&tx, leaveOneOut)
+	return relayed, nil
 }
 
-func (wallet *SPVWallet) getAddrFilter() *sdk.AddrFilter {
-	if wallet.filter == nil {
-		wallet.loadAddrFilter()
+/*
+Broadcast the transaction to BroadcastFanout random peers, or all peers if it's 0, the peers relay
+it to the others so the wallet is not seen as the origin by all peers. With leaveOneOut, one peer
+is left out when there are two or more, peers do not announce a transaction back to the peer it
+came from, but the peer left out learns it from the others and announces it, which tells the
+broadcast is accepted. Returns the peers the transaction is sent to.
+*/
+func (wallet *SPVWallet) broadcastTx(tx *Transaction, leaveOneOut bool) []*net.Peer {
+	count := wallet.broadcastFanout
+	if relay := wallet.relayPeers() - 1; leaveOneOut && relay > 0 && (count <= 0 || count > relay) {
+		count = relay
+	}
+	peers := wallet.peers.BroadcastTo(tx, count)
+	log.Debug("Transaction ", tx.Hash().String(), " broadcast to ", len(peers), " peers")
+	return peers
+}
+
+// The number of established peers relaying transactions to us
+func (wallet *SPVWallet) relayPeers() int {
+	count := 0
+	for _, peer := range wallet.peers.ConnectedPeers() {
+		if peer.State() == p2p.ESTABLISH && peer.Relay() != 0 {
+			count++
+		}
 	}
+	return count
+}
+
+func (wallet *SPVWallet) getAddrFilter() *sdk.AddrFilter {
 	return wallet.filter
 }
 
-func (wallet *SPVWallet) loadAddrFilter() *sdk.AddrFilter {
-	addrs, _ := wallet.dataStore.Addrs().GetAll()
-	wallet.filter = sdk.NewAddrFilter(nil)
+// Reload addresses from database into the address filter,
+// addresses are replaced at once, so it's safe to read the filter at the same time.
+func (wallet *SPVWallet) loadAddrFilter() error {
+	addrs, err := wallet.dataStore.Addrs().GetAll()
+	if err != nil {
+		return err
+	}
+	hashes := make([]*Uint168, 0, len(addrs))
 	for _, addr := range addrs {
-		wallet.filter.AddAddr(addr.Hash())
+		hashes = append(hashes, addr.Hash())
 	}
-	return wallet.filter
+	wallet.filter.LoadAddrs(hashes)
+	return nil
 }
 
+// Check if the address is watched by the wallet
+func (wallet *SPVWallet) IsWatched(addr string) bool {
+	hash, err := Uint168FromAddress(addr)
+	if err != nil {
+		return false
+	}
+	return wallet.getAddrFilter().ContainAddr(*hash)
+}
+
+// Get all addresses watched by the wallet
+func (wallet *SPVWallet) WatchedAddresses() []string {
+	hashes := wallet.getAddrFilter().GetAddrs()
+	addrs := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		addr, err := hash.ToAddress()
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// Get a copy of the bloom filter snapshot, it's safe to be called by concurrent connecting peers
 func (wallet *SPVWallet) getBloomFilter() *bloom.Filter {
+	return wallet.bloomFilter.Filter()
+}
+
+/*
+Get how full the current bloom filter is, the estimated number of elements, the number of elements
+it's sized for, its false positive rate and the ratio of the bits set. A filter with elements over
+the capacity matches more transactions than expected and should be rebuilt with less addresses.
+*/
+func (wallet *SPVWallet) FilterStats() (elements, capacity int, falsePositiveRate, fillRatio float64) {
+	stats := wallet.bloomFilter.Stats()
+	return stats.Elements, stats.Capacity, stats.FalsePositiveRate, stats.FillRatio
+}
+
+// Build the bloom filter with the watched addresses and the outpoints in database
+func (wallet *SPVWallet) buildBloomFilter() *bloom.Filter {
 	wallet.Lock()
 	defer wallet.Unlock()
 
 	addrs := wallet.getAddrFilter().GetAddrs()
-	utxos, _ := wallet.dataStore.UTXOs().GetAll()
-	stxos, _ := wallet.dataStore.STXOs().GetAll()
+	outpoints := wallet.filterOutPoints(addrs)
 
-	elements := uint32(len(addrs) + len(utxos) + len(stxos))
+	elements := uint32(len(addrs) + len(outpoints))
+	if int(elements) > sdk.MaxFilterElements {
+		log.Warn("Bloom filter has ", elements, " elements, more than MaxFilterElements ",
+			sdk.MaxFilterElements, ", false positives will increase")
+	}
 	filter := sdk.NewBloomFilter(elements)
 
 	for _, addr := range addrs {
 		filter.Add(addr.Bytes())
 	}
 
-	for _, utxo := range utxos {
-		filter.AddOutPoint(&utxo.Op)
-	}
-
-	for _, stxo := range stxos {
-		filter.AddOutPoint(&stxo.Op)
+	for _, op := range outpoints {
+		filter.AddOutPoint(op)
 	}
 
 	return filter
 }
+
+// Get the outpoints of the wallet outputs to add into the bloom filter by sdk.FilterUpdate
+func (wallet *SPVWallet) filterOutPoints(addrs []*Uint168) []*OutPoint {
+	var outpoints []*OutPoint
+	switch sdk.FilterUpdate {
+	case sdk.FilterUpdateAll:
+		utxos, _ := wallet.dataStore.UTXOs().GetAll()
+		for _, utxo := range utxos {
+			outpoints = append(outpoints, &utxo.Op)
+		}
+		stxos, _ := wallet.dataStore.STXOs().GetAll()
+		for _, stxo := range stxos {
+			outpoints = append(outpoints, &stxo.Op)
+		}
+
+	case sdk.FilterUpdateP2PubkeyOnly:
+		for _, hash := range addrs {
+			addr, err := wallet.dataStore.Addrs().Get(hash)
+			multisig := err == nil && addr.Type() == db.TypeMulti
+			if !sdk.FilterUpdate.AddsOutPoint(multisig) {
+				continue
+			}
+			utxos, _ := wallet.dataStore.UTXOs().GetAddrAll(hash)
+			for _, utxo := range utxos {
+				outpoints = append(outpoints, &utxo.Op)
+			}
+			stxos, _ := wallet.dataStore.STXOs().GetAddrAll(hash)
+			for _, stxo := range stxos {
+				outpoints = append(outpoints, &stxo.Op)
+			}
+		}
+	}
+	return outpoints
+}
@@ -0,0 +1,488 @@
+package spvwallet
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_FilterOutPoints(t *testing.T) {
+	defer func() { sdk.FilterUpdate = sdk.FilterUpdateAll }()
+
+	standard, multi := Uint168{1}, Uint168{2}
+	wallet, store := newTestWallet(standard)
+	wallet.getAddrFilter().AddAddr(&multi)
+	store.Addrs().Put(&standard, nil, db.TypeMaster)
+	store.Addrs().Put(&multi, nil, db.TypeMulti)
+
+	// One output received by each address
+	for i, addr := range []Uint168{standard, multi} {
+		utxo := ToUTXO(Uint256{byte(i + 1)}, 1, 0, 100, 0)
+		store.UTXOs().Put(&addr, utxo)
+	}
+	addrs := wallet.getAddrFilter().GetAddrs()
+
+	for _, test := range []struct {
+		mode      sdk.FilterUpdateMode
+		outpoints []Uint256
+	}{
+		{sdk.FilterUpdateNone, nil},
+		{sdk.FilterUpdateAll, []Uint256{{1}, {2}}},
+		{sdk.FilterUpdateP2PubkeyOnly, []Uint256{{2}}},
+	} {
+		sdk.FilterUpdate = test.mode
+		outpoints := wallet.filterOutPoints(addrs)
+		if len(outpoints) != len(test.outpoints) {
+			t.Errorf("mode %s adds %d outpoints, expect %d", test.mode, len(outpoints), len(test.outpoints))
+			continue
+		}
+		added := make(map[Uint256]bool)
+		for _, op := range outpoints {
+			added[op.TxID] = true
+		}
+		for _, txId := range test.outpoints {
+			if !added[txId] {
+				t.Errorf("mode %s does not add outpoint of %v", test.mode, txId)
+			}
+		}
+	}
+}
+
+func TestSPVWallet_FilterLoadOnReconnect(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.info.height = 10
+
+	// The filter loaded on the peers connected first has the address only
+	connected := wallet.getBloomFilter().GetFilterLoadMsg()
+	expect := sdk.BuildBloomFilter([]*Uint168{&addr}, nil).GetFilterLoadMsg()
+	if !bytes.Equal(connected.Filter, expect.Filter) {
+		t.Fatal("filter loaded on the first peers is not built from the address")
+	}
+
+	// Outpoints are added while the peers are connected
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	spend := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 60, ProgramHash: Uint168{2}}, {Value: 30, ProgramHash: addr}},
+	}
+	if _, err := wallet.CommitTx(NewStoreTx(spend, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The peers connected after the disconnect get all the outpoints added
+	reconnected := wallet.getBloomFilter().GetFilterLoadMsg()
+	outpoints := []*OutPoint{NewOutPoint(funding.Hash(), 0), NewOutPoint(spend.Hash(), 1)}
+	expect = sdk.BuildBloomFilter([]*Uint168{&addr}, outpoints).GetFilterLoadMsg()
+	if !bytes.Equal(reconnected.Filter, expect.Filter) || reconnected.HashFuncs != expect.HashFuncs {
+		t.Error("filter loaded on the reconnected peers does not have the outpoints added")
+	}
+}
+
+func TestSPVWallet_AddressScanHeight(t *testing.T) {
+	synced, added, unknown := Uint168{1}, Uint168{2}, Uint168{3}
+	wallet, store := newTestWallet(synced)
+	database := &DatabaseImpl{lock: new(sync.RWMutex), DataStore: store, maxFilterElements: sdk.MaxFilterElements}
+
+	// Watched since the chain is empty
+	if err := database.AddAddress(&synced, nil, db.TypeMaster); err != nil {
+		t.Fatal(err)
+	}
+	wallet.PutChainHeight(100)
+	// Added at height 100, it's not scanned in the blocks before
+	if err := database.AddAddress(&added, nil, db.TypeSub); err != nil {
+		t.Fatal(err)
+	}
+	wallet.loadAddrFilter()
+
+	wallet.PutChainHeight(120)
+	for _, test := range []struct {
+		hash   Uint168
+		height uint32
+	}{{synced, 120}, {added, 0}, {unknown, 0}} {
+		if height := wallet.addressScanHeight(&test.hash); height != test.height {
+			t.Errorf("address %v scan height %d, expect %d", test.hash, height, test.height)
+		}
+	}
+
+	// A reorganize above the scan height does not scan the gap
+	wallet.PutChainHeight(110)
+	if height := wallet.addressScanHeight(&added); height != 0 {
+		t.Errorf("address scan height %d after reorganize, expect 0", height)
+	}
+
+	// Rolled back to the scan height, the blocks synced again are scanned for the address
+	wallet.PutChainHeight(0)
+	wallet.PutChainHeight(50)
+	if height := wallet.addressScanHeight(&added); height != 50 {
+		t.Errorf("address scan height %d after rescan, expect 50", height)
+	}
+
+	// Deleted address is not watched
+	if err := database.DeleteAddress(&added); err != nil {
+		t.Fatal(err)
+	}
+	wallet.loadAddrFilter()
+	if height := wallet.addressScanHeight(&added); height != 0 {
+		t.Errorf("deleted address scan height %d, expect 0", height)
+	}
+}
+
+func TestDatabaseImpl_AddAddressFilterFull(t *testing.T) {
+	_, store := newTestWallet(Uint168{1})
+	database := &DatabaseImpl{lock: new(sync.RWMutex), DataStore: store, maxFilterElements: 2}
+
+	if err := database.AddAddress(&Uint168{1}, nil, db.TypeMaster); err != nil {
+		t.Fatal(err)
+	}
+	store.utxos.Put(&Uint168{1}, &db.UTXO{Op: *NewOutPoint(Uint256{1}, 0)})
+
+	// The address and the outpoint fill the filter
+	if err := database.AddAddress(&Uint168{2}, nil, db.TypeSub); err != ErrFilterFull {
+		t.Errorf("add address to the full filter error %v, expect %v", err, ErrFilterFull)
+	}
+	// Updating an existing address does not add a filter element
+	if err := database.AddAddress(&Uint168{1}, []byte{1}, db.TypeMaster); err != nil {
+		t.Errorf("update address in the full filter error %v", err)
+	}
+}
+
+func TestSPVWallet_NotifyNewAddress(t *testing.T) {
+	addr := Uint168{1}
+	wallet, _ := newTestWallet(addr)
+
+	// Malformed hashes are refused before touching the filter
+	if err := wallet.NotifyNewAddress(addr[:20]); err == nil {
+		t.Error("short address hash accepted")
+	}
+	if err := wallet.NotifyNewAddress(append(addr[:], 0)); err == nil {
+		t.Error("long address hash accepted")
+	}
+
+	// An address already in the filter does not reload the filter
+	if err := wallet.NotifyNewAddress(addr[:]); err != nil {
+		t.Errorf("duplicate address hash returns %v, expect nil", err)
+	}
+}
+
+func TestSPVWallet_WatchScript(t *testing.T) {
+	defer func(fullBlockMode bool) { sdk.FullBlockMode = fullBlockMode }(sdk.FullBlockMode)
+	sdk.FullBlockMode = true
+
+	wallet, store := newTestWallet(Uint168{1})
+	store.info.height = 10
+
+	if _, err := wallet.WatchScript([]byte{0x01, 0x02}); err == nil {
+		t.Error("script of unknown program type watched")
+	}
+
+	script := []byte{0x21, 0x02, 0xac}
+	programHash, err := wallet.WatchScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wallet.getAddrFilter().ContainAddr(*programHash) {
+		t.Error("program hash of the script not in the filter")
+	}
+	addr, err := store.addrs.Get(programHash)
+	if err != nil || addr.Type() != db.TypeNotify {
+		t.Fatalf("script not saved as watch only address, %v", err)
+	}
+	if height := wallet.addressScanHeight(programHash); height != 0 {
+		t.Errorf("script scan height %d, expect 0", height)
+	}
+
+	// Outputs paying to the script are wallet transactions
+	tx := Transaction{Outputs: []*Output{{ProgramHash: *programHash}}}
+	if !wallet.isWalletTx(&tx) {
+		t.Error("transaction paying to the script not matched")
+	}
+}
+
+func TestSPVWallet_TrackCoinbase(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+
+	coinbase := Transaction{TxType: CoinBase, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	fp, err := wallet.CommitTx(NewStoreTx(coinbase, 10))
+	if err != nil || fp {
+		t.Fatalf("commit coinbase returns %v, %v", fp, err)
+	}
+	utxo, err := store.UTXOs().Get(NewOutPoint(coinbase.Hash(), 0))
+	if err != nil {
+		t.Fatal("coinbase output not tracked")
+	}
+	if utxo.LockTime != 110 {
+		t.Errorf("coinbase output lock time %d, expect 110", utxo.LockTime)
+	}
+
+	// Mining rewards are ignored, they are matched so not false positives
+	wallet.skipCoinbase = true
+	ignored := Transaction{TxType: CoinBase, LockTime: 1, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	fp, err = wallet.CommitTx(NewStoreTx(ignored, 11))
+	if err != nil || fp {
+		t.Fatalf("commit ignored coinbase returns %v, %v", fp, err)
+	}
+	txId := ignored.Hash()
+	if _, err := store.Txs().Get(&txId); err == nil {
+		t.Error("ignored coinbase committed")
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(txId, 0)); err == nil {
+		t.Error("ignored coinbase output tracked")
+	}
+
+	// Other transactions are still committed
+	payment := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(payment, 11)); err != nil {
+		t.Fatal(err)
+	}
+	txId = payment.Hash()
+	if _, err := store.Txs().Get(&txId); err != nil {
+		t.Error("payment not committed with coinbase ignored")
+	}
+}
+
+func TestSPVWallet_TrackedTxTypes(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	wallet.trackedTxTypes = map[TransactionType]bool{TransferAsset: true}
+
+	// Transactions of the other types are ignored, they are matched so not false positives
+	ignored := Transaction{TxType: RegisterAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	fp, err := wallet.CommitTx(NewStoreTx(ignored, 10))
+	if err != nil || fp {
+		t.Fatalf("commit untracked transaction returns %v, %v", fp, err)
+	}
+	txId := ignored.Hash()
+	if _, err := store.Txs().Get(&txId); err == nil {
+		t.Error("untracked transaction committed")
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(txId, 0)); err == nil {
+		t.Error("untracked transaction output tracked")
+	}
+
+	payment := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(payment, 10)); err != nil {
+		t.Fatal(err)
+	}
+	txId = payment.Hash()
+	if _, err := store.Txs().Get(&txId); err != nil {
+		t.Error("tracked transaction not committed")
+	}
+	store.info.height = 10
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 100 {
+		t.Errorf("balance %+v, expect 100 confirmed", balance)
+	}
+
+	// The wallet outputs spent by an untracked transaction are spent still
+	spend := Transaction{TxType: RegisterAsset, Inputs: []*Input{{Previous: *NewOutPoint(payment.Hash(), 0)}}}
+	if fp, err := wallet.CommitTx(NewStoreTx(spend, 11)); err != nil || fp {
+		t.Fatalf("commit untracked spend returns %v, %v", fp, err)
+	}
+	txId = spend.Hash()
+	if _, err := store.Txs().Get(&txId); err == nil {
+		t.Error("untracked spend committed")
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(payment.Hash(), 0)); err == nil {
+		t.Error("output spent by untracked transaction still unspent")
+	}
+	if _, err := store.STXOs().Get(NewOutPoint(payment.Hash(), 0)); err != nil {
+		t.Error("output spent by untracked transaction not moved to STXOs")
+	}
+	if balance, _ := wallet.GetBalance(); balance.Confirmed != 0 {
+		t.Errorf("balance %+v, expect 0 confirmed", balance)
+	}
+}
+
+func TestSPVWallet_TxFee(t *testing.T) {
+	addr := Uint168{1}
+	wallet, _ := newTestWallet(addr)
+
+	// Received from outside the wallet, the fee is unknown
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := wallet.TxFee(funding.Hash()); err != nil || ok {
+		t.Errorf("funding fee known %v, %v", ok, err)
+	}
+
+	// Spending wallet outputs only, the fee is the difference of inputs and outputs
+	spend := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 60, ProgramHash: Uint168{2}}, {Value: 30, ProgramHash: addr}},
+	}
+	if _, err := wallet.CommitTx(NewStoreTx(spend, 0)); err != nil {
+		t.Fatal(err)
+	}
+	fee, ok, err := wallet.TxFee(spend.Hash())
+	if err != nil || !ok || fee != 10 {
+		t.Errorf("spend fee %s, %v, %v, expect 10", fee.String(), ok, err)
+	}
+
+	// Still known when confirmed, the spent output is an STXO then
+	if _, err := wallet.CommitTx(NewStoreTx(spend, 11)); err != nil {
+		t.Fatal(err)
+	}
+	if fee, ok, _ := wallet.TxFee(spend.Hash()); !ok || fee != 10 {
+		t.Errorf("confirmed spend fee %s, %v, expect 10", fee.String(), ok)
+	}
+
+	// Spending an output not known by the wallet, the fee is unknown
+	mixed := Transaction{
+		TxType: TransferAsset,
+		Inputs: []*Input{
+			{Previous: *NewOutPoint(spend.Hash(), 1)},
+			{Previous: *NewOutPoint(Uint256{9}, 0)},
+		},
+		Outputs: []*Output{{Value: 20, ProgramHash: Uint168{2}}},
+	}
+	if _, err := wallet.CommitTx(NewStoreTx(mixed, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := wallet.TxFee(mixed.Hash()); err != nil || ok {
+		t.Errorf("mixed fee known %v, %v", ok, err)
+	}
+}
+
+func TestSPVWallet_GetRawTransaction(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.info.height = 10
+
+	tx := Transaction{
+		TxType:   TransferAsset,
+		Outputs:  []*Output{{Value: 100, ProgramHash: addr}},
+		Programs: []*Program{{Code: []byte{1}, Parameter: []byte{2}}},
+	}
+	if _, err := wallet.CommitTx(NewStoreTx(tx, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The wire format with the programs
+	raw, err := wallet.GetRawTransaction(tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := new(bytes.Buffer)
+	tx.Serialize(expect)
+	if !bytes.Equal(raw, expect.Bytes()) {
+		t.Errorf("raw transaction %x, expect %x", raw, expect.Bytes())
+	}
+	if storeTx, err := wallet.GetTransaction(tx.Hash()); err != nil || storeTx.Height != 10 {
+		t.Errorf("get transaction returns %v, %v", storeTx, err)
+	}
+
+	if _, err := wallet.GetRawTransaction(Uint256{1}); err == nil {
+		t.Error("raw transaction of an unknown transaction returned")
+	}
+}
+
+func TestSPVWallet_CommitBatchFailed(t *testing.T) {
+	wallet, store := newTestWallet(Uint168{1})
+	headers := newTestHeaders()
+	wallet.headers = headers
+
+	tip := &StoreHeader{Header: Header{Height: 1}}
+	headers.Put(tip, true)
+
+	// The transactions of the batch fail to be written, the headers are dropped
+	if err := wallet.BeginBatch(); err != nil {
+		t.Fatal(err)
+	}
+	next := &StoreHeader{Header: Header{Previous: tip.Hash(), Height: 2}}
+	headers.Put(next, true)
+	store.commitErr = errors.New("disk full")
+	if err := wallet.CommitBatch(); err == nil {
+		t.Fatal("batch committed after the transactions failed to be written")
+	}
+	if current, err := headers.GetTip(); err != nil || current != tip {
+		t.Error("chain tip moved past the blocks with transactions lost")
+	}
+	if _, err := headers.GetHeader(next.Hash()); err == nil {
+		t.Error("header of the failed batch kept")
+	}
+
+	// The blocks are committed again in the next batch
+	store.commitErr = nil
+	wallet.BeginBatch()
+	headers.Put(next, true)
+	if err := wallet.CommitBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := headers.GetTip(); current != next {
+		t.Error("chain tip not moved by the committed batch")
+	}
+}
+
+func TestSPVWallet_GetOutpointConfirmations(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.Info().SaveChainHeight(10)
+
+	unspent := OutPoint{TxID: Uint256{1}}
+	store.UTXOs().Put(&addr, &db.UTXO{Op: unspent, AtHeight: 8})
+	pending := OutPoint{TxID: Uint256{2}}
+	store.UTXOs().Put(&addr, &db.UTXO{Op: pending})
+	// Spent by an unconfirmed transaction
+	spent := OutPoint{TxID: Uint256{3}}
+	store.UTXOs().Put(&addr, &db.UTXO{Op: spent, AtHeight: 10})
+	store.STXOs().FromUTXO(&spent, &Uint256{4}, 0)
+
+	for _, test := range []struct {
+		outpoint      OutPoint
+		confirmations int
+		spent         bool
+	}{{unspent, 3, false}, {pending, 0, false}, {spent, 1, true}} {
+		confirmations, isSpent, err := wallet.GetOutpointConfirmations(test.outpoint)
+		if err != nil {
+			t.Errorf("get outpoint confirmations error %v", err)
+			continue
+		}
+		if confirmations != test.confirmations || isSpent != test.spent {
+			t.Errorf("outpoint confirmations %d spent %v, expect %d %v",
+				confirmations, isSpent, test.confirmations, test.spent)
+		}
+	}
+
+	if _, _, err := wallet.GetOutpointConfirmations(OutPoint{TxID: Uint256{5}}); err != ErrOutpointNotFound {
+		t.Errorf("unknown outpoint error %v, expect ErrOutpointNotFound", err)
+	}
+}
+
+func TestConfigCheckpoints(t *testing.T) {
+	defer func() { sdk.Checkpoints = defaultCheckpoints }()
+
+	cfg := &config.Config{
+		Checkpoints: []config.Checkpoint{
+			{Height: 100, Hash: "0000000000000000000000000000000000000000000000000000000000000064"},
+		},
+		GenesisHash: "0000000000000000000000000000000000000000000000000000000000000001",
+	}
+	expect := len(defaultCheckpoints) + 2
+
+	// Applied again as Init is called after Stop, the config checkpoints are not duplicated
+	for i := 0; i < 2; i++ {
+		sdk.Checkpoints = configCheckpoints(cfg)
+		if len(sdk.Checkpoints) != expect {
+			t.Fatalf("apply %d, %d checkpoints, expect %d", i, len(sdk.Checkpoints), expect)
+		}
+	}
+	if sdk.Checkpoints[len(sdk.Checkpoints)-1].Height != 0 {
+		t.Error("genesis checkpoint not at height 0")
+	}
+}
@@ -0,0 +1,74 @@
+package spvwallet
+
+import (
+	"os"
+
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// The database files counted in the store size
+var storeFiles = []string{db.DBName, db.HeadersDBName}
+
+// WalletStats is an aggregate snapshot of the wallet data
+type WalletStats struct {
+	// The number of watched addresses
+	Addresses int
+
+	// The number of unspent outputs and tracked transactions
+	UTXOs int
+	Txs   int
+
+	// The balance of the outputs confirmed, not confirmed yet, and the coinbase outputs not mature yet
+	Confirmed   Fixed64
+	Unconfirmed Fixed64
+	Immature    Fixed64
+
+	// The chain height
+	Height uint32
+
+	// The size of the database files in bytes
+	StoreSize int64
+}
+
+/*
+Get the aggregate stats of the wallet. They are read while no block or transaction is committed,
+so the balances, counts and height are of the same moment. It reads all the outputs and
+transactions from database, calling it every few seconds is fine for a dashboard.
+*/
+func (wallet *SPVWallet) Stats() (WalletStats, error) {
+	var stats WalletStats
+	var err error
+	wallet.Blockchain().View(func() {
+		stats, err = wallet.stats()
+	})
+	return stats, err
+}
+
+func (wallet *SPVWallet) stats() (WalletStats, error) {
+	var stats WalletStats
+	stats.Addresses = len(wallet.getAddrFilter().GetAddrs())
+	stats.Height = wallet.GetChainHeight()
+
+	utxos, err := wallet.dataStore.UTXOs().GetAll()
+	if err != nil {
+		return stats, err
+	}
+	stats.UTXOs = len(utxos)
+	balance := computeBalance(utxos, stats.Height)
+	stats.Confirmed, stats.Unconfirmed, stats.Immature = balance.Confirmed, balance.Unconfirmed, balance.Immature
+
+	txs, err := wallet.dataStore.Txs().GetAll()
+	if err != nil {
+		return stats, err
+	}
+	stats.Txs = len(txs)
+
+	for _, file := range storeFiles {
+		if info, err := os.Stat(file); err == nil {
+			stats.StoreSize += info.Size()
+		}
+	}
+	return stats, nil
+}
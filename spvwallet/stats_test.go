@@ -0,0 +1,39 @@
+package spvwallet
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_Stats(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	store.info.height = 20
+
+	txs := []*StoreTx{
+		NewStoreTx(Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}, 10),
+		NewStoreTx(Transaction{TxType: TransferAsset, LockTime: 1, Outputs: []*Output{{Value: 20, ProgramHash: addr}}}, 0),
+		NewStoreTx(Transaction{TxType: CoinBase, Outputs: []*Output{{Value: 5, ProgramHash: addr}}}, 15),
+	}
+	for _, tx := range txs {
+		if _, err := wallet.CommitTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := wallet.stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Addresses != 1 || stats.UTXOs != 3 || stats.Txs != 3 || stats.Height != 20 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.Confirmed != 100 || stats.Unconfirmed != 20 || stats.Immature != 5 {
+		t.Errorf("balances confirmed %d, unconfirmed %d, immature %d, expect 100, 20, 5",
+			stats.Confirmed, stats.Unconfirmed, stats.Immature)
+	}
+}
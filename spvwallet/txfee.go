@@ -0,0 +1,54 @@
+package spvwallet
+
+import (
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+Compute the fee of the transaction from the values of the wallet outputs it spends, it's
+only known when all the inputs spend wallet outputs, UnknownFee is returned otherwise.
+The spent outputs are looked up in both UTXOs and STXOs, so the fee is also computed
+when an unconfirmed transaction is committed again as it's confirmed.
+*/
+func (wallet *SPVWallet) txFee(tx *Transaction) Fixed64 {
+	if len(tx.Inputs) == 0 || tx.IsCoinBaseTx() {
+		return UnknownFee
+	}
+
+	var totalInput Fixed64
+	for _, input := range tx.Inputs {
+		if utxo, err := wallet.dataStore.UTXOs().Get(&input.Previous); err == nil {
+			totalInput += utxo.Value
+			continue
+		}
+		if stxo, err := wallet.dataStore.STXOs().Get(&input.Previous); err == nil {
+			totalInput += stxo.Value
+			continue
+		}
+		return UnknownFee
+	}
+
+	var totalOutput Fixed64
+	for _, output := range tx.Outputs {
+		totalOutput += output.Value
+	}
+	if totalInput < totalOutput {
+		return UnknownFee
+	}
+	return totalInput - totalOutput
+}
+
+// Get the fee of the wallet transaction, ok is false if the fee is unknown
+func (wallet *SPVWallet) TxFee(txId Uint256) (fee Fixed64, ok bool, err error) {
+	storeTx, err := wallet.dataStore.Txs().Get(&txId)
+	if err != nil {
+		return 0, false, err
+	}
+	if storeTx.Fee == UnknownFee {
+		return 0, false, nil
+	}
+	return storeTx.Fee, true, nil
+}
@@ -0,0 +1,109 @@
+package spvwallet
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+Verify a received transaction that pays to or spends from the wallet addresses.
+
+The limits of what SPV can verify:
+  - The structure of the transaction is checked, a non coinbase transaction must have inputs,
+    and each program must have code and parameter.
+  - Inputs spending other's outputs can not be verified, the previous outputs are not known by SPV.
+  - Inputs spending the wallet's own outputs are fully verified, the program hash of the previous output
+    must match one of the programs, and the signature of a standard program must be valid.
+    For a multi-sign program, only the signature count is checked.
+*/
+func (wallet *SPVWallet) VerifyReceivedTx(tx *Transaction) error {
+	if tx.IsCoinBaseTx() {
+		return nil
+	}
+
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("transaction has no inputs")
+	}
+	if len(tx.Programs) == 0 {
+		return fmt.Errorf("transaction has no programs")
+	}
+
+	programs := make(map[Uint168]*Program)
+	for i, program := range tx.Programs {
+		if len(program.Code) == 0 || len(program.Parameter) == 0 {
+			return fmt.Errorf("program %d has empty code or parameter", i)
+		}
+		programHash, err := crypto.ToProgramHash(program.Code)
+		if err != nil {
+			return fmt.Errorf("program %d has invalid code, %s", i, err)
+		}
+		programs[*programHash] = program
+	}
+
+	buf := new(bytes.Buffer)
+	err := tx.SerializeUnsigned(buf)
+	if err != nil {
+		return fmt.Errorf("serialize transaction failed, %s", err)
+	}
+	data := buf.Bytes()
+
+	for i, input := range tx.Inputs {
+		// Only the wallet's own outputs can be verified
+		prevTx, err := wallet.dataStore.Txs().Get(&input.Previous.TxID)
+		if err != nil || int(input.Previous.Index) >= len(prevTx.Data.Outputs) {
+			continue
+		}
+		programHash := prevTx.Data.Outputs[input.Previous.Index].ProgramHash
+		if !wallet.getAddrFilter().ContainAddr(programHash) {
+			continue
+		}
+
+		program, ok := programs[programHash]
+		if !ok {
+			return fmt.Errorf("input %d has no program of the spending address", i)
+		}
+		err = verifyProgram(program, data)
+		if err != nil {
+			return fmt.Errorf("input %d %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+func verifyProgram(program *Program, data []byte) error {
+	signType, err := crypto.GetScriptType(program.Code)
+	if err != nil {
+		return fmt.Errorf("has invalid program code, %s", err)
+	}
+
+	switch signType {
+	case crypto.STANDARD:
+		publicKey, err := crypto.GetPublicKeyFromCode(program.Code)
+		if err != nil {
+			return fmt.Errorf("has invalid public key, %s", err)
+		}
+		signatures, err := crypto.GetSignaturesFromParam(program.Parameter)
+		if err != nil || len(signatures) != 1 {
+			return fmt.Errorf("has invalid signature parameter")
+		}
+		err = crypto.Verify(*publicKey, data, signatures[0])
+		if err != nil {
+			return fmt.Errorf("has invalid signature, %s", err)
+		}
+	case crypto.MULTISIG:
+		haveSign, needSign, err := crypto.GetSignStatus(program.Code, program.Parameter)
+		if err != nil {
+			return fmt.Errorf("has invalid multi sign program, %s", err)
+		}
+		if haveSign < needSign {
+			return fmt.Errorf("has %d signatures, %d needed", haveSign, needSign)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package spvwallet
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_CommitTxVerifyFailed(t *testing.T) {
+	log.Init()
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	wallet.verifyReceivedTx = true
+
+	// A payment without inputs or programs fails verification
+	forged := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if err := wallet.VerifyReceivedTx(&forged); err == nil {
+		t.Fatal("transaction without inputs verified")
+	}
+
+	// Dropped without failing the commit, the block it's in is still committed
+	fp, err := wallet.CommitTx(NewStoreTx(forged, 10))
+	if err != nil || fp {
+		t.Fatalf("commit forged transaction returns %v, %v", fp, err)
+	}
+	txId := forged.Hash()
+	if _, err := store.Txs().Get(&txId); err == nil {
+		t.Error("forged transaction committed")
+	}
+	if _, err := store.UTXOs().Get(NewOutPoint(txId, 0)); err == nil {
+		t.Error("forged transaction output tracked")
+	}
+}
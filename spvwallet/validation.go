@@ -0,0 +1,113 @@
+package spvwallet
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	MaxTxSize = 1024 * 1024 // The max size of a transaction in bytes
+
+	// The size of a signature in the program parameter, with the length byte
+	SignatureSize = 65
+	// The size of a public key in the redeem script, with the length byte
+	PublicKeySize = 34
+)
+
+// Get the minimum fee of a transaction of the given size in bytes, the rate is the fee per KB
+func relayFee(rate Fixed64, size int) Fixed64 {
+	return (rate*Fixed64(size) + 999) / 1000
+}
+
+// Estimate the size of the transaction after signed, with a signature for each public key in
+// the redeem scripts, the same as a standard transaction and more than a multi-sign one needs
+func signedSize(tx *Transaction) int {
+	buf := new(bytes.Buffer)
+	tx.Serialize(buf)
+	size := buf.Len()
+	for _, program := range tx.Programs {
+		keys := len(program.Code) / PublicKeySize
+		if keys == 0 {
+			keys = 1
+		}
+		size += keys*SignatureSize - len(program.Parameter)
+	}
+	return size
+}
+
+// Do local sanity checks of the transaction before it's broadcast to the network.
+// Inputs that reference watched UTXOs must be unspent and unlocked, outputs must be well-formed,
+// if all inputs are known by the wallet, the total input value must cover the total output value
+// and the fee must not be less than the minimum relay fee for the size of the transaction.
+func (wallet *SPVWallet) ValidateTransaction(tx Transaction) error {
+	buf := new(bytes.Buffer)
+	err := tx.Serialize(buf)
+	if err != nil {
+		return fmt.Errorf("serialize transaction failed, %s", err)
+	}
+	if buf.Len() > MaxTxSize {
+		return fmt.Errorf("transaction size %d exceeds the max size %d", buf.Len(), MaxTxSize)
+	}
+
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("transaction has no inputs")
+	}
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("transaction has no outputs")
+	}
+
+	// Check outputs
+	var totalOutput Fixed64
+	for i, output := range tx.Outputs {
+		if output.Value <= 0 {
+			return fmt.Errorf("output %d has invalid value %s", i, output.Value.String())
+		}
+		if !output.AssetID.IsEqual(SystemAssetId) {
+			return fmt.Errorf("output %d has unknown asset id %s", i, output.AssetID.String())
+		}
+		totalOutput += output.Value
+	}
+
+	// Check inputs
+	var totalInput Fixed64
+	var allKnown = true
+	var height = wallet.GetChainHeight()
+	var spends = make(map[OutPoint]bool)
+	for i, input := range tx.Inputs {
+		if spends[input.Previous] {
+			return fmt.Errorf("input %d spends a duplicate outpoint", i)
+		}
+		spends[input.Previous] = true
+
+		if _, err := wallet.dataStore.STXOs().Get(&input.Previous); err == nil {
+			return fmt.Errorf("input %d spends an already spent output %s:%d",
+				i, input.Previous.TxID.String(), input.Previous.Index)
+		}
+
+		utxo, err := wallet.dataStore.UTXOs().Get(&input.Previous)
+		if err != nil {
+			// Not a watched UTXO, can not check it's value
+			allKnown = false
+			continue
+		}
+		if utxo.LockTime > height {
+			return fmt.Errorf("input %d spends an output locked until height %d",
+				i, utxo.LockTime)
+		}
+		totalInput += utxo.Value
+	}
+
+	if allKnown && totalInput < totalOutput {
+		return fmt.Errorf("total input %s is less than total output %s",
+			totalInput.String(), totalOutput.String())
+	}
+	if minFee := relayFee(wallet.MinRelayFee(), buf.Len()); allKnown && totalInput-totalOutput < minFee {
+		return fmt.Errorf("transaction fee %s is less than the minimum relay fee %s",
+			(totalInput - totalOutput).String(), minFee.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package spvwallet
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// The SPV service of the wallet with a fixed minimum relay fee rate
+type testRelayFeeService struct {
+	sdk.SPVService
+	rate Fixed64
+}
+
+func (s *testRelayFeeService) MinRelayFee() Fixed64 {
+	return s.rate
+}
+
+func TestRelayFee(t *testing.T) {
+	for _, test := range []struct {
+		rate Fixed64
+		size int
+		fee  Fixed64
+	}{
+		{0, 250, 0},
+		{1000, 250, 250},
+		{10000, 250, 2500},
+		{10000, 1, 10},
+		{1, 250, 1},
+	} {
+		if fee := relayFee(test.rate, test.size); fee != test.fee {
+			t.Errorf("relay fee of %d bytes at rate %d is %d, expect %d", test.size, test.rate, fee, test.fee)
+		}
+	}
+}
+
+func TestSPVWallet_ValidateTransactionRelayFee(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	service := &testRelayFeeService{}
+	wallet.SPVService = service
+
+	funding := Uint256{1}
+	store.UTXOs().Put(&addr, ToUTXO(funding, 1, 0, 1000, 0))
+	tx := Transaction{
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding, 0)}},
+		Outputs: []*Output{{AssetID: SystemAssetId, Value: 900, ProgramHash: addr}},
+	}
+	size := signedSize(&tx)
+
+	// The fee 100 pays for the size at the rate, not the rate itself
+	service.rate = Fixed64(100 * 1000 / size)
+	if err := wallet.ValidateTransaction(tx); err != nil {
+		t.Errorf("transaction paying the relay fee rate rejected, %v", err)
+	}
+	service.rate = Fixed64(100*1000/size) + 1000
+	if err := wallet.ValidateTransaction(tx); err == nil {
+		t.Error("transaction paying less than the relay fee rate accepted")
+	}
+}
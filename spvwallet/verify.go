@@ -0,0 +1,156 @@
+package spvwallet
+
+import (
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Inconsistency is a broken invariant of the wallet data found by Verify
+type Inconsistency struct {
+	// The invariant broken, one of the Check constants
+	Check string
+
+	// What is inconsistent
+	Detail string
+}
+
+func (i Inconsistency) String() string {
+	return i.Check + ": " + i.Detail
+}
+
+// The invariants checked by Verify
+const (
+	// Every UTXO and STXO is created by a stored transaction
+	CheckFundingTx = "funding transaction stored"
+
+	// A spent output is not spendable at the same time
+	CheckSpentNotSpendable = "spent output not spendable"
+
+	// Every STXO is spent by a stored transaction
+	CheckSpendingTx = "spending transaction stored"
+
+	// No transaction or output is above the chain height
+	CheckAboveChainHeight = "nothing above chain height"
+
+	// The cached balance equals the balance computed from all the UTXOs
+	CheckBalance = "cached balance"
+
+	// The chain height equals the height of the header on the chain tip
+	CheckChainHeight = "chain height"
+
+	// The headers link from the chain tip back to the first block, each one height below
+	CheckHeaderChain = "header chain"
+)
+
+/*
+Check the invariants of the wallet data, the Check constants, and return the inconsistencies found.
+Nothing is modified. The error is returned only when the data can not be read. It reads all the
+outputs, transactions and headers, it's meant for support cases, after importing a state or
+recovering a backup, and for validating DataStore implementations.
+*/
+func (wallet *SPVWallet) Verify() ([]Inconsistency, error) {
+	var found []Inconsistency
+	var err error
+	wallet.Blockchain().View(func() {
+		found, err = wallet.verify()
+	})
+	return found, err
+}
+
+func (wallet *SPVWallet) verify() ([]Inconsistency, error) {
+	var found []Inconsistency
+	report := func(check string, format string, args ...interface{}) {
+		found = append(found, Inconsistency{Check: check, Detail: fmt.Sprintf(format, args...)})
+	}
+	height := wallet.GetChainHeight()
+
+	// Transactions stored without raw data are still stored
+	txs, err := wallet.dataStore.Txs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[Uint256]bool)
+	for _, tx := range txs {
+		stored[tx.TxId] = true
+		if tx.Height > height {
+			report(CheckAboveChainHeight, "transaction %s at height %d above chain height %d",
+				tx.TxId.String(), tx.Height, height)
+		}
+	}
+
+	utxos, err := wallet.dataStore.UTXOs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, utxo := range utxos {
+		if !stored[utxo.Op.TxID] {
+			report(CheckFundingTx, "UTXO %s:%d funded by a transaction not stored",
+				utxo.Op.TxID.String(), utxo.Op.Index)
+		}
+		if utxo.AtHeight > height {
+			report(CheckAboveChainHeight, "UTXO %s:%d at height %d above chain height %d",
+				utxo.Op.TxID.String(), utxo.Op.Index, utxo.AtHeight, height)
+		}
+	}
+
+	stxos, err := wallet.dataStore.STXOs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, stxo := range stxos {
+		if !stored[stxo.Op.TxID] {
+			report(CheckFundingTx, "STXO %s:%d funded by a transaction not stored",
+				stxo.Op.TxID.String(), stxo.Op.Index)
+		}
+		if !stored[stxo.SpendTxId] {
+			report(CheckSpendingTx, "STXO %s:%d spent by transaction %s not stored",
+				stxo.Op.TxID.String(), stxo.Op.Index, stxo.SpendTxId.String())
+		}
+		if _, err := wallet.dataStore.UTXOs().Get(&stxo.Op); err == nil {
+			report(CheckSpentNotSpendable, "output %s:%d is both spent and spendable",
+				stxo.Op.TxID.String(), stxo.Op.Index)
+		}
+	}
+
+	if wallet.balance.isLoaded() {
+		cached := wallet.balance.balance(height)
+		computed := computeBalance(utxos, height)
+		if cached != computed {
+			report(CheckBalance, "cached %+v, computed %+v", cached, computed)
+		}
+	}
+
+	wallet.verifyHeaders(height, report)
+	return found, nil
+}
+
+// Walk the headers from the chain tip back to the first block
+func (wallet *SPVWallet) verifyHeaders(height uint32, report func(check string, format string, args ...interface{})) {
+	tip, err := wallet.headers.GetTip()
+	if err != nil {
+		// An empty chain has no headers
+		if height > 0 {
+			report(CheckChainHeight, "chain height %d without headers", height)
+		}
+		return
+	}
+	if tip.Height != height {
+		report(CheckChainHeight, "chain height %d, chain tip at height %d", height, tip.Height)
+	}
+
+	for header := tip; header.Height > 1; {
+		previous, err := wallet.headers.GetPrevious(header)
+		if err != nil {
+			report(CheckHeaderChain, "previous header of %s at height %d not stored",
+				header.Hash().String(), header.Height)
+			return
+		}
+		if previous.Height+1 != header.Height {
+			report(CheckHeaderChain, "header %s at height %d follows header at height %d",
+				header.Hash().String(), header.Height, previous.Height)
+			return
+		}
+		header = previous
+	}
+}
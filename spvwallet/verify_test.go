@@ -0,0 +1,88 @@
+package spvwallet
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestSPVWallet_Verify(t *testing.T) {
+	addr := Uint168{1}
+	wallet, store := newTestWallet(addr)
+	headers := newTestHeaders()
+	wallet.headers = headers
+
+	// A chain of 3 headers
+	var previous Uint256
+	var chain []*StoreHeader
+	for height := uint32(1); height <= 3; height++ {
+		header := &StoreHeader{Header: Header{Previous: previous, Height: height}}
+		headers.Put(header, true)
+		chain = append(chain, header)
+		previous = header.Hash()
+	}
+	store.info.height = 3
+
+	funding := Transaction{TxType: TransferAsset, Outputs: []*Output{{Value: 100, ProgramHash: addr}}}
+	if _, err := wallet.CommitTx(NewStoreTx(funding, 2)); err != nil {
+		t.Fatal(err)
+	}
+	spend := Transaction{
+		TxType:  TransferAsset,
+		Inputs:  []*Input{{Previous: *NewOutPoint(funding.Hash(), 0)}},
+		Outputs: []*Output{{Value: 90, ProgramHash: addr}},
+	}
+	if _, err := wallet.CommitTx(NewStoreTx(spend, 3)); err != nil {
+		t.Fatal(err)
+	}
+	wallet.reloadBalance()
+
+	expect := func(step string, checks ...string) {
+		found, err := wallet.verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(checks) {
+			t.Fatalf("%s, found %v, expect %v", step, found, checks)
+		}
+		for i, check := range checks {
+			if found[i].Check != check {
+				t.Errorf("%s, found %v, expect %v", step, found, checks)
+			}
+		}
+	}
+	expect("consistent wallet")
+
+	// A UTXO funded by a transaction not stored, the cached balance does not count it
+	orphan := NewOutPoint(Uint256{9}, 0)
+	store.utxos.utxos[*orphan] = &db.UTXO{Op: *orphan, Value: 10, AtHeight: 3}
+	expect("orphan UTXO", CheckFundingTx, CheckBalance)
+	delete(store.utxos.utxos, *orphan)
+
+	// The spent output is spendable again
+	spent := NewOutPoint(funding.Hash(), 0)
+	store.utxos.utxos[*spent] = &db.UTXO{Op: *spent, Value: 100, AtHeight: 2}
+	wallet.reloadBalance()
+	expect("spent and spendable", CheckSpentNotSpendable)
+	delete(store.utxos.utxos, *spent)
+	wallet.reloadBalance()
+
+	// The spending transaction is lost, with the change it funded
+	spendTx := store.txs.txs[spend.Hash()]
+	delete(store.txs.txs, spend.Hash())
+	expect("spending transaction lost", CheckFundingTx, CheckSpendingTx)
+	store.txs.txs[spend.Hash()] = spendTx
+
+	// The chain height is not the tip height
+	store.info.height = 4
+	expect("chain height", CheckChainHeight)
+	store.info.height = 3
+
+	// A header is missing in the middle of the chain
+	delete(headers.headers, chain[1].Hash())
+	expect("header missing", CheckHeaderChain)
+}
@@ -1,20 +1,22 @@
 package spvwallet
 
 import (
-	"math"
 	"bytes"
 	"errors"
-	"strconv"
+	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
 
-	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 	"github.com/elastos/Elastos.ELA.SPV/log"
-	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 
-	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	. "github.com/elastos/Elastos.ELA/core"
 )
 
 var SystemAssetId = getSystemAssetId()
@@ -55,7 +57,7 @@ func Create(password []byte) (Wallet, error) {
 		return nil, err
 	}
 
-	database, err := GetDatabase()
+	database, err := GetDatabase(config.Values().MaxFilterElements)
 	if err != nil {
 		log.Error("Wallet create database failed:", err)
 		return nil, err
@@ -73,7 +75,7 @@ func Create(password []byte) (Wallet, error) {
 
 func Open() (Wallet, error) {
 	if wallet == nil {
-		database, err := GetDatabase()
+		database, err := GetDatabase(config.Values().MaxFilterElements)
 		if err != nil {
 			log.Error("Wallet open database failed:", err)
 			return nil, err
@@ -219,7 +221,14 @@ func (wallet *WalletImpl) createTransaction(fromAddress string, fee *Fixed64, lo
 		return nil, errors.New("[Wallet], Get spenders redeem script failed")
 	}
 
-	return wallet.newTransaction(addr.Script(), txInputs, txOutputs), nil
+	txn := wallet.newTransaction(addr.Script(), txInputs, txOutputs)
+
+	// Transactions with fee below the configured minimum relay fee rate will not be relayed
+	if minFee := relayFee(Fixed64(config.Values().MinRelayFee), signedSize(txn)); *fee < minFee {
+		return nil, fmt.Errorf("[Wallet], fee %s is less than the minimum relay fee %s", fee.String(), minFee.String())
+	}
+
+	return txn, nil
 }
 
 func (wallet *WalletImpl) Sign(password []byte, txn *Transaction) (*Transaction, error) {
@@ -275,7 +284,7 @@ func (wallet *WalletImpl) signStandardTransaction(txn *Transaction) (*Transactio
 	buf.WriteByte(byte(len(signedTx)))
 	buf.Write(signedTx)
 	// Set program
-	var program = &Program{code, buf.Bytes()}
+	var program = &Program{Code: code, Parameter: buf.Bytes()}
 	txn.Programs = []*Program{program}
 
 	return txn, nil
@@ -377,7 +386,7 @@ func (wallet *WalletImpl) newTransaction(redeemScript []byte, inputs []*Input, o
 	attributes := make([]*Attribute, 0)
 	attributes = append(attributes, &txAttr)
 	// Create program
-	var program = &Program{redeemScript, nil}
+	var program = &Program{Code: redeemScript}
 	// Create transaction
 	return &Transaction{
 		TxType:     TransferAsset,
@@ -0,0 +1,40 @@
+package spvwallet
+
+import (
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+/*
+Watch the outputs paying to the program of the script, like a contract or a cross chain program
+the wallet can not sign for. Outputs are matched by program hash, so the program hash of the script
+is added to the bloom filter, and transactions paying to it are committed and notified as the wallet
+transactions. The script is kept as a watch only address, the program hash is returned.
+*/
+func (wallet *SPVWallet) WatchScript(script []byte) (*Uint168, error) {
+	programHash, err := crypto.ToProgramHash(script)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script, %s", err)
+	}
+	if wallet.getAddrFilter().ContainAddr(*programHash) {
+		return programHash, nil
+	}
+
+	err = wallet.dataStore.Addrs().Put(programHash, script, db.TypeNotify)
+	if err != nil {
+		return nil, err
+	}
+	// The script is not scanned in the blocks synced before it's watched
+	if wallet.GetChainHeight() > 0 {
+		err = wallet.dataStore.Info().SaveAddrScanHeight(programHash, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return programHash, wallet.ReloadFilter()
+}